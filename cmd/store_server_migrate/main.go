@@ -0,0 +1,185 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/store_server/dbtools/driver"
+	"github.com/store_server/dbtools/migrate"
+	"github.com/store_server/store_server_http/conf"
+	"github.com/store_server/utils/common"
+
+	log "github.com/store_server/logger"
+)
+
+var (
+	GitTag  = "tag"
+	Version = "dev"
+	Build   = "2020-09-09"
+)
+
+//http及rpc服务配置中的mysql相关配置项
+type config struct {
+	Mysql       string                       `yaml:"mysql"`
+	LyricMysql  string                       `yaml:"lyric_mysql"`
+	KlyricMysql string                       `yaml:"klyric_mysql"`
+	Databases   map[string]*conf.MysqlConfig `yaml:"databases"`
+}
+
+//逻辑库配置, databases未配置时使用对应的dsn配置
+func (c *config) mysqlConfig(key string) *driver.MysqlConfig {
+	if mc := c.Databases[key]; mc != nil {
+		return &driver.MysqlConfig{
+			Dsn:          mc.Dsn,
+			Host:         mc.Host,
+			Port:         mc.Port,
+			User:         mc.User,
+			Passwd:       mc.Passwd,
+			Database:     mc.Database,
+			Charset:      mc.Charset,
+			Params:       mc.Params,
+			Timeout:      time.Duration(mc.Timeout) * time.Second,
+			ReadTimeout:  time.Duration(mc.ReadTimeout) * time.Second,
+			WriteTimeout: time.Duration(mc.WriteTimeout) * time.Second,
+			MaxOpenConns: 1,
+		}
+	}
+	dsn := map[string]string{"music": c.Mysql, "lyric": c.LyricMysql, "klyric": c.KlyricMysql}[key]
+	if len(dsn) == 0 {
+		return nil
+	}
+	return &driver.MysqlConfig{Dsn: dsn, MaxOpenConns: 1}
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "usage: store_server_migrate -c config [-db music|lyric|klyric] [options] up|down|status|plan\n\n")
+	fmt.Fprintf(os.Stderr, "  up       migrate to -to version, default latest\n")
+	fmt.Fprintf(os.Stderr, "  down     roll back to -to version, default roll back -steps versions\n")
+	fmt.Fprintf(os.Stderr, "  status   show applied and pending versions\n")
+	fmt.Fprintf(os.Stderr, "  plan     show sql to run for migrating to -to version, default latest\n\n")
+	flag.PrintDefaults()
+}
+
+func main() {
+	version := flag.Bool("V", false, "version")
+	path := flag.String("c", "", "config path, store_server_http or store_server_rpc config")
+	dsn := flag.String("dsn", "", "mysql dsn, overrides config")
+	db := flag.String("db", "music", "logical database: music, lyric, klyric")
+	to := flag.Int64("to", -1, "target version")
+	steps := flag.Int("steps", 1, "versions to roll back when -to is not set")
+	asJson := flag.Bool("json", false, "output in json")
+	timeout := flag.Duration("timeout", 30*time.Minute, "migration timeout")
+	logPath := flag.String("log_path", "/data/apps/store_server_migrate/logs/store_server_migrate.log", "log path")
+	level := flag.String("log_level", "info", "log level")
+	flag.Usage = usage
+	flag.Parse()
+	if *version {
+		fmt.Fprintf(os.Stdout, "GitTag: %s\nVersion: %s\nBuild: %s\n", GitTag, Version, Build)
+		os.Exit(0)
+	}
+	if flag.NArg() != 1 || (len(*path) == 0 && len(*dsn) == 0) {
+		usage()
+		os.Exit(2)
+	}
+	log.InitStructLog(*level, *logPath, "store_server_migrate")
+
+	schema, ok := migrate.Schemas[*db]
+	if !ok {
+		exit(fmt.Errorf("unknown db %s", *db))
+	}
+	mc := &driver.MysqlConfig{Dsn: *dsn, MaxOpenConns: 1}
+	if len(*dsn) == 0 {
+		c := &config{}
+		if err := common.ParseYamlConfigFile(*path, c); err != nil {
+			exit(err)
+		}
+		if mc = c.mysqlConfig(*db); mc == nil {
+			exit(fmt.Errorf("%s is not configured in %s", *db, *path))
+		}
+	}
+	rawDB, err := driver.CreateRawDBWithConfig("", mc)
+	if err != nil {
+		exit(err)
+	}
+	defer rawDB.Close()
+	mg, err := migrate.NewMigrator(rawDB, schema)
+	if err != nil {
+		exit(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	var ret interface{}
+	switch cmd := flag.Arg(0); cmd {
+	case "up":
+		ret, err = mg.Up(ctx, *to)
+	case "down":
+		ret, err = mg.Down(ctx, *to, *steps)
+	case "status":
+		ret, err = mg.Status(ctx)
+	case "plan":
+		ret, err = mg.Plan(ctx, *to)
+	default:
+		usage()
+		os.Exit(2)
+	}
+	output(ret, *asJson, mg.Latest())
+	if err != nil {
+		exit(err)
+	}
+}
+
+func output(ret interface{}, asJson bool, latest int64) {
+	if asJson {
+		data, _ := json.MarshalIndent(ret, "", "  ")
+		fmt.Fprintln(os.Stdout, string(data))
+		return
+	}
+	switch v := ret.(type) {
+	case []*migrate.Status:
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "VERSION\tNAME\tSTATE\tAPPLY TIME")
+		for _, s := range v {
+			state, applyTime := "pending", ""
+			if s.Applied {
+				state, applyTime = "applied", s.ApplyTime.Format("2006-01-02 15:04:05")
+			}
+			flags := make([]string, 0)
+			for name, on := range map[string]bool{"dirty": s.Dirty, "modified": s.Modified, "missing": s.Missing} {
+				if on {
+					flags = append(flags, name)
+				}
+			}
+			if len(flags) != 0 {
+				sort.Strings(flags)
+				state = fmt.Sprintf("%s(%s)", state, strings.Join(flags, ","))
+			}
+			fmt.Fprintf(w, "%d\t%s\t%s\t%s\n", s.Version, s.Name, state, applyTime)
+		}
+		w.Flush()
+		fmt.Fprintf(os.Stdout, "expected version: %d\n", latest)
+	case []*migrate.Step:
+		if len(v) == 0 {
+			fmt.Fprintln(os.Stdout, "nothing to migrate")
+		}
+		for _, step := range v {
+			fmt.Fprintf(os.Stdout, "-- %s %d_%s\n", step.Direction, step.Version, step.Name)
+			for _, stmt := range step.Statements {
+				fmt.Fprintf(os.Stdout, "%s;\n", stmt)
+			}
+			fmt.Fprintln(os.Stdout)
+		}
+	}
+}
+
+func exit(err error) {
+	fmt.Fprintf(os.Stderr, "error: %v\n", err)
+	os.Exit(1)
+}
@@ -559,3 +559,16 @@ func GetSourcesByIds(ids []int, onlyName bool) (interface{}, error) {
 	}
 	return infos, nil
 }
+
+//校验来源在地区是否有版权, region为地区简码(如HK, TH)
+func SourceHasCopyright(id int, region string) bool {
+	info, ok := SourceMap[id]
+	if !ok {
+		return false
+	}
+	copyright, ok := info["copyright"].(map[string]int)
+	if !ok {
+		return false
+	}
+	return copyright[region] > 0
+}
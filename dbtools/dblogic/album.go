@@ -0,0 +1,192 @@
+package dblogic
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/store_server/dbtools/driver"
+	"github.com/store_server/logger"
+
+	m "github.com/store_server/dbtools/models"
+)
+
+//JOOX CMS ALBUM相关操作
+type AlbumsDriver struct {
+	*driver.CMSDriver
+	*BaseDriver
+	lock sync.RWMutex
+}
+
+func NewAlbumsDriver(cmsDriver *driver.CMSDriver) *AlbumsDriver {
+	baseDriver := &BaseDriver{CMSDriver: cmsDriver, opDB: cmsDriver.MusicDB}
+	return &AlbumsDriver{cmsDriver, baseDriver, sync.RWMutex{}}
+}
+
+func (ad *AlbumsDriver) WithOp(info *OpInfo) *AlbumsDriver { //携带操作人
+	return &AlbumsDriver{ad.CMSDriver, ad.BaseDriver.withOp(info), sync.RWMutex{}}
+}
+
+func (ad *AlbumsDriver) WithConfirm(confirm *WriteConfirm) *AlbumsDriver { //携带预演/确认信息
+	return &AlbumsDriver{ad.CMSDriver, ad.BaseDriver.withConfirm(confirm), sync.RWMutex{}}
+}
+
+func (ad *AlbumsDriver) WithFields(fields []string) *AlbumsDriver { //查询投影字段
+	return &AlbumsDriver{ad.CMSDriver, ad.BaseDriver.withFields(fields), sync.RWMutex{}}
+}
+
+func (ad *AlbumsDriver) WithPrimary(on bool) *AlbumsDriver { //读主库
+	return &AlbumsDriver{ad.CMSDriver, ad.BaseDriver.withPrimary(on), sync.RWMutex{}}
+}
+
+func (ad *AlbumsDriver) WithTrace(trace *driver.QueryTrace) *AlbumsDriver { //携带查询来源
+	return &AlbumsDriver{ad.CMSDriver, ad.BaseDriver.withTrace(trace), sync.RWMutex{}}
+}
+
+var (
+	AlDriver *AlbumsDriver
+)
+
+/* ---------------------------- t_album ------------------------ */
+func (ad *AlbumsDriver) ExecRawQuerySql4Album(sql string, page, pagesize int64, count CountMode) ([]*m.Album, int64, error) { //原生query语句
+	albums := make([]*m.Album, 0)
+	res, total, err := ad.ExecRawQuerySql(sql, page, pagesize, &m.Album{}, count)
+	if err != nil {
+		return nil, 0, err
+	}
+	for _, r := range res {
+		if a, ok := r.(*m.Album); ok {
+			albums = append(albums, a)
+		}
+	}
+	return albums, total, nil
+}
+
+func (ad *AlbumsDriver) InsertOneAlbum(album *m.Album) (int64, error) {
+	current := m.TimeNormal{time.Now()}
+	album.FuploadTime = current
+	album.FmodifyTime = current
+	_, err := ad.InsertWithModel(album)
+	return album.FalbumId, err
+}
+
+var albumBatchModel = &batchModel{
+	table:      "t_album",
+	keys:       []string{"Falbum_id"},
+	insertOnly: map[string]bool{"Fupload_time": true},
+}
+
+//批量写入专辑, 按冲突策略处理已存在记录, 返回每行写入结果
+func (ad *AlbumsDriver) BatchUpsertAlbums(albums []*m.Album, opts BatchOptions) ([]*BatchRowResult, error) {
+	values := make([]interface{}, 0, len(albums))
+	for _, album := range albums {
+		current := m.TimeNormal{time.Now()}
+		album.FuploadTime = current
+		album.FmodifyTime = current
+		values = append(values, album)
+	}
+	return ad.BatchUpsertWithModel(albumBatchModel, values, opts)
+}
+
+//更新专辑, pre不为空时按Fversion/Fmodify_time做乐观锁校验
+func (ad *AlbumsDriver) UpdateOneAlbum(id int64, album *m.Album, pre *UpdatePrecond) (int64, error) {
+	album.FmodifyTime = m.TimeNormal{time.Now()}
+	affected, err := ad.UpdateWithPrecond(&m.Album{}, pre, 1, "Falbum_id = ?", album, id)
+	if err != nil {
+		return id, err
+	}
+	if affected != 1 {
+		return id, fmt.Errorf("update album[%d] error, affect %d raw", id, affected)
+	}
+	return id, nil
+}
+
+func (ad *AlbumsDriver) GetOneAlbum(id int64) (album *m.Album, err error) {
+	album = &m.Album{}
+	err = ad.readDB().First(album, "Falbum_id=?", id).Error
+	return
+}
+
+func (ad *AlbumsDriver) GetAlbumsByIds(ids []int64) ([]*m.Album, int64, error) {
+	var albums []*m.Album
+	db, err := ad.selectFields(ad.readDB(), &m.Album{})
+	if err != nil {
+		return nil, 0, err
+	}
+	err = db.Where("Falbum_id in (?)", ids).Find(&albums).Error
+	if err != nil {
+		return nil, 0, err
+	}
+	return albums, int64(len(albums)), nil
+}
+
+func (ad *AlbumsDriver) GetAlbumsByCondition(conds map[string]interface{}, page,
+	pagesize int64, count CountMode) ([]*m.Album, int64, error) {
+	albums := make([]*m.Album, 0)
+	res, total, err := ad.QueryWithModel(&m.Album{}, conds, page, pagesize, count)
+	if err != nil {
+		return nil, 0, err
+	}
+	for _, r := range res {
+		if a, ok := r.(*m.Album); ok {
+			albums = append(albums, a)
+		}
+	}
+	return albums, total, err
+}
+
+func (ad *AlbumsDriver) GetAlbumsByQuery(q *QueryDSL, page,
+	pagesize int64, count CountMode) ([]*m.Album, int64, error) { //结构化查询
+	albums := make([]*m.Album, 0)
+	res, total, err := ad.QueryWithDSL(&m.Album{}, q, page, pagesize, count)
+	if err != nil {
+		return nil, 0, err
+	}
+	for _, r := range res {
+		if a, ok := r.(*m.Album); ok {
+			albums = append(albums, a)
+		}
+	}
+	return albums, total, err
+}
+
+func (ad *AlbumsDriver) UpdateAlbumsAttr(ids []int64, conds,
+	updatesAttrs map[string]interface{}, pre *UpdatePrecond) (affected int64, err error) {
+	if len(ids) > 0 {
+		affected, err = ad.UpdateWithPrecond(&m.Album{}, pre, int64(len(ids)), "Falbum_id in (?)", updatesAttrs, ids)
+	} else if len(conds) != 0 {
+		affected, err = ad.UpdateWithPrecond(&m.Album{}, pre, 0, conds, updatesAttrs)
+	}
+	if err != nil {
+		return affected, err
+	}
+	if len(ids) > 0 {
+		if affected != int64(len(ids)) {
+			return affected, fmt.Errorf("update albums count[%d] error, affect %d raw", len(ids), affected)
+		}
+	}
+	return affected, nil
+}
+
+func (ad *AlbumsDriver) DeleteOneAlbum(id int64) (err error) {
+	_, err = ad.DeleteWithModelID(&m.Album{}, id)
+	return err
+}
+
+func (ad *AlbumsDriver) DeleteAlbums(ids []int64, conds map[string]interface{}) (affected int64, err error) {
+	if len(ids) > 0 {
+		affected, err = ad.DeleteWithModel(&m.Album{}, "Falbum_id in (?)", ids)
+	} else if len(conds) != 0 { //删除条件需严格把关
+		logger.Entry().Debugf("delete albums condition: %v", conds)
+		affected, err = ad.DeleteWithModel(&m.Album{}, conds)
+	}
+	if err != nil {
+		return affected, err
+	}
+	if len(ids) > 0 {
+		if affected != int64(len(ids)) {
+			return affected, fmt.Errorf("delete albums count[%d] error, affect %d raw", len(ids), affected)
+		}
+	}
+	return affected, nil
+}
@@ -0,0 +1,117 @@
+package dblogic
+
+import (
+	"testing"
+
+	"github.com/store_server/dbtools/driver"
+	"github.com/stretchr/testify/assert"
+
+	m "github.com/store_server/dbtools/models"
+)
+
+var (
+	albumsDriver *AlbumsDriver
+)
+
+//fixture中包含专辑1111111
+func alSetup() {
+	testScheme.Setup()
+	albumsDriver = NewAlbumsDriver(&driver.CMSDriver{
+		MusicDB:  testScheme.DB(),
+		ImportDB: testScheme.DB(),
+	})
+}
+
+func alCleanup() {
+	testScheme.Cleanup()
+	albumsDriver = nil
+}
+
+func genAlbumExample() *m.Album {
+	album := &m.Album{
+		FalbumId:   int64(2222222),
+		FalbumName: "test_album",
+		FalbumMid:  "2222222",
+		Ftype:      1,
+		Flanguage:  0,
+		Fgenre:     7,
+		FsingerId1: 71,
+		FsingerAll: "71",
+		FtrackNum:  10,
+		Fupc:       "123456789012",
+		Fstatus:    1,
+		Fversion:   1,
+	}
+	return album
+}
+
+func TestAlbumCRUD(t *testing.T) {
+	alSetup()
+	defer alCleanup()
+	album := genAlbumExample()
+	id, err := albumsDriver.InsertOneAlbum(album)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2222222), id)
+
+	data, err := albumsDriver.GetOneAlbum(id)
+	assert.NoError(t, err)
+	assert.Equal(t, "test_album", data.FalbumName)
+	assert.Equal(t, int64(10), data.FtrackNum)
+	albums, total, err := albumsDriver.GetAlbumsByIds([]int64{1111111, id})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), total)
+	albums, total, err = albumsDriver.GetAlbumsByCondition(map[string]interface{}{"Fsinger_id1": 71}, 1, 10, CountExact)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), total)
+	assert.Equal(t, 2, len(albums))
+
+	_, err = albumsDriver.UpdateOneAlbum(id, &m.Album{FalbumName: "renamed"}, nil)
+	assert.NoError(t, err)
+	data, err = albumsDriver.GetOneAlbum(id)
+	assert.NoError(t, err)
+	assert.Equal(t, "renamed", data.FalbumName)
+	assert.Equal(t, int64(2), data.Fversion) //更新时自动递增版本
+
+	_, err = albumsDriver.UpdateOneAlbum(3333333, &m.Album{FalbumName: "renamed"}, nil) //不存在的专辑
+	assert.Error(t, err)
+
+	affected, err := albumsDriver.DeleteAlbums([]int64{1111111, id}, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), affected)
+	_, err = albumsDriver.GetOneAlbum(id)
+	assert.Error(t, err)
+}
+
+func TestAlbumPrecondAndConfirm(t *testing.T) {
+	alSetup()
+	defer alCleanup()
+	_, err := albumsDriver.InsertOneAlbum(genAlbumExample())
+	assert.NoError(t, err)
+
+	//版本不一致时返回当前记录
+	stale, current := int64(0), int64(1)
+	_, err = albumsDriver.UpdateOneAlbum(2222222, &m.Album{Fstatus: 2}, &UpdatePrecond{Version: &stale})
+	ce, ok := err.(*ConflictError)
+	assert.True(t, ok)
+	assert.Equal(t, int64(1), ce.Current.(*m.Album).Fversion)
+	_, err = albumsDriver.UpdateOneAlbum(2222222, &m.Album{Fstatus: 2}, &UpdatePrecond{Version: &current})
+	assert.NoError(t, err)
+
+	//按条件批量更新超过阈值需确认
+	albumsDriver.SetConfirmThresholds(1, nil)
+	conds := map[string]interface{}{"Fsinger_id1": 71}
+	fields := map[string]interface{}{"Fgenre": 9}
+	_, err = albumsDriver.UpdateAlbumsAttr(nil, conds, fields, nil)
+	_, ok = err.(*ConfirmRequiredError)
+	assert.True(t, ok)
+	_, err = albumsDriver.WithConfirm(&WriteConfirm{DryRun: true}).UpdateAlbumsAttr(nil, conds, fields, nil)
+	confirm, ok := err.(*ConfirmRequiredError)
+	assert.True(t, ok)
+	assert.Equal(t, int64(2), confirm.Affected)
+	affected, err := albumsDriver.WithConfirm(&WriteConfirm{Token: confirm.Token}).UpdateAlbumsAttr(nil, conds, fields, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), affected)
+	data, err := albumsDriver.GetOneAlbum(1111111)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(9), data.Fgenre)
+}
@@ -14,13 +14,39 @@ import (
 //base driver
 type BaseDriver struct {
 	*driver.CMSDriver
-	opDB *gorm.DB
+	opDB       *gorm.DB
+	softDelete bool           //软删除模式, 删除记录先移入回收站
+	history    bool           //记录写操作的变更历史
+	op         *OpInfo        //当前写操作的操作信息
+	fields     []string       //当前查询的投影字段
+	uow        *UnitOfWork    //所属事务单元, 不为空时opDB为事务单元的事务
+	savepoint  string         //事务单元内的嵌套事务
+	policy     *confirmPolicy //批量写操作无需确认的最大影响行数
+	confirm    *WriteConfirm  //当前写操作的预演/确认信息
+	primary    bool           //查询使用主库(读己之写), 事务内始终为true
+	skipRules  []string       //当前写操作跳过的校验规则
+
+	//查询来源(请求路由及请求id), 记录于慢查询
+	trace *driver.QueryTrace
 }
 
 func (bd *BaseDriver) clone() *BaseDriver {
 	cv := &BaseDriver{
-		CMSDriver: bd.CMSDriver,
-		opDB:      bd.opDB.Begin(),
+		CMSDriver:  bd.CMSDriver,
+		opDB:       bd.opDB,
+		softDelete: bd.softDelete,
+		history:    bd.history,
+		op:         bd.op,
+		fields:     bd.fields,
+		uow:        bd.uow,
+		policy:     bd.policy,
+		confirm:    bd.confirm,
+		primary:    true,
+		trace:      bd.trace,
+		skipRules:  bd.skipRules,
+	}
+	if bd.uow == nil {
+		cv.opDB = bd.opDB.Begin()
 	}
 	return cv
 }
@@ -30,12 +56,24 @@ func (bd *BaseDriver) bBegin() (cv *BaseDriver, err error) { //开始事务
 		return nil, fmt.Errorf("invalid db pointer")
 	}
 	cv = bd.clone()
+	if cv.uow != nil { //事务单元内以savepoint实现嵌套事务
+		cv.savepoint, err = cv.uow.Savepoint()
+		logger.Entry().Debugf("BaseDriver[db: %p] savepoint %s...", cv.opDB, cv.savepoint)
+		return
+	}
 	err = cv.opDB.Error
 	logger.Entry().Debugf("BaseDriver[db: %p] begin transaction...", cv.opDB)
 	return
 }
 
 func (bd *BaseDriver) bRollback() { //支持回滚
+	if len(bd.savepoint) != 0 {
+		logger.Entry().Debugf("BaseDriver[db: %p] rollback to %s...", bd.opDB, bd.savepoint)
+		if err := bd.uow.RollbackTo(bd.savepoint); err != nil {
+			logger.Entry().Errorf("BaseDriver rollback to savepoint err: %v", err)
+		}
+		return
+	}
 	logger.Entry().Debugf("BaseDriver[db: %p] rollback...", bd.opDB)
 	if err := bd.opDB.Rollback().Error; err != nil {
 		logger.Entry().Errorf("BaseDriver rollback err: %v", err)
@@ -43,6 +81,13 @@ func (bd *BaseDriver) bRollback() { //支持回滚
 }
 
 func (bd *BaseDriver) bCommit() { //提交事务
+	if len(bd.savepoint) != 0 {
+		logger.Entry().Debugf("BaseDriver[db: %p] release %s...", bd.opDB, bd.savepoint)
+		if err := bd.uow.Release(bd.savepoint); err != nil {
+			logger.Entry().Errorf("BaseDriver release savepoint err: %v", err)
+		}
+		return
+	}
 	logger.Entry().Debugf("BaseDriver[db: %p] commit...", bd.opDB)
 	if err := bd.opDB.Commit().Error; err != nil {
 		logger.Entry().Errorf("BaseDriver commit err: %v", err)
@@ -50,10 +95,49 @@ func (bd *BaseDriver) bCommit() { //提交事务
 	}
 }
 
+//加锁读(SELECT ... FOR UPDATE), sqlite测试库不支持行锁且写事务串行执行, 不追加锁选项
+func forUpdate(db *gorm.DB) *gorm.DB {
+	if db.Dialect().GetName() == "sqlite3" {
+		return db
+	}
+	return db.Set("gorm:query_option", "FOR UPDATE")
+}
+
+//拼接分组内的字段值, sqlite测试库的group_concat不支持separator语法
+func groupConcat(db *gorm.DB, column, sep string) string {
+	if db.Dialect().GetName() == "sqlite3" {
+		return fmt.Sprintf("group_concat(%s, '%s')", column, sep)
+	}
+	return fmt.Sprintf("group_concat(%s separator '%s')", column, sep)
+}
+
+//查询使用的db, 事务内或要求读己之写时使用主库, 否则使用健康的从库
+func (bd *BaseDriver) readDB() *gorm.DB {
+	if bd.primary || bd.uow != nil || bd.CMSDriver == nil {
+		return bd.opDB
+	}
+	return driver.WithTrace(bd.ReadDB(driver.MusicDBName, bd.opDB), bd.trace)
+}
+
+//读己之写的driver副本, on为true时查询使用主库
+func (bd *BaseDriver) withPrimary(on bool) *BaseDriver {
+	cv := *bd
+	cv.primary = on
+	return &cv
+}
+
+//携带查询来源的driver副本, 慢查询记录中包含请求路由及请求id
+func (bd *BaseDriver) withTrace(trace *driver.QueryTrace) *BaseDriver {
+	cv := *bd
+	cv.trace = trace
+	cv.opDB = driver.WithTrace(bd.opDB, trace)
+	return &cv
+}
+
 /*-------------------------- 通用属性方法封装 -------------------------*/
-//原生query语句, 返回所有字段
+//原生query语句, 返回所有字段, count为首页总数统计方式
 func (bd *BaseDriver) ExecRawQuerySql(sql string, page, pagesize int64,
-	model interface{}) ([]interface{}, int64, error) {
+	model interface{}, count CountMode) ([]interface{}, int64, error) {
 	defer func() {
 		if err := recover(); err != nil {
 			logger.Entry().Errorf("exec raw sql query error: %v", err)
@@ -71,25 +155,24 @@ func (bd *BaseDriver) ExecRawQuerySql(sql string, page, pagesize int64,
 	if pagesize == 0 {
 		pagesize = 10000
 	}
+	if err := count.check(); err != nil {
+		return nil, 0, err
+	}
 	modelType := reflect.TypeOf(model)
 	//logger.Entry().Errorf("get model type: %v", modelType)
 	var total int64
+	var err error
 	if page == 1 {
-		if strings.Contains(sql, "where") {
-			var tmp []interface{}
-			total = bd.opDB.Model(model).Raw(sql).Scan(&tmp).RowsAffected
-			tmp = nil
-		} else {
-			bd.opDB.Model(model).Count(&total)
+		if total, err = bd.countWithRawSql(sql, count); err != nil {
+			return nil, 0, err
 		}
 	}
 	offset := (page - 1) * pagesize
-	var err error
 	var rows *osql.Rows
 	if strings.Contains(strings.ToLower(sql), "limit") {
-		rows, err = bd.opDB.Model(model).Raw(sql).Rows()
+		rows, err = bd.readDB().Model(model).Raw(sql).Rows()
 	} else {
-		rows, err = bd.opDB.Model(model).Offset(offset).Limit(pagesize).Raw(sql).Rows()
+		rows, err = bd.readDB().Model(model).Offset(offset).Limit(pagesize).Raw(sql).Rows()
 	}
 	if err != nil {
 		return nil, total, err
@@ -128,9 +211,9 @@ func (bd *BaseDriver) ExecRawQuerySqlCustomized(sql string, page,
 	var err error
 	var rows *osql.Rows
 	if strings.Contains(strings.ToLower(sql), "limit") {
-		rows, err = bd.opDB.Raw(sql).Rows()
+		rows, err = bd.readDB().Raw(sql).Rows()
 	} else {
-		rows, err = bd.opDB.Raw(sql).Offset(offset).Limit(pagesize).Rows()
+		rows, err = bd.readDB().Raw(sql).Offset(offset).Limit(pagesize).Rows()
 	}
 	if err != nil {
 		return nil, err
@@ -159,23 +242,48 @@ func (bd *BaseDriver) ExecRawQuerySqlCustomized(sql string, page,
 	return results, err
 }
 
-//原生update, insert or delete语句
+//原生update, insert or delete语句, 只允许model对应表上的单条语句, 在事务内执行, 预演或影响行数超过阈值时需携带token确认;
+//delete按where条件转入回收站并记录变更历史, update记录变更历史
 func (bd *BaseDriver) ExecRawUpdateOrInsertOrDeleteSql(sql string,
-	model interface{}) error {
-	if len(sql) == 0 {
-		return gorm.ErrInvalidSQL
-	}
-	err := bd.opDB.Model(model).Exec(sql).Error
+	model interface{}) (int64, error) {
+	rw, err := parseRawWrite(sql, modelTableName(model))
 	if err != nil {
-		return gorm.ErrInvalidSQL
+		return 0, err
 	}
 	tx, err := bd.bBegin()
 	if err != nil {
+		return 0, err
+	}
+	pw := newRawPendingWrite(rw, sql)
+	if err = tx.prepareWrite(pw); err != nil {
 		tx.bRollback()
-	} else {
-		tx.bCommit()
+		return 0, err
+	}
+	var before []interface{}
+	switch rw.verb {
+	case rawWriteDelete:
+		err = tx.beforeDelete(model, rw.where)
+	case rawWriteUpdate:
+		before, err = tx.historyBefore(model, rw.where)
+	}
+	if err != nil {
+		tx.bRollback()
+		return 0, err
+	}
+	ret := tx.opDB.Exec(sql)
+	if ret.Error != nil {
+		tx.bRollback()
+		return 0, ret.Error
+	}
+	if err = tx.historyAfterUpdate(model, before); err != nil {
+		tx.bRollback()
+		return 0, err
+	}
+	if err = bd.confirmWrite(tx, pw, ret.RowsAffected); err != nil {
+		return 0, err
 	}
-	return err
+	tx.bCommit()
+	return ret.RowsAffected, nil
 }
 
 //原生join query语句
@@ -198,9 +306,9 @@ func (bd *BaseDriver) JoinQueryWithSql(sql string, page,
 	var err error
 	var rows *osql.Rows
 	if strings.Contains(strings.ToLower(sql), "limit") {
-		rows, err = bd.opDB.Raw(sql).Rows()
+		rows, err = bd.readDB().Raw(sql).Rows()
 	} else {
-		rows, err = bd.opDB.Raw(sql).Offset(offset).Limit(pagesize).Rows()
+		rows, err = bd.readDB().Raw(sql).Offset(offset).Limit(pagesize).Rows()
 	}
 	if err != nil {
 		return nil, err
@@ -231,7 +339,7 @@ func (bd *BaseDriver) JoinQueryWithSql(sql string, page,
 
 //导出model所有记录
 func (bd *BaseDriver) ExportAllRecords(sql string) ([][]interface{}, error) {
-	rows, err := bd.opDB.Raw(sql).Rows()
+	rows, err := bd.readDB().Raw(sql).Rows()
 	if err != nil {
 		return nil, err
 	}
@@ -263,29 +371,89 @@ func (bd *BaseDriver) ExportAllRecords(sql string) ([][]interface{}, error) {
 	return res, nil
 }
 
-//通用model query
+//通用model query, count为首页总数统计方式
 func (bd *BaseDriver) QueryWithModel(model interface{}, conds map[string]interface{},
-	page, pagesize int64) ([]interface{}, int64, error) {
+	page, pagesize int64, count CountMode) ([]interface{}, int64, error) {
 	if page <= 0 {
 		page = 1
 	}
 	if pagesize <= 0 {
 		pagesize = 100
 	}
+	if err := count.check(); err != nil {
+		return nil, 0, err
+	}
 	modelType := reflect.TypeOf(model)
 	var total int64
 	var err error
 	if page == 1 {
-		if len(conds) != 0 {
-			var tmp []interface{}
-			total = bd.opDB.Model(model).Where(conds).Scan(&tmp).RowsAffected
-			tmp = nil
-		} else {
-			bd.opDB.Model(model).Count(&total)
+		db := bd.readDB().Model(model).Where(conds)
+		total, err = bd.countWithModel(db, model, fmt.Sprint(conds), len(conds) != 0, count)
+		if err != nil {
+			return nil, 0, err
 		}
 	}
 	offset := (page - 1) * pagesize
-	rows, err := bd.opDB.Model(model).Where(conds).Offset(offset).Limit(pagesize).Rows()
+	db, err := bd.selectFields(bd.readDB().Model(model).Where(conds), model)
+	if err != nil {
+		return nil, total, err
+	}
+	rows, err := db.Offset(offset).Limit(pagesize).Rows()
+	if err != nil {
+		return nil, total, err
+	}
+	defer rows.Close()
+	res := make([]interface{}, 0, pagesize)
+	for rows.Next() {
+		r := reflect.New(modelType.Elem())
+		t := r.Elem().Addr().Interface()
+		err = bd.opDB.ScanRows(rows, t)
+		if err != nil {
+			return nil, total, err
+		}
+		res = append(res, t)
+	}
+	return res, total, err
+}
+
+//通用model结构化查询, 条件经白名单校验后参数化执行
+func (bd *BaseDriver) QueryWithDSL(model interface{}, q *QueryDSL,
+	page, pagesize int64, count CountMode) ([]interface{}, int64, error) {
+	if page <= 0 {
+		page = 1
+	}
+	if pagesize <= 0 {
+		pagesize = 100
+	}
+	if err := count.check(); err != nil {
+		return nil, 0, err
+	}
+	cq, err := q.compile(model)
+	if err != nil {
+		return nil, 0, err
+	}
+	modelType := reflect.TypeOf(model)
+	db := bd.readDB().Model(model)
+	if len(cq.where) != 0 {
+		db = db.Where(cq.where, cq.args...)
+	}
+	var total int64
+	if page == 1 {
+		key := cq.where + fmt.Sprint(cq.args)
+		if total, err = bd.countWithModel(db, model, key, len(cq.where) != 0, count); err != nil {
+			return nil, 0, err
+		}
+	}
+	if len(cq.selects) != 0 {
+		db = db.Select(cq.selects)
+	} else if db, err = bd.selectFields(db, model); err != nil {
+		return nil, total, err
+	}
+	for _, o := range cq.orders {
+		db = db.Order(o)
+	}
+	offset := (page - 1) * pagesize
+	rows, err := db.Offset(offset).Limit(pagesize).Rows()
 	if err != nil {
 		return nil, total, err
 	}
@@ -332,24 +500,17 @@ func (bd *BaseDriver) WithScope(scope [3]interface{}) func(*gorm.DB) *gorm.DB {
 	}
 }
 
-//通用model update
+//通用model update, 含Fversion的model自动递增版本
 func (bd *BaseDriver) UpdateWithModel(model interface{}, conds interface{},
 	updateAttrs interface{}, args ...interface{}) (int64, error) {
-	tx, err := bd.bBegin()
-	if err != nil {
-		return 0, err
-	}
-	ret := tx.opDB.Model(model).Where(conds, args...).Update(updateAttrs)
-	if ret.Error != nil {
-		tx.bRollback()
-		return 0, ret.Error
-	}
-	tx.bCommit()
-	return ret.RowsAffected, nil
+	return bd.UpdateWithPrecond(model, nil, 0, conds, updateAttrs, args...)
 }
 
 //通用model insert
 func (bd *BaseDriver) InsertWithModel(modelValue interface{}) (int64, error) {
+	if err := bd.validateInsert(modelValue); err != nil {
+		return 0, err
+	}
 	tx, err := bd.bBegin()
 	if err != nil {
 		return 0, err
@@ -357,12 +518,38 @@ func (bd *BaseDriver) InsertWithModel(modelValue interface{}) (int64, error) {
 	db := tx.opDB.Create(modelValue)
 	if db.Error != nil {
 		tx.bRollback()
-	} else {
-		tx.bCommit()
+		return db.RowsAffected, db.Error
 	}
+	if err = tx.historyAfterInsert(modelValue); err != nil {
+		tx.bRollback()
+		return 0, err
+	}
+	tx.bCommit()
 	return db.RowsAffected, err
 }
 
+//删除前查询待删除记录, 软删除模式下移入回收站, 并记录变更历史
+func (bd *BaseDriver) beforeDelete(model interface{}, where ...interface{}) error {
+	if !bd.softDelete && !bd.history {
+		return nil
+	}
+	rows, err := bd.lockRecords(model, where...)
+	if err != nil {
+		return err
+	}
+	if bd.softDelete {
+		if err = bd.moveToTrash(modelTableName(model), rows); err != nil {
+			return err
+		}
+	}
+	for _, row := range rows {
+		if err = bd.writeHistory(HistoryDelete, modelTableName(model), row, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 //通用model delete with id
 func (bd *BaseDriver) DeleteWithModelID(model interface{},
 	id interface{}) (int64, error) {
@@ -370,6 +557,10 @@ func (bd *BaseDriver) DeleteWithModelID(model interface{},
 	if err != nil {
 		return 0, err
 	}
+	if err = tx.beforeDelete(model, id); err != nil {
+		tx.bRollback()
+		return 0, err
+	}
 	var ret *gorm.DB
 	ret = tx.opDB.Delete(model, id)
 	if ret.Error != nil {
@@ -391,14 +582,23 @@ func (bd *BaseDriver) DeleteWithModel(model interface{},
 	if err != nil {
 		return 0, err
 	}
+	where := append([]interface{}{conds}, args...)
+	pw := newPendingWrite(HistoryDelete, model, where)
+	if err = tx.prepareWrite(pw); err != nil {
+		tx.bRollback()
+		return 0, err
+	}
+	if err = tx.beforeDelete(model, where...); err != nil {
+		tx.bRollback()
+		return 0, err
+	}
 	ret := tx.opDB.Where(conds, args...).Delete(model)
 	if ret.Error != nil {
 		tx.bRollback()
 		return 0, ret.Error
 	}
-	if ret.RowsAffected > 100 {
-		tx.bRollback()
-		return 0, fmt.Errorf("%d rows wiil be delete, please confirm it", ret.RowsAffected)
+	if err = bd.confirmWrite(tx, pw, ret.RowsAffected); err != nil {
+		return 0, err
 	}
 	tx.bCommit()
 	return ret.RowsAffected, nil
@@ -0,0 +1,351 @@
+package dblogic
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/jinzhu/gorm"
+	"github.com/store_server/logger"
+)
+
+/*-------------------------- 批量写入(insert/upsert) -------------------------*/
+
+//主键冲突处理策略
+const (
+	ConflictSkip      = "skip"      //跳过已存在记录
+	ConflictOverwrite = "overwrite" //覆盖已存在记录
+	ConflictFail      = "fail"      //已存在记录报错
+
+	defaultBatchChunkSize = 500
+	maxBatchChunkSize     = 2000
+)
+
+//单行写入结果
+const (
+	BatchCreated = "created"
+	BatchUpdated = "updated"
+	BatchSkipped = "skipped"
+	BatchFailed  = "failed"
+)
+
+//batch write options
+type BatchOptions struct {
+	Policy    string `json:"policy,omitempty"`
+	ChunkSize int    `json:"chunkSize,omitempty"`
+}
+
+//batch row result
+type BatchRowResult struct {
+	Index   int                    `json:"index"`
+	Keys    map[string]interface{} `json:"keys"`
+	Action  string                 `json:"action"`
+	Error   string                 `json:"error,omitempty"`
+	Invalid []*FieldError          `json:"invalid,omitempty"` //写入校验失败的字段
+}
+
+//批量写入的model描述
+type batchModel struct {
+	table      string
+	keys       []string        //主键(唯一键)字段
+	insertOnly map[string]bool //仅插入时写入, 覆盖时不更新的字段
+}
+
+type batchRow struct {
+	index   int
+	columns []string
+	values  []interface{}
+	keyVals []interface{}
+}
+
+func (opts *BatchOptions) normalize() error {
+	switch opts.Policy {
+	case "":
+		opts.Policy = ConflictFail
+	case ConflictSkip, ConflictOverwrite, ConflictFail:
+	default:
+		return fmt.Errorf("batch conflict policy[%s] not supported", opts.Policy)
+	}
+	if opts.ChunkSize <= 0 {
+		opts.ChunkSize = defaultBatchChunkSize
+	}
+	if opts.ChunkSize > maxBatchChunkSize {
+		opts.ChunkSize = maxBatchChunkSize
+	}
+	return nil
+}
+
+func keyString(vals []interface{}) string {
+	segs := make([]string, 0, len(vals))
+	for _, v := range vals {
+		if b, ok := v.([]byte); ok {
+			v = string(b)
+		}
+		segs = append(segs, fmt.Sprint(v))
+	}
+	return strings.Join(segs, "|")
+}
+
+func isZeroKey(vals []interface{}) bool {
+	for _, v := range vals {
+		if !reflect.ValueOf(v).IsZero() {
+			return false
+		}
+	}
+	return true
+}
+
+func quoteColumns(columns []string) []string {
+	quoted := make([]string, 0, len(columns))
+	for _, c := range columns {
+		quoted = append(quoted, fmt.Sprintf("`%s`", c))
+	}
+	return quoted
+}
+
+func (bd *BaseDriver) newBatchRow(bm *batchModel, index int, value interface{}) *batchRow {
+	row := &batchRow{index: index}
+	fieldMap := make(map[string]interface{})
+	for _, f := range bd.opDB.NewScope(value).Fields() {
+		if !f.IsNormal || f.IsIgnored {
+			continue
+		}
+		row.columns = append(row.columns, f.DBName)
+		row.values = append(row.values, f.Field.Interface())
+		fieldMap[f.DBName] = f.Field.Interface()
+	}
+	for _, k := range bm.keys {
+		row.keyVals = append(row.keyVals, fieldMap[k])
+	}
+	return row
+}
+
+func (row *batchRow) result(bm *batchModel, action string, err error) *BatchRowResult {
+	ret := &BatchRowResult{Index: row.index, Keys: make(map[string]interface{}), Action: action}
+	for i, k := range bm.keys {
+		ret.Keys[k] = row.keyVals[i]
+	}
+	if err != nil {
+		ret.Error = err.Error()
+	}
+	if ve, ok := err.(*ValidationError); ok {
+		ret.Invalid = ve.Fields
+	}
+	return ret
+}
+
+//唯一键查询条件, 多字段唯一键使用(k1, k2) IN (?)
+func keysWhere(keys []string, keyVals [][]interface{}) (string, interface{}) {
+	keyCols := strings.Join(quoteColumns(keys), ", ")
+	if len(keys) == 1 {
+		vals := make([]interface{}, 0, len(keyVals))
+		for _, kv := range keyVals {
+			vals = append(vals, kv[0])
+		}
+		return fmt.Sprintf("%s IN (?)", keyCols), vals
+	}
+	return fmt.Sprintf("(%s) IN (?)", keyCols), keyVals
+}
+
+func batchKeyVals(rows []*batchRow) [][]interface{} {
+	keyVals := make([][]interface{}, 0, len(rows))
+	for _, r := range rows {
+		keyVals = append(keyVals, r.keyVals)
+	}
+	return keyVals
+}
+
+//查询已存在的记录主键, 并加锁防止并发写入
+func existBatchKeys(tx *gorm.DB, bm *batchModel, rows []*batchRow) (map[string]bool, error) {
+	exist := make(map[string]bool)
+	where, arg := keysWhere(bm.keys, batchKeyVals(rows))
+	dbRows, err := forUpdate(tx.Table(bm.table).Select(strings.Join(quoteColumns(bm.keys), ", ")).
+		Where(where, arg)).Rows()
+	if err != nil {
+		return nil, err
+	}
+	defer dbRows.Close()
+	for dbRows.Next() {
+		vals := make([]interface{}, len(bm.keys))
+		ptrs := make([]interface{}, len(bm.keys))
+		for i := range vals {
+			ptrs[i] = &vals[i]
+		}
+		if err = dbRows.Scan(ptrs...); err != nil {
+			return nil, err
+		}
+		exist[keyString(vals)] = true
+	}
+	return exist, dbRows.Err()
+}
+
+//批量写入后对比写入前后记录, 记录变更历史
+func (bd *BaseDriver) batchHistory(bm *batchModel, writes []*batchRow, actions []string,
+	before map[string]interface{}) error {
+	rt, ok := recordTables[bm.table]
+	if !bd.history || !ok {
+		return nil
+	}
+	after, err := bd.recordsByKeys(rt, batchKeyVals(writes))
+	if err != nil {
+		return err
+	}
+	for i, r := range writes {
+		key := keyString(r.keyVals)
+		action := HistoryInsert
+		if actions[i] == BatchUpdated {
+			action = HistoryUpdate
+		}
+		if err = bd.writeHistory(action, bm.table, before[key], after[key]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//多行insert语句, overwrite策略下使用on duplicate key update
+func buildBatchInsertSql(bm *batchModel, rows []*batchRow, overwrite bool) (string, []interface{}) {
+	columns := rows[0].columns
+	marks := "(" + strings.TrimSuffix(strings.Repeat("?, ", len(columns)), ", ") + ")"
+	values := make([]string, 0, len(rows))
+	args := make([]interface{}, 0, len(rows)*len(columns))
+	for _, r := range rows {
+		values = append(values, marks)
+		args = append(args, r.values...)
+	}
+	sql := fmt.Sprintf("INSERT INTO `%s` (%s) VALUES %s", bm.table,
+		strings.Join(quoteColumns(columns), ", "), strings.Join(values, ", "))
+	if overwrite {
+		keys := make(map[string]bool)
+		for _, k := range bm.keys {
+			keys[k] = true
+		}
+		updates := make([]string, 0, len(columns))
+		for _, c := range columns {
+			if keys[c] || bm.insertOnly[c] {
+				continue
+			}
+			if c == versionColumn { //覆盖时递增版本号
+				updates = append(updates, "`Fversion` = `Fversion` + 1")
+				continue
+			}
+			updates = append(updates, fmt.Sprintf("`%s` = VALUES(`%s`)", c, c))
+		}
+		if len(updates) != 0 {
+			sql += " ON DUPLICATE KEY UPDATE " + strings.Join(updates, ", ")
+		}
+	}
+	return sql, args
+}
+
+//在单个事务中写入一批记录, 返回每行结果
+func (bd *BaseDriver) writeBatchChunk(bm *batchModel, rows []*batchRow,
+	policy string) ([]*BatchRowResult, error) {
+	tx, err := bd.bBegin()
+	if err != nil {
+		return nil, err
+	}
+	exist, err := existBatchKeys(tx.opDB, bm, rows)
+	if err != nil {
+		tx.bRollback()
+		return nil, err
+	}
+	results := make([]*BatchRowResult, 0, len(rows))
+	writes := make([]*batchRow, 0, len(rows))
+	actions := make([]string, 0, len(rows))
+	for _, r := range rows {
+		if !exist[keyString(r.keyVals)] {
+			writes, actions = append(writes, r), append(actions, BatchCreated)
+			continue
+		}
+		switch policy {
+		case ConflictSkip:
+			results = append(results, r.result(bm, BatchSkipped, nil))
+		case ConflictOverwrite:
+			writes, actions = append(writes, r), append(actions, BatchUpdated)
+		default:
+			results = append(results, r.result(bm, BatchFailed, fmt.Errorf("duplicate key %v", keyString(r.keyVals))))
+		}
+	}
+	if len(writes) != 0 {
+		var before map[string]interface{}
+		if rt, ok := recordTables[bm.table]; ok && tx.history && policy == ConflictOverwrite {
+			if before, err = tx.recordsByKeys(rt, batchKeyVals(writes)); err != nil {
+				tx.bRollback()
+				return nil, err
+			}
+		}
+		sql, args := buildBatchInsertSql(bm, writes, policy == ConflictOverwrite)
+		if err = tx.opDB.Exec(sql, args...).Error; err != nil {
+			tx.bRollback()
+			return nil, err
+		}
+		if err = tx.batchHistory(bm, writes, actions, before); err != nil {
+			tx.bRollback()
+			return nil, err
+		}
+	}
+	tx.bCommit()
+	for i, r := range writes {
+		results = append(results, r.result(bm, actions[i], nil))
+	}
+	return results, nil
+}
+
+//逐行写入无主键(自增)记录, 以获取生成的主键
+func (bd *BaseDriver) insertBatchAutoKey(bm *batchModel, index int,
+	value interface{}) *BatchRowResult {
+	_, err := bd.InsertWithModel(value)
+	row := bd.newBatchRow(bm, index, value)
+	if err != nil {
+		return row.result(bm, BatchFailed, err)
+	}
+	return row.result(bm, BatchCreated, nil)
+}
+
+//通用model批量写入, 分批执行多行insert, 返回每行的写入结果
+func (bd *BaseDriver) BatchUpsertWithModel(bm *batchModel, values []interface{},
+	opts BatchOptions) ([]*BatchRowResult, error) {
+	if err := opts.normalize(); err != nil {
+		return nil, err
+	}
+	results := make([]*BatchRowResult, len(values))
+	rows := make([]*batchRow, 0, len(values))
+	for i, v := range values {
+		row := bd.newBatchRow(bm, i, v)
+		if err := bd.validateInsert(v); err != nil { //校验失败的行不写入
+			results[i] = row.result(bm, BatchFailed, err)
+			continue
+		}
+		if isZeroKey(row.keyVals) {
+			results[i] = bd.insertBatchAutoKey(bm, i, v)
+			continue
+		}
+		rows = append(rows, row)
+	}
+	for start := 0; start < len(rows); start += opts.ChunkSize {
+		end := start + opts.ChunkSize
+		if end > len(rows) {
+			end = len(rows)
+		}
+		chunk := rows[start:end]
+		chunkResults, err := bd.writeBatchChunk(bm, chunk, opts.Policy)
+		if err != nil { //批次写入失败时逐行重试, 定位失败记录
+			logger.Entry().Errorf("batch write %s chunk[%d:%d] error: %v, retry row by row",
+				bm.table, start, end, err)
+			chunkResults = make([]*BatchRowResult, 0, len(chunk))
+			for _, r := range chunk {
+				rowResults, err := bd.writeBatchChunk(bm, []*batchRow{r}, opts.Policy)
+				if err != nil {
+					chunkResults = append(chunkResults, r.result(bm, BatchFailed, err))
+					continue
+				}
+				chunkResults = append(chunkResults, rowResults...)
+			}
+		}
+		for _, ret := range chunkResults {
+			results[ret.Index] = ret
+		}
+	}
+	return results, nil
+}
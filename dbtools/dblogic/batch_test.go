@@ -0,0 +1,36 @@
+package dblogic
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBuildBatchInsertSql(t *testing.T) {
+	rows := []*batchRow{
+		{index: 0, columns: []string{"Ftrack_id", "Fregion", "Flocal_name"}, values: []interface{}{1, 2, "a"}},
+		{index: 1, columns: []string{"Ftrack_id", "Fregion", "Flocal_name"}, values: []interface{}{3, 4, "b"}},
+	}
+	sql, args := buildBatchInsertSql(trackExtraOsBatchModel, rows, false)
+	assert.Equal(t, "INSERT INTO `t_track_extra_os` (`Ftrack_id`, `Fregion`, `Flocal_name`) VALUES (?, ?, ?), (?, ?, ?)", sql)
+	assert.Equal(t, []interface{}{1, 2, "a", 3, 4, "b"}, args)
+
+	sql, _ = buildBatchInsertSql(trackExtraOsBatchModel, rows, true)
+	assert.Contains(t, sql, " ON DUPLICATE KEY UPDATE `Flocal_name` = VALUES(`Flocal_name`)")
+	assert.NotContains(t, sql, "`Fregion` = VALUES")
+
+	rows = []*batchRow{{columns: []string{"Ftrack_id", "Fupload_time", "Fversion"}, values: []interface{}{1, "t", 0}}}
+	sql, _ = buildBatchInsertSql(trackBatchModel, rows, true)
+	assert.Contains(t, sql, " ON DUPLICATE KEY UPDATE `Fversion` = `Fversion` + 1")
+	assert.NotContains(t, sql, "`Fupload_time` = VALUES")
+}
+
+func TestBatchOptionsNormalize(t *testing.T) {
+	opts := BatchOptions{}
+	assert.NoError(t, opts.normalize())
+	assert.Equal(t, ConflictFail, opts.Policy)
+	assert.Equal(t, defaultBatchChunkSize, opts.ChunkSize)
+	opts = BatchOptions{Policy: "replace"}
+	assert.Error(t, opts.normalize())
+	assert.Equal(t, "1|2", keyString([]interface{}{int64(1), []byte("2")}))
+}
@@ -0,0 +1,270 @@
+package dblogic
+
+import (
+	"crypto/md5"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+/*-------------------------- 写操作预演及确认(dry run & confirm) -------------------------*/
+//批量update/delete及原生写sql分两阶段执行: 预演时在事务内执行写操作并回滚, 返回影响行数、
+//受影响记录唯一键样例及确认token; 确认时携带token重新执行, 受影响记录不变时才提交
+
+const (
+	defaultConfirmThreshold = 100
+	confirmTokenTTL         = 5 * time.Minute
+	confirmTokenMaxSize     = 1024
+	confirmSampleSize       = 20
+	confirmRawWrite         = "raw"
+)
+
+//确认token无效、过期或受影响记录已变化
+var ErrConfirmToken = errors.New("confirm token invalid or expired, or affected records changed, please dry run again")
+
+//write confirm, dryRun为true时仅预演, confirmToken为预演返回的token
+type WriteConfirm struct {
+	DryRun bool   `json:"dryRun,omitempty"`
+	Token  string `json:"confirmToken,omitempty"`
+}
+
+//预演结果, 预演或影响行数超过阈值时返回, samples为受影响记录唯一键样例
+type ConfirmRequiredError struct {
+	Table    string   `json:"table"`
+	Affected int64    `json:"affected"`
+	Samples  []string `json:"samples,omitempty"`
+	Token    string   `json:"confirmToken"`
+	ExpireAt int64    `json:"expireAt"`
+	DryRun   bool     `json:"dryRun"`
+}
+
+func (e *ConfirmRequiredError) Error() string {
+	if e.DryRun {
+		return fmt.Sprintf("dry run: %d rows of %s will be affected", e.Affected, e.Table)
+	}
+	return fmt.Sprintf("%d rows of %s will be affected, please confirm it with confirmToken", e.Affected, e.Table)
+}
+
+func IsConfirmRequired(err error) bool {
+	_, ok := err.(*ConfirmRequiredError)
+	return ok
+}
+
+//影响行数阈值, tables为按表配置, 未配置的表使用threshold
+type confirmPolicy struct {
+	threshold int64
+	tables    map[string]int64
+}
+
+func (p *confirmPolicy) limit(table string) int64 {
+	if p == nil {
+		return defaultConfirmThreshold
+	}
+	if n, ok := p.tables[table]; ok && n > 0 {
+		return n
+	}
+	if p.threshold > 0 {
+		return p.threshold
+	}
+	return defaultConfirmThreshold
+}
+
+//设置无需确认的最大影响行数, threshold<=0时使用默认值100
+func (bd *BaseDriver) SetConfirmThresholds(threshold int64, tables map[string]int64) {
+	bd.policy = &confirmPolicy{threshold: threshold, tables: tables}
+}
+
+//携带写操作确认信息的driver副本, 单次请求内使用
+func (bd *BaseDriver) withConfirm(confirm *WriteConfirm) *BaseDriver {
+	cv := *bd
+	cv.confirm = confirm
+	return &cv
+}
+
+type confirmEntry struct {
+	fingerprint string
+	keysHash    string
+	affected    int64
+	expire      time.Time
+}
+
+//预演签发的确认token, 单次有效; 保存在进程内存中, 仅适用于单实例部署,
+//多实例时预演与确认请求须路由到同一实例
+type confirmTokens struct {
+	sync.Mutex
+	entries map[string]*confirmEntry
+}
+
+var writeTokens = &confirmTokens{entries: make(map[string]*confirmEntry)}
+
+func (c *confirmTokens) issue(e *confirmEntry) (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	token := hex.EncodeToString(buf)
+	c.Lock()
+	defer c.Unlock()
+	now := time.Now()
+	if len(c.entries) >= confirmTokenMaxSize {
+		for k, v := range c.entries {
+			if now.After(v.expire) {
+				delete(c.entries, k)
+			}
+		}
+		if len(c.entries) >= confirmTokenMaxSize {
+			return "", fmt.Errorf("too many pending confirm tokens")
+		}
+	}
+	e.expire = now.Add(confirmTokenTTL)
+	c.entries[token] = e
+	return token, nil
+}
+
+//取出与fingerprint匹配且未过期的token并在同一锁内删除, 并发确认时只有一个请求能取到
+func (c *confirmTokens) take(token, fingerprint string) *confirmEntry {
+	c.Lock()
+	defer c.Unlock()
+	e, ok := c.entries[token]
+	if !ok {
+		return nil
+	}
+	if time.Now().After(e.expire) {
+		delete(c.entries, token)
+		return nil
+	}
+	if e.fingerprint != fingerprint {
+		return nil
+	}
+	delete(c.entries, token)
+	return e
+}
+
+//待确认的写操作, rt为空时无法获取受影响记录, 仅按影响行数校验
+type pendingWrite struct {
+	table       string
+	fingerprint string
+	rt          *recordTable
+	where       []interface{}
+	keys        []string
+	entry       *confirmEntry
+}
+
+func writeFingerprint(parts ...interface{}) string {
+	data, err := json.Marshal(parts)
+	if err != nil {
+		data = []byte(fmt.Sprint(parts...))
+	}
+	sum := md5.Sum(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func keysHash(keys []string) string {
+	sum := md5.Sum([]byte(strings.Join(keys, ",")))
+	return hex.EncodeToString(sum[:])
+}
+
+//model update/delete的待确认写操作, parts为参与token校验的写操作参数
+func newPendingWrite(action string, model interface{}, where []interface{}, parts ...interface{}) *pendingWrite {
+	table := modelTableName(model)
+	return &pendingWrite{
+		table:       table,
+		fingerprint: writeFingerprint(append([]interface{}{action, table, where}, parts...)...),
+		rt:          recordTables[table],
+		where:       where,
+	}
+}
+
+//原生写sql的待确认写操作, update/delete按where条件查询受影响记录
+func newRawPendingWrite(rw *rawWrite, sql string) *pendingWrite {
+	pw := &pendingWrite{table: rw.table, fingerprint: writeFingerprint(confirmRawWrite, rw.table, sql)}
+	if len(rw.where) != 0 {
+		pw.rt, pw.where = recordTables[rw.table], []interface{}{rw.where}
+	}
+	return pw
+}
+
+//查询并锁定受影响记录的唯一键, 按字典序排列
+func (bd *BaseDriver) affectedKeys(pw *pendingWrite) ([]string, error) {
+	rows := reflect.New(reflect.SliceOf(reflect.TypeOf(pw.rt.newModel())))
+	err := forUpdate(bd.opDB).Select(quoteColumns(pw.rt.keys)).
+		Find(rows.Interface(), pw.where...).Error
+	if err != nil {
+		return nil, err
+	}
+	rows = rows.Elem()
+	keys := make([]string, 0, rows.Len())
+	for i := 0; i < rows.Len(); i++ {
+		keys = append(keys, keyString(pw.rt.keyValues(bd.recordFields(rows.Index(i).Interface()))))
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+//写操作前调用, 预演或确认时在事务内锁定并记录受影响记录, 确认时校验token
+func (bd *BaseDriver) prepareWrite(pw *pendingWrite) (err error) {
+	if bd.confirm == nil || (!bd.confirm.DryRun && len(bd.confirm.Token) == 0) {
+		return nil
+	}
+	if pw.rt != nil {
+		if pw.keys, err = bd.affectedKeys(pw); err != nil {
+			return err
+		}
+	}
+	if bd.confirm.DryRun {
+		return nil
+	}
+	pw.entry = writeTokens.take(bd.confirm.Token, pw.fingerprint) //token取出即失效, 校验失败需重新预演
+	if pw.entry == nil || (pw.rt != nil && pw.entry.keysHash != keysHash(pw.keys)) {
+		return ErrConfirmToken
+	}
+	return nil
+}
+
+//写操作后调用, 预演或超过阈值且未确认时回滚tx并返回ConfirmRequiredError;
+//返回错误时tx已回滚
+func (bd *BaseDriver) confirmWrite(tx *BaseDriver, pw *pendingWrite, affected int64) error {
+	if pw.entry != nil {
+		if pw.rt == nil && pw.entry.affected != affected {
+			tx.bRollback()
+			return ErrConfirmToken
+		}
+		return nil
+	}
+	dryRun := bd.confirm != nil && bd.confirm.DryRun
+	if !dryRun && affected <= bd.policy.limit(pw.table) {
+		return nil
+	}
+	tx.bRollback()
+	if pw.rt != nil && pw.keys == nil { //回滚后查询受影响记录
+		keys, err := bd.affectedKeys(pw)
+		if err != nil {
+			return err
+		}
+		pw.keys = keys
+	}
+	entry := &confirmEntry{fingerprint: pw.fingerprint, keysHash: keysHash(pw.keys), affected: affected}
+	token, err := writeTokens.issue(entry)
+	if err != nil {
+		return err
+	}
+	samples := pw.keys
+	if len(samples) > confirmSampleSize {
+		samples = samples[:confirmSampleSize]
+	}
+	return &ConfirmRequiredError{
+		Table:    pw.table,
+		Affected: affected,
+		Samples:  samples,
+		Token:    token,
+		ExpireAt: entry.expire.Unix(),
+		DryRun:   dryRun,
+	}
+}
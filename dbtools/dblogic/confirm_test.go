@@ -0,0 +1,143 @@
+package dblogic
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	m "github.com/store_server/dbtools/models"
+)
+
+func TestConfirmPolicyAndRawWrite(t *testing.T) {
+	var p *confirmPolicy
+	assert.Equal(t, int64(defaultConfirmThreshold), p.limit("t_track"))
+	p = &confirmPolicy{threshold: 50, tables: map[string]int64{"t_track": 10}}
+	assert.Equal(t, int64(10), p.limit("t_track"))
+	assert.Equal(t, int64(50), p.limit("t_video"))
+
+	rw, err := parseRawWrite("UPDATE `t_track` SET Fstatus = 1 WHERE Fsinger_id = 3;", "t_track")
+	assert.NoError(t, err)
+	pw := newRawPendingWrite(rw, "UPDATE `t_track` SET Fstatus = 1 WHERE Fsinger_id = 3;")
+	assert.NotNil(t, pw.rt)
+	assert.Equal(t, []interface{}{"Fsinger_id = 3"}, pw.where)
+	rw, err = parseRawWrite("update t_track set Fname = 'a where b; c' where Fstatus = 0", "t_track")
+	assert.NoError(t, err)
+	assert.Equal(t, "Fstatus = 0", rw.where)
+	rw, err = parseRawWrite("INSERT INTO t_track(Ftrack_id) VALUES (5)", "t_track")
+	assert.NoError(t, err)
+	assert.Nil(t, newRawPendingWrite(rw, "INSERT INTO t_track(Ftrack_id) VALUES (5)").rt)
+
+	//多语句、ddl、无where条件、order by/limit、注释及其它表均不允许
+	for _, sql := range []string{
+		"delete from t_track where Fstatus = 0; drop table t_track",
+		"drop table t_track",
+		"alter table t_track add column Fx int",
+		"truncate table t_track",
+		"delete from t_track",
+		"delete from t_track where Fstatus = 0 limit 10",
+		"update t_track set Fstatus = 1 where Fstatus = 0 order by Ftrack_id",
+		"delete from t_track where Fstatus = 0 -- comment",
+		"delete from t_video where Fid = 1",
+		"update t_track, t_album set t_track.Fstatus = 1 where t_track.Falbum_id = t_album.Falbum_id",
+	} {
+		_, err = parseRawWrite(sql, "t_track")
+		assert.True(t, IsRawSqlError(err), sql)
+	}
+
+	a := newPendingWrite(HistoryDelete, &m.Track{}, []interface{}{"Ftrack_id in (?)", []int64{1, 2}})
+	b := newPendingWrite(HistoryDelete, &m.Track{}, []interface{}{"Ftrack_id in (?)", []int64{1, 3}})
+	assert.NotEqual(t, a.fingerprint, b.fingerprint)
+
+	token, err := writeTokens.issue(&confirmEntry{fingerprint: a.fingerprint})
+	assert.NoError(t, err)
+	assert.Nil(t, writeTokens.take(token, b.fingerprint)) //fingerprint不匹配时不删除
+	assert.NotNil(t, writeTokens.take(token, a.fingerprint))
+	assert.Nil(t, writeTokens.take(token, a.fingerprint))
+
+	//并发确认同一token只有一个请求能取到
+	token, err = writeTokens.issue(&confirmEntry{fingerprint: a.fingerprint})
+	assert.NoError(t, err)
+	var taken int32
+	wg := sync.WaitGroup{}
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if writeTokens.take(token, a.fingerprint) != nil {
+				atomic.AddInt32(&taken, 1)
+			}
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, int32(1), taken)
+}
+
+//超过阈值需确认, 预演获取token后携带token执行, token单次有效, 受影响记录变化后token失效
+func TestConfirmDryRunAndReplay(t *testing.T) {
+	tkSetup()
+	defer tkCleanup()
+	for _, id := range []int64{2, 3} {
+		track := genTrackExample()
+		track.FtrackId = id
+		_, err := tracksDriver.InsertOneTrack(track)
+		assert.NoError(t, err)
+	}
+	tracksDriver.SetConfirmThresholds(1, nil)
+	conds := map[string]interface{}{"Fsinger": 71}
+	fields := map[string]interface{}{"Fnote": 5}
+
+	_, err := tracksDriver.UpdateTracksAttr(nil, conds, fields, nil)
+	ce, ok := err.(*ConfirmRequiredError)
+	assert.True(t, ok)
+	assert.False(t, ce.DryRun)
+	assert.Equal(t, int64(3), ce.Affected)
+	track, err := tracksDriver.GetOneTrack(2)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(111), track.Fnote) //超过阈值未确认时已回滚
+
+	_, err = tracksDriver.WithConfirm(&WriteConfirm{DryRun: true}).UpdateTracksAttr(nil, conds, fields, nil)
+	ce, ok = err.(*ConfirmRequiredError)
+	assert.True(t, ok)
+	assert.True(t, ce.DryRun)
+	assert.Equal(t, 3, len(ce.Samples))
+	confirmed := tracksDriver.WithConfirm(&WriteConfirm{Token: ce.Token})
+	affected, err := confirmed.UpdateTracksAttr(nil, conds, fields, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3), affected)
+	track, err = tracksDriver.GetOneTrack(2)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(5), track.Fnote)
+	_, err = confirmed.UpdateTracksAttr(nil, conds, fields, nil) //token已使用
+	assert.Equal(t, ErrConfirmToken, err)
+
+	//预演后受影响记录变化
+	_, err = tracksDriver.WithConfirm(&WriteConfirm{DryRun: true}).DeleteTracks(nil, conds)
+	ce, ok = err.(*ConfirmRequiredError)
+	assert.True(t, ok)
+	track = genTrackExample()
+	track.FtrackId = 4
+	_, err = tracksDriver.InsertOneTrack(track)
+	assert.NoError(t, err)
+	_, err = tracksDriver.WithConfirm(&WriteConfirm{Token: ce.Token}).DeleteTracks(nil, conds)
+	assert.Equal(t, ErrConfirmToken, err)
+	_, err = tracksDriver.GetOneTrack(4)
+	assert.NoError(t, err)
+
+	//原生写sql
+	sql := "UPDATE t_track SET Fnote = 6 WHERE Fsinger = 71"
+	_, err = tracksDriver.WithConfirm(&WriteConfirm{DryRun: true}).ExecRawUpdateOrInsertOrDeleteSql(sql, &m.Track{})
+	ce, ok = err.(*ConfirmRequiredError)
+	assert.True(t, ok)
+	assert.Equal(t, int64(4), ce.Affected)
+	_, err = tracksDriver.WithConfirm(&WriteConfirm{Token: ce.Token}).
+		ExecRawUpdateOrInsertOrDeleteSql("UPDATE t_track SET Fnote = 7 WHERE Fsinger = 71", &m.Track{})
+	assert.Equal(t, ErrConfirmToken, err) //token与sql不匹配
+	affected, err = tracksDriver.WithConfirm(&WriteConfirm{Token: ce.Token}).ExecRawUpdateOrInsertOrDeleteSql(sql, &m.Track{})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(4), affected)
+	track, err = tracksDriver.GetOneTrack(4)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(6), track.Fnote)
+}
@@ -0,0 +1,168 @@
+package dblogic
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+/*-------------------------- 分页总数统计 -------------------------*/
+
+//total count mode
+type CountMode string
+
+const (
+	CountExact    CountMode = "exact"    //select count(*)精确统计(默认)
+	CountNone     CountMode = "none"     //不统计总数
+	CountEstimate CountMode = "estimate" //根据explain或information_schema估算
+
+	countCacheTTL     = 30 * time.Second
+	countCacheMaxSize = 1024
+)
+
+func (c CountMode) check() error {
+	switch c {
+	case "", CountExact, CountNone, CountEstimate:
+		return nil
+	}
+	return fmt.Errorf("count mode[%s] not supported", c)
+}
+
+type countEntry struct {
+	total  int64
+	expire time.Time
+}
+
+//按查询条件短暂缓存总数, 避免翻页时重复统计
+type countCache struct {
+	sync.Mutex
+	entries map[string]*countEntry
+}
+
+var totalCache = &countCache{entries: make(map[string]*countEntry)}
+
+func (c *countCache) get(key string) (int64, bool) {
+	c.Lock()
+	defer c.Unlock()
+	e, ok := c.entries[key]
+	if !ok || time.Now().After(e.expire) {
+		return 0, false
+	}
+	return e.total, true
+}
+
+func (c *countCache) set(key string, total int64) {
+	c.Lock()
+	defer c.Unlock()
+	now := time.Now()
+	if len(c.entries) >= countCacheMaxSize {
+		for k, e := range c.entries {
+			if now.After(e.expire) {
+				delete(c.entries, k)
+			}
+		}
+		if len(c.entries) >= countCacheMaxSize {
+			c.entries = make(map[string]*countEntry)
+		}
+	}
+	c.entries[key] = &countEntry{total: total, expire: now.Add(countCacheTTL)}
+}
+
+//从explain结果获取预估扫描行数
+func (bd *BaseDriver) explainRows(query string, args ...interface{}) (int64, error) {
+	rows, err := bd.readDB().Raw("EXPLAIN "+query, args...).Rows()
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+	columns, err := rows.Columns()
+	if err != nil {
+		return 0, err
+	}
+	var estimate int64
+	values := make([]sql.NullString, len(columns))
+	scanArgs := make([]interface{}, len(columns))
+	for i := range values {
+		scanArgs[i] = &values[i]
+	}
+	for rows.Next() {
+		if err = rows.Scan(scanArgs...); err != nil {
+			return 0, err
+		}
+		for i, c := range columns {
+			if strings.ToLower(c) != "rows" || !values[i].Valid {
+				continue
+			}
+			var n int64
+			fmt.Sscan(values[i].String, &n)
+			if n > estimate {
+				estimate = n
+			}
+		}
+	}
+	return estimate, rows.Err()
+}
+
+//无条件时从information_schema获取表行数估算值
+func (bd *BaseDriver) tableRows(table string) (total int64, err error) {
+	err = bd.readDB().Raw("SELECT TABLE_ROWS FROM information_schema.TABLES "+
+		"WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ?", table).Row().Scan(&total)
+	return
+}
+
+//统计model在条件下的总数, db为已附加查询条件的gorm实例, key为条件缓存key
+func (bd *BaseDriver) countWithModel(db *gorm.DB, model interface{}, key string,
+	hasCond bool, mode CountMode) (total int64, err error) {
+	if mode == CountNone {
+		return 0, nil
+	}
+	if mode == "" {
+		mode = CountExact
+	}
+	key = fmt.Sprintf("%s|%s|%s", modelTableName(model), mode, key)
+	if total, ok := totalCache.get(key); ok {
+		return total, nil
+	}
+	switch {
+	case mode == CountExact:
+		err = db.Count(&total).Error
+	case hasCond:
+		expr := db.QueryExpr()
+		total, err = bd.explainRows("?", expr)
+	default:
+		total, err = bd.tableRows(modelTableName(model))
+	}
+	if err != nil {
+		return 0, err
+	}
+	totalCache.set(key, total)
+	return total, nil
+}
+
+//统计原生sql结果总数
+func (bd *BaseDriver) countWithRawSql(query string, mode CountMode) (total int64, err error) {
+	if mode == CountNone {
+		return 0, nil
+	}
+	if mode == "" {
+		mode = CountExact
+	}
+	key := fmt.Sprintf("raw|%s|%s", mode, query)
+	if total, ok := totalCache.get(key); ok {
+		return total, nil
+	}
+	if mode == CountExact {
+		err = bd.readDB().Raw(fmt.Sprintf("SELECT COUNT(*) FROM (%s) AS t_count", query)).Row().Scan(&total)
+	} else {
+		total, err = bd.explainRows(query)
+	}
+	if err != nil {
+		return 0, err
+	}
+	totalCache.set(key, total)
+	return total, nil
+}
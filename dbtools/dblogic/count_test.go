@@ -0,0 +1,33 @@
+package dblogic
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCountMode(t *testing.T) {
+	for _, c := range []CountMode{"", CountExact, CountNone, CountEstimate} {
+		assert.NoError(t, c.check())
+	}
+	assert.Error(t, CountMode("fast").check())
+}
+
+func TestCountCache(t *testing.T) {
+	c := &countCache{entries: make(map[string]*countEntry)}
+	_, ok := c.get("t_track|exact|map[]")
+	assert.False(t, ok)
+	c.set("t_track|exact|map[]", 10)
+	total, ok := c.get("t_track|exact|map[]")
+	assert.True(t, ok)
+	assert.Equal(t, int64(10), total)
+
+	c.entries["expired"] = &countEntry{total: 1, expire: time.Now().Add(-time.Second)}
+	_, ok = c.get("expired")
+	assert.False(t, ok)
+	for i := 0; i < countCacheMaxSize+10; i++ {
+		c.set(time.Duration(i).String(), int64(i))
+	}
+	assert.True(t, len(c.entries) <= countCacheMaxSize)
+}
@@ -0,0 +1,183 @@
+package dblogic
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"reflect"
+)
+
+/*-------------------------- 游标分页(keyset pagination) -------------------------*/
+//按主键(或白名单排序字段+主键)排序, 以上一页最后一条记录为起点查询, 避免深分页offset扫描
+
+const (
+	defaultCursorPageSize = 100
+	maxCursorPageSize     = 10000
+)
+
+//cursor page, cursor为上一页返回的next_cursor, 为空时从第一页开始
+type CursorPage struct {
+	Cursor string `json:"cursor,omitempty"`
+	SortBy string `json:"sortBy,omitempty"` //排序字段, 默认主键
+	Desc   bool   `json:"desc,omitempty"`
+	Size   int64  `json:"size,omitempty"`
+}
+
+//游标内容, 编码后对调用方不透明
+type cursorToken struct {
+	SortBy string      `json:"s"`
+	Desc   bool        `json:"d,omitempty"`
+	Value  interface{} `json:"v"`
+	Key    interface{} `json:"k"`
+}
+
+func encodeCursor(token *cursorToken) (string, error) {
+	data, err := json.Marshal(token)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+func decodeCursor(cursor string) (*cursorToken, error) {
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cursor")
+	}
+	token := &cursorToken{}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber() //避免大整数精度丢失
+	if err = dec.Decode(token); err != nil {
+		return nil, fmt.Errorf("invalid cursor")
+	}
+	return token, nil
+}
+
+//游标分页条件及排序
+func (cp *CursorPage) build(wl map[string]bool, pk string) (where string, args []interface{},
+	orders []string, err error) {
+	if len(cp.SortBy) == 0 {
+		cp.SortBy = pk
+	}
+	sortColumn, err := checkQueryField(wl, cp.SortBy)
+	if err != nil {
+		return "", nil, nil, err
+	}
+	pkColumn := fmt.Sprintf("`%s`", pk)
+	op, dir := ">", ""
+	if cp.Desc {
+		op, dir = "<", " DESC"
+	}
+	orders = []string{sortColumn + dir}
+	if cp.SortBy != pk {
+		orders = append(orders, pkColumn+dir)
+	}
+	if len(cp.Cursor) == 0 {
+		return "", nil, orders, nil
+	}
+	token, err := decodeCursor(cp.Cursor)
+	if err != nil {
+		return "", nil, nil, err
+	}
+	if token.SortBy != cp.SortBy || token.Desc != cp.Desc {
+		return "", nil, nil, fmt.Errorf("cursor not match sort %s", cp.SortBy)
+	}
+	if cp.SortBy == pk {
+		return fmt.Sprintf("%s %s ?", pkColumn, op), []interface{}{token.Key}, orders, nil
+	}
+	where = fmt.Sprintf("(%s %s ? OR (%s = ? AND %s %s ?))", sortColumn, op, sortColumn, pkColumn, op)
+	return where, []interface{}{token.Value, token.Value, token.Key}, orders, nil
+}
+
+//根据当前页最后一条记录生成下一页游标
+func (bd *BaseDriver) nextCursor(cp *CursorPage, pk string, last interface{}) (string, error) {
+	scope := bd.opDB.NewScope(last)
+	token := &cursorToken{SortBy: cp.SortBy, Desc: cp.Desc}
+	if f, ok := scope.FieldByName(pk); ok {
+		token.Key = f.Field.Interface()
+	}
+	if f, ok := scope.FieldByName(cp.SortBy); ok {
+		token.Value = f.Field.Interface()
+	}
+	return encodeCursor(token)
+}
+
+//通用model游标分页查询, q与conds为可选的查询条件, 返回下一页游标(无更多数据时为空)
+func (bd *BaseDriver) QueryWithCursor(model interface{}, pk string, q *QueryDSL,
+	conds map[string]interface{}, cp *CursorPage) ([]interface{}, string, error) {
+	if cp == nil {
+		cp = &CursorPage{}
+	}
+	if cp.Size <= 0 {
+		cp.Size = defaultCursorPageSize
+	}
+	if cp.Size > maxCursorPageSize {
+		cp.Size = maxCursorPageSize
+	}
+	if q != nil && len(q.OrderBy) != 0 {
+		return nil, "", fmt.Errorf("cursor paging not support orderBy, use sortBy instead")
+	}
+	cq, err := q.compile(model)
+	if err != nil {
+		return nil, "", err
+	}
+	wl, _ := queryColumns(model)
+	where, args, orders, err := cp.build(wl, pk)
+	if err != nil {
+		return nil, "", err
+	}
+	db := bd.readDB().Model(model)
+	if len(conds) != 0 {
+		db = db.Where(conds)
+	}
+	if len(cq.where) != 0 {
+		db = db.Where(cq.where, cq.args...)
+	}
+	if len(where) != 0 {
+		db = db.Where(where, args...)
+	}
+	if len(cq.selects) != 0 { //游标字段需在查询结果中
+		selects := cq.selects
+		for _, c := range []string{pk, cp.SortBy} {
+			if column := fmt.Sprintf("`%s`", c); !containsString(selects, column) {
+				selects = append(selects, column)
+			}
+		}
+		db = db.Select(selects)
+	} else if db, err = bd.selectFields(db, model, pk, cp.SortBy); err != nil {
+		return nil, "", err
+	}
+	for _, o := range orders {
+		db = db.Order(o)
+	}
+	rows, err := db.Limit(cp.Size + 1).Rows()
+	if err != nil {
+		return nil, "", err
+	}
+	defer rows.Close()
+	modelType := reflect.TypeOf(model)
+	res := make([]interface{}, 0, cp.Size)
+	for rows.Next() {
+		t := reflect.New(modelType.Elem()).Interface()
+		if err = bd.opDB.ScanRows(rows, t); err != nil {
+			return nil, "", err
+		}
+		res = append(res, t)
+	}
+	if int64(len(res)) <= cp.Size {
+		return res, "", nil
+	}
+	res = res[:cp.Size]
+	next, err := bd.nextCursor(cp, pk, res[len(res)-1])
+	return res, next, err
+}
+
+func containsString(ss []string, s string) bool {
+	for _, v := range ss {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,41 @@
+package dblogic
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	m "github.com/store_server/dbtools/models"
+)
+
+func TestCursorPageBuild(t *testing.T) {
+	wl, err := queryColumns(&m.Track{})
+	assert.NoError(t, err)
+
+	cp := &CursorPage{}
+	where, args, orders, err := cp.build(wl, "Ftrack_id")
+	assert.NoError(t, err)
+	assert.Empty(t, where)
+	assert.Nil(t, args)
+	assert.Equal(t, []string{"`Ftrack_id`"}, orders)
+
+	cursor, err := encodeCursor(&cursorToken{SortBy: "Fmodify_time", Desc: true, Value: "2020-10-01 00:00:00", Key: 12345})
+	assert.NoError(t, err)
+	cp = &CursorPage{Cursor: cursor, SortBy: "Fmodify_time", Desc: true}
+	where, args, orders, err = cp.build(wl, "Ftrack_id")
+	assert.NoError(t, err)
+	assert.Equal(t, "(`Fmodify_time` < ? OR (`Fmodify_time` = ? AND `Ftrack_id` < ?))", where)
+	assert.Equal(t, []interface{}{"2020-10-01 00:00:00", "2020-10-01 00:00:00", json.Number("12345")}, args)
+	assert.Equal(t, []string{"`Fmodify_time` DESC", "`Ftrack_id` DESC"}, orders)
+
+	cp = &CursorPage{Cursor: cursor, SortBy: "Fmodify_time"}
+	_, _, _, err = cp.build(wl, "Ftrack_id")
+	assert.Error(t, err)
+	cp = &CursorPage{Cursor: "not a cursor"}
+	_, _, _, err = cp.build(wl, "Ftrack_id")
+	assert.Error(t, err)
+	cp = &CursorPage{SortBy: "rand()"}
+	_, _, _, err = cp.build(wl, "Ftrack_id")
+	assert.Error(t, err)
+}
@@ -0,0 +1,84 @@
+package dblogic
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/jinzhu/gorm"
+)
+
+/*-------------------------- 字段投影(sparse fields) -------------------------*/
+//仅查询并返回调用方指定的字段, 字段名为model的gorm column
+
+//校验投影字段并返回select字段列表, fields为空时返回空
+func SelectColumns(model interface{}, fields []string) ([]string, error) {
+	if len(fields) == 0 {
+		return nil, nil
+	}
+	columns := make(map[string]bool)
+	for _, c := range modelColumns(model) {
+		columns[c] = true
+	}
+	selects := make([]string, 0, len(fields))
+	for _, f := range fields {
+		if !columns[f] {
+			return nil, fmt.Errorf("select field[%s] not in %s", f, modelTableName(model))
+		}
+		if column := fmt.Sprintf("`%s`", f); !containsString(selects, column) {
+			selects = append(selects, column)
+		}
+	}
+	return selects, nil
+}
+
+//按投影字段裁剪查询结果, rows为model指针切片, 返回以json字段名为key的记录
+func TrimFields(rows interface{}, fields []string) []map[string]interface{} {
+	selected := make(map[string]bool, len(fields))
+	for _, f := range fields {
+		selected[f] = true
+	}
+	rv := reflect.ValueOf(rows)
+	res := make([]map[string]interface{}, 0, rv.Len())
+	for i := 0; i < rv.Len(); i++ {
+		row := reflect.Indirect(rv.Index(i))
+		if !row.IsValid() {
+			continue
+		}
+		trimmed := make(map[string]interface{}, len(fields))
+		for j := 0; j < row.NumField(); j++ {
+			sf := row.Type().Field(j)
+			if !selected[gormColumn(sf)] {
+				continue
+			}
+			name := strings.Split(sf.Tag.Get("json"), ",")[0]
+			if len(name) == 0 {
+				name = sf.Name
+			}
+			trimmed[name] = row.Field(j).Interface()
+		}
+		res = append(res, trimmed)
+	}
+	return res
+}
+
+//携带投影字段的driver副本, 单次请求内使用
+func (bd *BaseDriver) withFields(fields []string) *BaseDriver {
+	cv := *bd
+	cv.fields = fields
+	return &cv
+}
+
+//为查询附加投影字段, extra为必须查询的字段(如游标分页的排序字段)
+func (bd *BaseDriver) selectFields(db *gorm.DB, model interface{}, extra ...string) (*gorm.DB, error) {
+	selects, err := SelectColumns(model, bd.fields)
+	if err != nil || len(selects) == 0 {
+		return db, err
+	}
+	for _, c := range extra {
+		if column := fmt.Sprintf("`%s`", c); !containsString(selects, column) {
+			selects = append(selects, column)
+		}
+	}
+	return db.Select(selects), nil
+}
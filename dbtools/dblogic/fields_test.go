@@ -0,0 +1,29 @@
+package dblogic
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	m "github.com/store_server/dbtools/models"
+)
+
+func TestSelectAndTrimFields(t *testing.T) {
+	selects, err := SelectColumns(&m.Track{}, nil)
+	assert.NoError(t, err)
+	assert.Nil(t, selects)
+
+	selects, err = SelectColumns(&m.Track{}, []string{"Ftrack_id", "Ftrack_name", "Ftrack_id"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"`Ftrack_id`", "`Ftrack_name`"}, selects)
+
+	_, err = SelectColumns(&m.Track{}, []string{"Ftrack_id", "count(*)"})
+	assert.Error(t, err)
+
+	tracks := []*m.Track{{FtrackId: 1, FtrackName: "a"}, nil, {FtrackId: 2}}
+	rows := TrimFields(tracks, []string{"Ftrack_id", "Ftrack_name"})
+	assert.Equal(t, []map[string]interface{}{
+		{"Ftrack_id": int64(1), "Ftrack_name": "a"},
+		{"Ftrack_id": int64(2), "Ftrack_name": ""},
+	}, rows)
+}
@@ -0,0 +1,358 @@
+package dblogic
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"time"
+
+	m "github.com/store_server/dbtools/models"
+)
+
+/*-------------------------- 变更历史(change history) -------------------------*/
+
+//变更类型
+const (
+	HistoryInsert = "insert"
+	HistoryUpdate = "update"
+	HistoryDelete = "delete"
+
+	modifyTimeColumn = "Fmodify_time"
+)
+
+//op info, 写操作的操作人、请求id及原因, 记录于变更历史及回收站
+type OpInfo struct {
+	Operator  string `json:"operator,omitempty"`
+	RequestId string `json:"requestId,omitempty"`
+	Reason    string `json:"reason,omitempty"`
+}
+
+//字段变更前后的值
+type FieldChange struct {
+	Old interface{} `json:"old"`
+	New interface{} `json:"new"`
+}
+
+//记录序列化方法, 与models中的Encoder/Decoder一致
+type recordCodec interface {
+	Encoder() ([]byte, error)
+	Decoder(value []byte) error
+}
+
+//开启/关闭变更历史记录
+func (bd *BaseDriver) SetHistory(open bool) {
+	bd.history = open
+}
+
+//携带操作信息的driver副本, 单次请求内使用
+func (bd *BaseDriver) withOp(info *OpInfo) *BaseDriver {
+	cv := *bd
+	cv.op = info
+	return &cv
+}
+
+func (bd *BaseDriver) opInfo() *OpInfo {
+	if bd.op == nil {
+		return &OpInfo{}
+	}
+	return bd.op
+}
+
+//记录所有字段值, key为数据库字段名
+func (bd *BaseDriver) recordFields(row interface{}) map[string]interface{} {
+	fields := make(map[string]interface{})
+	for _, f := range bd.opDB.NewScope(row).Fields() {
+		if !f.IsNormal || f.IsIgnored {
+			continue
+		}
+		fields[f.DBName] = f.Field.Interface()
+	}
+	return fields
+}
+
+func (rt *recordTable) keyValues(fields map[string]interface{}) []interface{} {
+	vals := make([]interface{}, 0, len(rt.keys))
+	for _, k := range rt.keys {
+		vals = append(vals, fields[k])
+	}
+	return vals
+}
+
+func (rt *recordTable) keyConds(fields map[string]interface{}) map[string]interface{} {
+	conds := make(map[string]interface{})
+	for _, k := range rt.keys {
+		conds[k] = fields[k]
+	}
+	return conds
+}
+
+func isZeroValue(v interface{}) bool {
+	return v == nil || reflect.ValueOf(v).IsZero()
+}
+
+//对比变更前后字段, insert/delete时只记录非零值字段
+func diffFields(before, after map[string]interface{}) map[string]*FieldChange {
+	changes := make(map[string]*FieldChange)
+	for c, v := range before {
+		nv, ok := after[c]
+		if !ok {
+			if !isZeroValue(v) {
+				changes[c] = &FieldChange{Old: v}
+			}
+			continue
+		}
+		if !reflect.DeepEqual(v, nv) {
+			changes[c] = &FieldChange{Old: v, New: nv}
+		}
+	}
+	for c, nv := range after {
+		if _, ok := before[c]; !ok && !isZeroValue(nv) {
+			changes[c] = &FieldChange{New: nv}
+		}
+	}
+	return changes
+}
+
+func encodeRecord(row interface{}) (string, error) {
+	if row == nil {
+		return "", nil
+	}
+	var data []byte
+	var err error
+	if c, ok := row.(recordCodec); ok {
+		data, err = c.Encoder()
+	} else {
+		data, err = json.Marshal(row)
+	}
+	return string(data), err
+}
+
+func decodeRecord(rt *recordTable, data string) (interface{}, error) {
+	if len(data) == 0 {
+		return nil, fmt.Errorf("record snapshot is empty")
+	}
+	row := rt.newModel()
+	if c, ok := row.(recordCodec); ok {
+		return row, c.Decoder([]byte(data))
+	}
+	return row, json.Unmarshal([]byte(data), row)
+}
+
+//写入一条变更历史, insert时before为空, delete时after为空, 需在写事务内调用
+func (bd *BaseDriver) writeHistory(action, table string, before, after interface{}) error {
+	rt, ok := recordTables[table]
+	if !bd.history || !ok {
+		return nil
+	}
+	var beforeFields, afterFields, keyFields map[string]interface{}
+	if before != nil {
+		beforeFields = bd.recordFields(before)
+		keyFields = beforeFields
+	}
+	if after != nil {
+		afterFields = bd.recordFields(after)
+		keyFields = afterFields
+	}
+	changes := diffFields(beforeFields, afterFields)
+	if action == HistoryUpdate && len(changes) == 0 { //未实际变更
+		return nil
+	}
+	info := bd.opInfo()
+	keyVals := rt.keyValues(keyFields)
+	h := &m.History{
+		Ftable:      table,
+		FrecordKey:  keyString(keyVals),
+		Faction:     action,
+		Foperator:   info.Operator,
+		FrequestId:  info.RequestId,
+		FcreateTime: m.TimeNormal{time.Now()},
+	}
+	h.FrecordId, _ = keyVals[0].(int64)
+	data, err := json.Marshal(changes)
+	if err != nil {
+		return err
+	}
+	h.Fchanges = string(data)
+	if h.Fbefore, err = encodeRecord(before); err != nil {
+		return err
+	}
+	if h.Fafter, err = encodeRecord(after); err != nil {
+		return err
+	}
+	return bd.opDB.Create(h).Error
+}
+
+//查询并锁定待变更记录, 返回model指针列表
+func (bd *BaseDriver) lockRecords(model interface{}, where ...interface{}) ([]interface{}, error) {
+	rows := reflect.New(reflect.SliceOf(reflect.TypeOf(model)))
+	if err := forUpdate(bd.opDB).Find(rows.Interface(), where...).Error; err != nil {
+		return nil, err
+	}
+	rows = rows.Elem()
+	res := make([]interface{}, 0, rows.Len())
+	for i := 0; i < rows.Len(); i++ {
+		res = append(res, rows.Index(i).Interface())
+	}
+	return res, nil
+}
+
+//按唯一键查询记录, 返回唯一键 -> 记录
+func (bd *BaseDriver) recordsByKeys(rt *recordTable, keyVals [][]interface{}) (map[string]interface{}, error) {
+	res := make(map[string]interface{})
+	if len(keyVals) == 0 {
+		return res, nil
+	}
+	where, arg := keysWhere(rt.keys, keyVals)
+	rows, err := bd.lockRecords(rt.newModel(), where, arg)
+	if err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		res[keyString(rt.keyValues(bd.recordFields(row)))] = row
+	}
+	return res, nil
+}
+
+//写操作前查询待变更记录, 未开启变更历史时返回空
+func (bd *BaseDriver) historyBefore(model interface{}, where ...interface{}) ([]interface{}, error) {
+	if _, ok := recordTables[modelTableName(model)]; !bd.history || !ok {
+		return nil, nil
+	}
+	return bd.lockRecords(model, where...)
+}
+
+//update后按唯一键重新查询记录, 与更新前对比写入变更历史
+func (bd *BaseDriver) historyAfterUpdate(model interface{}, before []interface{}) error {
+	if len(before) == 0 {
+		return nil
+	}
+	table := modelTableName(model)
+	rt := recordTables[table]
+	keyVals := make([][]interface{}, 0, len(before))
+	for _, row := range before {
+		keyVals = append(keyVals, rt.keyValues(bd.recordFields(row)))
+	}
+	after, err := bd.recordsByKeys(rt, keyVals)
+	if err != nil {
+		return err
+	}
+	for i, row := range before {
+		if err = bd.writeHistory(HistoryUpdate, table, row, after[keyString(keyVals[i])]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//insert后写入变更历史, value可为单条记录或记录切片
+func (bd *BaseDriver) historyAfterInsert(value interface{}) error {
+	rv := reflect.Indirect(reflect.ValueOf(value))
+	if rv.Kind() != reflect.Slice {
+		return bd.writeHistory(HistoryInsert, modelTableName(value), nil, value)
+	}
+	for i := 0; i < rv.Len(); i++ {
+		row := rv.Index(i).Interface()
+		if err := bd.writeHistory(HistoryInsert, modelTableName(row), nil, row); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//查询变更历史, recordId/requestId为可选条件, 按时间倒序
+func (bd *BaseDriver) QueryHistory(tables []string, recordId int64, requestId string,
+	page, pagesize int64) ([]*m.History, int64, error) {
+	if page <= 0 {
+		page = 1
+	}
+	if pagesize <= 0 {
+		pagesize = 100
+	}
+	db := bd.readDB().Model(&m.History{}).Where("Ftable in (?)", tables)
+	if recordId != 0 {
+		db = db.Where("Frecord_id = ?", recordId)
+	}
+	if len(requestId) != 0 {
+		db = db.Where("Frequest_id = ?", requestId)
+	}
+	var total int64
+	if err := db.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	histories := make([]*m.History, 0)
+	err := db.Order("Fid DESC").Offset((page - 1) * pagesize).Limit(pagesize).Find(&histories).Error
+	return histories, total, err
+}
+
+//回滚到变更前版本: insert删除记录, delete重新插入记录, update恢复变更字段的旧值;
+//经由常规写入路径执行, 同样记录变更历史, 含Fversion的记录在版本不一致时返回ConflictError
+func (bd *BaseDriver) RollbackHistory(tables []string, historyId int64) (int64, error) {
+	h := &m.History{}
+	if err := bd.opDB.Where("Fid = ? AND Ftable in (?)", historyId, tables).First(h).Error; err != nil {
+		return 0, err
+	}
+	rt, ok := recordTables[h.Ftable]
+	if !ok {
+		return 0, fmt.Errorf("table %s not support rollback", h.Ftable)
+	}
+	bd = bd.withValidation([]string{SkipAllRules}) //恢复历史数据, 不做写入校验
+	switch h.Faction {
+	case HistoryInsert:
+		after, err := decodeRecord(rt, h.Fafter)
+		if err != nil {
+			return 0, err
+		}
+		return bd.DeleteWithModel(rt.newModel(), rt.keyConds(bd.recordFields(after)))
+	case HistoryDelete:
+		before, err := decodeRecord(rt, h.Fbefore)
+		if err != nil {
+			return 0, err
+		}
+		return bd.InsertWithModel(before)
+	case HistoryUpdate:
+		return bd.rollbackUpdate(rt, h)
+	}
+	return 0, fmt.Errorf("history action[%s] not support rollback", h.Faction)
+}
+
+func (bd *BaseDriver) rollbackUpdate(rt *recordTable, h *m.History) (int64, error) {
+	before, err := decodeRecord(rt, h.Fbefore)
+	if err != nil {
+		return 0, err
+	}
+	after, err := decodeRecord(rt, h.Fafter)
+	if err != nil {
+		return 0, err
+	}
+	changes := make(map[string]*FieldChange)
+	if err = json.Unmarshal([]byte(h.Fchanges), &changes); err != nil {
+		return 0, err
+	}
+	fields := bd.recordFields(before)
+	attrs := make(map[string]interface{})
+	for c := range changes {
+		if c == versionColumn || c == modifyTimeColumn {
+			continue
+		}
+		attrs[c] = fields[c]
+	}
+	if len(attrs) == 0 {
+		return 0, fmt.Errorf("history[%d] has nothing to rollback", h.Fid)
+	}
+	model := rt.newModel()
+	if modelHasColumn(model, modifyTimeColumn) {
+		attrs[modifyTimeColumn] = m.TimeNormal{time.Now()}
+	}
+	var pre *UpdatePrecond
+	if v, ok := bd.recordFields(after)[versionColumn].(int64); ok { //变更后已被再次修改时冲突
+		pre = &UpdatePrecond{Version: &v}
+	}
+	affected, err := bd.UpdateWithPrecond(model, pre, 1, rt.keyConds(fields), attrs)
+	if err != nil {
+		return 0, err
+	}
+	if affected == 0 {
+		return 0, fmt.Errorf("record %s of %s not found", h.FrecordKey, h.Ftable)
+	}
+	return affected, nil
+}
@@ -0,0 +1,48 @@
+package dblogic
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHistoryDiffFields(t *testing.T) {
+	before := map[string]interface{}{"Ftrack_id": int64(1), "Ftrack_name": "a", "Fversion": int64(1)}
+	after := map[string]interface{}{"Ftrack_id": int64(1), "Ftrack_name": "b", "Fversion": int64(2)}
+	changes := diffFields(before, after)
+	assert.Len(t, changes, 2)
+	assert.Equal(t, &FieldChange{Old: "a", New: "b"}, changes["Ftrack_name"])
+	assert.Equal(t, &FieldChange{Old: int64(1), New: int64(2)}, changes["Fversion"])
+
+	changes = diffFields(nil, map[string]interface{}{"Ftrack_id": int64(1), "Ftrack_name": ""})
+	assert.Equal(t, map[string]*FieldChange{"Ftrack_id": {New: int64(1)}}, changes)
+	changes = diffFields(before, nil)
+	assert.Len(t, changes, 3)
+	assert.Nil(t, changes["Ftrack_name"].New)
+
+	rt := recordTables["t_track_extra_os"]
+	fields := map[string]interface{}{"Ftrack_id": int64(1), "Fregion": int64(2), "Fstatus": 1}
+	assert.Equal(t, "1|2", keyString(rt.keyValues(fields)))
+	assert.Equal(t, map[string]interface{}{"Ftrack_id": int64(1), "Fregion": int64(2)}, rt.keyConds(fields))
+}
+
+//视频写入的变更历史按自增id记录, 可按id查询并回滚
+func TestVideoInsertHistory(t *testing.T) {
+	voSetup()
+	defer voCleanup()
+	videosDriver.SetHistory(true)
+	id, err := videosDriver.WithOp(&OpInfo{Operator: "tester"}).InsertOneVideo(genVideoExample())
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), id)
+	histories, total, err := videosDriver.GetVideoHistory(id, "", 1, 10)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), total)
+	assert.Equal(t, id, histories[0].FrecordId)
+	assert.Equal(t, HistoryInsert, histories[0].Faction)
+	assert.Equal(t, "tester", histories[0].Foperator)
+
+	_, err = videosDriver.RollbackVideoHistory(histories[0].Fid)
+	assert.NoError(t, err)
+	_, err = videosDriver.GetOneVideo(id)
+	assert.Error(t, err)
+}
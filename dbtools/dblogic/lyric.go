@@ -0,0 +1,533 @@
+package dblogic
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/jinzhu/gorm"
+	"github.com/store_server/dbtools/driver"
+	"github.com/store_server/logger"
+
+	m "github.com/store_server/dbtools/models"
+)
+
+/*-------------------------- 歌词存储 -------------------------*/
+//普通歌词(lrc/plain)存于LyricDB, 逐字歌词(karaoke)存于KlyricDB; 每次上传及删除版本号加1并记录于t_lyric_version,
+//普通歌词写入/删除后同步t_track.Flyric标识, t_track与歌词不同库, 同步失败时加入重试队列, 不影响歌词写入结果
+
+const (
+	LyricFormatLrc     = "lrc"
+	LyricFormatPlain   = "plain"
+	LyricFormatKaraoke = "karaoke"
+
+	LyricRegionDefault = 0       //默认地区, 指定地区无歌词时回退
+	maxLyricSize       = 1 << 20 //歌词内容最大字节数
+
+	lyricFlagNone  = 0
+	lyricFlagExist = 1
+
+	LyricActionUpload = "upload"
+	LyricActionDelete = "delete"
+
+	lyricFlagRetryInterval = time.Minute
+)
+
+//期望的版本号不为0但歌词不存在(未上传或已删除)
+var ErrLyricNotFound = errors.New("lyric not found, upload with version 0 to create it")
+
+var (
+	lrcTimeTag    = regexp.MustCompile(`^\[(\d{1,3}):(\d{1,2})(?:[.:](\d{1,3}))?\]`)
+	lrcMetaTag    = regexp.MustCompile(`(?i)^\[(ar|ti|al|by|au|re|ve|length|offset|#):[^\]]*\]$`)
+	karaokeLine   = regexp.MustCompile(`^\[(\d+),(\d+)\](.*)$`)
+	karaokeWord   = regexp.MustCompile(`^([^()]*)\((\d+),(\d+)\)`)
+	lyricLineTrim = strings.NewReplacer("\r\n", "\n", "\r", "\n")
+)
+
+//歌词格式错误, line为出错行号(从1开始), 0表示整体错误
+type LyricFormatError struct {
+	Format string
+	Line   int
+	Reason string
+}
+
+func (e *LyricFormatError) Error() string {
+	if e.Line > 0 {
+		return fmt.Sprintf("invalid %s lyric at line %d: %s", e.Format, e.Line, e.Reason)
+	}
+	return fmt.Sprintf("invalid %s lyric: %s", e.Format, e.Reason)
+}
+
+func IsLyricFormatError(err error) bool {
+	_, ok := err.(*LyricFormatError)
+	return ok
+}
+
+//统一换行符并去除BOM
+func NormalizeLyric(content string) string {
+	content = strings.TrimPrefix(content, "\ufeff")
+	return lyricLineTrim.Replace(content)
+}
+
+//校验歌词格式, content需已NormalizeLyric
+func ValidateLyric(format, content string) error {
+	switch format {
+	case LyricFormatLrc, LyricFormatPlain, LyricFormatKaraoke:
+	default:
+		return &LyricFormatError{Format: format, Reason: "unknown lyric format"}
+	}
+	if len(strings.TrimSpace(content)) == 0 {
+		return &LyricFormatError{Format: format, Reason: "content is empty"}
+	}
+	if len(content) > maxLyricSize {
+		return &LyricFormatError{Format: format, Reason: fmt.Sprintf("content exceeds %d bytes", maxLyricSize)}
+	}
+	if !utf8.ValidString(content) {
+		return &LyricFormatError{Format: format, Reason: "content is not valid utf8"}
+	}
+	switch format {
+	case LyricFormatLrc:
+		return validateLrc(content)
+	case LyricFormatKaraoke:
+		return validateKaraoke(content)
+	}
+	return nil
+}
+
+//lrc: 元信息行[ar:xx]或以一个及以上时间标签[mm:ss.xx]开头的歌词行, 至少包含一行歌词
+func validateLrc(content string) error {
+	timed := 0
+	for i, line := range strings.Split(content, "\n") {
+		line = strings.TrimSpace(line)
+		if len(line) == 0 || lrcMetaTag.MatchString(line) {
+			continue
+		}
+		tags := 0
+		for {
+			match := lrcTimeTag.FindStringSubmatch(line)
+			if match == nil {
+				break
+			}
+			if sec, _ := strconv.Atoi(match[2]); sec >= 60 {
+				return &LyricFormatError{Format: LyricFormatLrc, Line: i + 1, Reason: "seconds of time tag should be less than 60"}
+			}
+			line = line[len(match[0]):]
+			tags++
+		}
+		if tags == 0 {
+			return &LyricFormatError{Format: LyricFormatLrc, Line: i + 1, Reason: "time tag or meta tag needed"}
+		}
+		timed++
+	}
+	if timed == 0 {
+		return &LyricFormatError{Format: LyricFormatLrc, Reason: "no timed line"}
+	}
+	return nil
+}
+
+//karaoke: 元信息行或[行开始毫秒,行时长]字(开始毫秒,时长)...格式的逐字歌词行, 至少包含一行歌词
+func validateKaraoke(content string) error {
+	timed := 0
+	for i, line := range strings.Split(content, "\n") {
+		line = strings.TrimSpace(line)
+		if len(line) == 0 || lrcMetaTag.MatchString(line) {
+			continue
+		}
+		match := karaokeLine.FindStringSubmatch(line)
+		if match == nil {
+			return &LyricFormatError{Format: LyricFormatKaraoke, Line: i + 1, Reason: "line timing [start,duration] needed"}
+		}
+		words, rest := 0, match[3]
+		for len(rest) > 0 {
+			word := karaokeWord.FindStringSubmatch(rest)
+			if word == nil {
+				return &LyricFormatError{Format: LyricFormatKaraoke, Line: i + 1, Reason: "word timing (start,duration) needed"}
+			}
+			rest = rest[len(word[0]):]
+			words++
+		}
+		if words == 0 {
+			return &LyricFormatError{Format: LyricFormatKaraoke, Line: i + 1, Reason: "no timed word"}
+		}
+		timed++
+	}
+	if timed == 0 {
+		return &LyricFormatError{Format: LyricFormatKaraoke, Reason: "no timed line"}
+	}
+	return nil
+}
+
+//t_track.Flyric同步失败的歌曲及操作信息, 等待重试
+type lyricFlagQueue struct {
+	sync.Mutex
+	pending map[int64]*OpInfo
+}
+
+func (q *lyricFlagQueue) add(trackId int64, info *OpInfo) {
+	q.Lock()
+	defer q.Unlock()
+	q.pending[trackId] = info
+}
+
+func (q *lyricFlagQueue) snapshot() map[int64]*OpInfo {
+	q.Lock()
+	defer q.Unlock()
+	pending := make(map[int64]*OpInfo, len(q.pending))
+	for k, v := range q.pending {
+		pending[k] = v
+	}
+	return pending
+}
+
+//重试成功后移除, 期间再次失败(info已变化)的保留
+func (q *lyricFlagQueue) done(trackId int64, info *OpInfo) {
+	q.Lock()
+	defer q.Unlock()
+	if q.pending[trackId] == info {
+		delete(q.pending, trackId)
+	}
+}
+
+func (q *lyricFlagQueue) size() int {
+	q.Lock()
+	defer q.Unlock()
+	return len(q.pending)
+}
+
+//JOOX CMS LYRIC相关操作
+type LyricsDriver struct {
+	*driver.CMSDriver
+	tracks  *TracksDriver
+	op      *OpInfo
+	primary bool //查询使用主库(读己之写)
+	flags   *lyricFlagQueue
+	lock    sync.RWMutex
+}
+
+//td用于同步t_track.Flyric
+func NewLyricsDriver(cmsDriver *driver.CMSDriver, td *TracksDriver) *LyricsDriver {
+	return &LyricsDriver{CMSDriver: cmsDriver, tracks: td, flags: &lyricFlagQueue{pending: make(map[int64]*OpInfo)}}
+}
+
+//携带操作人及请求id的driver副本, 记录于歌词版本及t_track变更历史
+func (ld *LyricsDriver) WithOp(info *OpInfo) *LyricsDriver {
+	return &LyricsDriver{CMSDriver: ld.CMSDriver, tracks: ld.tracks, op: info, primary: ld.primary, flags: ld.flags}
+}
+
+func (ld *LyricsDriver) WithPrimary(on bool) *LyricsDriver { //读主库
+	return &LyricsDriver{CMSDriver: ld.CMSDriver, tracks: ld.tracks, op: ld.op, primary: on, flags: ld.flags}
+}
+
+var (
+	LyDriver *LyricsDriver
+)
+
+func (ld *LyricsDriver) opInfo() *OpInfo {
+	if ld.op == nil {
+		return &OpInfo{}
+	}
+	return ld.op
+}
+
+//歌词所在库, karaoke为true时为逐字歌词库
+func (ld *LyricsDriver) lyricDB(karaoke bool) (*gorm.DB, error) {
+	db, name := ld.LyricDB, "LyricDB"
+	if karaoke {
+		db, name = ld.KlyricDB, "KlyricDB"
+	}
+	if db == nil {
+		return nil, fmt.Errorf("%s not configured", name)
+	}
+	return db, nil
+}
+
+//歌词查询使用的db, 未要求读己之写时使用健康的从库
+func (ld *LyricsDriver) lyricReadDB(karaoke bool) (*gorm.DB, error) {
+	db, err := ld.lyricDB(karaoke)
+	if err != nil || ld.primary {
+		return db, err
+	}
+	if karaoke {
+		return ld.ReadDB(driver.KlyricDBName, db), nil
+	}
+	return ld.ReadDB(driver.LyricDBName, db), nil
+}
+
+//获取单曲指定地区歌词, 无该地区歌词时回退默认地区; 未找到时返回nil
+func (ld *LyricsDriver) GetLyric(trackId, region int64, karaoke bool) (*m.Lyric, error) {
+	lyrics, err := ld.GetLyrics([]int64{trackId}, region, karaoke)
+	if err != nil || len(lyrics) == 0 {
+		return nil, err
+	}
+	return lyrics[0], nil
+}
+
+//批量获取歌词, 每首歌曲优先返回指定地区歌词, 否则返回默认地区歌词
+func (ld *LyricsDriver) GetLyrics(trackIds []int64, region int64, karaoke bool) ([]*m.Lyric, error) {
+	if len(trackIds) == 0 {
+		return nil, fmt.Errorf("track ids is empty")
+	}
+	db, err := ld.lyricReadDB(karaoke)
+	if err != nil {
+		return nil, err
+	}
+	rows := make([]*m.Lyric, 0)
+	err = db.Where("Ftrack_id in (?) AND Fregion in (?)", trackIds, []int64{region, LyricRegionDefault}).
+		Find(&rows).Error
+	if err != nil {
+		logger.Entry().Errorf("get lyrics err: %v|trackIds: %v|region: %d", err, trackIds, region)
+		return nil, err
+	}
+	picked := make(map[int64]*m.Lyric, len(rows))
+	for _, row := range rows {
+		if cur, ok := picked[row.FtrackId]; !ok || cur.Fregion != region {
+			picked[row.FtrackId] = row
+		}
+	}
+	lyrics := make([]*m.Lyric, 0, len(picked))
+	for _, id := range trackIds {
+		if lyric, ok := picked[id]; ok {
+			lyrics = append(lyrics, lyric)
+			delete(picked, id)
+		}
+	}
+	return lyrics, nil
+}
+
+//获取歌词指定版本, 未找到时返回nil
+func (ld *LyricsDriver) GetLyricVersion(trackId, region, version int64, karaoke bool) (*m.LyricVersion, error) {
+	db, err := ld.lyricReadDB(karaoke)
+	if err != nil {
+		return nil, err
+	}
+	lv := &m.LyricVersion{}
+	err = db.Where("Ftrack_id = ? AND Fregion = ? AND Fversion = ?", trackId, region, version).First(lv).Error
+	if gorm.IsRecordNotFoundError(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return lv, nil
+}
+
+//获取歌词版本列表, 按版本号倒序, withContent为false时不返回歌词内容
+func (ld *LyricsDriver) GetLyricVersions(trackId, region int64, karaoke, withContent bool) ([]*m.LyricVersion, error) {
+	db, err := ld.lyricReadDB(karaoke)
+	if err != nil {
+		return nil, err
+	}
+	if !withContent {
+		db = db.Select("`Fid`, `Ftrack_id`, `Fregion`, `Fversion`, `Fformat`, `Foperator`, `Frequest_id`, `Faction`, `Fcreate_time`")
+	}
+	versions := make([]*m.LyricVersion, 0)
+	err = db.Where("Ftrack_id = ? AND Fregion = ?", trackId, region).Order("Fversion desc").Find(&versions).Error
+	if err != nil {
+		return nil, err
+	}
+	return versions, nil
+}
+
+//上传歌词, version不为nil时要求当前版本号与之相等, 否则返回ConflictError(Current为当前歌词),
+//歌词不存在时返回ErrLyricNotFound; 返回写入后的歌词
+func (ld *LyricsDriver) UploadLyric(lyric *m.Lyric, version *int64) (*m.Lyric, error) {
+	if lyric == nil || lyric.FtrackId <= 0 {
+		return nil, fmt.Errorf("invalid lyric or track id")
+	}
+	lyric.Fcontent = NormalizeLyric(lyric.Fcontent)
+	if err := ValidateLyric(lyric.Fformat, lyric.Fcontent); err != nil {
+		return nil, err
+	}
+	karaoke := lyric.Fformat == LyricFormatKaraoke
+	db, err := ld.lyricDB(karaoke)
+	if err != nil {
+		return nil, err
+	}
+	info := ld.opInfo()
+	tx := db.Begin()
+	if tx.Error != nil {
+		return nil, tx.Error
+	}
+	current := &m.Lyric{}
+	err = forUpdate(tx).
+		Where("Ftrack_id = ? AND Fregion = ?", lyric.FtrackId, lyric.Fregion).First(current).Error
+	exist := err == nil
+	if err != nil && !gorm.IsRecordNotFoundError(err) {
+		tx.Rollback()
+		return nil, err
+	}
+	if version != nil && ((exist && current.Fversion != *version) || (!exist && *version != 0)) {
+		tx.Rollback()
+		if !exist {
+			return nil, ErrLyricNotFound
+		}
+		return nil, &ConflictError{Current: current}
+	}
+	now := m.TimeNormal{time.Now()}
+	if exist {
+		lyric.Fid, lyric.Fversion, lyric.FcreateTime = current.Fid, current.Fversion+1, current.FcreateTime
+	} else {
+		lyric.Fid, lyric.FcreateTime = 0, now
+		//删除后重新上传时版本号接续版本记录
+		if lyric.Fversion, err = nextLyricVersion(tx, lyric.FtrackId, lyric.Fregion); err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+	}
+	lyric.Foperator, lyric.FmodifyTime = info.Operator, now
+	if exist {
+		err = tx.Save(lyric).Error
+	} else {
+		err = tx.Create(lyric).Error
+	}
+	if err == nil {
+		err = tx.Create(&m.LyricVersion{
+			FtrackId:    lyric.FtrackId,
+			Fregion:     lyric.Fregion,
+			Fversion:    lyric.Fversion,
+			Fformat:     lyric.Fformat,
+			Fcontent:    lyric.Fcontent,
+			Foperator:   info.Operator,
+			FrequestId:  info.RequestId,
+			Faction:     LyricActionUpload,
+			FcreateTime: now,
+		}).Error
+	}
+	if err != nil {
+		tx.Rollback()
+		logger.Entry().Errorf("upload lyric err: %v|trackId: %d|region: %d", err, lyric.FtrackId, lyric.Fregion)
+		return nil, err
+	}
+	if err = tx.Commit().Error; err != nil {
+		return nil, err
+	}
+	if !karaoke {
+		ld.syncLyricFlagOrRetry(lyric.FtrackId)
+	}
+	return lyric, nil
+}
+
+//版本记录中的最大版本号加1
+func nextLyricVersion(tx *gorm.DB, trackId, region int64) (int64, error) {
+	var max struct {
+		Version int64
+	}
+	err := tx.Model(&m.LyricVersion{}).Select("IFNULL(MAX(`Fversion`), 0) AS version").
+		Where("Ftrack_id = ? AND Fregion = ?", trackId, region).Scan(&max).Error
+	return max.Version + 1, err
+}
+
+//删除单曲指定地区歌词, 记录删除版本(内容为空)及操作人, 历史版本保留; 返回是否删除
+func (ld *LyricsDriver) DeleteLyric(trackId, region int64, karaoke bool) (bool, error) {
+	db, err := ld.lyricDB(karaoke)
+	if err != nil {
+		return false, err
+	}
+	info := ld.opInfo()
+	tx := db.Begin()
+	if tx.Error != nil {
+		return false, tx.Error
+	}
+	current := &m.Lyric{}
+	err = forUpdate(tx).Where("Ftrack_id = ? AND Fregion = ?", trackId, region).First(current).Error
+	if gorm.IsRecordNotFoundError(err) {
+		tx.Rollback()
+		return false, nil
+	}
+	if err == nil {
+		err = tx.Where("Fid = ?", current.Fid).Delete(&m.Lyric{}).Error
+	}
+	if err == nil {
+		err = tx.Create(&m.LyricVersion{
+			FtrackId:    trackId,
+			Fregion:     region,
+			Fversion:    current.Fversion + 1,
+			Fformat:     current.Fformat,
+			Foperator:   info.Operator,
+			FrequestId:  info.RequestId,
+			Faction:     LyricActionDelete,
+			FcreateTime: m.TimeNormal{time.Now()},
+		}).Error
+	}
+	if err != nil {
+		tx.Rollback()
+		logger.Entry().Errorf("delete lyric err: %v|trackId: %d|region: %d", err, trackId, region)
+		return false, err
+	}
+	if err = tx.Commit().Error; err != nil {
+		return false, err
+	}
+	if !karaoke {
+		ld.syncLyricFlagOrRetry(trackId)
+	}
+	return true, nil
+}
+
+//同步t_track.Flyric, 失败时加入重试队列; 歌词已提交, 不向调用方返回错误
+func (ld *LyricsDriver) syncLyricFlagOrRetry(trackId int64) {
+	if err := ld.SyncLyricFlag(trackId); err != nil && ld.flags != nil {
+		logger.Entry().Warnf("sync track lyric flag failed, retry later|trackId: %d|err: %v", trackId, err)
+		ld.flags.add(trackId, ld.opInfo())
+	}
+}
+
+//重试同步失败的t_track.Flyric, 返回仍待重试的歌曲数
+func (ld *LyricsDriver) RetryLyricFlags() int {
+	if ld.flags == nil {
+		return 0
+	}
+	for trackId, info := range ld.flags.snapshot() {
+		if err := ld.WithOp(info).SyncLyricFlag(trackId); err == nil {
+			ld.flags.done(trackId, info)
+		}
+	}
+	return ld.flags.size()
+}
+
+//t_track.Flyric同步重试任务
+func (ld *LyricsDriver) RunLyricFlagRetry(ctx context.Context) {
+	ticker := time.NewTicker(lyricFlagRetryInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if pending := ld.RetryLyricFlags(); pending != 0 {
+			logger.Entry().Warnf("%d tracks wait for lyric flag sync retry", pending)
+		}
+	}
+}
+
+//按普通歌词是否存在同步t_track.Flyric
+func (ld *LyricsDriver) SyncLyricFlag(trackId int64) error {
+	db, err := ld.lyricDB(false)
+	if err != nil {
+		return err
+	}
+	count := int64(0)
+	if err = db.Model(&m.Lyric{}).Where("Ftrack_id = ?", trackId).Count(&count).Error; err != nil {
+		return err
+	}
+	if ld.tracks == nil {
+		return fmt.Errorf("tracks driver not configured")
+	}
+	flag := lyricFlagNone
+	if count > 0 {
+		flag = lyricFlagExist
+	}
+	//经由带版本的更新路径写入, 递增t_track.Fversion, 持有旧版本的编辑提交时返回冲突
+	_, err = ld.tracks.WithOp(ld.opInfo()).UpdateWithPrecond(&m.Track{}, nil, 0, "Ftrack_id = ? AND Flyric <> ?",
+		map[string]interface{}{"Flyric": flag}, trackId, flag)
+	if err != nil {
+		logger.Entry().Errorf("sync track lyric flag err: %v|trackId: %d|flag: %d", err, trackId, flag)
+	}
+	return err
+}
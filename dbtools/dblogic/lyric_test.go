@@ -0,0 +1,79 @@
+package dblogic
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/store_server/dbtools/driver"
+	"github.com/store_server/dbtools/migrate"
+	m "github.com/store_server/dbtools/models"
+)
+
+func TestValidateLyric(t *testing.T) {
+	lrc := NormalizeLyric("\ufeff[ti:song]\r\n[ar:singer]\r\n[00:01.10][01:02.30]hello\r\n\r\n[00:05.00]world")
+	assert.Equal(t, "[ti:song]\n[ar:singer]\n[00:01.10][01:02.30]hello\n\n[00:05.00]world", lrc)
+	assert.NoError(t, ValidateLyric(LyricFormatLrc, lrc))
+	assert.NoError(t, ValidateLyric(LyricFormatPlain, "hello\nworld"))
+	assert.NoError(t, ValidateLyric(LyricFormatKaraoke, "[ti:song]\n[0,1500]hel(0,500)lo(500,1000)\n[1500,800]world(1500,800)"))
+
+	err := ValidateLyric(LyricFormatLrc, "[ti:song]\n[00:01.10]hello\nworld")
+	assert.True(t, IsLyricFormatError(err))
+	assert.Equal(t, 3, err.(*LyricFormatError).Line)
+	assert.Error(t, ValidateLyric(LyricFormatLrc, "[ti:song]\n[ar:singer]"))
+	assert.Error(t, ValidateLyric(LyricFormatLrc, "[00:61.00]hello"))
+	assert.Error(t, ValidateLyric(LyricFormatKaraoke, "[0,1500]hello"))
+	assert.Error(t, ValidateLyric(LyricFormatKaraoke, "[0,1500]hel(0,500)lo"))
+	assert.Error(t, ValidateLyric(LyricFormatPlain, " \n "))
+	assert.Error(t, ValidateLyric("txt", "hello"))
+}
+
+func TestUploadAndDeleteLyric(t *testing.T) {
+	tkSetup()
+	defer tkCleanup()
+	lyricScheme := &driver.Scheme{Mysql: driver.DefaultTestScheme.Mysql, Schema: migrate.LyricSchema}
+	lyricScheme.Setup()
+	defer lyricScheme.Cleanup()
+	//未配置tracks driver, t_track.Flyric同步失败后进入重试队列
+	ld := NewLyricsDriver(&driver.CMSDriver{LyricDB: lyricScheme.DB()}, nil).WithOp(&OpInfo{Operator: "tester"})
+
+	lyric, err := ld.UploadLyric(&m.Lyric{FtrackId: 1, Fformat: LyricFormatPlain, Fcontent: "hello"}, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), lyric.Fversion)
+	assert.Equal(t, 1, ld.flags.size())
+	ld.tracks = tracksDriver
+	assert.Equal(t, 0, ld.RetryLyricFlags())
+	track, err := tracksDriver.GetOneTrack(1)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(lyricFlagExist), track.Flyric)
+	assert.Equal(t, int64(2), track.Fversion) //歌词标记变更递增歌曲版本
+
+	deleted, err := ld.DeleteLyric(1, LyricRegionDefault, false)
+	assert.NoError(t, err)
+	assert.True(t, deleted)
+	deleted, err = ld.DeleteLyric(1, LyricRegionDefault, false)
+	assert.NoError(t, err)
+	assert.False(t, deleted)
+	track, err = tracksDriver.GetOneTrack(1)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(lyricFlagNone), track.Flyric)
+
+	versions, err := ld.GetLyricVersions(1, LyricRegionDefault, false, true)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(versions))
+	assert.Equal(t, LyricActionDelete, versions[0].Faction)
+	assert.Equal(t, "tester", versions[0].Foperator)
+	assert.Equal(t, int64(2), versions[0].Fversion)
+
+	version := int64(2)
+	_, err = ld.UploadLyric(&m.Lyric{FtrackId: 1, Fformat: LyricFormatPlain, Fcontent: "hello"}, &version)
+	assert.Equal(t, ErrLyricNotFound, err)
+	version = 0
+	lyric, err = ld.UploadLyric(&m.Lyric{FtrackId: 1, Fformat: LyricFormatPlain, Fcontent: "world"}, &version)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3), lyric.Fversion) //版本号接续删除版本
+	_, err = ld.UploadLyric(&m.Lyric{FtrackId: 1, Fformat: LyricFormatPlain, Fcontent: "again"}, &version)
+	ce, ok := err.(*ConflictError)
+	assert.True(t, ok)
+	assert.Equal(t, int64(3), ce.Current.(*m.Lyric).Fversion)
+}
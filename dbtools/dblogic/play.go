@@ -0,0 +1,113 @@
+package dblogic
+
+import (
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/store_server/dbtools/common"
+
+	m "github.com/store_server/dbtools/models"
+)
+
+//歌曲播放判定结果码
+const (
+	PlayOk = iota
+	PlayTrackNotFound
+	PlayTrackOffline
+	PlayTrackNotValid
+	PlayRegionNotPublished
+	PlayRegionOffline
+	PlayRegionNotValid
+	PlayNoCopyright
+	PlayCopyrightLimit
+	PlaySourceNoCopyright
+	PlayRegionUnknown
+	PlayNoURL
+)
+
+var PlayReasonMap = map[int]string{
+	PlayOk:                 "ok",
+	PlayTrackNotFound:      "track not found",
+	PlayTrackOffline:       "track offline",
+	PlayTrackNotValid:      "track not reach valid time",
+	PlayRegionNotPublished: "track not published in region",
+	PlayRegionOffline:      "track offline in region",
+	PlayRegionNotValid:     "track not reach local valid time",
+	PlayNoCopyright:        "track has no local copyright",
+	PlayCopyrightLimit:     "track copyright limited in region",
+	PlaySourceNoCopyright:  "track source has no copyright in region",
+	PlayRegionUnknown:      "region code unknown",
+	PlayNoURL:              "no play url",
+}
+
+//track play info
+type TrackPlayInfo struct {
+	TrackId int64 `json:"track_id"`
+	Region  int64 `json:"region"`
+	CanPlay bool  `json:"can_play"`
+	Reason  int   `json:"reason"`
+	Source  int64 `json:"source"`
+}
+
+//根据曲库状态判定歌曲在地区是否可播放, regionCode为地区简码(如HK, TH), 用于匹配来源版权矩阵
+func CheckTrackPlayable(track *m.Track, extra *m.TrackExtraOs, regionCode string, now time.Time) int {
+	if track == nil {
+		return PlayTrackNotFound
+	}
+	if track.Fstatus < 0 {
+		return PlayTrackOffline
+	}
+	if track.FvalidTime.After(now) {
+		return PlayTrackNotValid
+	}
+	if extra == nil {
+		return PlayRegionNotPublished
+	}
+	if extra.FlocalStatus <= 0 {
+		return PlayRegionOffline
+	}
+	if extra.FlocalValidTime.After(now) {
+		return PlayRegionNotValid
+	}
+	if extra.FlocalCopyright <= 0 {
+		return PlayNoCopyright
+	}
+	if extra.FcopyrightLimit > 0 {
+		return PlayCopyrightLimit
+	}
+	if len(regionCode) == 0 {
+		return PlayRegionUnknown
+	}
+	if !common.SourceHasCopyright(int(extra.FlocalFrom), regionCode) {
+		return PlaySourceNoCopyright
+	}
+	return PlayOk
+}
+
+//查询歌曲在指定地区的播放状态
+func (td *TracksDriver) ResolveTrackPlay(id, region int64, regionCode string) (*TrackPlayInfo, error) {
+	info := &TrackPlayInfo{TrackId: id, Region: region}
+	track, err := td.GetOneTrack(id)
+	if err != nil {
+		if !gorm.IsRecordNotFoundError(err) {
+			return nil, err
+		}
+		track = nil
+	}
+	var extra *m.TrackExtraOs
+	if track != nil {
+		extra, err = td.GetOneTrackExtraOs(id, region)
+		if err != nil {
+			if !gorm.IsRecordNotFoundError(err) {
+				return nil, err
+			}
+			extra = nil
+		}
+	}
+	if extra != nil {
+		info.Source = extra.FlocalFrom
+	}
+	info.Reason = CheckTrackPlayable(track, extra, regionCode, time.Now())
+	info.CanPlay = info.Reason == PlayOk
+	return info, nil
+}
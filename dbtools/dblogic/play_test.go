@@ -0,0 +1,62 @@
+package dblogic
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	m "github.com/store_server/dbtools/models"
+)
+
+func TestCheckTrackPlayable(t *testing.T) {
+	now := time.Now()
+	past, future := m.TimeNormal{now.Add(-time.Hour)}, m.TimeNormal{now.Add(time.Hour)}
+	track := &m.Track{FtrackId: 1, FvalidTime: past}
+	extra := &m.TrackExtraOs{FtrackId: 1, Fregion: 1, FlocalStatus: 1, FlocalCopyright: 1,
+		FlocalValidTime: past, FlocalFrom: 6}
+
+	assert.Equal(t, PlayOk, CheckTrackPlayable(track, extra, "HK", now))
+	assert.Equal(t, PlaySourceNoCopyright, CheckTrackPlayable(track, extra, "TH", now))
+	assert.Equal(t, PlayRegionUnknown, CheckTrackPlayable(track, extra, "", now))
+	assert.Equal(t, PlayTrackNotFound, CheckTrackPlayable(nil, extra, "HK", now))
+	assert.Equal(t, PlayRegionNotPublished, CheckTrackPlayable(track, nil, "HK", now))
+
+	extra.FlocalValidTime = future
+	assert.Equal(t, PlayRegionNotValid, CheckTrackPlayable(track, extra, "HK", now))
+	extra.FlocalValidTime, extra.FcopyrightLimit = past, 1
+	assert.Equal(t, PlayCopyrightLimit, CheckTrackPlayable(track, extra, "HK", now))
+	track.Fstatus = -1
+	assert.Equal(t, PlayTrackOffline, CheckTrackPlayable(track, extra, "HK", now))
+}
+
+//地区简码由调用方按配置传入, 未映射的地区判定为地区未知
+func TestResolveTrackPlayRegionCode(t *testing.T) {
+	tkSetup()
+	defer tkCleanup()
+	past := m.TimeNormal{time.Now().Add(-time.Hour)}
+	track := genTrackExample()
+	track.Fstatus, track.FvalidTime = 0, past
+	_, err := tracksDriver.InsertOneTrack(track)
+	assert.NoError(t, err)
+
+	codes := map[int64]string{1: "HK", 4: "TH"}
+	for _, region := range []int64{1, 4, 9} {
+		extra := genTrackExtraOsExample()
+		extra.FtrackId, extra.Fregion = track.FtrackId, region
+		extra.FlocalFrom, extra.FcopyrightLimit, extra.FlocalValidTime = 0, 0, past
+		if _, err := tracksDriver.GetOneTrackExtraOs(extra.FtrackId, extra.Fregion); err != nil {
+			_, err = tracksDriver.InsertOneTrackExtraOs(extra)
+			assert.NoError(t, err)
+		}
+		info, err := tracksDriver.ResolveTrackPlay(track.FtrackId, region, codes[region])
+		assert.NoError(t, err)
+		if len(codes[region]) == 0 {
+			assert.Equal(t, PlayRegionUnknown, info.Reason, "region %d", region)
+			assert.False(t, info.CanPlay)
+			continue
+		}
+		assert.Equal(t, PlayOk, info.Reason, "region %d", region)
+		assert.True(t, info.CanPlay)
+	}
+}
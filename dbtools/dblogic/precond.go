@@ -0,0 +1,146 @@
+package dblogic
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/jinzhu/gorm"
+	"github.com/store_server/logger"
+
+	m "github.com/store_server/dbtools/models"
+)
+
+/*-------------------------- 乐观锁更新(update precondition) -------------------------*/
+
+const versionColumn = "Fversion"
+
+//update precondition, version对应Fversion, modifyTime对应Fmodify_time, 均为空时不校验
+type UpdatePrecond struct {
+	Version    *int64        `json:"version,omitempty"`
+	ModifyTime *m.TimeNormal `json:"modifyTime,omitempty"`
+}
+
+//前置条件不满足时返回的冲突错误, Current为当前记录
+type ConflictError struct {
+	Current interface{}
+}
+
+func (e *ConflictError) Error() string {
+	return "update conflict, record has been modified by others"
+}
+
+func IsConflictError(err error) bool {
+	_, ok := err.(*ConflictError)
+	return ok
+}
+
+func (p *UpdatePrecond) empty() bool {
+	return p == nil || (p.Version == nil && p.ModifyTime == nil)
+}
+
+func (p *UpdatePrecond) apply(db *gorm.DB, hasVersion bool) (*gorm.DB, error) {
+	if p.Version != nil {
+		if !hasVersion {
+			return nil, fmt.Errorf("version precondition not supported, use modifyTime instead")
+		}
+		db = db.Where("`Fversion` = ?", *p.Version)
+	}
+	if p.ModifyTime != nil {
+		db = db.Where("`Fmodify_time` = ?", *p.ModifyTime)
+	}
+	return db, nil
+}
+
+func modelHasColumn(model interface{}, column string) bool {
+	for _, c := range modelColumns(model) {
+		if c == column {
+			return true
+		}
+	}
+	return false
+}
+
+//struct转为待更新字段, 与gorm一致忽略零值字段
+func (bd *BaseDriver) updateAttrsOf(value interface{}) map[string]interface{} {
+	attrs := make(map[string]interface{})
+	if src, ok := value.(map[string]interface{}); ok {
+		for k, v := range src {
+			attrs[k] = v
+		}
+		return attrs
+	}
+	for _, f := range bd.opDB.NewScope(value).Fields() {
+		if !f.IsNormal || f.IsIgnored || f.IsBlank {
+			continue
+		}
+		attrs[f.DBName] = f.Field.Interface()
+	}
+	return attrs
+}
+
+//查询冲突时的当前记录, 单行时返回记录本身
+func (bd *BaseDriver) conflictError(model interface{}, conds interface{}, args ...interface{}) error {
+	rows := reflect.New(reflect.SliceOf(reflect.TypeOf(model)))
+	if err := bd.opDB.Where(conds, args...).Find(rows.Interface()).Error; err != nil {
+		logger.Entry().Errorf("query conflict record error: %v", err)
+	}
+	rows = rows.Elem()
+	if rows.Len() == 1 {
+		return &ConflictError{Current: rows.Index(0).Interface()}
+	}
+	return &ConflictError{Current: rows.Interface()}
+}
+
+//带前置条件的model update, 自动递增Fversion; expected为期望更新行数(<=0时至少1行),
+//前置条件不满足时回滚并返回ConflictError
+func (bd *BaseDriver) UpdateWithPrecond(model interface{}, pre *UpdatePrecond, expected int64,
+	conds interface{}, updateAttrs interface{}, args ...interface{}) (int64, error) {
+	if err := bd.validateUpdate(model, updateAttrs); err != nil {
+		return 0, err
+	}
+	attrs := bd.updateAttrsOf(updateAttrs)
+	hasVersion := modelHasColumn(model, versionColumn)
+	if hasVersion {
+		attrs[versionColumn] = gorm.Expr("`Fversion` + 1")
+	}
+	tx, err := bd.bBegin()
+	if err != nil {
+		return 0, err
+	}
+	where := append([]interface{}{conds}, args...)
+	pw := newPendingWrite(HistoryUpdate, model, where, updateAttrs, pre)
+	if err = tx.prepareWrite(pw); err != nil {
+		tx.bRollback()
+		return 0, err
+	}
+	before, err := tx.historyBefore(model, where...)
+	if err != nil {
+		tx.bRollback()
+		return 0, err
+	}
+	db := tx.opDB.Model(model).Where(conds, args...)
+	if !pre.empty() {
+		if db, err = pre.apply(db, hasVersion); err != nil {
+			tx.bRollback()
+			return 0, err
+		}
+	}
+	ret := db.Updates(attrs)
+	if ret.Error != nil {
+		tx.bRollback()
+		return 0, ret.Error
+	}
+	if !pre.empty() && (ret.RowsAffected == 0 || (expected > 0 && ret.RowsAffected != expected)) {
+		tx.bRollback()
+		return 0, bd.conflictError(model, conds, args...)
+	}
+	if err = bd.confirmWrite(tx, pw, ret.RowsAffected); err != nil {
+		return 0, err
+	}
+	if err = tx.historyAfterUpdate(model, before); err != nil {
+		tx.bRollback()
+		return 0, err
+	}
+	tx.bCommit()
+	return ret.RowsAffected, nil
+}
@@ -0,0 +1,248 @@
+package dblogic
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+
+	m "github.com/store_server/dbtools/models"
+)
+
+/*-------------------------- 结构化查询(query dsl) -------------------------*/
+//json查询语言, 由dblogic编译为参数化的gorm查询, 字段需在model白名单内
+
+const (
+	maxQueryCondDepth = 8     //条件组最大嵌套层数
+	maxQueryInValues  = 10000 //in/nin最大取值个数
+)
+
+//query dsl
+type QueryDSL struct {
+	Where   *QueryCond    `json:"where,omitempty"`
+	OrderBy []*QueryOrder `json:"orderBy,omitempty"`
+	Select  []string      `json:"select,omitempty"`
+}
+
+//query condition, field/op/value为单个谓词, and/or为条件组
+type QueryCond struct {
+	Field string       `json:"field,omitempty"`
+	Op    string       `json:"op,omitempty"`
+	Value interface{}  `json:"value,omitempty"`
+	And   []*QueryCond `json:"and,omitempty"`
+	Or    []*QueryCond `json:"or,omitempty"`
+}
+
+//query order
+type QueryOrder struct {
+	Field string `json:"field"`
+	Desc  bool   `json:"desc,omitempty"`
+}
+
+//编译后的查询语句
+type compiledQuery struct {
+	where   string
+	args    []interface{}
+	orders  []string
+	selects []string
+}
+
+var (
+	queryWhitelist = make(map[string]map[string]bool) //table -> 可查询字段
+	whitelistLock  sync.RWMutex
+)
+
+func modelTableName(model interface{}) string {
+	if t, ok := model.(interface{ TableName() string }); ok {
+		return t.TableName()
+	}
+	return reflect.Indirect(reflect.ValueOf(model)).Type().Name()
+}
+
+//struct字段对应的gorm column, 无column tag时为空
+func gormColumn(sf reflect.StructField) string {
+	for _, seg := range strings.Split(sf.Tag.Get("gorm"), ";") {
+		if strings.HasPrefix(seg, "column:") {
+			return strings.TrimPrefix(seg, "column:")
+		}
+	}
+	return ""
+}
+
+//根据gorm column tag获取model所有字段
+func modelColumns(model interface{}) []string {
+	columns := make([]string, 0)
+	modelType := reflect.Indirect(reflect.ValueOf(model)).Type()
+	for i := 0; i < modelType.NumField(); i++ {
+		if c := gormColumn(modelType.Field(i)); len(c) != 0 {
+			columns = append(columns, c)
+		}
+	}
+	return columns
+}
+
+//设置model可查询字段白名单, 未指定字段时默认开放model所有字段
+func RegisterQueryWhitelist(model interface{}, columns ...string) {
+	if len(columns) == 0 {
+		columns = modelColumns(model)
+	}
+	wl := make(map[string]bool, len(columns))
+	for _, c := range columns {
+		wl[c] = true
+	}
+	whitelistLock.Lock()
+	queryWhitelist[modelTableName(model)] = wl
+	whitelistLock.Unlock()
+}
+
+func queryColumns(model interface{}) (map[string]bool, error) {
+	whitelistLock.RLock()
+	defer whitelistLock.RUnlock()
+	wl, ok := queryWhitelist[modelTableName(model)]
+	if !ok {
+		return nil, fmt.Errorf("model %s not support structured query", modelTableName(model))
+	}
+	return wl, nil
+}
+
+func checkQueryField(wl map[string]bool, field string) (string, error) {
+	if !wl[field] {
+		return "", fmt.Errorf("query field[%s] not in whitelist", field)
+	}
+	return fmt.Sprintf("`%s`", field), nil
+}
+
+//编译单个谓词
+func compilePredicate(wl map[string]bool, cond *QueryCond) (string, []interface{}, error) {
+	column, err := checkQueryField(wl, cond.Field)
+	if err != nil {
+		return "", nil, err
+	}
+	switch cond.Op {
+	case "eq", "":
+		return column + " = ?", []interface{}{cond.Value}, nil
+	case "ne":
+		return column + " != ?", []interface{}{cond.Value}, nil
+	case "gt":
+		return column + " > ?", []interface{}{cond.Value}, nil
+	case "ge":
+		return column + " >= ?", []interface{}{cond.Value}, nil
+	case "lt":
+		return column + " < ?", []interface{}{cond.Value}, nil
+	case "le":
+		return column + " <= ?", []interface{}{cond.Value}, nil
+	case "like":
+		if _, ok := cond.Value.(string); !ok {
+			return "", nil, fmt.Errorf("query field[%s] op like need string value", cond.Field)
+		}
+		return column + " LIKE ?", []interface{}{cond.Value}, nil
+	case "in", "nin":
+		values, ok := cond.Value.([]interface{})
+		if !ok || len(values) == 0 {
+			return "", nil, fmt.Errorf("query field[%s] op %s need non-empty array value", cond.Field, cond.Op)
+		}
+		if len(values) > maxQueryInValues {
+			return "", nil, fmt.Errorf("query field[%s] op %s values exceed %d", cond.Field, cond.Op, maxQueryInValues)
+		}
+		if cond.Op == "nin" {
+			return column + " NOT IN (?)", []interface{}{values}, nil
+		}
+		return column + " IN (?)", []interface{}{values}, nil
+	case "between":
+		values, ok := cond.Value.([]interface{})
+		if !ok || len(values) != 2 {
+			return "", nil, fmt.Errorf("query field[%s] op between need two values", cond.Field)
+		}
+		return column + " BETWEEN ? AND ?", values, nil
+	case "null":
+		return column + " IS NULL", nil, nil
+	case "notnull":
+		return column + " IS NOT NULL", nil, nil
+	}
+	return "", nil, fmt.Errorf("query field[%s] op[%s] not supported", cond.Field, cond.Op)
+}
+
+//编译条件(组)
+func compileCond(wl map[string]bool, cond *QueryCond, depth int) (string, []interface{}, error) {
+	if cond == nil {
+		return "", nil, nil
+	}
+	if depth > maxQueryCondDepth {
+		return "", nil, fmt.Errorf("query condition nested too deep, max %d", maxQueryCondDepth)
+	}
+	isPredicate := len(cond.Field) != 0
+	if isPredicate && (len(cond.And) != 0 || len(cond.Or) != 0) {
+		return "", nil, fmt.Errorf("query condition can not both be predicate and group")
+	}
+	if isPredicate {
+		return compilePredicate(wl, cond)
+	}
+	if len(cond.And) != 0 && len(cond.Or) != 0 {
+		return "", nil, fmt.Errorf("query condition group can not both be and and or")
+	}
+	sep, subs := " AND ", cond.And
+	if len(cond.Or) != 0 {
+		sep, subs = " OR ", cond.Or
+	}
+	if len(subs) == 0 {
+		return "", nil, fmt.Errorf("query condition is empty")
+	}
+	parts := make([]string, 0, len(subs))
+	args := make([]interface{}, 0)
+	for _, sub := range subs {
+		s, a, err := compileCond(wl, sub, depth+1)
+		if err != nil {
+			return "", nil, err
+		}
+		parts = append(parts, "("+s+")")
+		args = append(args, a...)
+	}
+	return strings.Join(parts, sep), args, nil
+}
+
+func (q *QueryDSL) compile(model interface{}) (*compiledQuery, error) {
+	wl, err := queryColumns(model)
+	if err != nil {
+		return nil, err
+	}
+	cq := &compiledQuery{}
+	if q == nil {
+		return cq, nil
+	}
+	cq.where, cq.args, err = compileCond(wl, q.Where, 1)
+	if err != nil {
+		return nil, err
+	}
+	for _, o := range q.OrderBy {
+		if o == nil {
+			continue
+		}
+		column, err := checkQueryField(wl, o.Field)
+		if err != nil {
+			return nil, err
+		}
+		if o.Desc {
+			column += " DESC"
+		}
+		cq.orders = append(cq.orders, column)
+	}
+	for _, f := range q.Select {
+		column, err := checkQueryField(wl, f)
+		if err != nil {
+			return nil, err
+		}
+		cq.selects = append(cq.selects, column)
+	}
+	return cq, nil
+}
+
+func init() {
+	RegisterQueryWhitelist(&m.Track{})
+	RegisterQueryWhitelist(&m.TrackExtraOs{})
+	RegisterQueryWhitelist(&m.Video{})
+	RegisterQueryWhitelist(&m.VideoExtraOs{})
+	RegisterQueryWhitelist(&m.VideoSingerTrack{})
+	RegisterQueryWhitelist(&m.Album{})
+	RegisterQueryWhitelist(&m.Singer{})
+	RegisterQueryWhitelist(&m.SingerAlias{})
+}
@@ -0,0 +1,62 @@
+package dblogic
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	m "github.com/store_server/dbtools/models"
+)
+
+func TestCompileQueryDSL(t *testing.T) {
+	q := &QueryDSL{
+		Where: &QueryCond{
+			And: []*QueryCond{
+				{Field: "Fstatus", Op: "ge", Value: 0},
+				{Or: []*QueryCond{
+					{Field: "Falbum_id", Op: "in", Value: []interface{}{1, 2}},
+					{Field: "Ftrack_name", Op: "like", Value: "abc%"},
+				}},
+			},
+		},
+		OrderBy: []*QueryOrder{{Field: "Ftrack_id", Desc: true}},
+		Select:  []string{"Ftrack_id", "Ftrack_name"},
+	}
+	cq, err := q.compile(&m.Track{})
+	assert.NoError(t, err)
+	assert.Equal(t, "(`Fstatus` >= ?) AND ((`Falbum_id` IN (?)) OR (`Ftrack_name` LIKE ?))", cq.where)
+	assert.Equal(t, []interface{}{0, []interface{}{1, 2}, "abc%"}, cq.args)
+	assert.Equal(t, []string{"`Ftrack_id` DESC"}, cq.orders)
+	assert.Equal(t, []string{"`Ftrack_id`", "`Ftrack_name`"}, cq.selects)
+}
+
+func TestCompileQueryDSLRejectInvalid(t *testing.T) {
+	cases := []*QueryDSL{
+		{Where: &QueryCond{Field: "Ftrack_id = 1 or 1", Op: "eq", Value: 1}},
+		{Where: &QueryCond{Field: "Ftrack_id", Op: "regexp", Value: ".*"}},
+		{Where: &QueryCond{Field: "Ftrack_id", Op: "in", Value: 1}},
+		{Where: &QueryCond{Field: "Ftrack_id", Op: "between", Value: []interface{}{1}}},
+		{Where: &QueryCond{And: []*QueryCond{{Field: "Fstatus"}}, Or: []*QueryCond{{Field: "Fstatus"}}}},
+		{OrderBy: []*QueryOrder{{Field: "rand()"}}},
+		{Select: []string{"*"}},
+	}
+	for _, q := range cases {
+		_, err := q.compile(&m.Track{})
+		assert.Error(t, err)
+	}
+}
+
+func TestQueryWhitelist(t *testing.T) {
+	RegisterQueryWhitelist(&m.VideoAid{}, "Fid", "Fregion_id")
+	defer func() {
+		whitelistLock.Lock()
+		delete(queryWhitelist, "t_video_aid")
+		whitelistLock.Unlock()
+	}()
+	_, err := (&QueryDSL{Where: &QueryCond{Field: "Fregion_id", Value: 1}}).compile(&m.VideoAid{})
+	assert.NoError(t, err)
+	_, err = (&QueryDSL{Where: &QueryCond{Field: "Fitem_id", Value: 1}}).compile(&m.VideoAid{})
+	assert.Error(t, err)
+	_, err = (&QueryDSL{}).compile(&m.VideoUpload{})
+	assert.Error(t, err)
+}
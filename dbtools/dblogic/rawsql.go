@@ -0,0 +1,119 @@
+package dblogic
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+/*-------------------------- 原生写sql校验 -------------------------*/
+//原生写sql只允许目标表上的单条update/delete/insert语句, 拒绝多语句、注释及ddl(ddl隐式提交, 预演无法回滚);
+//update/delete必须带where条件且不能带order by/limit, 以便按where条件锁定受影响记录、转入回收站及记录变更历史
+
+const (
+	rawWriteUpdate = "update"
+	rawWriteDelete = "delete"
+	rawWriteInsert = "insert"
+)
+
+var (
+	//单表update/delete, 提取表名及where条件
+	rawWritePattern = regexp.MustCompile("(?is)^(?:(update)\\s+`?(\\w+)`?\\s+set\\s+.+?|(delete)\\s+from\\s+`?(\\w+)`?)" +
+		"\\s+where\\s+(.+)$")
+	rawInsertPattern = regexp.MustCompile("(?is)^(insert)\\s+(?:ignore\\s+)?into\\s+`?(\\w+)`?[\\s(]")
+	rawLimitPattern  = regexp.MustCompile("(?is)\\b(?:limit|order\\s+by)\\b")
+)
+
+//不允许执行的原生写sql
+type RawSqlError struct {
+	Reason string
+}
+
+func (e *RawSqlError) Error() string {
+	return fmt.Sprintf("invalid raw sql: %s", e.Reason)
+}
+
+func IsRawSqlError(err error) bool {
+	_, ok := err.(*RawSqlError)
+	return ok
+}
+
+//解析后的原生写sql, where仅update/delete有
+type rawWrite struct {
+	verb  string
+	table string
+	where string
+}
+
+//解析单条原生写sql, table为允许写入的表
+func parseRawWrite(sql, table string) (*rawWrite, error) {
+	stmt, err := singleStatement(sql)
+	if err != nil {
+		return nil, err
+	}
+	rw := &rawWrite{}
+	masked := maskQuoted(stmt, "'\"") //在字符串常量外匹配关键字, 按位置从原语句截取
+	if idx := rawWritePattern.FindStringSubmatchIndex(masked); idx != nil {
+		sub := func(i int) string {
+			if idx[2*i] < 0 {
+				return ""
+			}
+			return stmt[idx[2*i]:idx[2*i+1]]
+		}
+		rw.verb, rw.table, rw.where = strings.ToLower(sub(1)+sub(3)), sub(2)+sub(4), sub(5)
+		if rawLimitPattern.MatchString(masked[idx[10]:]) {
+			return nil, &RawSqlError{Reason: "order by or limit is not allowed"}
+		}
+	} else if match := rawInsertPattern.FindStringSubmatch(masked); match != nil {
+		rw.verb, rw.table = rawWriteInsert, match[2]
+	} else {
+		return nil, &RawSqlError{Reason: "only single table update/delete with where or insert is allowed"}
+	}
+	if rw.table != table {
+		return nil, &RawSqlError{Reason: fmt.Sprintf("sql must write table %s", table)}
+	}
+	return rw, nil
+}
+
+//去除首尾空白及末尾分号, 引号外出现分号或注释时返回错误
+func singleStatement(sql string) (string, error) {
+	stmt := strings.TrimSpace(sql)
+	stmt = strings.TrimSpace(strings.TrimSuffix(stmt, ";"))
+	if len(stmt) == 0 {
+		return "", &RawSqlError{Reason: "sql is empty"}
+	}
+	masked := maskQuoted(stmt, "'\"`")
+	if strings.Contains(masked, ";") {
+		return "", &RawSqlError{Reason: "multiple statements are not allowed"}
+	}
+	if strings.Contains(masked, "--") || strings.Contains(masked, "#") || strings.Contains(masked, "/*") {
+		return "", &RawSqlError{Reason: "comments are not allowed"}
+	}
+	return stmt, nil
+}
+
+//将quotes中各引号内的内容替换为空格, 用于检查引号外的语法
+func maskQuoted(s, quotes string) string {
+	b := []byte(s)
+	var quote byte
+	for i := 0; i < len(b); i++ {
+		c := b[i]
+		if quote == 0 {
+			if strings.IndexByte(quotes, c) >= 0 {
+				quote = c
+			}
+			continue
+		}
+		if c == '\\' && quote != '`' && i+1 < len(b) {
+			b[i], b[i+1] = ' ', ' '
+			i++
+			continue
+		}
+		if c == quote {
+			quote = 0
+			continue
+		}
+		b[i] = ' '
+	}
+	return string(b)
+}
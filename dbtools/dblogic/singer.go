@@ -0,0 +1,297 @@
+package dblogic
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/store_server/dbtools/driver"
+	"github.com/store_server/logger"
+
+	m "github.com/store_server/dbtools/models"
+)
+
+//JOOX CMS SINGER相关操作
+type SingersDriver struct {
+	*driver.CMSDriver
+	*BaseDriver
+	lock sync.RWMutex
+}
+
+func NewSingersDriver(cmsDriver *driver.CMSDriver) *SingersDriver {
+	baseDriver := &BaseDriver{CMSDriver: cmsDriver, opDB: cmsDriver.MusicDB}
+	return &SingersDriver{cmsDriver, baseDriver, sync.RWMutex{}}
+}
+
+func (sd *SingersDriver) WithOp(info *OpInfo) *SingersDriver { //携带操作人
+	return &SingersDriver{sd.CMSDriver, sd.BaseDriver.withOp(info), sync.RWMutex{}}
+}
+
+func (sd *SingersDriver) WithConfirm(confirm *WriteConfirm) *SingersDriver { //携带预演/确认信息
+	return &SingersDriver{sd.CMSDriver, sd.BaseDriver.withConfirm(confirm), sync.RWMutex{}}
+}
+
+func (sd *SingersDriver) WithFields(fields []string) *SingersDriver { //查询投影字段
+	return &SingersDriver{sd.CMSDriver, sd.BaseDriver.withFields(fields), sync.RWMutex{}}
+}
+
+func (sd *SingersDriver) WithPrimary(on bool) *SingersDriver { //读主库
+	return &SingersDriver{sd.CMSDriver, sd.BaseDriver.withPrimary(on), sync.RWMutex{}}
+}
+
+func (sd *SingersDriver) WithTrace(trace *driver.QueryTrace) *SingersDriver { //携带查询来源
+	return &SingersDriver{sd.CMSDriver, sd.BaseDriver.withTrace(trace), sync.RWMutex{}}
+}
+
+var (
+	SgDriver *SingersDriver
+)
+
+/* ---------------------------- t_singer ------------------------ */
+func (sd *SingersDriver) ExecRawQuerySql4Singer(sql string, page, pagesize int64, count CountMode) ([]*m.Singer, int64, error) { //原生query语句
+	singers := make([]*m.Singer, 0)
+	res, total, err := sd.ExecRawQuerySql(sql, page, pagesize, &m.Singer{}, count)
+	if err != nil {
+		return nil, 0, err
+	}
+	for _, r := range res {
+		if s, ok := r.(*m.Singer); ok {
+			singers = append(singers, s)
+		}
+	}
+	return singers, total, nil
+}
+
+func (sd *SingersDriver) InsertOneSinger(singer *m.Singer) (int64, error) {
+	current := m.TimeNormal{time.Now()}
+	singer.FuploadTime = current
+	singer.FmodifyTime = current
+	_, err := sd.InsertWithModel(singer)
+	return singer.FsingerId, err
+}
+
+var singerBatchModel = &batchModel{
+	table:      "t_singer",
+	keys:       []string{"Fsinger_id"},
+	insertOnly: map[string]bool{"Fupload_time": true},
+}
+
+//批量写入艺人, 按冲突策略处理已存在记录, 返回每行写入结果
+func (sd *SingersDriver) BatchUpsertSingers(singers []*m.Singer, opts BatchOptions) ([]*BatchRowResult, error) {
+	values := make([]interface{}, 0, len(singers))
+	for _, singer := range singers {
+		current := m.TimeNormal{time.Now()}
+		singer.FuploadTime = current
+		singer.FmodifyTime = current
+		values = append(values, singer)
+	}
+	return sd.BatchUpsertWithModel(singerBatchModel, values, opts)
+}
+
+//更新艺人, pre不为空时按Fversion/Fmodify_time做乐观锁校验
+func (sd *SingersDriver) UpdateOneSinger(id int64, singer *m.Singer, pre *UpdatePrecond) (int64, error) {
+	singer.FmodifyTime = m.TimeNormal{time.Now()}
+	affected, err := sd.UpdateWithPrecond(&m.Singer{}, pre, 1, "Fsinger_id = ?", singer, id)
+	if err != nil {
+		return id, err
+	}
+	if affected != 1 {
+		return id, fmt.Errorf("update singer[%d] error, affect %d raw", id, affected)
+	}
+	return id, nil
+}
+
+func (sd *SingersDriver) GetOneSinger(id int64) (singer *m.Singer, err error) {
+	singer = &m.Singer{}
+	err = sd.readDB().First(singer, "Fsinger_id=?", id).Error
+	return
+}
+
+func (sd *SingersDriver) GetSingersByIds(ids []int64) ([]*m.Singer, int64, error) {
+	var singers []*m.Singer
+	db, err := sd.selectFields(sd.readDB(), &m.Singer{})
+	if err != nil {
+		return nil, 0, err
+	}
+	err = db.Where("Fsinger_id in (?)", ids).Find(&singers).Error
+	if err != nil {
+		return nil, 0, err
+	}
+	return singers, int64(len(singers)), nil
+}
+
+func (sd *SingersDriver) GetSingersByCondition(conds map[string]interface{}, page,
+	pagesize int64, count CountMode) ([]*m.Singer, int64, error) {
+	singers := make([]*m.Singer, 0)
+	res, total, err := sd.QueryWithModel(&m.Singer{}, conds, page, pagesize, count)
+	if err != nil {
+		return nil, 0, err
+	}
+	for _, r := range res {
+		if s, ok := r.(*m.Singer); ok {
+			singers = append(singers, s)
+		}
+	}
+	return singers, total, err
+}
+
+func (sd *SingersDriver) GetSingersByQuery(q *QueryDSL, page,
+	pagesize int64, count CountMode) ([]*m.Singer, int64, error) { //结构化查询
+	singers := make([]*m.Singer, 0)
+	res, total, err := sd.QueryWithDSL(&m.Singer{}, q, page, pagesize, count)
+	if err != nil {
+		return nil, 0, err
+	}
+	for _, r := range res {
+		if s, ok := r.(*m.Singer); ok {
+			singers = append(singers, s)
+		}
+	}
+	return singers, total, err
+}
+
+func (sd *SingersDriver) UpdateSingersAttr(ids []int64, conds,
+	updatesAttrs map[string]interface{}, pre *UpdatePrecond) (affected int64, err error) {
+	if len(ids) > 0 {
+		affected, err = sd.UpdateWithPrecond(&m.Singer{}, pre, int64(len(ids)), "Fsinger_id in (?)", updatesAttrs, ids)
+	} else if len(conds) != 0 {
+		affected, err = sd.UpdateWithPrecond(&m.Singer{}, pre, 0, conds, updatesAttrs)
+	}
+	if err != nil {
+		return affected, err
+	}
+	if len(ids) > 0 {
+		if affected != int64(len(ids)) {
+			return affected, fmt.Errorf("update singers count[%d] error, affect %d raw", len(ids), affected)
+		}
+	}
+	return affected, nil
+}
+
+func (sd *SingersDriver) DeleteOneSinger(id int64) (err error) {
+	_, err = sd.DeleteWithModelID(&m.Singer{}, id)
+	return err
+}
+
+func (sd *SingersDriver) DeleteSingers(ids []int64, conds map[string]interface{}) (affected int64, err error) {
+	if len(ids) > 0 {
+		affected, err = sd.DeleteWithModel(&m.Singer{}, "Fsinger_id in (?)", ids)
+	} else if len(conds) != 0 { //删除条件需严格把关
+		logger.Entry().Debugf("delete singers condition: %v", conds)
+		affected, err = sd.DeleteWithModel(&m.Singer{}, conds)
+	}
+	if err != nil {
+		return affected, err
+	}
+	if len(ids) > 0 {
+		if affected != int64(len(ids)) {
+			return affected, fmt.Errorf("delete singers count[%d] error, affect %d raw", len(ids), affected)
+		}
+	}
+	return affected, nil
+}
+
+//导出所有艺人id、名称及以|分隔的别名
+func (sd *SingersDriver) ExportSingersWithAliases() ([][]interface{}, error) {
+	sql := fmt.Sprintf("select s.Fsinger_id, s.Fsinger_name, ifnull(%s, '') from t_singer s "+
+		"left join t_singer_alias a on s.Fsinger_id = a.Fsinger_id group by s.Fsinger_id, s.Fsinger_name order by s.Fsinger_id",
+		groupConcat(sd.readDB(), "a.Falias_name", "|"))
+	return sd.ExportAllRecords(sql)
+}
+
+//查询t_singer中实际存在的艺人id
+func (sd *SingersDriver) ExistSingerIds(ids []int64) (map[int64]bool, error) {
+	exist := make(map[int64]bool)
+	if len(ids) == 0 {
+		return exist, nil
+	}
+	var found []int64
+	err := sd.readDB().Model(&m.Singer{}).Where("Fsinger_id in (?)", ids).Pluck("Fsinger_id", &found).Error
+	if err != nil {
+		return nil, err
+	}
+	for _, id := range found {
+		exist[id] = true
+	}
+	return exist, nil
+}
+
+/* ---------------------------- t_singer_alias ------------------------ */
+func (sd *SingersDriver) GetSingerAliases(singerIds []int64) ([]*m.SingerAlias, error) {
+	var aliases []*m.SingerAlias
+	err := sd.readDB().Where("Fsinger_id in (?)", singerIds).Find(&aliases).Error
+	if err != nil {
+		return nil, err
+	}
+	return aliases, nil
+}
+
+func (sd *SingersDriver) GetSingerAliasesByCondition(conds map[string]interface{}, page,
+	pagesize int64, count CountMode) ([]*m.SingerAlias, int64, error) {
+	aliases := make([]*m.SingerAlias, 0)
+	res, total, err := sd.QueryWithModel(&m.SingerAlias{}, conds, page, pagesize, count)
+	if err != nil {
+		return nil, 0, err
+	}
+	for _, r := range res {
+		if a, ok := r.(*m.SingerAlias); ok {
+			aliases = append(aliases, a)
+		}
+	}
+	return aliases, total, err
+}
+
+var singerAliasBatchModel = &batchModel{
+	table:      "t_singer_alias",
+	keys:       []string{"Fid"},
+	insertOnly: map[string]bool{"Fcreate_time": true},
+}
+
+//批量写入艺人别名, Fid为空时自增写入
+func (sd *SingersDriver) BatchUpsertSingerAliases(aliases []*m.SingerAlias,
+	opts BatchOptions) ([]*BatchRowResult, error) {
+	values := make([]interface{}, 0, len(aliases))
+	for _, alias := range aliases {
+		current := m.TimeNormal{time.Now()}
+		alias.FcreateTime = current
+		alias.FmodifyTime = current
+		values = append(values, alias)
+	}
+	return sd.BatchUpsertWithModel(singerAliasBatchModel, values, opts)
+}
+
+func (sd *SingersDriver) UpdateSingerAliasesAttr(ids []int64, conds,
+	updatesAttrs map[string]interface{}) (affected int64, err error) {
+	if len(ids) > 0 {
+		affected, err = sd.UpdateWithModel(&m.SingerAlias{}, "Fid in (?)", updatesAttrs, ids)
+	} else if len(conds) != 0 {
+		affected, err = sd.UpdateWithModel(&m.SingerAlias{}, conds, updatesAttrs)
+	}
+	if err != nil {
+		return affected, err
+	}
+	if len(ids) > 0 {
+		if affected != int64(len(ids)) {
+			return affected, fmt.Errorf("update singer aliases count[%d] error, affect %d raw", len(ids), affected)
+		}
+	}
+	return affected, nil
+}
+
+func (sd *SingersDriver) DeleteSingerAliases(ids []int64, conds map[string]interface{}) (affected int64, err error) {
+	if len(ids) > 0 {
+		affected, err = sd.DeleteWithModel(&m.SingerAlias{}, "Fid in (?)", ids)
+	} else if len(conds) != 0 { //删除条件需严格把关
+		logger.Entry().Debugf("delete singer aliases condition: %v", conds)
+		affected, err = sd.DeleteWithModel(&m.SingerAlias{}, conds)
+	}
+	if err != nil {
+		return affected, err
+	}
+	if len(ids) > 0 {
+		if affected != int64(len(ids)) {
+			return affected, fmt.Errorf("delete singer aliases count[%d] error, affect %d raw", len(ids), affected)
+		}
+	}
+	return affected, nil
+}
@@ -0,0 +1,79 @@
+package dblogic
+
+import (
+	"testing"
+
+	"github.com/store_server/dbtools/driver"
+	"github.com/stretchr/testify/assert"
+
+	m "github.com/store_server/dbtools/models"
+)
+
+var (
+	singersDriver *SingersDriver
+)
+
+//fixture中包含艺人71(别名alias_a、alias_b)及72
+func sgSetup() {
+	testScheme.Setup()
+	singersDriver = NewSingersDriver(&driver.CMSDriver{
+		MusicDB:  testScheme.DB(),
+		ImportDB: testScheme.DB(),
+	})
+}
+
+func sgCleanup() {
+	testScheme.Cleanup()
+	singersDriver = nil
+}
+
+func TestSingerCRUD(t *testing.T) {
+	sgSetup()
+	defer sgCleanup()
+	id, err := singersDriver.InsertOneSinger(&m.Singer{FsingerId: 73, FsingerName: "test_singer", Farea: 2, Fversion: 1})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(73), id)
+	data, err := singersDriver.GetOneSinger(id)
+	assert.NoError(t, err)
+	assert.Equal(t, "test_singer", data.FsingerName)
+	singers, total, err := singersDriver.GetSingersByCondition(map[string]interface{}{"Fstatus": 1}, 1, 10, CountExact)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), total)
+	assert.Equal(t, 2, len(singers))
+
+	//版本不一致时返回当前记录
+	stale := int64(0)
+	_, err = singersDriver.UpdateOneSinger(id, &m.Singer{FsingerName: "renamed"}, &UpdatePrecond{Version: &stale})
+	assert.True(t, IsConflictError(err))
+	_, err = singersDriver.UpdateOneSinger(id, &m.Singer{FsingerName: "renamed"}, nil)
+	assert.NoError(t, err)
+	data, err = singersDriver.GetOneSinger(id)
+	assert.NoError(t, err)
+	assert.Equal(t, "renamed", data.FsingerName)
+
+	//按条件批量删除超过阈值需确认
+	singersDriver.SetConfirmThresholds(1, nil)
+	conds := map[string]interface{}{"Fstatus": 1}
+	_, err = singersDriver.DeleteSingers(nil, conds)
+	_, ok := err.(*ConfirmRequiredError)
+	assert.True(t, ok)
+	_, err = singersDriver.WithConfirm(&WriteConfirm{DryRun: true}).DeleteSingers(nil, conds)
+	confirm, ok := err.(*ConfirmRequiredError)
+	assert.True(t, ok)
+	affected, err := singersDriver.WithConfirm(&WriteConfirm{Token: confirm.Token}).DeleteSingers(nil, conds)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), affected)
+	exist, err := singersDriver.ExistSingerIds([]int64{71, 72, 73})
+	assert.NoError(t, err)
+	assert.Equal(t, map[int64]bool{73: true}, exist)
+}
+
+func TestExportSingersWithAliases(t *testing.T) {
+	sgSetup()
+	defer sgCleanup()
+	res, err := singersDriver.ExportSingersWithAliases()
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(res))
+	assert.Equal(t, []interface{}{"71", "fixture_singer", "alias_a|alias_b"}, res[0])
+	assert.Equal(t, []interface{}{"72", "fixture_singer_2", ""}, res[1]) //无别名
+}
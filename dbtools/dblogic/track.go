@@ -2,6 +2,8 @@ package dblogic
 
 import (
 	"fmt"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 
@@ -19,18 +21,42 @@ type TracksDriver struct {
 }
 
 func NewTracksDriver(cmsDriver *driver.CMSDriver) *TracksDriver {
-	baseDriver := &BaseDriver{cmsDriver, cmsDriver.MusicDB}
+	baseDriver := &BaseDriver{CMSDriver: cmsDriver, opDB: cmsDriver.MusicDB}
 	return &TracksDriver{cmsDriver, baseDriver, sync.RWMutex{}}
 }
 
+func (td *TracksDriver) WithOp(info *OpInfo) *TracksDriver { //携带操作人
+	return &TracksDriver{td.CMSDriver, td.BaseDriver.withOp(info), sync.RWMutex{}}
+}
+
+func (td *TracksDriver) WithConfirm(confirm *WriteConfirm) *TracksDriver { //携带预演/确认信息
+	return &TracksDriver{td.CMSDriver, td.BaseDriver.withConfirm(confirm), sync.RWMutex{}}
+}
+
+func (td *TracksDriver) WithFields(fields []string) *TracksDriver { //查询投影字段
+	return &TracksDriver{td.CMSDriver, td.BaseDriver.withFields(fields), sync.RWMutex{}}
+}
+
+func (td *TracksDriver) WithPrimary(on bool) *TracksDriver { //读主库
+	return &TracksDriver{td.CMSDriver, td.BaseDriver.withPrimary(on), sync.RWMutex{}}
+}
+
+func (td *TracksDriver) WithTrace(trace *driver.QueryTrace) *TracksDriver { //携带查询来源
+	return &TracksDriver{td.CMSDriver, td.BaseDriver.withTrace(trace), sync.RWMutex{}}
+}
+
+func (td *TracksDriver) WithValidation(skipRules []string) *TracksDriver { //跳过校验规则
+	return &TracksDriver{td.CMSDriver, td.BaseDriver.withValidation(skipRules), sync.RWMutex{}}
+}
+
 var (
 	TkDriver *TracksDriver
 )
 
 /* ---------------------------- t_track ------------------------ */
-func (td *TracksDriver) ExecRawQuerySql4Track(sql string, page, pagesize int64) ([]*m.Track, int64, error) { //原生query语句
+func (td *TracksDriver) ExecRawQuerySql4Track(sql string, page, pagesize int64, count CountMode) ([]*m.Track, int64, error) { //原生query语句
 	tracks := make([]*m.Track, 0)
-	res, total, err := td.ExecRawQuerySql(sql, page, pagesize, &m.Track{})
+	res, total, err := td.ExecRawQuerySql(sql, page, pagesize, &m.Track{}, count)
 	if err != nil {
 		return nil, 0, err
 	}
@@ -64,11 +90,32 @@ func (td *TracksDriver) InsertTracks(tracks []*m.Track) (int64, error) {
 	return td.InsertWithModel(tracks)
 }
 
-func (td *TracksDriver) UpdateOneTrack(id int64, track *m.Track) (int64, error) {
+var trackBatchModel = &batchModel{
+	table:      "t_track",
+	keys:       []string{"Ftrack_id"},
+	insertOnly: map[string]bool{"Fvalid_time": true, "Fupload_time": true},
+}
+
+//批量写入歌曲, 按冲突策略处理已存在记录, 返回每行写入结果
+func (td *TracksDriver) BatchUpsertTracks(tracks []*m.Track, opts BatchOptions) ([]*BatchRowResult, error) {
+	values := make([]interface{}, 0, len(tracks))
+	for _, track := range tracks {
+		current := m.TimeNormal{time.Now()}
+		track.FvalidTime = current
+		track.FuploadTime = current
+		track.FmodifyTime = current
+		track.FlastestModifyTime = current
+		values = append(values, track)
+	}
+	return td.BatchUpsertWithModel(trackBatchModel, values, opts)
+}
+
+//更新歌曲, pre不为空时按Fversion/Fmodify_time做乐观锁校验
+func (td *TracksDriver) UpdateOneTrack(id int64, track *m.Track, pre *UpdatePrecond) (int64, error) {
 	current := m.TimeNormal{time.Now()}
 	track.FmodifyTime = current
 	track.FlastestModifyTime = current
-	affected, err := td.UpdateWithModel(&m.Track{}, "Ftrack_id = ?", track, id)
+	affected, err := td.UpdateWithPrecond(&m.Track{}, pre, 1, "Ftrack_id = ?", track, id)
 	if err != nil {
 		return track.FtrackId, err
 	}
@@ -80,13 +127,17 @@ func (td *TracksDriver) UpdateOneTrack(id int64, track *m.Track) (int64, error)
 
 func (td *TracksDriver) GetOneTrack(id int64) (track *m.Track, err error) {
 	track = &m.Track{}
-	err = td.MusicDB.First(track, "Ftrack_id=?", id).Error
+	err = td.readDB().First(track, "Ftrack_id=?", id).Error
 	return
 }
 
 func (td *TracksDriver) GetTracksByIds(ids []int64) ([]*m.Track, int64, error) {
 	var tracks []*m.Track
-	err := td.MusicDB.Where("Ftrack_id in (?)", ids).Find(&tracks).Error
+	db, err := td.selectFields(td.readDB(), &m.Track{})
+	if err != nil {
+		return nil, 0, err
+	}
+	err = db.Where("Ftrack_id in (?)", ids).Find(&tracks).Error
 	if err != nil {
 		return nil, 0, err
 	}
@@ -95,9 +146,9 @@ func (td *TracksDriver) GetTracksByIds(ids []int64) ([]*m.Track, int64, error) {
 }
 
 func (td *TracksDriver) GetTracksByCondition(conds map[string]interface{}, page,
-	pagesize int64) ([]*m.Track, int64, error) {
+	pagesize int64, count CountMode) ([]*m.Track, int64, error) {
 	tracks := make([]*m.Track, 0)
-	res, total, err := td.QueryWithModel(&m.Track{}, conds, page, pagesize)
+	res, total, err := td.QueryWithModel(&m.Track{}, conds, page, pagesize, count)
 	if err != nil {
 		return nil, 0, err
 	}
@@ -109,12 +160,42 @@ func (td *TracksDriver) GetTracksByCondition(conds map[string]interface{}, page,
 	return tracks, total, err
 }
 
+func (td *TracksDriver) GetTracksByQuery(q *QueryDSL, page,
+	pagesize int64, count CountMode) ([]*m.Track, int64, error) { //结构化查询
+	tracks := make([]*m.Track, 0)
+	res, total, err := td.QueryWithDSL(&m.Track{}, q, page, pagesize, count)
+	if err != nil {
+		return nil, 0, err
+	}
+	for _, r := range res {
+		if t, ok := r.(*m.Track); ok {
+			tracks = append(tracks, t)
+		}
+	}
+	return tracks, total, err
+}
+
+func (td *TracksDriver) GetTracksByCursor(q *QueryDSL, conds map[string]interface{},
+	cp *CursorPage) ([]*m.Track, string, error) { //游标分页查询
+	tracks := make([]*m.Track, 0)
+	res, next, err := td.QueryWithCursor(&m.Track{}, "Ftrack_id", q, conds, cp)
+	if err != nil {
+		return nil, "", err
+	}
+	for _, r := range res {
+		if t, ok := r.(*m.Track); ok {
+			tracks = append(tracks, t)
+		}
+	}
+	return tracks, next, err
+}
+
 func (td *TracksDriver) UpdateTracksAttr(ids []int64, conds,
-	updatesAttrs map[string]interface{}) (affected int64, err error) {
+	updatesAttrs map[string]interface{}, pre *UpdatePrecond) (affected int64, err error) {
 	if len(ids) > 0 {
-		affected, err = td.UpdateWithModel(&m.Track{}, "Ftrack_id in (?)", updatesAttrs, ids)
+		affected, err = td.UpdateWithPrecond(&m.Track{}, pre, int64(len(ids)), "Ftrack_id in (?)", updatesAttrs, ids)
 	} else if len(conds) != 0 {
-		affected, err = td.UpdateWithModel(&m.Track{}, conds, updatesAttrs)
+		affected, err = td.UpdateWithPrecond(&m.Track{}, pre, 0, conds, updatesAttrs)
 	}
 	if err != nil {
 		return affected, err
@@ -156,9 +237,9 @@ func (td *TracksDriver) ExportAllTracks(sql string) ([][]interface{}, error) { /
 
 /* ---------------------------- t_track_extra_os ------------------------ */
 func (td *TracksDriver) ExecRawQuerySql4TrackExtraOs(sql string, page,
-	pagesize int64) ([]*m.TrackExtraOs, int64, error) { //原生query语句
+	pagesize int64, count CountMode) ([]*m.TrackExtraOs, int64, error) { //原生query语句
 	tracks := make([]*m.TrackExtraOs, 0)
-	res, total, err := td.ExecRawQuerySql(sql, page, pagesize, &m.TrackExtraOs{})
+	res, total, err := td.ExecRawQuerySql(sql, page, pagesize, &m.TrackExtraOs{}, count)
 	if err != nil {
 		return nil, 0, err
 	}
@@ -186,6 +267,23 @@ func (td *TracksDriver) InsertTrackExtraOs(tracks []*m.TrackExtraOs) (int64, err
 	return td.InsertWithModel(tracks)
 }
 
+var trackExtraOsBatchModel = &batchModel{
+	table:      "t_track_extra_os",
+	keys:       []string{"Ftrack_id", "Fregion"},
+	insertOnly: map[string]bool{"Flocal_valid_time": true},
+}
+
+//批量写入歌曲地区信息, 按冲突策略处理已存在记录, 返回每行写入结果
+func (td *TracksDriver) BatchUpsertTrackExtraOs(tracks []*m.TrackExtraOs,
+	opts BatchOptions) ([]*BatchRowResult, error) {
+	values := make([]interface{}, 0, len(tracks))
+	for _, track := range tracks {
+		track.FmodifyTime = m.TimeNormal{time.Now()}
+		values = append(values, track)
+	}
+	return td.BatchUpsertWithModel(trackExtraOsBatchModel, values, opts)
+}
+
 func (td *TracksDriver) UpdateTrackExtraOsAttr(ids []int64, conds,
 	updatesAttrs map[string]interface{}) (affected int64, err error) {
 	if len(ids) > 0 {
@@ -206,14 +304,33 @@ func (td *TracksDriver) UpdateTrackExtraOsAttr(ids []int64, conds,
 
 func (td *TracksDriver) GetOneTrackExtraOs(id, region int64) (track *m.TrackExtraOs, err error) {
 	track = &m.TrackExtraOs{}
-	err = td.MusicDB.First(track, "Ftrack_id=? and Fregion=?", id, region).Error
+	db, err := td.selectFields(td.readDB(), track)
+	if err != nil {
+		return nil, err
+	}
+	err = db.First(track, "Ftrack_id=? and Fregion=?", id, region).Error
 	return
 }
 
 func (td *TracksDriver) GetTrackExtraOsByCondition(conds map[string]interface{}, page,
-	pagesize int64) ([]*m.TrackExtraOs, int64, error) {
+	pagesize int64, count CountMode) ([]*m.TrackExtraOs, int64, error) {
 	tracks := make([]*m.TrackExtraOs, 0)
-	res, total, err := td.QueryWithModel(&m.TrackExtraOs{}, conds, page, pagesize)
+	res, total, err := td.QueryWithModel(&m.TrackExtraOs{}, conds, page, pagesize, count)
+	if err != nil {
+		return nil, 0, err
+	}
+	for _, r := range res {
+		if t, ok := r.(*m.TrackExtraOs); ok {
+			tracks = append(tracks, t)
+		}
+	}
+	return tracks, total, err
+}
+
+func (td *TracksDriver) GetTrackExtraOsByQuery(q *QueryDSL, page,
+	pagesize int64, count CountMode) ([]*m.TrackExtraOs, int64, error) { //结构化查询
+	tracks := make([]*m.TrackExtraOs, 0)
+	res, total, err := td.QueryWithDSL(&m.TrackExtraOs{}, q, page, pagesize, count)
 	if err != nil {
 		return nil, 0, err
 	}
@@ -235,6 +352,116 @@ func (td *TracksDriver) DeleteTrackExtraOs(ids []int64, conds map[string]interfa
 	return affected, err
 }
 
+//从回收站恢复歌曲及歌曲地区信息
+func (td *TracksDriver) RestoreTracks(recordIds, trashIds []int64) (*RestoreResult, error) {
+	return td.RestoreTrash(trackTables, recordIds, trashIds)
+}
+
+var trackTables = []string{"t_track", "t_track_extra_os"}
+
+//查询歌曲及歌曲地区信息的变更历史
+func (td *TracksDriver) GetTrackHistory(id int64, requestId string, page,
+	pagesize int64) ([]*m.History, int64, error) {
+	return td.QueryHistory(trackTables, id, requestId, page, pagesize)
+}
+
+//回滚歌曲变更历史对应的变更
+func (td *TracksDriver) RollbackTrackHistory(historyId int64) (int64, error) {
+	return td.RollbackHistory(trackTables, historyId)
+}
+
+/* ---------------------------- track 关联艺人校验 ------------------------ */
+//获取歌曲关联艺人id, 包括Fsinger_id1..4及Fsinger_all中的艺人id
+func trackSingerIds(track *m.Track) []int64 {
+	ids := make([]int64, 0)
+	for _, id := range []int64{track.FsingerId1, track.FsingerId2, track.FsingerId3, track.FsingerId4} {
+		if id > 0 {
+			ids = append(ids, id)
+		}
+	}
+	splitFn := func(r rune) bool { return r < '0' || r > '9' }
+	for _, seg := range strings.FieldsFunc(track.FsingerAll, splitFn) {
+		if id, err := strconv.ParseInt(seg, 10, 64); err == nil && id > 0 {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+//与歌曲driver共用连接、事务及读写选项的艺人driver
+func (td *TracksDriver) singers() *SingersDriver {
+	return &SingersDriver{td.CMSDriver, td.BaseDriver, sync.RWMutex{}}
+}
+
+//校验歌曲是否关联有效艺人, 返回无有效艺人的歌曲id
+//指定region时, 若t_track_extra_os中该地区配置了替换歌曲(Freplace_id), 以替换歌曲的艺人为准
+func (td *TracksDriver) CheckTracksSinger(ids []int64, region int64) ([]int64, error) {
+	invalidIds := make([]int64, 0)
+	if len(ids) == 0 {
+		return invalidIds, nil
+	}
+	tracks, _, err := td.GetTracksByIds(ids)
+	if err != nil {
+		return nil, err
+	}
+	trackMap := make(map[int64]*m.Track, len(tracks))
+	for _, t := range tracks {
+		trackMap[t.FtrackId] = t
+	}
+	resolved := make(map[int64]int64, len(ids)) //歌曲id -> 实际取艺人信息的歌曲id
+	for _, id := range ids {
+		resolved[id] = id
+	}
+	if region != 0 {
+		var extras []*m.TrackExtraOs
+		err = td.readDB().Where("Ftrack_id in (?) and Fregion=?", ids, region).Find(&extras).Error
+		if err != nil {
+			return nil, err
+		}
+		replaceIds := make([]int64, 0)
+		for _, e := range extras {
+			if e.FreplaceId > 0 && e.FreplaceId != e.FtrackId {
+				resolved[e.FtrackId] = e.FreplaceId
+				if _, ok := trackMap[e.FreplaceId]; !ok {
+					replaceIds = append(replaceIds, e.FreplaceId)
+				}
+			}
+		}
+		if len(replaceIds) != 0 {
+			replaces, _, err := td.GetTracksByIds(replaceIds)
+			if err != nil {
+				return nil, err
+			}
+			for _, t := range replaces {
+				trackMap[t.FtrackId] = t
+			}
+		}
+	}
+	singerIds := make([]int64, 0)
+	for _, t := range trackMap {
+		singerIds = append(singerIds, trackSingerIds(t)...)
+	}
+	exist, err := td.singers().ExistSingerIds(singerIds)
+	if err != nil {
+		return nil, err
+	}
+	for _, id := range ids {
+		valid := false
+		if t, ok := trackMap[resolved[id]]; ok {
+			for _, sid := range trackSingerIds(t) {
+				if exist[sid] {
+					valid = true
+					break
+				}
+			}
+		}
+		if !valid {
+			invalidIds = append(invalidIds, id)
+		}
+	}
+	return invalidIds, nil
+}
+
 /* ---------------------------- track 相关join查询------------------------ */
 
 func (td *TracksDriver) JoinQueryWithRawSql(sql string, page, pagesize int64) ([][]interface{}, error) {
@@ -1,45 +1,45 @@
 package dblogic
 
 import (
+	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
 	"github.com/store_server/dbtools/driver"
+	"github.com/store_server/logger"
 	"github.com/stretchr/testify/assert"
 
+	_ "github.com/jinzhu/gorm/dialects/sqlite" //embedded测试后端
 	m "github.com/store_server/dbtools/models"
 )
 
 var (
 	tracksDriver *TracksDriver
+	//测试库, fixture中包含歌曲1
+	testScheme = &driver.Scheme{Mysql: driver.DefaultTestScheme.Mysql, Fixtures: "testdata/fixtures"}
 )
 
+func init() {
+	logger.InitStructLog("error", filepath.Join(os.TempDir(), "store_server_test.log"), "store_server_test")
+}
+
 func tkSetup() {
-	driver.DefaultTestScheme.Setup()
-	driver.DefaultTestMongoScheme.Setup()
-	tracksDriver = &TracksDriver{
-		&driver.CMSDriver{
-			MusicDB:  driver.DefaultTestScheme.DB(),
-			ImportDB: driver.DefaultTestScheme.DB(),
-		},
-		lock,
-	}
+	testScheme.Setup()
+	tracksDriver = NewTracksDriver(&driver.CMSDriver{
+		MusicDB:  testScheme.DB(),
+		ImportDB: testScheme.DB(),
+	})
 }
 
 func tkCleanup() {
-	driver.DefaultTestScheme.Cleanup()
-	driver.DefaultTestMongoScheme.Cleanup()
-	if tracksDriver != nil {
-		if tracksDriver.CMSDriver != nil {
-			tracksDriver.CMSDriver.Close()
-		}
-		tracksDriver = nil
-	}
+	testScheme.Cleanup()
+	tracksDriver = nil
 }
 
 func genTrackExample() *m.Track {
 	track := &m.Track{
-		FtrackId:     int64(1),
+		FtrackId:     int64(2),
 		FtrackName:   "中国人",
 		FalbumId:     int64(1111111),
 		Ftype:        -1,
@@ -55,7 +55,7 @@ func genTrackExample() *m.Track {
 		Fprice1:      10,
 		Fprice2:      0,
 		Fprice3:      0,
-		Fisrc:        "test_isrc",
+		Fisrc:        "CNA011900001",
 		Fattribute1:  1,
 		Fattribute2:  2,
 		Fattribute3:  3,
@@ -76,9 +76,7 @@ func genTrackExample() *m.Track {
 		FlinkMv:      10,
 		FmediaId:     10,
 		FlinkRing:    7,
-		FvalidTime:   time.Now(),
-		FuploadTime:  time.Now(),
-		FmodifyTime:  time.Now(),
+		FgenreIds:    m.Int64s{7},
 	}
 	return track
 }
@@ -86,7 +84,7 @@ func genTrackExample() *m.Track {
 func genTrackExtraOsExample() *m.TrackExtraOs {
 	trackExtraOs := &m.TrackExtraOs{
 		FtrackId:          int64(1),
-		Fregion:           int64(1),
+		Fregion:           int64(2),
 		FlocalName:        "xxxxxxxxuuuuuuuuuuuukkkkkkkkkkkk",
 		FlocalCopyright:   1,
 		FlocalStatus:      1,
@@ -96,12 +94,12 @@ func genTrackExtraOsExample() *m.TrackExtraOs {
 		FmvId:             1,
 		FcopyrightLimit:   1,
 		FreplaceId:        1,
-		FlocalIsrc:        "test_isrc",
+		FlocalIsrc:        "CNA011900001",
 		FlocalLabel:       "test_label",
 		Fsupplier:         "test_supplier",
 		FallSources:       "test_all_sources",
 		FlocalOtherName:   "test_other_name",
-		FlocalValidTime:   time.Now(),
+		FlocalValidTime:   m.TimeNormal{time.Now()},
 	}
 	return trackExtraOs
 }
@@ -110,25 +108,33 @@ func TestInsertTrack(t *testing.T) {
 	tkSetup()
 	defer tkCleanup()
 	track := genTrackExample()
-	id, err := tracksDriver.InsertTrack(track)
+	id, err := tracksDriver.InsertOneTrack(track)
 	assert.NoError(t, err)
-	assert.Equal(t, id, int64(1))
+	assert.Equal(t, id, int64(2))
 
 	data, err := tracksDriver.GetOneTrack(track.FtrackId)
 	assert.NoError(t, err)
-	assert.Equal(t, data.Fsize, 100)
+	assert.Equal(t, data.Fsize, int64(100))
 	assert.Equal(t, data.FsingerAll, "test_all")
-	assert.Equal(t, data.Fstatus, -50)
+	assert.Equal(t, data.Fstatus, int64(-50))
 	assert.Equal(t, data.FtrackName, "中国人")
+	assert.Equal(t, data.FgenreIds, m.Int64s{7})
+
+	_, err = tracksDriver.InsertOneTrack(genTrackExample()) //主键冲突
+	assert.Error(t, err)
 }
 
 func TestInsertTrackExtraOs(t *testing.T) {
 	tkSetup()
 	defer tkCleanup()
 	trackExtraOs := genTrackExtraOsExample()
-	id, err := tracksDriver.InsertTrackExtraOs(trackExtraOs)
+	id, err := tracksDriver.InsertOneTrackExtraOs(trackExtraOs)
 	assert.NoError(t, err)
 	assert.Equal(t, id, int64(1))
+
+	data, err := tracksDriver.GetOneTrackExtraOs(1, 2)
+	assert.NoError(t, err)
+	assert.Equal(t, data.FlocalName, trackExtraOs.FlocalName)
 }
 
 func TestUpdateTrack(t *testing.T) {
@@ -136,42 +142,87 @@ func TestUpdateTrack(t *testing.T) {
 	defer tkCleanup()
 	id := int64(1)
 	track := genTrackExample()
-	track.FalbumId, track.Fsize = int64(233333), int64(200)
-	idx, err := tracksDriver.UpdateTrack(id, track)
-
+	track.FtrackId, track.FalbumId, track.Fsize = id, int64(233333), int64(200)
+	idx, err := tracksDriver.UpdateOneTrack(id, track, nil)
 	assert.NoError(t, err)
 	assert.Equal(t, idx, int64(1))
+
+	data, err := tracksDriver.GetOneTrack(id)
+	assert.NoError(t, err)
+	assert.Equal(t, data.FalbumId, int64(233333))
+	assert.Equal(t, data.Fsize, int64(200))
+
+	_, err = tracksDriver.UpdateOneTrack(3, track, nil) //不存在的歌曲
+	assert.Error(t, err)
 }
 
-func TestGetTrackByCondition(t *testing.T) {
+func TestGetTracksByCondition(t *testing.T) {
 	tkSetup()
 	defer tkCleanup()
 	track := genTrackExample()
-	track.FtrackId, track.FalbumId, track.Fmovie = int64(2), int64(20191108), "test_20191108_movie"
+	track.FalbumId, track.Fmovie = int64(20191108), "test_20191108_movie"
 
-	id, err := tracksDriver.InsertTrack(track)
+	id, err := tracksDriver.InsertOneTrack(track)
 	assert.NoError(t, err)
 	assert.Equal(t, id, int64(2))
 
-	page, pagesize := 1, 10
-	cons := map[string]interface{}{"Fisrc": "test_isrc"}
-	tracks, total, err := tracksDriver.GetTrackByCondition(cons, page, pagesize)
-
+	cons := map[string]interface{}{"Fisrc": "CNA011900001"}
+	tracks, total, err := tracksDriver.GetTracksByCondition(cons, 1, 10, CountExact)
 	assert.NoError(t, err)
 	assert.Equal(t, len(tracks), 2)
-	assert.Equal(t, total, 2)
+	assert.Equal(t, total, int64(2))
+
+	cons = map[string]interface{}{"Falbum_id": 20191108}
+	tracks, total, err = tracksDriver.GetTracksByCondition(cons, 1, 10, CountExact)
+	assert.NoError(t, err)
+	assert.Equal(t, len(tracks), 1)
+	assert.Equal(t, total, int64(1))
+	assert.Equal(t, tracks[0].Fmovie, "test_20191108_movie")
 }
 
-func TestUpdateTrackAttr(t *testing.T) {
+func TestUpdateTracksAttr(t *testing.T) {
 	tkSetup()
 	defer tkCleanup()
-	track := genTrackExample()
 	updateAttrs := map[string]interface{}{"Fstatus": 50}
-	err := tracksDriver.UpdateTrackAttr(track, updateAttrs)
+	affected, err := tracksDriver.UpdateTracksAttr([]int64{1}, nil, updateAttrs, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, affected, int64(1))
+
+	newTrack, err := tracksDriver.GetOneTrack(1)
+	assert.NoError(t, err)
+	assert.Equal(t, newTrack.Fstatus, int64(50))
+}
+
+func TestCheckTracksSinger(t *testing.T) {
+	tkSetup()
+	defer tkCleanup()
+	track := genTrackExample()
+	track.FtrackId, track.FsingerId1, track.FsingerAll = 3, 999, ""
+	_, err := tracksDriver.InsertOneTrack(track)
+	assert.NoError(t, err)
+	invalid, err := tracksDriver.CheckTracksSinger([]int64{1, 3}, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, []int64{3}, invalid)
 
+	//地区配置了替换歌曲时以替换歌曲的艺人为准
+	extra := genTrackExtraOsExample()
+	extra.FtrackId, extra.FreplaceId = 3, 1
+	_, err = tracksDriver.InsertOneTrackExtraOs(extra)
+	assert.NoError(t, err)
+	invalid, err = tracksDriver.CheckTracksSinger([]int64{1, 3}, 2)
 	assert.NoError(t, err)
+	assert.Equal(t, []int64{}, invalid)
+}
 
-	newTrack, err := tracksDriver.GetOneTrack(track.FtrackId)
+//通用update同样递增Fversion
+func TestUpdateWithModelBumpsVersion(t *testing.T) {
+	tkSetup()
+	defer tkCleanup()
+	affected, err := tracksDriver.UpdateWithModel(&m.Track{}, "Ftrack_id = ?", map[string]interface{}{"Fnote": 3}, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), affected)
+	track, err := tracksDriver.GetOneTrack(1)
 	assert.NoError(t, err)
-	assert.Equal(t, newTrack.Fstatus, 50)
+	assert.Equal(t, int64(3), track.Fnote)
+	assert.Equal(t, int64(2), track.Fversion)
 }
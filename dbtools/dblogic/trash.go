@@ -0,0 +1,183 @@
+package dblogic
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/store_server/logger"
+
+	m "github.com/store_server/dbtools/models"
+)
+
+/*-------------------------- 软删除(回收站) -------------------------*/
+
+const (
+	trashPurgeBatch    = 1000
+	trashPurgeInterval = time.Hour
+)
+
+//支持回收站及变更历史的表, keys为记录唯一键字段(第一个字段为记录id)
+type recordTable struct {
+	keys     []string
+	newModel func() interface{}
+}
+
+var recordTables = map[string]*recordTable{
+	"t_track":              {[]string{"Ftrack_id"}, func() interface{} { return &m.Track{} }},
+	"t_track_extra_os":     {[]string{"Ftrack_id", "Fregion"}, func() interface{} { return &m.TrackExtraOs{} }},
+	"t_video":              {[]string{"Fid"}, func() interface{} { return &m.Video{} }},
+	"t_video_extra_os":     {[]string{"Flocal_id", "Fregion_id"}, func() interface{} { return &m.VideoExtraOs{} }},
+	"t_video_singer_track": {[]string{"Fid"}, func() interface{} { return &m.VideoSingerTrack{} }},
+	"t_album":              {[]string{"Falbum_id"}, func() interface{} { return &m.Album{} }},
+	"t_singer":             {[]string{"Fsinger_id"}, func() interface{} { return &m.Singer{} }},
+	"t_singer_alias":       {[]string{"Fid"}, func() interface{} { return &m.SingerAlias{} }},
+}
+
+//restore result
+type RestoreResult struct {
+	Restored int64            `json:"restored"`
+	Failed   map[int64]string `json:"failed,omitempty"` //回收站记录id -> 错误信息
+}
+
+//开启/关闭软删除模式
+func (bd *BaseDriver) SetSoftDelete(open bool) {
+	bd.softDelete = open
+}
+
+//将待删除记录写入回收站, 需在删除事务内调用
+func (bd *BaseDriver) moveToTrash(table string, rows []interface{}) error {
+	rt, ok := recordTables[table]
+	if !ok {
+		return fmt.Errorf("table %s not support soft delete", table)
+	}
+	info := bd.opInfo()
+	now := m.TimeNormal{time.Now()}
+	for _, row := range rows {
+		data, err := json.Marshal(row)
+		if err != nil {
+			return err
+		}
+		trash := &m.Trash{
+			Ftable:      table,
+			Fdata:       string(data),
+			Fdeleter:    info.Operator,
+			Freason:     info.Reason,
+			FdeleteTime: now,
+		}
+		trash.FrecordId, _ = bd.recordFields(row)[rt.keys[0]].(int64)
+		if err = bd.opDB.Create(trash).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//从回收站恢复单条记录, 事务内加锁读取回收站记录, 并发恢复时仅一个成功
+func (bd *BaseDriver) restoreOneTrash(trashId int64) error {
+	tx, err := bd.bBegin()
+	if err != nil {
+		return err
+	}
+	trash := &m.Trash{}
+	if err = forUpdate(tx.opDB).Where("Fid = ?", trashId).First(trash).Error; err != nil {
+		tx.bRollback()
+		if err == gorm.ErrRecordNotFound {
+			return fmt.Errorf("trash[%d] has been restored or purged", trashId)
+		}
+		return err
+	}
+	rt, ok := recordTables[trash.Ftable]
+	if !ok {
+		tx.bRollback()
+		return fmt.Errorf("table %s not support restore", trash.Ftable)
+	}
+	row := rt.newModel()
+	if err = json.Unmarshal([]byte(trash.Fdata), row); err != nil {
+		tx.bRollback()
+		return err
+	}
+	if err = tx.opDB.Create(row).Error; err != nil {
+		tx.bRollback()
+		return err
+	}
+	if err = tx.writeHistory(HistoryInsert, trash.Ftable, nil, row); err != nil {
+		tx.bRollback()
+		return err
+	}
+	if err = tx.opDB.Delete(&m.Trash{}, "Fid = ?", trash.Fid).Error; err != nil {
+		tx.bRollback()
+		return err
+	}
+	tx.bCommit()
+	return nil
+}
+
+//按回收站记录id或原表记录id恢复, 原表记录已存在时恢复失败; 回收站记录从主库读取
+func (bd *BaseDriver) RestoreTrash(tables []string, recordIds, trashIds []int64) (*RestoreResult, error) {
+	db := bd.opDB.Model(&m.Trash{})
+	if len(trashIds) != 0 {
+		db = db.Where("Fid in (?)", trashIds)
+	} else if len(recordIds) != 0 {
+		db = db.Where("Frecord_id in (?)", recordIds)
+	} else {
+		return nil, fmt.Errorf("restore ids is empty")
+	}
+	db = db.Where("Ftable in (?)", tables)
+	ids := make([]int64, 0)
+	if err := db.Order("Fid").Pluck("Fid", &ids).Error; err != nil {
+		return nil, err
+	}
+	ret := &RestoreResult{Failed: make(map[int64]string)}
+	for _, id := range ids {
+		if err := bd.restoreOneTrash(id); err != nil {
+			logger.Entry().Errorf("restore trash[%d] error: %v", id, err)
+			ret.Failed[id] = err.Error()
+			continue
+		}
+		ret.Restored++
+	}
+	return ret, nil
+}
+
+//清理删除时间早于before的回收站记录, 按id分批删除避免长事务(DELETE ... LIMIT仅mysql支持)
+func (bd *BaseDriver) PurgeTrash(before time.Time) (int64, error) {
+	var total int64
+	for {
+		ids := make([]int64, 0)
+		err := bd.opDB.Model(&m.Trash{}).Where("Fdelete_time < ?", before).Order("Fid").
+			Limit(trashPurgeBatch).Pluck("Fid", &ids).Error
+		if err != nil || len(ids) == 0 {
+			return total, err
+		}
+		ret := bd.opDB.Delete(&m.Trash{}, "Fid in (?)", ids)
+		if ret.Error != nil {
+			return total, ret.Error
+		}
+		total += ret.RowsAffected
+		if len(ids) < trashPurgeBatch {
+			return total, nil
+		}
+	}
+}
+
+//回收站保留期清理任务, retention为保留时长
+func (bd *BaseDriver) RunTrashPurge(ctx context.Context, retention time.Duration) {
+	ticker := time.NewTicker(trashPurgeInterval)
+	defer ticker.Stop()
+	for {
+		purged, err := bd.PurgeTrash(time.Now().Add(-retention))
+		if err != nil {
+			logger.Entry().Errorf("purge trash error: %v", err)
+		} else if purged != 0 {
+			logger.Entry().Infof("purge %d trash records older than %v", purged, retention)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package dblogic
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	m "github.com/store_server/dbtools/models"
+)
+
+func TestRestoreAndPurgeTrash(t *testing.T) {
+	tkSetup()
+	defer tkCleanup()
+	tracksDriver.SetSoftDelete(true)
+	_, err := tracksDriver.WithOp(&OpInfo{Operator: "tester"}).DeleteTracks([]int64{1}, nil)
+	assert.NoError(t, err)
+	trash := &m.Trash{}
+	assert.NoError(t, tracksDriver.opDB.Where("Frecord_id = ?", 1).First(trash).Error)
+
+	ret, err := tracksDriver.RestoreTracks([]int64{1}, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), ret.Restored)
+	_, err = tracksDriver.GetOneTrack(1)
+	assert.NoError(t, err)
+	//已恢复的回收站记录不能再次恢复
+	assert.Error(t, tracksDriver.restoreOneTrash(trash.Fid))
+
+	_, err = tracksDriver.DeleteTracks([]int64{1}, nil)
+	assert.NoError(t, err)
+	purged, err := tracksDriver.PurgeTrash(time.Now().Add(-time.Hour)) //未过期
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), purged)
+	purged, err = tracksDriver.PurgeTrash(time.Now().Add(time.Hour))
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), purged)
+	ret, err = tracksDriver.RestoreTracks([]int64{1}, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), ret.Restored)
+}
+
+//软删除模式下原生delete同样移入回收站
+func TestRawDeleteToTrash(t *testing.T) {
+	tkSetup()
+	defer tkCleanup()
+	tracksDriver.SetSoftDelete(true)
+	affected, err := tracksDriver.ExecRawUpdateOrInsertOrDeleteSql("DELETE FROM t_track WHERE Ftrack_id = 1", &m.Track{})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), affected)
+	_, err = tracksDriver.GetOneTrack(1)
+	assert.Error(t, err)
+	ret, err := tracksDriver.RestoreTracks([]int64{1}, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), ret.Restored)
+	_, err = tracksDriver.GetOneTrack(1)
+	assert.NoError(t, err)
+}
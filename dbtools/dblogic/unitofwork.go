@@ -0,0 +1,133 @@
+package dblogic
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/jinzhu/gorm"
+	"github.com/store_server/logger"
+)
+
+/*-------------------------- 跨driver事务(unit of work) -------------------------*/
+//Tracks/Videos为绑定同一事务的driver, 其写操作在事务单元内以savepoint嵌套, 最终统一提交或回滚;
+//事务单元非并发安全, 仅在单个goroutine内使用
+
+const savepointPrefix = "uow_sp_"
+
+//unit of work
+type UnitOfWork struct {
+	Tracks *TracksDriver
+	Videos *VideosDriver
+
+	db         *gorm.DB
+	seq        int
+	savepoints map[string]bool
+	finished   bool
+}
+
+//开始事务单元, 软删除、变更历史及操作信息等配置沿用td/vod
+func BeginUnitOfWork(td *TracksDriver, vod *VideosDriver) (*UnitOfWork, error) {
+	if td == nil || vod == nil {
+		return nil, fmt.Errorf("invalid driver pointer")
+	}
+	db := td.opDB.Begin()
+	if db.Error != nil {
+		return nil, db.Error
+	}
+	uow := &UnitOfWork{db: db, savepoints: make(map[string]bool)}
+	cms := td.CMSDriver.WithMusicDB(db)
+	uow.Tracks = &TracksDriver{cms, uow.bind(td.BaseDriver), sync.RWMutex{}}
+	uow.Videos = &VideosDriver{cms, uow.bind(vod.BaseDriver), sync.RWMutex{}}
+	logger.Entry().Debugf("UnitOfWork[db: %p] begin transaction...", db)
+	return uow, nil
+}
+
+//绑定到事务单元的BaseDriver副本
+func (uow *UnitOfWork) bind(bd *BaseDriver) *BaseDriver {
+	cv := *bd
+	cv.CMSDriver = bd.CMSDriver.WithMusicDB(uow.db)
+	cv.opDB = uow.db
+	cv.uow = uow
+	cv.savepoint = ""
+	return &cv
+}
+
+//创建savepoint, 返回savepoint名称
+func (uow *UnitOfWork) Savepoint() (string, error) {
+	if uow.finished {
+		return "", fmt.Errorf("unit of work already finished")
+	}
+	uow.seq++
+	name := fmt.Sprintf("%s%d", savepointPrefix, uow.seq)
+	if err := uow.db.Exec("SAVEPOINT " + name).Error; err != nil {
+		return "", err
+	}
+	uow.savepoints[name] = true
+	return name, nil
+}
+
+//回滚到savepoint, savepoint之后的写操作撤销, 事务继续
+func (uow *UnitOfWork) RollbackTo(name string) error {
+	if !uow.savepoints[name] {
+		return fmt.Errorf("savepoint %s not found", name)
+	}
+	return uow.db.Exec("ROLLBACK TO SAVEPOINT " + name).Error
+}
+
+//释放savepoint
+func (uow *UnitOfWork) Release(name string) error {
+	if !uow.savepoints[name] {
+		return fmt.Errorf("savepoint %s not found", name)
+	}
+	delete(uow.savepoints, name)
+	return uow.db.Exec("RELEASE SAVEPOINT " + name).Error
+}
+
+//提交事务单元
+func (uow *UnitOfWork) Commit() error {
+	if uow.finished {
+		return fmt.Errorf("unit of work already finished")
+	}
+	uow.finished = true
+	logger.Entry().Debugf("UnitOfWork[db: %p] commit...", uow.db)
+	if err := uow.db.Commit().Error; err != nil {
+		logger.Entry().Errorf("UnitOfWork commit err: %v", err)
+		uow.db.Rollback()
+		return err
+	}
+	return nil
+}
+
+//回滚事务单元, 已提交或回滚时忽略
+func (uow *UnitOfWork) Rollback() error {
+	if uow.finished {
+		return nil
+	}
+	uow.finished = true
+	logger.Entry().Debugf("UnitOfWork[db: %p] rollback...", uow.db)
+	return uow.db.Rollback().Error
+}
+
+//在事务单元内执行fn, fn返回错误或panic时回滚, 否则提交
+func RunUnitOfWork(td *TracksDriver, vod *VideosDriver, fn func(uow *UnitOfWork) error) (err error) {
+	uow, err := BeginUnitOfWork(td, vod)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			logger.Entry().Errorf("unit of work panic: %v", r)
+			if e := uow.Rollback(); e != nil {
+				logger.Entry().Errorf("UnitOfWork rollback err: %v", e)
+			}
+			err = fmt.Errorf("unit of work panic: %v", r)
+		}
+	}()
+	if err = fn(uow); err != nil {
+		if e := uow.Rollback(); e != nil {
+			logger.Entry().Errorf("UnitOfWork rollback err: %v", e)
+		}
+		return err
+	}
+	return uow.Commit()
+}
@@ -0,0 +1,117 @@
+package dblogic
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/jinzhu/gorm"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/store_server/dbtools/driver"
+)
+
+func TestUnitOfWorkFinished(t *testing.T) {
+	_, err := BeginUnitOfWork(nil, nil)
+	assert.Error(t, err)
+
+	uow := &UnitOfWork{savepoints: make(map[string]bool), finished: true}
+	assert.Error(t, uow.RollbackTo("uow_sp_1"))
+	assert.Error(t, uow.Release("uow_sp_1"))
+	_, err = uow.Savepoint()
+	assert.Error(t, err)
+	assert.Error(t, uow.Commit())
+	assert.NoError(t, uow.Rollback())
+}
+
+func uowSetup() {
+	tkSetup()
+	videosDriver = NewVideosDriver(&driver.CMSDriver{
+		MusicDB:  testScheme.DB(),
+		ImportDB: testScheme.DB(),
+	})
+}
+
+func uowCleanup() {
+	tkCleanup()
+	videosDriver = nil
+}
+
+func TestUnitOfWorkCommitAndRollback(t *testing.T) {
+	uowSetup()
+	defer uowCleanup()
+	err := RunUnitOfWork(tracksDriver, videosDriver, func(uow *UnitOfWork) error {
+		if _, err := uow.Tracks.InsertOneTrack(genTrackExample()); err != nil {
+			return err
+		}
+		_, err := uow.Videos.InsertOneVideo(genVideoExample())
+		return err
+	})
+	assert.NoError(t, err)
+	_, err = tracksDriver.GetOneTrack(2)
+	assert.NoError(t, err)
+	_, err = videosDriver.GetOneVideo(1)
+	assert.NoError(t, err)
+
+	//返回错误时回滚
+	err = RunUnitOfWork(tracksDriver, videosDriver, func(uow *UnitOfWork) error {
+		track := genTrackExample()
+		track.FtrackId = 3
+		if _, err := uow.Tracks.InsertOneTrack(track); err != nil {
+			return err
+		}
+		if _, err := uow.Videos.InsertOneVideo(genVideoExample()); err != nil {
+			return err
+		}
+		return errors.New("abort")
+	})
+	assert.EqualError(t, err, "abort")
+	_, err = tracksDriver.GetOneTrack(3)
+	assert.True(t, gorm.IsRecordNotFoundError(err))
+	_, err = videosDriver.GetOneVideo(2)
+	assert.True(t, gorm.IsRecordNotFoundError(err))
+
+	//panic时回滚
+	err = RunUnitOfWork(tracksDriver, videosDriver, func(uow *UnitOfWork) error {
+		track := genTrackExample()
+		track.FtrackId = 4
+		if _, err := uow.Tracks.InsertOneTrack(track); err != nil {
+			return err
+		}
+		panic("boom")
+	})
+	assert.Error(t, err)
+	_, err = tracksDriver.GetOneTrack(4)
+	assert.True(t, gorm.IsRecordNotFoundError(err))
+}
+
+//单个写操作失败时仅回滚到其savepoint, 事务单元继续并提交其余写操作
+func TestUnitOfWorkSavepoint(t *testing.T) {
+	uowSetup()
+	defer uowCleanup()
+	err := RunUnitOfWork(tracksDriver, videosDriver, func(uow *UnitOfWork) error {
+		if _, err := uow.Tracks.InsertOneTrack(genTrackExample()); err != nil {
+			return err
+		}
+		_, err := uow.Tracks.InsertOneTrack(genTrackExample()) //主键冲突
+		assert.Error(t, err)
+
+		sp, err := uow.Savepoint()
+		if err != nil {
+			return err
+		}
+		if _, err = uow.Tracks.UpdateTracksAttr([]int64{2}, nil, map[string]interface{}{"Fnote": 5}, nil); err != nil {
+			return err
+		}
+		if err = uow.RollbackTo(sp); err != nil {
+			return err
+		}
+		_, err = uow.Videos.InsertOneVideo(genVideoExample())
+		return err
+	})
+	assert.NoError(t, err)
+	track, err := tracksDriver.GetOneTrack(2)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(111), track.Fnote)
+	_, err = videosDriver.GetOneVideo(1)
+	assert.NoError(t, err)
+}
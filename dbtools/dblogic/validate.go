@@ -0,0 +1,507 @@
+package dblogic
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/jinzhu/gorm"
+	"github.com/store_server/dbtools/common"
+)
+
+/*-------------------------- 写入校验 -------------------------*/
+//model字段通过validate标签声明校验规则, 多个规则以逗号分隔, 规则参数以=分隔, 如:
+//FtrackName string `validate:"required,maxlen=255"`
+//insert(含批量写入)校验全部字段; update时struct仅校验非零值字段, map按列名校验待更新字段.
+//规则可通过配置全局关闭, 也可由调用方通过WithValidation按次跳过
+
+//跳过全部校验规则
+const SkipAllRules = "*"
+
+//校验规则, value为归一化后的字段值(int64/float64/string/bool), 不满足时返回错误信息
+type ValidateRule func(value interface{}, param string) error
+
+//字段校验错误
+type FieldError struct {
+	Field   string      `json:"field"`
+	Rule    string      `json:"rule"`
+	Message string      `json:"message"`
+	Value   interface{} `json:"value,omitempty"`
+}
+
+//写入校验失败, fields为所有不满足规则的字段
+type ValidationError struct {
+	Table  string        `json:"table"`
+	Fields []*FieldError `json:"fields"`
+}
+
+func (e *ValidationError) Error() string {
+	msgs := make([]string, 0, len(e.Fields))
+	for _, f := range e.Fields {
+		msgs = append(msgs, fmt.Sprintf("%s(%s): %s", f.Field, f.Rule, f.Message))
+	}
+	return fmt.Sprintf("validate %s failed: %s", e.Table, strings.Join(msgs, "; "))
+}
+
+func IsValidationError(err error) bool {
+	_, ok := err.(*ValidationError)
+	return ok
+}
+
+//全局校验配置, regions为合法地区id, 为空时不校验地区
+type ValidationOptions struct {
+	Disabled      bool
+	DisabledRules []string
+	Regions       []int64
+}
+
+type validation struct {
+	opts     ValidationOptions
+	disabled map[string]bool
+	regions  map[int64]bool
+	rules    map[string]ValidateRule
+	sync.RWMutex
+}
+
+var (
+	isrcPattern = regexp.MustCompile(`(?i)^[A-Z]{2}-?[A-Z0-9]{3}-?\d{2}-?\d{5}$`)
+	upcPattern  = regexp.MustCompile(`^\d{12,13}$`)
+
+	validator = &validation{rules: make(map[string]ValidateRule)}
+
+	//按model类型缓存字段规则
+	fieldRulesCache sync.Map
+)
+
+func init() { //内置规则
+	RegisterRule("required", ruleRequired)
+	RegisterRule("min", ruleMin)
+	RegisterRule("max", ruleMax)
+	RegisterRule("maxlen", ruleMaxLen)
+	RegisterRule("region", ruleRegion)
+	RegisterRule("source", ruleSource)
+	RegisterRule("isrc", rulePattern(isrcPattern, "invalid isrc"))
+	RegisterRule("upc", rulePattern(upcPattern, "invalid upc, should be 12 or 13 digits"))
+	RegisterRule("duration", ruleDuration)
+}
+
+//设置全局校验配置, 支持配置重载
+func SetValidationOptions(opts ValidationOptions) {
+	disabled := make(map[string]bool)
+	for _, r := range opts.DisabledRules {
+		disabled[r] = true
+	}
+	regions := make(map[int64]bool)
+	for _, r := range opts.Regions {
+		regions[r] = true
+	}
+	validator.Lock()
+	defer validator.Unlock()
+	validator.opts, validator.disabled, validator.regions = opts, disabled, regions
+}
+
+//注册校验规则, 同名规则覆盖内置规则
+func RegisterRule(name string, rule ValidateRule) {
+	validator.Lock()
+	defer validator.Unlock()
+	validator.rules[name] = rule
+}
+
+func (v *validation) rule(name string) (ValidateRule, bool) {
+	v.RLock()
+	defer v.RUnlock()
+	r, ok := v.rules[name]
+	return r, ok
+}
+
+func (v *validation) validRegion(region int64) bool {
+	v.RLock()
+	defer v.RUnlock()
+	return len(v.regions) == 0 || v.regions[region]
+}
+
+//当前生效的跳过规则, 返回nil时跳过全部校验
+func (v *validation) skipped(skipRules []string) map[string]bool {
+	v.RLock()
+	defer v.RUnlock()
+	if v.opts.Disabled {
+		return nil
+	}
+	skip := make(map[string]bool, len(v.disabled)+len(skipRules))
+	for r := range v.disabled {
+		skip[r] = true
+	}
+	for _, r := range skipRules {
+		if r == SkipAllRules {
+			return nil
+		}
+		skip[r] = true
+	}
+	return skip
+}
+
+/*-------------------------- 内置规则 -------------------------*/
+
+func ruleRequired(value interface{}, param string) error {
+	switch v := value.(type) {
+	case nil:
+		return fmt.Errorf("is required")
+	case string:
+		if len(strings.TrimSpace(v)) == 0 {
+			return fmt.Errorf("should not be empty")
+		}
+	case int64:
+		if v == 0 {
+			return fmt.Errorf("is required")
+		}
+	case float64:
+		if v == 0 {
+			return fmt.Errorf("is required")
+		}
+	}
+	return nil
+}
+
+func ruleMin(value interface{}, param string) error {
+	n, limit, err := numberAndParam(value, param)
+	if err != nil {
+		return err
+	}
+	if n < limit {
+		return fmt.Errorf("should be >= %s", param)
+	}
+	return nil
+}
+
+func ruleMax(value interface{}, param string) error {
+	n, limit, err := numberAndParam(value, param)
+	if err != nil {
+		return err
+	}
+	if n > limit {
+		return fmt.Errorf("should be <= %s", param)
+	}
+	return nil
+}
+
+func ruleMaxLen(value interface{}, param string) error {
+	s, ok := value.(string)
+	if !ok {
+		return nil
+	}
+	limit, err := strconv.Atoi(param)
+	if err != nil {
+		return fmt.Errorf("invalid rule param %s", param)
+	}
+	if utf8.RuneCountInString(s) > limit {
+		return fmt.Errorf("length should be <= %d", limit)
+	}
+	return nil
+}
+
+func ruleRegion(value interface{}, param string) error {
+	n, ok := toNumber(value)
+	if !ok || n != math.Trunc(n) {
+		return fmt.Errorf("should be an integer")
+	}
+	if !validator.validRegion(int64(n)) {
+		return fmt.Errorf("region %d is not valid", int64(n))
+	}
+	return nil
+}
+
+func ruleSource(value interface{}, param string) error {
+	n, ok := toNumber(value)
+	if !ok || n != math.Trunc(n) {
+		return fmt.Errorf("should be an integer")
+	}
+	if _, ok = common.SourceMap[int(n)]; !ok {
+		return fmt.Errorf("unknown source %d", int64(n))
+	}
+	return nil
+}
+
+//格式规则, 空字符串不校验(是否必填由required声明)
+func rulePattern(pattern *regexp.Regexp, msg string) ValidateRule {
+	return func(value interface{}, param string) error {
+		s, ok := value.(string)
+		if !ok {
+			return fmt.Errorf("should be a string")
+		}
+		if len(s) != 0 && !pattern.MatchString(s) {
+			return fmt.Errorf("%s", msg)
+		}
+		return nil
+	}
+}
+
+//时长为秒数或时长字符串(如3s、1m30s), 不能为负
+func ruleDuration(value interface{}, param string) error {
+	if s, ok := value.(string); ok {
+		if len(s) == 0 {
+			return nil
+		}
+		if _, err := strconv.ParseFloat(s, 64); err != nil { //非秒数时按时长字符串解析
+			d, err := time.ParseDuration(s)
+			if err != nil {
+				return fmt.Errorf("invalid duration %s", s)
+			}
+			value = d.Seconds()
+		}
+	}
+	n, ok := toNumber(value)
+	if !ok {
+		return fmt.Errorf("invalid duration")
+	}
+	if n < 0 {
+		return fmt.Errorf("should not be negative")
+	}
+	return nil
+}
+
+func numberAndParam(value interface{}, param string) (float64, float64, error) {
+	n, ok := toNumber(value)
+	if !ok {
+		return 0, 0, fmt.Errorf("should be a number")
+	}
+	limit, err := strconv.ParseFloat(param, 64)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid rule param %s", param)
+	}
+	return n, limit, nil
+}
+
+func toNumber(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case int64:
+		return float64(v), true
+	case float64:
+		return v, true
+	case string:
+		n, err := strconv.ParseFloat(v, 64)
+		return n, err == nil
+	}
+	return 0, false
+}
+
+//字段值归一化, 非基本类型(时间、json列、sql表达式等)返回false, 不做校验
+func normalizeValue(value interface{}) (interface{}, bool) {
+	if value == nil {
+		return nil, true
+	}
+	if n, ok := value.(json.Number); ok {
+		if i, err := n.Int64(); err == nil {
+			return i, true
+		}
+		f, err := n.Float64()
+		return f, err == nil
+	}
+	rv := reflect.ValueOf(value)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return rv.Int(), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return int64(rv.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return rv.Float(), true
+	case reflect.String:
+		return rv.String(), true
+	case reflect.Bool:
+		return rv.Bool(), true
+	}
+	return nil, false
+}
+
+/*-------------------------- model字段规则 -------------------------*/
+
+type fieldRule struct {
+	name  string
+	param string
+}
+
+type fieldRules struct {
+	index  int
+	column string
+	json   string
+	rules  []fieldRule
+}
+
+//model的字段规则, 按字段顺序
+func modelFieldRules(t reflect.Type) []*fieldRules {
+	for t.Kind() == reflect.Ptr || t.Kind() == reflect.Slice {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return nil
+	}
+	if v, ok := fieldRulesCache.Load(t); ok {
+		return v.([]*fieldRules)
+	}
+	frs := make([]*fieldRules, 0)
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		tag := sf.Tag.Get("validate")
+		if len(tag) == 0 || tag == "-" {
+			continue
+		}
+		fr := &fieldRules{index: i, column: columnOf(sf), json: strings.Split(sf.Tag.Get("json"), ",")[0]}
+		for _, r := range strings.Split(tag, ",") {
+			name, param := strings.TrimSpace(r), ""
+			if p := strings.Index(name, "="); p >= 0 {
+				name, param = name[:p], name[p+1:]
+			}
+			if len(name) != 0 {
+				fr.rules = append(fr.rules, fieldRule{name, param})
+			}
+		}
+		frs = append(frs, fr)
+	}
+	fieldRulesCache.Store(t, frs)
+	return frs
+}
+
+func columnOf(sf reflect.StructField) string {
+	for _, s := range strings.Split(sf.Tag.Get("gorm"), ";") {
+		if kv := strings.SplitN(s, ":", 2); len(kv) == 2 && strings.EqualFold(strings.TrimSpace(kv[0]), "column") {
+			return strings.TrimSpace(kv[1])
+		}
+	}
+	return gorm.ToColumnName(sf.Name)
+}
+
+func tableOf(model interface{}) string {
+	if t, ok := model.(interface{ TableName() string }); ok {
+		return t.TableName()
+	}
+	t := reflect.TypeOf(model)
+	for t.Kind() == reflect.Ptr || t.Kind() == reflect.Slice {
+		t = t.Elem()
+	}
+	return gorm.ToTableName(t.Name())
+}
+
+//按规则校验单个字段, required以外的规则跳过空值(nil)
+func checkField(fr *fieldRules, name string, value interface{}, skip map[string]bool) []*FieldError {
+	value, ok := normalizeValue(value)
+	if !ok {
+		return nil
+	}
+	errs := make([]*FieldError, 0)
+	for _, r := range fr.rules {
+		if skip[r.name] || (value == nil && r.name != "required") {
+			continue
+		}
+		rule, ok := validator.rule(r.name)
+		if !ok {
+			errs = append(errs, &FieldError{Field: name, Rule: r.name, Message: "unknown rule"})
+			continue
+		}
+		if err := rule(value, r.param); err != nil {
+			errs = append(errs, &FieldError{Field: name, Rule: r.name, Message: err.Error(), Value: value})
+		}
+	}
+	return errs
+}
+
+//校验单条记录的全部字段
+func validateRecord(value interface{}, skip map[string]bool) error {
+	rv := reflect.Indirect(reflect.ValueOf(value))
+	if rv.Kind() != reflect.Struct {
+		return nil
+	}
+	errs := make([]*FieldError, 0)
+	for _, fr := range modelFieldRules(rv.Type()) {
+		errs = append(errs, checkField(fr, fr.column, rv.Field(fr.index).Interface(), skip)...)
+	}
+	if len(errs) != 0 {
+		return &ValidationError{Table: tableOf(value), Fields: errs}
+	}
+	return nil
+}
+
+//校验待更新字段, map按列名(或json字段名)匹配规则, 未声明规则的字段不校验
+func validateAttrs(model interface{}, attrs interface{}, skip map[string]bool) error {
+	frs := modelFieldRules(reflect.TypeOf(model))
+	if len(frs) == 0 {
+		return nil
+	}
+	errs := make([]*FieldError, 0)
+	if src, ok := attrs.(map[string]interface{}); ok {
+		keys := make([]string, 0, len(src))
+		for k := range src {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			for _, fr := range frs {
+				if k == fr.column || k == fr.json {
+					errs = append(errs, checkField(fr, k, src[k], skip)...)
+					break
+				}
+			}
+		}
+	} else {
+		rv := reflect.Indirect(reflect.ValueOf(attrs))
+		if rv.Kind() != reflect.Struct || rv.Type() != reflect.Indirect(reflect.ValueOf(model)).Type() {
+			return nil
+		}
+		for _, fr := range frs {
+			f := rv.Field(fr.index)
+			if f.IsZero() { //与gorm一致忽略零值字段
+				continue
+			}
+			errs = append(errs, checkField(fr, fr.column, f.Interface(), skip)...)
+		}
+	}
+	if len(errs) != 0 {
+		return &ValidationError{Table: tableOf(model), Fields: errs}
+	}
+	return nil
+}
+
+//携带跳过校验规则的driver副本, skipRules含"*"时跳过全部校验
+func (bd *BaseDriver) withValidation(skipRules []string) *BaseDriver {
+	cv := *bd
+	cv.skipRules = skipRules
+	return &cv
+}
+
+//insert前校验记录, value为model指针或model切片
+func (bd *BaseDriver) validateInsert(value interface{}) error {
+	skip := validator.skipped(bd.skipRules)
+	if skip == nil {
+		return nil
+	}
+	rv := reflect.Indirect(reflect.ValueOf(value))
+	if rv.Kind() != reflect.Slice {
+		return validateRecord(value, skip)
+	}
+	for i := 0; i < rv.Len(); i++ {
+		if err := validateRecord(rv.Index(i).Interface(), skip); err != nil {
+			if ve, ok := err.(*ValidationError); ok {
+				for _, f := range ve.Fields {
+					f.Field = fmt.Sprintf("[%d].%s", i, f.Field)
+				}
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+//update前校验待更新字段, attrs为struct或map
+func (bd *BaseDriver) validateUpdate(model interface{}, attrs interface{}) error {
+	skip := validator.skipped(bd.skipRules)
+	if skip == nil {
+		return nil
+	}
+	return validateAttrs(model, attrs, skip)
+}
@@ -0,0 +1,79 @@
+package dblogic
+
+import (
+	"testing"
+
+	m "github.com/store_server/dbtools/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateInsert(t *testing.T) {
+	bd := &BaseDriver{}
+	err := bd.validateInsert(&m.Track{FtrackName: " ", Fduration: -1, Fisrc: "bad_isrc"})
+	ve, ok := err.(*ValidationError)
+	assert.True(t, ok)
+	assert.Equal(t, "t_track", ve.Table)
+	rules := make(map[string]string)
+	for _, f := range ve.Fields {
+		rules[f.Field] = f.Rule
+	}
+	assert.Equal(t, map[string]string{"Ftrack_name": "required", "Fduration": "min", "Fisrc": "isrc"}, rules)
+
+	assert.NoError(t, bd.validateInsert(&m.Track{FtrackName: "a", Fduration: 32, Fisrc: "CN-A01-19-00001"}))
+	assert.Error(t, bd.validateInsert(&m.TrackExtraOs{FlocalFrom: 1000}))
+	assert.Error(t, bd.validateInsert(&m.Video{Ftitle: "a", Fduration: "-3s"}))
+	assert.Error(t, bd.validateInsert(&m.Video{Ftitle: "a", Fupc: "12345"}))
+	assert.NoError(t, bd.validateInsert(&m.Video{Ftitle: "a", Fduration: "90", Fupc: "123456789012"}))
+
+	//跳过指定规则及全部规则
+	assert.NoError(t, bd.withValidation([]string{"required", "min", "isrc"}).validateInsert(
+		&m.Track{Fduration: -1, Fisrc: "bad_isrc"}))
+	assert.NoError(t, bd.withValidation([]string{SkipAllRules}).validateInsert(&m.Track{}))
+}
+
+func TestValidateUpdate(t *testing.T) {
+	bd := &BaseDriver{}
+	//struct仅校验非零值字段
+	assert.NoError(t, bd.validateUpdate(&m.Track{}, &m.Track{Fstatus: 1}))
+	assert.Error(t, bd.validateUpdate(&m.Track{}, &m.Track{Fduration: -1}))
+	//map按列名校验
+	err := bd.validateUpdate(&m.Track{}, map[string]interface{}{"Ftrack_name": "", "Fstatus": 1, "Fduration": float64(-2)})
+	ve, ok := err.(*ValidationError)
+	assert.True(t, ok)
+	assert.Equal(t, 2, len(ve.Fields))
+	assert.Equal(t, "Fduration", ve.Fields[0].Field)
+	assert.Equal(t, "Ftrack_name", ve.Fields[1].Field)
+	assert.NoError(t, bd.validateUpdate(&m.Singer{}, map[string]interface{}{"Fsinger_name": ""}))
+}
+
+func TestValidationOptions(t *testing.T) {
+	defer SetValidationOptions(ValidationOptions{})
+	bd := &BaseDriver{}
+	extra := &m.TrackExtraOs{Fregion: 3, FlocalFrom: 1}
+	assert.NoError(t, bd.validateInsert(extra))
+
+	SetValidationOptions(ValidationOptions{Regions: []int64{1, 2}})
+	assert.Error(t, bd.validateInsert(extra))
+	extra.Fregion = 2
+	assert.NoError(t, bd.validateInsert(extra))
+
+	SetValidationOptions(ValidationOptions{DisabledRules: []string{"required"}})
+	assert.NoError(t, bd.validateInsert(&m.Track{}))
+	SetValidationOptions(ValidationOptions{Disabled: true})
+	assert.NoError(t, bd.validateInsert(&m.Track{Fduration: -1}))
+}
+
+func TestBatchUpsertInvalid(t *testing.T) {
+	tkSetup()
+	defer tkCleanup()
+	tracks := []*m.Track{{FtrackId: 101, FtrackName: "a", Fduration: -1}, {FtrackId: 102, Fisrc: "bad_isrc"}}
+	results, err := tracksDriver.BatchUpsertTracks(tracks, BatchOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, BatchFailed, results[0].Action)
+	assert.Equal(t, "Fduration", results[0].Invalid[0].Field)
+	assert.Equal(t, BatchFailed, results[1].Action)
+	assert.Equal(t, 2, len(results[1].Invalid))
+
+	_, err = tracksDriver.InsertOneTrack(&m.Track{FtrackId: 103})
+	assert.True(t, IsValidationError(err))
+}
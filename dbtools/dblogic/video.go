@@ -19,19 +19,43 @@ type VideosDriver struct {
 }
 
 func NewVideosDriver(cmsDriver *driver.CMSDriver) *VideosDriver {
-	baseDriver := &BaseDriver{cmsDriver, cmsDriver.MusicDB}
+	baseDriver := &BaseDriver{CMSDriver: cmsDriver, opDB: cmsDriver.MusicDB}
 	return &VideosDriver{cmsDriver, baseDriver, sync.RWMutex{}}
 }
 
+func (vod *VideosDriver) WithOp(info *OpInfo) *VideosDriver { //携带操作人
+	return &VideosDriver{vod.CMSDriver, vod.BaseDriver.withOp(info), sync.RWMutex{}}
+}
+
+func (vod *VideosDriver) WithConfirm(confirm *WriteConfirm) *VideosDriver { //携带预演/确认信息
+	return &VideosDriver{vod.CMSDriver, vod.BaseDriver.withConfirm(confirm), sync.RWMutex{}}
+}
+
+func (vod *VideosDriver) WithFields(fields []string) *VideosDriver { //查询投影字段
+	return &VideosDriver{vod.CMSDriver, vod.BaseDriver.withFields(fields), sync.RWMutex{}}
+}
+
+func (vod *VideosDriver) WithPrimary(on bool) *VideosDriver { //读主库
+	return &VideosDriver{vod.CMSDriver, vod.BaseDriver.withPrimary(on), sync.RWMutex{}}
+}
+
+func (vod *VideosDriver) WithTrace(trace *driver.QueryTrace) *VideosDriver { //携带查询来源
+	return &VideosDriver{vod.CMSDriver, vod.BaseDriver.withTrace(trace), sync.RWMutex{}}
+}
+
+func (vod *VideosDriver) WithValidation(skipRules []string) *VideosDriver { //跳过校验规则
+	return &VideosDriver{vod.CMSDriver, vod.BaseDriver.withValidation(skipRules), sync.RWMutex{}}
+}
+
 var (
 	VoDriver *VideosDriver
 )
 
 /* ---------------------------- t_video ------------------------ */
 func (vod *VideosDriver) ExecRawQuerySql4Video(sql string, page,
-	pagesize int64) ([]*m.Video, int64, error) { //原生query语句
+	pagesize int64, count CountMode) ([]*m.Video, int64, error) { //原生query语句
 	vos := make([]*m.Video, 0)
-	res, total, err := vod.ExecRawQuerySql(sql, page, pagesize, &m.Video{})
+	res, total, err := vod.ExecRawQuerySql(sql, page, pagesize, &m.Video{}, count)
 	if err != nil {
 		return nil, 0, err
 	}
@@ -51,9 +75,10 @@ func (vod *VideosDriver) InsertOneVideo(vo *m.Video) (int64, error) {
 	return vo.Fid, err
 }
 
-func (vod *VideosDriver) UpdateOneVideo(id int64, vo *m.Video) (int64, error) {
+//更新视频, pre不为空时按Fmodify_time做乐观锁校验(t_video无Fversion)
+func (vod *VideosDriver) UpdateOneVideo(id int64, vo *m.Video, pre *UpdatePrecond) (int64, error) {
 	vo.FmodifyTime = m.TimeNormal{time.Now()}
-	affected, err := vod.UpdateWithModel(&m.Video{}, "Fid = ?", vo, id)
+	affected, err := vod.UpdateWithPrecond(&m.Video{}, pre, 1, "Fid = ?", vo, id)
 	if err != nil {
 		return vo.Fid, err
 	}
@@ -65,13 +90,17 @@ func (vod *VideosDriver) UpdateOneVideo(id int64, vo *m.Video) (int64, error) {
 
 func (vod *VideosDriver) GetOneVideo(id int64) (video *m.Video, err error) {
 	video = &m.Video{}
-	err = vod.MusicDB.First(video, "Fid=?", id).Error
+	err = vod.readDB().First(video, "Fid=?", id).Error
 	return
 }
 
 func (vod *VideosDriver) GetVideosByIds(ids []int64) ([]*m.Video, int64, error) {
 	var videos []*m.Video
-	err := vod.MusicDB.Where("Fid in (?)", ids).Find(&videos).Error
+	db, err := vod.selectFields(vod.readDB(), &m.Video{})
+	if err != nil {
+		return nil, 0, err
+	}
+	err = db.Where("Fid in (?)", ids).Find(&videos).Error
 	if err != nil {
 		return nil, 0, err
 	}
@@ -80,9 +109,9 @@ func (vod *VideosDriver) GetVideosByIds(ids []int64) ([]*m.Video, int64, error)
 }
 
 func (vod *VideosDriver) GetVideosByCondition(conds map[string]interface{}, page,
-	pagesize int64) ([]*m.Video, int64, error) {
+	pagesize int64, count CountMode) ([]*m.Video, int64, error) {
 	vos := make([]*m.Video, 0)
-	res, total, err := vod.QueryWithModel(&m.Video{}, conds, page, pagesize)
+	res, total, err := vod.QueryWithModel(&m.Video{}, conds, page, pagesize, count)
 	if err != nil {
 		return nil, 0, err
 	}
@@ -94,12 +123,43 @@ func (vod *VideosDriver) GetVideosByCondition(conds map[string]interface{}, page
 	return vos, total, err
 }
 
+func (vod *VideosDriver) GetVideosByQuery(q *QueryDSL, page,
+	pagesize int64, count CountMode) ([]*m.Video, int64, error) { //结构化查询
+	vos := make([]*m.Video, 0)
+	res, total, err := vod.QueryWithDSL(&m.Video{}, q, page, pagesize, count)
+	if err != nil {
+		return nil, 0, err
+	}
+	for _, r := range res {
+		if t, ok := r.(*m.Video); ok {
+			vos = append(vos, t)
+		}
+	}
+	return vos, total, err
+}
+
+func (vod *VideosDriver) GetVideosByCursor(q *QueryDSL, conds map[string]interface{},
+	cp *CursorPage) ([]*m.Video, string, error) { //游标分页查询
+	vos := make([]*m.Video, 0)
+	res, next, err := vod.QueryWithCursor(&m.Video{}, "Fid", q, conds, cp)
+	if err != nil {
+		return nil, "", err
+	}
+	for _, r := range res {
+		if t, ok := r.(*m.Video); ok {
+			vos = append(vos, t)
+		}
+	}
+	return vos, next, err
+}
+
+//批量更新视频, pre不为空时按Fmodify_time做乐观锁校验
 func (vod *VideosDriver) UpdateVideoAttr(ids []int64, conds,
-	updatesAttrs map[string]interface{}) (affected int64, err error) {
+	updatesAttrs map[string]interface{}, pre *UpdatePrecond) (affected int64, err error) {
 	if len(ids) > 0 {
-		affected, err = vod.UpdateWithModel(&m.Video{}, "Fid in (?)", updatesAttrs, ids)
+		affected, err = vod.UpdateWithPrecond(&m.Video{}, pre, int64(len(ids)), "Fid in (?)", updatesAttrs, ids)
 	} else if len(conds) != 0 {
-		affected, err = vod.UpdateWithModel(&m.Video{}, conds, updatesAttrs)
+		affected, err = vod.UpdateWithPrecond(&m.Video{}, pre, 0, conds, updatesAttrs)
 	}
 	if err != nil {
 		return affected, err
@@ -132,9 +192,9 @@ func (vod *VideosDriver) DeleteVideos(ids []int64, conds map[string]interface{})
 
 /* ---------------------------- t_video_extra_os ------------------------ */
 func (vod *VideosDriver) ExecRawQuerySql4VideoExtraOs(sql string, page,
-	pagesize int64) ([]*m.VideoExtraOs, int64, error) { //原生query语句
+	pagesize int64, count CountMode) ([]*m.VideoExtraOs, int64, error) { //原生query语句
 	vos := make([]*m.VideoExtraOs, 0)
-	res, total, err := vod.ExecRawQuerySql(sql, page, pagesize, &m.VideoExtraOs{})
+	res, total, err := vod.ExecRawQuerySql(sql, page, pagesize, &m.VideoExtraOs{}, count)
 	if err != nil {
 		return nil, 0, err
 	}
@@ -156,7 +216,7 @@ func (vod *VideosDriver) InsertOneVideoExtraOs(vo *m.VideoExtraOs) (int64, error
 
 func (vod *VideosDriver) GetVideoExtraOs(id, region int64) ([]*m.VideoExtraOs, int64, error) {
 	var videos []*m.VideoExtraOs
-	err := vod.MusicDB.Where("Flocal_id=? and Fregion_id=?", id, region).Find(&videos).Error
+	err := vod.readDB().Where("Flocal_id=? and Fregion_id=?", id, region).Find(&videos).Error
 	if err != nil {
 		return nil, 0, err
 	}
@@ -165,9 +225,24 @@ func (vod *VideosDriver) GetVideoExtraOs(id, region int64) ([]*m.VideoExtraOs, i
 }
 
 func (vod *VideosDriver) GetVideoExtraOsByCondition(conds map[string]interface{}, page,
-	pagesize int64) ([]*m.VideoExtraOs, int64, error) {
+	pagesize int64, count CountMode) ([]*m.VideoExtraOs, int64, error) {
 	videos := make([]*m.VideoExtraOs, 0)
-	res, total, err := vod.QueryWithModel(&m.VideoExtraOs{}, conds, page, pagesize)
+	res, total, err := vod.QueryWithModel(&m.VideoExtraOs{}, conds, page, pagesize, count)
+	if err != nil {
+		return nil, 0, err
+	}
+	for _, r := range res {
+		if t, ok := r.(*m.VideoExtraOs); ok {
+			videos = append(videos, t)
+		}
+	}
+	return videos, total, err
+}
+
+func (vod *VideosDriver) GetVideoExtraOsByQuery(q *QueryDSL, page,
+	pagesize int64, count CountMode) ([]*m.VideoExtraOs, int64, error) { //结构化查询
+	videos := make([]*m.VideoExtraOs, 0)
+	res, total, err := vod.QueryWithDSL(&m.VideoExtraOs{}, q, page, pagesize, count)
 	if err != nil {
 		return nil, 0, err
 	}
@@ -181,7 +256,7 @@ func (vod *VideosDriver) GetVideoExtraOsByCondition(conds map[string]interface{}
 
 func (vod *VideosDriver) DeleteVideoExtraOs(ids []int64, conds map[string]interface{}) (affected int64, err error) {
 	if len(ids) > 0 {
-		affected, err = vod.DeleteWithModel(&m.VideoExtraOs{}, "Flocal id in (?)", ids)
+		affected, err = vod.DeleteWithModel(&m.VideoExtraOs{}, "Flocal_id in (?)", ids)
 	} else if len(conds) != 0 { //删除条件需严格把关
 		logger.Entry().Debugf("delete video extra os condition: %v", conds)
 		affected, err = vod.DeleteWithModel(&m.VideoExtraOs{}, conds)
@@ -197,11 +272,29 @@ func (vod *VideosDriver) DeleteVideoExtraOs(ids []int64, conds map[string]interf
 	return affected, nil
 }
 
+//从回收站恢复视频相关记录
+func (vod *VideosDriver) RestoreVideos(recordIds, trashIds []int64) (*RestoreResult, error) {
+	return vod.RestoreTrash(videoTables, recordIds, trashIds)
+}
+
+var videoTables = []string{"t_video", "t_video_extra_os", "t_video_singer_track"}
+
+//查询视频相关记录的变更历史
+func (vod *VideosDriver) GetVideoHistory(id int64, requestId string, page,
+	pagesize int64) ([]*m.History, int64, error) {
+	return vod.QueryHistory(videoTables, id, requestId, page, pagesize)
+}
+
+//回滚视频变更历史对应的变更
+func (vod *VideosDriver) RollbackVideoHistory(historyId int64) (int64, error) {
+	return vod.RollbackHistory(videoTables, historyId)
+}
+
 /* ---------------------------- t_video_singer_track ------------------------ */
 func (vod *VideosDriver) ExecRawQuerySql4VideoSingerTrack(sql string, page,
-	pagesize int64) ([]*m.VideoSingerTrack, int64, error) { //原生query语句
+	pagesize int64, count CountMode) ([]*m.VideoSingerTrack, int64, error) { //原生query语句
 	vos := make([]*m.VideoSingerTrack, 0)
-	res, total, err := vod.ExecRawQuerySql(sql, page, pagesize, &m.VideoSingerTrack{})
+	res, total, err := vod.ExecRawQuerySql(sql, page, pagesize, &m.VideoSingerTrack{}, count)
 	if err != nil {
 		return nil, 0, err
 	}
@@ -235,7 +328,7 @@ func (vod *VideosDriver) UpdateOneVideoSingerTrack(id int64, vo *m.VideoSingerTr
 
 func (vod *VideosDriver) GetVideoSingerTrack(id, region int64) (videos []*m.VideoSingerTrack, total int64, err error) {
 	videos = []*m.VideoSingerTrack{}
-	err = vod.MusicDB.Where("Flocal_v_id=? and Fregion_id=?", id, region).Find(&videos).Error
+	err = vod.readDB().Where("Flocal_v_id=? and Fregion_id=?", id, region).Find(&videos).Error
 	if err != nil {
 		return
 	}
@@ -244,9 +337,24 @@ func (vod *VideosDriver) GetVideoSingerTrack(id, region int64) (videos []*m.Vide
 }
 
 func (vod *VideosDriver) GetVideoSingerTrackByCondition(conds map[string]interface{}, page,
-	pagesize int64) ([]*m.VideoSingerTrack, int64, error) {
+	pagesize int64, count CountMode) ([]*m.VideoSingerTrack, int64, error) {
+	vos := make([]*m.VideoSingerTrack, 0)
+	res, total, err := vod.QueryWithModel(&m.VideoSingerTrack{}, conds, page, pagesize, count)
+	if err != nil {
+		return nil, 0, err
+	}
+	for _, r := range res {
+		if t, ok := r.(*m.VideoSingerTrack); ok {
+			vos = append(vos, t)
+		}
+	}
+	return vos, total, err
+}
+
+func (vod *VideosDriver) GetVideoSingerTrackByQuery(q *QueryDSL, page,
+	pagesize int64, count CountMode) ([]*m.VideoSingerTrack, int64, error) { //结构化查询
 	vos := make([]*m.VideoSingerTrack, 0)
-	res, total, err := vod.QueryWithModel(&m.VideoSingerTrack{}, conds, page, pagesize)
+	res, total, err := vod.QueryWithDSL(&m.VideoSingerTrack{}, q, page, pagesize, count)
 	if err != nil {
 		return nil, 0, err
 	}
@@ -2,6 +2,7 @@ package dblogic
 
 import (
 	"testing"
+	"time"
 
 	"github.com/store_server/dbtools/driver"
 	"github.com/stretchr/testify/assert"
@@ -14,26 +15,16 @@ var (
 )
 
 func voSetup() {
-	driver.DefaultTestScheme.Setup()
-	driver.DefaultTestMongoScheme.Setup()
-	videosDriver = &VideosDriver{
-		&driver.CMSDriver{
-			MusicDB:  driver.DefaultTestScheme.DB(),
-			ImportDB: driver.DefaultTestScheme.DB(),
-		},
-		lock,
-	}
+	testScheme.Setup()
+	videosDriver = NewVideosDriver(&driver.CMSDriver{
+		MusicDB:  testScheme.DB(),
+		ImportDB: testScheme.DB(),
+	})
 }
 
 func voCleanup() {
-	driver.DefaultTestScheme.Cleanup()
-	driver.DefaultTestMongoScheme.Cleanup()
-	if videosDriver != nil {
-		if videosDriver.CMSDriver != nil {
-			videosDriver.CMSDriver.Close()
-		}
-		videosDriver = nil
-	}
+	testScheme.Cleanup()
+	videosDriver = nil
 }
 
 func genVideoExample() *m.Video {
@@ -50,8 +41,8 @@ func genVideoExample() *m.Video {
 		Fduration:     "3s",
 		Fformat:       ".mp4",
 		Fsize:         "128k",
-		Fupc:          "test_upc",
-		Fisrc:         "test_isrc",
+		Fupc:          "123456789012",
+		Fisrc:         "CNA011900001",
 		Fgrid:         "test_grid",
 		FuploadStatus: int64(2),
 		Fwatermark:    int64(1),
@@ -64,7 +55,7 @@ func TestInsertVideo(t *testing.T) {
 	voSetup()
 	defer voCleanup()
 	video := genVideoExample()
-	id, err := videosDriver.InsertVideo(video)
+	id, err := videosDriver.InsertOneVideo(video)
 	assert.NoError(t, err)
 	assert.Equal(t, id, int64(1))
 
@@ -73,5 +64,35 @@ func TestInsertVideo(t *testing.T) {
 	assert.Equal(t, data.Fsize, "128k")
 	assert.Equal(t, data.Fcreator, "erichli")
 	assert.Equal(t, data.Fuuid, "test_uuid")
-	assert.Equal(t, data.FuploadStatus, int(2))
+	assert.Equal(t, data.FuploadStatus, int64(2))
+
+	id, err = videosDriver.InsertOneVideo(genVideoExample())
+	assert.NoError(t, err)
+	assert.Equal(t, id, int64(2))
+}
+
+//t_video无Fversion, 前置条件仅支持Fmodify_time
+func TestUpdateVideoAttrPrecond(t *testing.T) {
+	voSetup()
+	defer voCleanup()
+	id, err := videosDriver.InsertOneVideo(genVideoExample())
+	assert.NoError(t, err)
+	data, err := videosDriver.GetOneVideo(id)
+	assert.NoError(t, err)
+
+	stale := m.TimeNormal{time.Unix(0, 0)}
+	_, err = videosDriver.UpdateVideoAttr([]int64{id}, nil, map[string]interface{}{"Ftitle": "renamed"},
+		&UpdatePrecond{ModifyTime: &stale})
+	assert.True(t, IsConflictError(err))
+	version := int64(1)
+	_, err = videosDriver.UpdateVideoAttr([]int64{id}, nil, map[string]interface{}{"Ftitle": "renamed"},
+		&UpdatePrecond{Version: &version})
+	assert.Error(t, err)
+	affected, err := videosDriver.UpdateVideoAttr([]int64{id}, nil, map[string]interface{}{"Ftitle": "renamed"},
+		&UpdatePrecond{ModifyTime: &data.FmodifyTime})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), affected)
+	data, err = videosDriver.GetOneVideo(id)
+	assert.NoError(t, err)
+	assert.Equal(t, "renamed", data.Ftitle)
 }
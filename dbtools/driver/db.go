@@ -6,16 +6,18 @@ import (
 	"fmt"
 	"os"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/jinzhu/gorm"
-	"github.com/store_server/dbtools/models"
+	"github.com/store_server/dbtools/migrate"
 	"github.com/store_server/logger"
 	"github.com/store_server/utils/common"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 
+	mysqld "github.com/go-sql-driver/mysql"
 	_ "github.com/jinzhu/gorm/dialects/mysql" //初始化mysql driver
 	log "github.com/store_server/logger"
 )
@@ -34,40 +36,120 @@ var (
 	mongo_db_name = getEnvOrDefault("MONGO_DBNAME", "music_cms")
 )
 
-var Tables = []interface{}{
-	&models.Track{}, &models.TrackExtraOs{},
+const (
+	defaultMaxOpenConns    = 200
+	defaultMaxIdleConns    = 10
+	defaultConnMaxLifetime = 10 * time.Minute
+)
+
+//mysql逻辑库配置, Dsn不为空时直接使用, 否则由Host等字段拼接; 连接池参数为0时使用默认值
+type MysqlConfig struct {
+	Dsn      string
+	Host     string
+	Port     int
+	User     string
+	Passwd   string
+	Database string
+	Charset  string
+	Params   map[string]string //其他dsn参数, 如loc
+
+	Timeout      time.Duration //建立连接超时
+	ReadTimeout  time.Duration
+	WriteTimeout time.Duration
+
+	MaxOpenConns    int
+	MaxIdleConns    int
+	ConnMaxLifetime time.Duration
+	ConnMaxIdleTime time.Duration
+}
+
+//拼接dsn
+func (c *MysqlConfig) DSN() string {
+	if len(c.Dsn) != 0 {
+		return c.Dsn
+	}
+	if len(c.Host) == 0 {
+		return ""
+	}
+	mc := mysqld.NewConfig()
+	mc.User, mc.Passwd, mc.DBName = c.User, c.Passwd, c.Database
+	mc.Net, mc.Addr = "tcp", c.Host
+	if c.Port > 0 {
+		mc.Addr = fmt.Sprintf("%s:%d", c.Host, c.Port)
+	}
+	mc.ParseTime, mc.Loc = true, time.Local
+	mc.Timeout, mc.ReadTimeout, mc.WriteTimeout = c.Timeout, c.ReadTimeout, c.WriteTimeout
+	mc.Params = map[string]string{"charset": "utf8"}
+	if len(c.Charset) != 0 {
+		mc.Params["charset"] = c.Charset
+	}
+	for k, v := range c.Params {
+		mc.Params[k] = v
+	}
+	return mc.FormatDSN()
+}
+
+func (c *MysqlConfig) setPool(db *sql.DB) {
+	maxOpen, maxIdle, lifetime := defaultMaxOpenConns, defaultMaxIdleConns, defaultConnMaxLifetime
+	if c.MaxOpenConns > 0 {
+		maxOpen = c.MaxOpenConns
+	}
+	if c.MaxIdleConns > 0 {
+		maxIdle = c.MaxIdleConns
+	}
+	if c.ConnMaxLifetime > 0 {
+		lifetime = c.ConnMaxLifetime
+	}
+	db.SetMaxOpenConns(maxOpen)
+	db.SetMaxIdleConns(maxIdle)
+	db.SetConnMaxLifetime(lifetime)
+	if c.ConnMaxIdleTime > 0 {
+		db.SetConnMaxIdleTime(c.ConnMaxIdleTime)
+	}
 }
 
 func CreateDB(cf string) (db *gorm.DB, err error) {
-	if len(cf) == 0 {
+	return CreateDBWithConfig("", &MysqlConfig{Dsn: cf})
+}
+
+//按逻辑库配置创建gorm db, name不为空时上报连接池及查询耗时监控
+func CreateDBWithConfig(name string, c *MysqlConfig) (db *gorm.DB, err error) {
+	if c == nil || len(c.DSN()) == 0 {
 		err = fmt.Errorf("mysql config is empty.")
 		return
 	}
-	db, err = gorm.Open("mysql", cf)
+	db, err = gorm.Open("mysql", c.DSN())
 	if err != nil {
 		return
 	}
 	db.SingularTable(true) //全局禁用表名复数
-	db.DB().SetConnMaxLifetime(time.Minute * 10)
-	db.DB().SetMaxIdleConns(10)
-	db.DB().SetMaxOpenConns(200)
-	for _, _ = range Tables { //no permission for product db
-		//db.AutoMigrate(item)
+	c.setPool(db.DB())
+	//表结构由dbtools/migrate版本迁移管理, 不使用AutoMigrate
+	if len(name) != 0 {
+		registerQueryMetrics(name, db)
+		registerDBStats(name, db.DB())
 	}
 	return
 }
 
 func CreateRawDB(cf string) (db *sql.DB, err error) {
-	if len(cf) == 0 {
+	return CreateRawDBWithConfig("", &MysqlConfig{Dsn: cf})
+}
+
+//按逻辑库配置创建原生db, name不为空时上报连接池监控
+func CreateRawDBWithConfig(name string, c *MysqlConfig) (db *sql.DB, err error) {
+	if c == nil || len(c.DSN()) == 0 {
 		err = fmt.Errorf("mysql config is empty.")
 		return
 	}
-	db, err = sql.Open("mysql", cf)
+	db, err = sql.Open("mysql", c.DSN())
 	if err != nil {
 		return nil, err
 	}
-	db.SetMaxIdleConns(10)
-	db.SetMaxOpenConns(200)
+	c.setPool(db)
+	if len(name) != 0 {
+		registerDBStats(name, db)
+	}
 	return db, nil
 }
 
@@ -87,40 +169,96 @@ func CreateMongo(opts *options.ClientOptions) (client *mongo.Client, err error)
 }
 
 /*封装测试MYSQL DB环境*/
+//测试后端由环境变量STORE_TEST_BACKEND指定, embedded(默认)时使用sqlite内存库, 无需外部依赖;
+//integration时连接MYSQL_*环境变量指定的mysql. 两种后端的表结构均由dbtools/migrate迁移文件创建.
+//sqlite方言由测试包引入: import _ "github.com/jinzhu/gorm/dialects/sqlite"
+const (
+	TestBackendEmbedded    = "embedded"
+	TestBackendIntegration = "integration"
+
+	dialectMysql  = "mysql"
+	dialectSqlite = "sqlite3"
+)
+
+func TestBackend() string {
+	return getEnvOrDefault("STORE_TEST_BACKEND", TestBackendEmbedded)
+}
+
 type Scheme struct {
-	localDB *gorm.DB
-	Mysql   string
+	localDB  *gorm.DB
+	Mysql    string
+	Dialect  string //mysql或sqlite3, 为空时按测试后端选择
+	Schema   string //建表使用的迁移目录, 为空时为music
+	Fixtures string //fixture目录, 每个<表名>.json文件为该表的初始数据
 	sync.RWMutex
 }
 
 var DefaultTestScheme = &Scheme{Mysql: mysql}
 
+var sqliteSeq int64
+
 func (s *Scheme) DB() *gorm.DB {
 	s.createDB()
 	return s.localDB
 }
 
+func (s *Scheme) dialect() string {
+	if len(s.Dialect) != 0 {
+		return s.Dialect
+	}
+	if TestBackend() == TestBackendIntegration {
+		return dialectMysql
+	}
+	return dialectSqlite
+}
+
 func (s *Scheme) createDB() {
 	s.Lock()
 	defer s.Unlock()
 	if s.localDB != nil {
 		return
 	}
-
-	db, err := CreateDB(s.Mysql)
-	if err != nil {
-		log.Fatal(err)
+	schema := s.Schema
+	if len(schema) == 0 {
+		schema = migrate.MusicSchema
 	}
-	for _, item := range Tables { //删除旧表
-		if db.HasTable(item) {
-			if err := db.DropTable(item).Error; err != nil {
+
+	var db *gorm.DB
+	var err error
+	ctx := context.Background()
+	if s.dialect() == dialectSqlite {
+		//每次创建独立的共享缓存内存库, 最后一个连接关闭时释放
+		name := fmt.Sprintf("file:store_test_%d?mode=memory&cache=shared&_loc=auto", atomic.AddInt64(&sqliteSeq, 1))
+		if db, err = gorm.Open(dialectSqlite, name); err != nil {
+			log.Fatal(err)
+		}
+		db.SingularTable(true)
+		if err = migrate.CreateSQLite(ctx, db.DB(), schema); err != nil {
+			log.Fatal(err)
+		}
+	} else {
+		if db, err = CreateDB(s.Mysql); err != nil {
+			log.Fatal(err)
+		}
+		var tables []string
+		if tables, err = migrate.Tables(schema); err != nil {
+			log.Fatal(err)
+		}
+		for _, table := range append(tables, "schema_migrations") { //删除旧表
+			if err = db.DropTableIfExists(table).Error; err != nil {
 				log.Fatal(err)
 			}
 		}
+		mg, err := migrate.NewMigrator(db.DB(), schema)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if _, err = mg.Up(ctx, -1); err != nil {
+			log.Fatal(err)
+		}
 	}
-	db = db.Set("gorm:table_options", "ENGINE=InnoDB CHARSET=utf8")
-	for _, item := range Tables { //根据model自动更新表结构
-		if err := db.AutoMigrate(item).Error; err != nil {
+	if len(s.Fixtures) != 0 {
+		if err = LoadFixtures(db, s.Fixtures); err != nil {
 			log.Fatal(err)
 		}
 	}
@@ -134,13 +272,14 @@ func (s *Scheme) Setup() {
 	s.createDB()
 }
 
+//关闭测试库, sqlite内存库随之释放, 下次Setup重新建表并导入fixture
 func (s *Scheme) Cleanup() {
-	/*db := s.localDB
-	for _, item := range Tables {
-		if err := db.Delete(item).Error; err != nil {
-			log.Fatal(err)
-		}
-	}*/
+	s.Lock()
+	defer s.Unlock()
+	if s.localDB != nil {
+		s.localDB.Close()
+		s.localDB = nil
+	}
 }
 
 var Collections = []string{"auto_publish_album_test", "singer_info_test"}
@@ -156,7 +295,7 @@ type MongoScheme struct {
 	Ctx context.Context
 }
 
-var DefaultTestMongoScheme = &MongoScheme{opts: mockClientopts()}
+var DefaultTestMongoScheme = &MongoScheme{Mongo: mongo_conf, opts: mockClientopts()}
 
 func mockClientopts() *options.ClientOptions {
 	//mock mongo client options
@@ -201,7 +340,11 @@ func (s *MongoScheme) createClient() {
 		return
 	}
 	s.Ctx = context.Background()
-	mdb, err := CreateMongo(s.opts)
+	opts := s.opts
+	if len(s.Mongo) != 0 { //MONGO_*环境变量拼接的连接串
+		opts = options.Client().ApplyURI(s.Mongo)
+	}
+	mdb, err := CreateMongo(opts)
 	if err != nil {
 		fmt.Printf("----------------- create mongo db client error: %v --------------------\n", err)
 		log.Fatal(err)
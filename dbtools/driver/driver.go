@@ -25,6 +25,7 @@ type CMSDriver struct {
 	RawDB       *sql.DB
 	MongoClient *mongo.Client
 	ImportMongo *mongo.Client
+	Replicas    map[string]*ReplicaSet //逻辑库名称对应的只读从库
 	sync.RWMutex
 	Ctx    context.Context
 	Cancel func()
@@ -48,6 +49,23 @@ func (cd *CMSDriver) clone() *CMSDriver {
 	return cv
 }
 
+//以db替换MusicDB的driver副本, 用于在外部事务内操作MusicDB
+func (cd *CMSDriver) WithMusicDB(db *gorm.DB) *CMSDriver {
+	return &CMSDriver{
+		MusicDB:     db,
+		ImportDB:    cd.ImportDB,
+		KtrackDB:    cd.KtrackDB,
+		KlyricDB:    cd.KlyricDB,
+		LyricDB:     cd.LyricDB,
+		RawDB:       cd.RawDB,
+		MongoClient: cd.MongoClient,
+		ImportMongo: cd.ImportMongo,
+		Replicas:    cd.Replicas,
+		Ctx:         cd.Ctx,
+		Cancel:      cd.Cancel,
+	}
+}
+
 func (cd *CMSDriver) Begin() (cv *CMSDriver, err error) { //开始事务
 	cv = cd.clone()
 	err = cv.MusicDB.Error
@@ -80,6 +98,15 @@ func (cd *CMSDriver) Close() {
 	if cd.ImportDB != nil {
 		cd.ImportDB.Close()
 	}
+	if cd.LyricDB != nil {
+		cd.LyricDB.Close()
+	}
+	if cd.KlyricDB != nil {
+		cd.KlyricDB.Close()
+	}
+	for _, rs := range cd.Replicas {
+		rs.Close()
+	}
 	if cd.MongoClient != nil {
 		cd.MongoClient.Disconnect(cd.Ctx)
 	}
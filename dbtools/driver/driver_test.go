@@ -2,29 +2,53 @@ package driver
 
 import (
 	"context"
-	//"testing"
-	//"github.com/stretchr/testify/assert"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	_ "github.com/jinzhu/gorm/dialects/sqlite" //embedded测试后端
 )
 
 var (
-	cmsDriver *CMSDriver
+	cmsDriver  *CMSDriver
+	testScheme = &Scheme{Mysql: mysql, Fixtures: "testdata/fixtures"}
 )
 
 func setup() {
-	DefaultTestScheme.Setup()
-	DefaultTestMongoScheme.Setup()
+	testScheme.Setup()
 	ct := context.Background()
 	cmsDriver = &CMSDriver{
-		ctx:     ct,
-		MusicDB: DefaultTestScheme.DB(),
+		Ctx:     ct,
+		MusicDB: testScheme.DB(),
 	}
 }
 
 func cleanup() {
-	DefaultTestScheme.Cleanup()
-	DefaultTestMongoScheme.Cleanup()
-	if cmsDriver != nil {
-		cmsDriver.MusicDB.Close()
-	}
+	testScheme.Cleanup()
 	cmsDriver = nil
 }
+
+func TestSchemeFixtures(t *testing.T) {
+	setup()
+	defer cleanup()
+	var name string
+	var total int64
+	db := cmsDriver.MusicDB
+	assert.Nil(t, db.Table("t_singer").Where("Fsinger_id = ?", 71).Select("Fsinger_name").Row().Scan(&name))
+	assert.Equal(t, "test_singer", name)
+	assert.Nil(t, db.Table("t_singer").Count(&total).Error)
+	assert.Equal(t, int64(2), total)
+
+	//自增主键及默认值
+	assert.Nil(t, db.Exec("INSERT INTO t_singer_alias (Fsinger_id, Falias_name) VALUES (?, ?)", 72, "alias_2").Error)
+	var id, lang int64
+	assert.Nil(t, db.Table("t_singer_alias").Where("Falias_name = ?", "alias_2").Select("Fid, Flanguage").Row().Scan(&id, &lang))
+	assert.Equal(t, int64(2), id)
+	assert.Equal(t, int64(0), lang)
+
+	//重新Setup后为新库
+	cleanup()
+	setup()
+	assert.Nil(t, cmsDriver.MusicDB.Table("t_singer_alias").Count(&total).Error)
+	assert.Equal(t, int64(1), total)
+}
@@ -0,0 +1,89 @@
+package driver
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/jinzhu/gorm"
+)
+
+/*-------------------------- 测试数据 -------------------------*/
+//fixture目录下每个<表名>.json文件为json数组, 数组元素为列名到值的映射, 如:
+//[{"Ftrack_id": 1, "Ftrack_name": "test", "Fvalid_time": "2020-01-01 00:00:00"}]
+//对象或数组类型的值(json列)按json字符串写入
+
+//按文件名顺序导入fixture目录下的表数据
+func LoadFixtures(db *gorm.DB, dir string) error {
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return err
+	}
+	sort.Strings(files)
+	for _, file := range files {
+		table := strings.TrimSuffix(filepath.Base(file), ".json")
+		rows, err := readFixture(file)
+		if err != nil {
+			return err
+		}
+		for i, row := range rows {
+			if err = insertFixtureRow(db, table, row); err != nil {
+				return fmt.Errorf("load fixture %s row %d error: %v", file, i, err)
+			}
+		}
+	}
+	return nil
+}
+
+func readFixture(file string) ([]map[string]interface{}, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	rows := make([]map[string]interface{}, 0)
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if err = dec.Decode(&rows); err != nil {
+		return nil, fmt.Errorf("parse fixture %s error: %v", file, err)
+	}
+	return rows, nil
+}
+
+func insertFixtureRow(db *gorm.DB, table string, row map[string]interface{}) error {
+	columns := make([]string, 0, len(row))
+	for col := range row {
+		columns = append(columns, col)
+	}
+	sort.Strings(columns)
+	quoted, holders := make([]string, 0, len(columns)), make([]string, 0, len(columns))
+	values := make([]interface{}, 0, len(columns))
+	for _, col := range columns {
+		v, err := fixtureValue(row[col])
+		if err != nil {
+			return err
+		}
+		quoted, holders = append(quoted, db.Dialect().Quote(col)), append(holders, "?")
+		values = append(values, v)
+	}
+	sql := fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)", db.Dialect().Quote(table),
+		strings.Join(quoted, ", "), strings.Join(holders, ", "))
+	return db.Exec(sql, values...).Error
+}
+
+func fixtureValue(v interface{}) (interface{}, error) {
+	switch val := v.(type) {
+	case json.Number:
+		if i, err := val.Int64(); err == nil {
+			return i, nil
+		}
+		return val.Float64()
+	case map[string]interface{}, []interface{}:
+		data, err := json.Marshal(val)
+		return string(data), err
+	}
+	return v, nil
+}
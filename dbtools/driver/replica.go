@@ -0,0 +1,248 @@
+package driver
+
+import (
+	"context"
+	osql "database/sql"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/store_server/logger"
+)
+
+/*-------------------------- 读写分离(read replicas) -------------------------*/
+//每个逻辑库可配置多个只读从库, 查询轮询健康且延迟不超过阈值的从库, 无可用从库时回退主库
+
+//逻辑库名称, 与从库配置的key一致
+const (
+	MusicDBName  = "musicDB"
+	ImportDBName = "importDB"
+	KtrackDBName = "ktrackDB"
+	LyricDBName  = "lyricDB"
+	KlyricDBName = "klyricDB"
+)
+
+const (
+	defaultReplicaMaxLag        = 5 * time.Second
+	defaultReplicaCheckInterval = 5 * time.Second
+	replicaPingTimeout          = 2 * time.Second
+	heartbeatInterval           = time.Second
+)
+
+//从库延迟检测及健康检查配置, HeartbeatTable为空时通过SHOW SLAVE STATUS获取延迟
+/*
+CREATE TABLE `t_heartbeat` (
+  `Fid` int(11) NOT NULL,
+  `Fheartbeat_time` datetime(6) NOT NULL,
+  PRIMARY KEY (`Fid`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
+*/
+type ReplicaOptions struct {
+	MaxLag         time.Duration
+	CheckInterval  time.Duration
+	HeartbeatTable string //配置后每秒向主库写入心跳, 延迟为从库当前时间与最新心跳时间之差
+}
+
+type replica struct {
+	index   int
+	db      *gorm.DB
+	healthy bool
+	lag     time.Duration
+	err     error
+}
+
+//从库健康状态
+type ReplicaStatus struct {
+	Index   int           `json:"index"`
+	Healthy bool          `json:"healthy"`
+	Lag     time.Duration `json:"lag"`
+	Error   string        `json:"error,omitempty"`
+}
+
+//逻辑库的从库集合, 首次健康检查完成前不使用从库
+type ReplicaSet struct {
+	name     string
+	primary  *gorm.DB
+	replicas []*replica
+	opts     ReplicaOptions
+	next     uint64
+	sync.RWMutex
+}
+
+func NewReplicaSet(name string, primary *gorm.DB, dbs []*gorm.DB, opts ReplicaOptions) *ReplicaSet {
+	if opts.MaxLag <= 0 {
+		opts.MaxLag = defaultReplicaMaxLag
+	}
+	if opts.CheckInterval <= 0 {
+		opts.CheckInterval = defaultReplicaCheckInterval
+	}
+	rs := &ReplicaSet{name: name, primary: primary, opts: opts}
+	for i, db := range dbs {
+		rs.replicas = append(rs.replicas, &replica{index: i, db: db})
+	}
+	return rs
+}
+
+//轮询选择健康的从库, 无可用从库时返回nil
+func (rs *ReplicaSet) Pick() *gorm.DB {
+	if rs == nil {
+		return nil
+	}
+	rs.RLock()
+	defer rs.RUnlock()
+	n := len(rs.replicas)
+	if n == 0 {
+		return nil
+	}
+	start := int(atomic.AddUint64(&rs.next, 1) % uint64(n))
+	for i := 0; i < n; i++ {
+		if r := rs.replicas[(start+i)%n]; r.healthy {
+			return r.db
+		}
+	}
+	return nil
+}
+
+//当前各从库状态
+func (rs *ReplicaSet) Status() []ReplicaStatus {
+	rs.RLock()
+	defer rs.RUnlock()
+	status := make([]ReplicaStatus, 0, len(rs.replicas))
+	for _, r := range rs.replicas {
+		s := ReplicaStatus{Index: r.index, Healthy: r.healthy, Lag: r.lag}
+		if r.err != nil {
+			s.Error = r.err.Error()
+		}
+		status = append(status, s)
+	}
+	return status
+}
+
+//检查各从库连通性及复制延迟, 不可用或延迟超过阈值的从库不参与查询
+func (rs *ReplicaSet) Check() {
+	for _, r := range rs.replicas {
+		lag, err := rs.check(r)
+		healthy := err == nil && lag <= rs.opts.MaxLag
+		if err == nil && !healthy {
+			err = fmt.Errorf("replica lag %v exceeds %v", lag, rs.opts.MaxLag)
+		}
+		rs.Lock()
+		if r.healthy != healthy {
+			logger.Entry().Warnf("replica %s[%d] healthy changed to %v|lag: %v|err: %v", rs.name, r.index, healthy, lag, err)
+		}
+		r.healthy, r.lag, r.err = healthy, lag, err
+		rs.Unlock()
+	}
+}
+
+func (rs *ReplicaSet) check(r *replica) (time.Duration, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), replicaPingTimeout)
+	defer cancel()
+	if err := r.db.DB().PingContext(ctx); err != nil {
+		return 0, err
+	}
+	if len(rs.opts.HeartbeatTable) != 0 {
+		return heartbeatLag(r.db, rs.opts.HeartbeatTable)
+	}
+	return slaveStatusLag(r.db)
+}
+
+func heartbeatLag(db *gorm.DB, table string) (time.Duration, error) {
+	var lag osql.NullInt64
+	err := db.Raw(fmt.Sprintf("SELECT TIMESTAMPDIFF(MICROSECOND, MAX(Fheartbeat_time), NOW(6)) FROM `%s`", table)).
+		Row().Scan(&lag)
+	if err != nil {
+		return 0, err
+	}
+	if !lag.Valid {
+		return 0, fmt.Errorf("no heartbeat in %s", table)
+	}
+	if lag.Int64 < 0 {
+		return 0, nil
+	}
+	return time.Duration(lag.Int64) * time.Microsecond, nil
+}
+
+func slaveStatusLag(db *gorm.DB) (time.Duration, error) {
+	rows, err := db.Raw("SHOW SLAVE STATUS").Rows()
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+	columns, err := rows.Columns()
+	if err != nil {
+		return 0, err
+	}
+	if !rows.Next() {
+		return 0, fmt.Errorf("not a replica, slave status is empty")
+	}
+	values := make([]osql.NullString, len(columns))
+	dest := make([]interface{}, len(columns))
+	for i := range values {
+		dest[i] = &values[i]
+	}
+	if err = rows.Scan(dest...); err != nil {
+		return 0, err
+	}
+	for i, c := range columns {
+		if c != "Seconds_Behind_Master" {
+			continue
+		}
+		if !values[i].Valid { //复制线程未运行
+			return 0, fmt.Errorf("replication not running")
+		}
+		var sec int64
+		if _, err = fmt.Sscan(values[i].String, &sec); err != nil {
+			return 0, err
+		}
+		return time.Duration(sec) * time.Second, nil
+	}
+	return 0, fmt.Errorf("Seconds_Behind_Master not found in slave status")
+}
+
+func (rs *ReplicaSet) beat() {
+	sql := fmt.Sprintf("REPLACE INTO `%s` (Fid, Fheartbeat_time) VALUES (1, NOW(6))", rs.opts.HeartbeatTable)
+	if err := rs.primary.Exec(sql).Error; err != nil {
+		logger.Entry().Errorf("replica %s write heartbeat err: %v", rs.name, err)
+	}
+}
+
+//定时健康检查, 配置心跳表时同时写入心跳, ctx取消时退出
+func (rs *ReplicaSet) Run(ctx context.Context) {
+	check := time.NewTicker(rs.opts.CheckInterval)
+	defer check.Stop()
+	var beat <-chan time.Time
+	if len(rs.opts.HeartbeatTable) != 0 && rs.primary != nil {
+		ticker := time.NewTicker(heartbeatInterval)
+		defer ticker.Stop()
+		beat = ticker.C
+		rs.beat()
+	}
+	rs.Check()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-beat:
+			rs.beat()
+		case <-check.C:
+			rs.Check()
+		}
+	}
+}
+
+//查询使用的db, name为逻辑库名称, 无可用从库时返回primary
+func (cd *CMSDriver) ReadDB(name string, primary *gorm.DB) *gorm.DB {
+	if db := cd.Replicas[name].Pick(); db != nil {
+		return db
+	}
+	return primary
+}
+
+func (rs *ReplicaSet) Close() {
+	for _, r := range rs.replicas {
+		r.db.Close()
+	}
+}
@@ -0,0 +1,30 @@
+package driver
+
+import (
+	"testing"
+
+	"github.com/jinzhu/gorm"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReplicaSetPick(t *testing.T) {
+	primary, r0, r1 := &gorm.DB{}, &gorm.DB{}, &gorm.DB{}
+	rs := NewReplicaSet(MusicDBName, primary, []*gorm.DB{r0, r1}, ReplicaOptions{})
+	assert.Nil(t, rs.Pick()) //首次检查前不使用从库
+
+	rs.replicas[1].healthy = true
+	for i := 0; i < 4; i++ {
+		assert.True(t, rs.Pick() == r1)
+	}
+	rs.replicas[0].healthy = true
+	picked := map[*gorm.DB]bool{}
+	for i := 0; i < 4; i++ {
+		picked[rs.Pick()] = true
+	}
+	assert.Equal(t, 2, len(picked))
+
+	cd := &CMSDriver{Replicas: map[string]*ReplicaSet{MusicDBName: rs}}
+	assert.True(t, cd.ReadDB(LyricDBName, primary) == primary)
+	rs.replicas[0].healthy, rs.replicas[1].healthy = false, false
+	assert.True(t, cd.ReadDB(MusicDBName, primary) == primary)
+}
@@ -0,0 +1,278 @@
+package driver
+
+import (
+	"container/heap"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/store_server/logger"
+)
+
+/*-------------------------- 慢查询记录 -------------------------*/
+//耗时超过阈值的语句记录耗时、行数、调用方及请求路由, select语句异步执行EXPLAIN,
+//并保留耗时最长的topN条供管理接口查询
+
+const (
+	defaultSlowQueryTopN = 100
+	queryTraceKey        = "slowlog:trace"
+	explainTimeout       = 3 * time.Second
+	maxExplainRunning    = 2 //同时执行的EXPLAIN数, 超过时不执行
+	maxSlowQuerySQLLen   = 4096
+)
+
+//慢查询配置, Threshold<=0时不记录
+type SlowQueryOptions struct {
+	Threshold time.Duration
+	TopN      int
+	Explain   bool
+}
+
+//查询来源, 由dblogic的WithTrace设置
+type QueryTrace struct {
+	Route     string `json:"route,omitempty"`
+	RequestId string `json:"requestId,omitempty"`
+}
+
+//慢查询记录, Rows为-1时表示行数未知(Rows()方式的流式读取)
+type SlowQuery struct {
+	DB        string                   `json:"db"`
+	Op        string                   `json:"op"`
+	Table     string                   `json:"table"`
+	SQL       string                   `json:"sql"`
+	Vars      []interface{}            `json:"vars,omitempty"`
+	Cost      time.Duration            `json:"cost"`
+	Rows      int64                    `json:"rows"`
+	Caller    string                   `json:"caller"`
+	Route     string                   `json:"route,omitempty"`
+	RequestId string                   `json:"requestId,omitempty"`
+	Time      time.Time                `json:"time"`
+	Explain   []map[string]interface{} `json:"explain,omitempty"`
+}
+
+//按耗时排序的小顶堆, 堆顶为保留记录中耗时最短的
+type slowQueryHeap []*SlowQuery
+
+func (h slowQueryHeap) Len() int            { return len(h) }
+func (h slowQueryHeap) Less(i, j int) bool  { return h[i].Cost < h[j].Cost }
+func (h slowQueryHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *slowQueryHeap) Push(x interface{}) { *h = append(*h, x.(*SlowQuery)) }
+func (h *slowQueryHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	x := old[n-1]
+	*h = old[:n-1]
+	return x
+}
+
+type slowQueryLog struct {
+	opts    SlowQueryOptions
+	top     slowQueryHeap
+	total   int64
+	explain chan struct{}
+	sync.RWMutex
+}
+
+var slowLog = &slowQueryLog{explain: make(chan struct{}, maxExplainRunning)}
+
+//设置慢查询配置, 缩小topN时丢弃耗时较短的记录
+func SetSlowQueryOptions(opts SlowQueryOptions) {
+	if opts.TopN <= 0 {
+		opts.TopN = defaultSlowQueryTopN
+	}
+	slowLog.Lock()
+	defer slowLog.Unlock()
+	slowLog.opts = opts
+	for slowLog.top.Len() > opts.TopN {
+		heap.Pop(&slowLog.top)
+	}
+}
+
+//耗时最长的limit条慢查询(按耗时倒序)及累计慢查询数, limit<=0时返回全部
+func SlowQueries(limit int) ([]*SlowQuery, int64) {
+	slowLog.RLock()
+	queries := make([]*SlowQuery, len(slowLog.top))
+	copy(queries, slowLog.top)
+	total := slowLog.total
+	slowLog.RUnlock()
+	sort.Slice(queries, func(i, j int) bool {
+		return queries[i].Cost > queries[j].Cost
+	})
+	if limit > 0 && len(queries) > limit {
+		queries = queries[:limit]
+	}
+	return queries, total
+}
+
+//清空慢查询记录
+func ResetSlowQueries() {
+	slowLog.Lock()
+	defer slowLog.Unlock()
+	slowLog.top, slowLog.total = nil, 0
+}
+
+//设置查询来源, 慢查询记录中携带请求路由及请求id
+func WithTrace(db *gorm.DB, trace *QueryTrace) *gorm.DB {
+	if db == nil || trace == nil {
+		return db
+	}
+	return db.Set(queryTraceKey, trace)
+}
+
+func (sl *slowQueryLog) options() SlowQueryOptions {
+	sl.RLock()
+	defer sl.RUnlock()
+	return sl.opts
+}
+
+//gorm回调中调用, 耗时超过阈值时记录
+func (sl *slowQueryLog) observe(name, op, table string, raw *sql.DB, scope *gorm.Scope, cost time.Duration) {
+	opts := sl.options()
+	if opts.Threshold <= 0 || cost < opts.Threshold {
+		return
+	}
+	sq := &SlowQuery{
+		DB:     name,
+		Op:     op,
+		Table:  table,
+		SQL:    scope.SQL,
+		Vars:   scope.SQLVars,
+		Cost:   cost,
+		Rows:   scope.DB().RowsAffected,
+		Caller: caller(),
+		Time:   time.Now(),
+	}
+	if op == "row_query" {
+		sq.Rows = -1
+	}
+	if len(sq.SQL) > maxSlowQuerySQLLen {
+		sq.SQL = sq.SQL[:maxSlowQuerySQLLen] + "..."
+	}
+	if v, ok := scope.Get(queryTraceKey); ok {
+		if trace, ok := v.(*QueryTrace); ok {
+			sq.Route, sq.RequestId = trace.Route, trace.RequestId
+		}
+	}
+	if opts.Explain && raw != nil && isSelect(scope.SQL) {
+		select {
+		case sl.explain <- struct{}{}:
+			go func() {
+				defer func() { <-sl.explain }()
+				sl.runExplain(raw, scope.SQL, scope.SQLVars, sq)
+			}()
+			return
+		default: //EXPLAIN并发已满, 仅记录语句
+		}
+	}
+	sl.add(sq)
+	sq.log()
+}
+
+func (sl *slowQueryLog) add(sq *SlowQuery) {
+	sl.Lock()
+	defer sl.Unlock()
+	sl.total++
+	topN := sl.opts.TopN
+	if topN <= 0 {
+		topN = defaultSlowQueryTopN
+	}
+	if sl.top.Len() < topN {
+		heap.Push(&sl.top, sq)
+		return
+	}
+	if sl.top[0].Cost < sq.Cost {
+		sl.top[0] = sq
+		heap.Fix(&sl.top, 0)
+	}
+}
+
+//在原连接池上执行EXPLAIN, 不占用事务连接; 完成后再加入记录, 记录加入后不再修改
+func (sl *slowQueryLog) runExplain(raw *sql.DB, query string, vars []interface{}, sq *SlowQuery) {
+	ctx, cancel := context.WithTimeout(context.Background(), explainTimeout)
+	defer cancel()
+	explain, err := explainQuery(ctx, raw, query, vars)
+	if err != nil {
+		logger.Entry().Warnf("explain slow query err: %v|sql: %s", err, sq.SQL)
+	}
+	sq.Explain = explain
+	sl.add(sq)
+	sq.log()
+}
+
+func explainQuery(ctx context.Context, raw *sql.DB, query string, vars []interface{}) ([]map[string]interface{}, error) {
+	rows, err := raw.QueryContext(ctx, "EXPLAIN "+query, vars...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+	values := make([]sql.NullString, len(columns))
+	dest := make([]interface{}, len(columns))
+	for i := range values {
+		dest[i] = &values[i]
+	}
+	explain := make([]map[string]interface{}, 0)
+	for rows.Next() {
+		if err = rows.Scan(dest...); err != nil {
+			return nil, err
+		}
+		row := make(map[string]interface{}, len(columns))
+		for i, c := range columns {
+			if values[i].Valid {
+				row[c] = values[i].String
+			} else {
+				row[c] = nil
+			}
+		}
+		explain = append(explain, row)
+	}
+	return explain, rows.Err()
+}
+
+func (sq *SlowQuery) log() {
+	explain, _ := json.Marshal(sq.Explain)
+	logger.Entry().Warnf("slow query|db: %s|table: %s|cost: %v|rows: %d|route: %s|requestId: %s|caller: %s|sql: %s|vars: %v|explain: %s",
+		sq.DB, sq.Table, sq.Cost, sq.Rows, sq.Route, sq.RequestId, sq.Caller, sq.SQL, sq.Vars, explain)
+}
+
+func isSelect(query string) bool {
+	q := strings.ToLower(strings.TrimSpace(query))
+	return strings.HasPrefix(q, "select") || strings.HasPrefix(q, "(select")
+}
+
+//调用栈中第一个不属于gorm、database/sql及本包的函数
+func caller() string {
+	pcs := make([]uintptr, 32)
+	n := runtime.Callers(3, pcs)
+	frames := runtime.CallersFrames(pcs[:n])
+	for {
+		frame, more := frames.Next()
+		fn := frame.Function
+		if !strings.Contains(fn, "github.com/jinzhu/gorm") && !strings.HasPrefix(fn, "database/sql") &&
+			!strings.Contains(fn, "store_server/dbtools/driver.") && !strings.HasPrefix(fn, "runtime.") {
+			return fmt.Sprintf("%s:%d", shortFunc(fn), frame.Line)
+		}
+		if !more {
+			return ""
+		}
+	}
+}
+
+//去掉包路径, 如github.com/store_server/dbtools/dblogic.(*BaseDriver).JoinQueryWithSql
+//返回dblogic.(*BaseDriver).JoinQueryWithSql
+func shortFunc(fn string) string {
+	if i := strings.LastIndex(fn, "/"); i >= 0 {
+		return fn[i+1:]
+	}
+	return fn
+}
@@ -0,0 +1,33 @@
+package driver
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSlowQueryTopN(t *testing.T) {
+	defer ResetSlowQueries()
+	SetSlowQueryOptions(SlowQueryOptions{Threshold: time.Millisecond, TopN: 3})
+	for _, ms := range []int{5, 1, 9, 3, 7} {
+		slowLog.add(&SlowQuery{SQL: "SELECT 1", Cost: time.Duration(ms) * time.Millisecond})
+	}
+	queries, total := SlowQueries(0)
+	assert.Equal(t, int64(5), total)
+	assert.Equal(t, 3, len(queries))
+	assert.Equal(t, 9*time.Millisecond, queries[0].Cost)
+	assert.Equal(t, 5*time.Millisecond, queries[2].Cost)
+
+	queries, _ = SlowQueries(1)
+	assert.Equal(t, 1, len(queries))
+	SetSlowQueryOptions(SlowQueryOptions{Threshold: time.Millisecond, TopN: 2}) //缩小topN丢弃耗时较短的记录
+	queries, _ = SlowQueries(0)
+	assert.Equal(t, 2, len(queries))
+	assert.Equal(t, 7*time.Millisecond, queries[1].Cost)
+
+	assert.True(t, isSelect(" select * from t_track"))
+	assert.False(t, isSelect("UPDATE t_track SET Fstatus = 1"))
+	assert.Equal(t, "dblogic.(*BaseDriver).JoinQueryWithSql",
+		shortFunc("github.com/store_server/dbtools/dblogic.(*BaseDriver).JoinQueryWithSql"))
+}
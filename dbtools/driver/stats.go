@@ -0,0 +1,108 @@
+package driver
+
+import (
+	"context"
+	"database/sql"
+	"sync"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/store_server/metrics"
+)
+
+/*-------------------------- 连接池及查询耗时监控 -------------------------*/
+
+const (
+	defaultDBStatsInterval = 15 * time.Second
+	queryStartKey          = "metrics:query_start"
+	rawQueryTable          = "raw"
+)
+
+//已注册上报连接池状态的db, key为库名称
+var statsDBs = struct {
+	sync.RWMutex
+	dbs map[string]*sql.DB
+}{dbs: make(map[string]*sql.DB)}
+
+func registerDBStats(name string, db *sql.DB) {
+	statsDBs.Lock()
+	defer statsDBs.Unlock()
+	statsDBs.dbs[name] = db
+}
+
+//上报各库连接池状态
+func ReportDBStats() {
+	statsDBs.RLock()
+	defer statsDBs.RUnlock()
+	for name, db := range statsDBs.dbs {
+		st := db.Stats()
+		for stat, v := range map[string]float64{
+			"max_open":              float64(st.MaxOpenConnections),
+			"open":                  float64(st.OpenConnections),
+			"in_use":                float64(st.InUse),
+			"idle":                  float64(st.Idle),
+			"wait_count":            float64(st.WaitCount),
+			"wait_duration_seconds": st.WaitDuration.Seconds(),
+			"max_idle_closed":       float64(st.MaxIdleClosed),
+			"max_idle_time_closed":  float64(st.MaxIdleTimeClosed),
+			"max_lifetime_closed":   float64(st.MaxLifetimeClosed),
+		} {
+			metrics.DBStatsGauge.WithLabelValues(metrics.ServerTag, name, stat).Set(v)
+		}
+	}
+}
+
+//定时上报连接池状态, interval<=0时使用默认值15s, ctx取消时退出
+func RunDBStats(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		interval = defaultDBStatsInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		ReportDBStats()
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+//注册gorm回调, 按库、操作类型及表统计查询耗时并记录慢查询; db.Exec执行的原生sql不经过回调, 不统计
+func registerQueryMetrics(name string, db *gorm.DB) {
+	raw := db.DB()
+	before := func(scope *gorm.Scope) {
+		scope.Set(queryStartKey, time.Now())
+	}
+	after := func(op string) func(scope *gorm.Scope) {
+		return func(scope *gorm.Scope) {
+			v, ok := scope.Get(queryStartKey)
+			if !ok {
+				return
+			}
+			start, ok := v.(time.Time)
+			if !ok {
+				return
+			}
+			table := scope.TableName()
+			if len(table) == 0 { //未指定model的原生sql
+				table = rawQueryTable
+			}
+			cost := time.Since(start)
+			metrics.DBQueryHistogram.WithLabelValues(metrics.ServerTag, name, op, table).Observe(cost.Seconds())
+			slowLog.observe(name, op, table, raw, scope, cost)
+		}
+	}
+	cb := db.Callback()
+	cb.Create().Before("gorm:begin_transaction").Register("metrics:before_create", before)
+	cb.Create().After("gorm:commit_or_rollback_transaction").Register("metrics:after_create", after("create"))
+	cb.Update().Before("gorm:begin_transaction").Register("metrics:before_update", before)
+	cb.Update().After("gorm:commit_or_rollback_transaction").Register("metrics:after_update", after("update"))
+	cb.Delete().Before("gorm:begin_transaction").Register("metrics:before_delete", before)
+	cb.Delete().After("gorm:commit_or_rollback_transaction").Register("metrics:after_delete", after("delete"))
+	cb.Query().Before("gorm:query").Register("metrics:before_query", before)
+	cb.Query().After("gorm:after_query").Register("metrics:after_query", after("query"))
+	cb.RowQuery().Before("gorm:row_query").Register("metrics:before_row_query", before)
+	cb.RowQuery().After("gorm:row_query").Register("metrics:after_row_query", after("row_query"))
+}
@@ -0,0 +1,534 @@
+package migrate
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"embed"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/store_server/logger"
+)
+
+/*-------------------------- 表结构版本迁移 -------------------------*/
+//迁移文件位于migrations/<schema>/目录, 命名为<版本号>_<名称>.up.sql及<版本号>_<名称>.down.sql,
+//随二进制编译打包; 已执行的版本记录于各库的schema_migrations表. 无down文件的版本不可回滚
+
+//go:embed migrations
+var migrationFS embed.FS
+
+const (
+	MusicSchema = "music"
+	LyricSchema = "lyric"
+
+	migrationTable  = "schema_migrations"
+	migrationLock   = "store_server.schema_migrations"
+	lockTimeout     = 30 //获取迁移锁超时(秒)
+	directionUp     = "up"
+	directionDown   = "down"
+	defaultDownStep = 1
+)
+
+//逻辑库配置项与迁移目录的对应关系, 逐字歌词库与普通歌词库表结构相同
+var Schemas = map[string]string{
+	"music":  MusicSchema,
+	"lyric":  LyricSchema,
+	"klyric": LyricSchema,
+}
+
+var fileRegexp = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+//迁移版本记录表, 首次执行迁移时创建
+/*
+CREATE TABLE `schema_migrations` (
+  `Fversion` bigint(20) NOT NULL,
+  `Fname` varchar(128) NOT NULL DEFAULT '',
+  `Fchecksum` varchar(64) NOT NULL DEFAULT '',
+  `Fdirty` tinyint(4) NOT NULL DEFAULT '0',
+  `Fapply_time` datetime NOT NULL,
+  PRIMARY KEY (`Fversion`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+*/
+const createMigrationTable = "CREATE TABLE IF NOT EXISTS `" + migrationTable + "` (" +
+	"`Fversion` bigint(20) NOT NULL, " +
+	"`Fname` varchar(128) NOT NULL DEFAULT '', " +
+	"`Fchecksum` varchar(64) NOT NULL DEFAULT '', " +
+	"`Fdirty` tinyint(4) NOT NULL DEFAULT '0', " +
+	"`Fapply_time` datetime NOT NULL, " +
+	"PRIMARY KEY (`Fversion`)" +
+	") ENGINE=InnoDB DEFAULT CHARSET=utf8mb4"
+
+//单个版本的迁移
+type Migration struct {
+	Version int64  `json:"version"`
+	Name    string `json:"name"`
+	Up      string `json:"-"`
+	Down    string `json:"-"`
+}
+
+//up文件内容的sha256, 用于发现已执行版本的文件被修改
+func (m *Migration) Checksum() string {
+	sum := sha256.Sum256([]byte(m.Up))
+	return hex.EncodeToString(sum[:])
+}
+
+func (m *Migration) Reversible() bool {
+	return len(strings.TrimSpace(m.Down)) != 0
+}
+
+//已执行版本记录
+type Record struct {
+	Version   int64     `json:"version"`
+	Name      string    `json:"name"`
+	Checksum  string    `json:"checksum"`
+	Dirty     bool      `json:"dirty"`
+	ApplyTime time.Time `json:"applyTime"`
+}
+
+//版本状态, Modified为已执行版本的up文件与执行时不一致, Missing为库中已执行但当前二进制中不存在的版本
+type Status struct {
+	Version   int64      `json:"version"`
+	Name      string     `json:"name"`
+	Applied   bool       `json:"applied"`
+	Dirty     bool       `json:"dirty,omitempty"`
+	Modified  bool       `json:"modified,omitempty"`
+	Missing   bool       `json:"missing,omitempty"`
+	ApplyTime *time.Time `json:"applyTime,omitempty"`
+}
+
+//待执行的迁移步骤
+type Step struct {
+	*Migration
+	Direction  string   `json:"direction"`
+	Statements []string `json:"statements"`
+}
+
+//加载schema对应的迁移文件, 按版本号升序
+func Load(schema string) ([]*Migration, error) {
+	sub, err := fs.Sub(migrationFS, path.Join("migrations", schema))
+	if err != nil {
+		return nil, err
+	}
+	return parse(sub)
+}
+
+func parse(fsys fs.FS) ([]*Migration, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, err
+	}
+	byVersion := make(map[int64]*Migration)
+	for _, e := range entries {
+		if e.IsDir() {
+			continue
+		}
+		matches := fileRegexp.FindStringSubmatch(e.Name())
+		if matches == nil {
+			return nil, fmt.Errorf("invalid migration file name: %s", e.Name())
+		}
+		version, _ := strconv.ParseInt(matches[1], 10, 64)
+		if version <= 0 {
+			return nil, fmt.Errorf("invalid migration version: %s", e.Name())
+		}
+		data, err := fs.ReadFile(fsys, e.Name())
+		if err != nil {
+			return nil, err
+		}
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: matches[2]}
+			byVersion[version] = m
+		} else if m.Name != matches[2] {
+			return nil, fmt.Errorf("duplicate migration version %d: %s, %s", version, m.Name, matches[2])
+		}
+		if matches[3] == directionUp {
+			m.Up = string(data)
+		} else {
+			m.Down = string(data)
+		}
+	}
+	migrations := make([]*Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if len(strings.TrimSpace(m.Up)) == 0 {
+			return nil, fmt.Errorf("migration %d_%s has no up sql", m.Version, m.Name)
+		}
+		migrations = append(migrations, m)
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+	return migrations, nil
+}
+
+//按行尾分号拆分sql语句, 忽略--注释行; 语句中的字符串不可包含行尾分号
+func SplitStatements(content string) []string {
+	stmts := make([]string, 0)
+	var buf strings.Builder
+	for _, line := range strings.Split(content, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if len(trimmed) == 0 || strings.HasPrefix(trimmed, "--") {
+			continue
+		}
+		buf.WriteString(line)
+		buf.WriteString("\n")
+		if strings.HasSuffix(trimmed, ";") {
+			if stmt := strings.TrimSuffix(strings.TrimSpace(buf.String()), ";"); len(stmt) != 0 {
+				stmts = append(stmts, stmt)
+			}
+			buf.Reset()
+		}
+	}
+	if stmt := strings.TrimSpace(buf.String()); len(stmt) != 0 {
+		stmts = append(stmts, stmt)
+	}
+	return stmts
+}
+
+//单个库的迁移执行器
+type Migrator struct {
+	db         *sql.DB
+	schema     string
+	migrations []*Migration
+}
+
+func NewMigrator(db *sql.DB, schema string) (*Migrator, error) {
+	migrations, err := Load(schema)
+	if err != nil {
+		return nil, err
+	}
+	if len(migrations) == 0 {
+		return nil, fmt.Errorf("no migrations found for schema %s", schema)
+	}
+	return &Migrator{db: db, schema: schema, migrations: migrations}, nil
+}
+
+func (mg *Migrator) Migrations() []*Migration {
+	return mg.migrations
+}
+
+//当前二进制期望的版本号
+func (mg *Migrator) Latest() int64 {
+	return mg.migrations[len(mg.migrations)-1].Version
+}
+
+//已执行版本记录, 迁移表不存在时返回空
+func (mg *Migrator) records(ctx context.Context, q querier) ([]*Record, error) {
+	var exists string
+	err := q.QueryRowContext(ctx, "SHOW TABLES LIKE '"+migrationTable+"'").Scan(&exists)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	rows, err := q.QueryContext(ctx, "SELECT Fversion, Fname, Fchecksum, Fdirty, Fapply_time FROM `"+
+		migrationTable+"` ORDER BY Fversion")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	records := make([]*Record, 0)
+	for rows.Next() {
+		r := &Record{}
+		var applyTime interface{}
+		if err = rows.Scan(&r.Version, &r.Name, &r.Checksum, &r.Dirty, &applyTime); err != nil {
+			return nil, err
+		}
+		switch t := applyTime.(type) { //兼容dsn是否开启parseTime
+		case time.Time:
+			r.ApplyTime = t
+		case []byte:
+			r.ApplyTime, _ = time.ParseInLocation("2006-01-02 15:04:05", string(t), time.Local)
+		}
+		records = append(records, r)
+	}
+	return records, rows.Err()
+}
+
+//当前版本号及是否存在执行失败的版本
+func (mg *Migrator) Version(ctx context.Context) (version int64, dirty bool, err error) {
+	records, err := mg.records(ctx, mg.db)
+	if err != nil {
+		return
+	}
+	version, dirty = current(records)
+	return
+}
+
+func current(records []*Record) (version int64, dirty bool) {
+	for _, r := range records {
+		if r.Dirty {
+			dirty = true
+		}
+		if r.Version > version {
+			version = r.Version
+		}
+	}
+	return
+}
+
+func (mg *Migrator) Status(ctx context.Context) ([]*Status, error) {
+	records, err := mg.records(ctx, mg.db)
+	if err != nil {
+		return nil, err
+	}
+	applied := make(map[int64]*Record, len(records))
+	for _, r := range records {
+		applied[r.Version] = r
+	}
+	status := make([]*Status, 0, len(mg.migrations))
+	for _, m := range mg.migrations {
+		s := &Status{Version: m.Version, Name: m.Name}
+		if r, ok := applied[m.Version]; ok {
+			applyTime := r.ApplyTime
+			s.Applied, s.Dirty, s.ApplyTime = true, r.Dirty, &applyTime
+			s.Modified = len(r.Checksum) != 0 && r.Checksum != m.Checksum()
+			delete(applied, m.Version)
+		}
+		status = append(status, s)
+	}
+	for _, r := range applied {
+		applyTime := r.ApplyTime
+		status = append(status, &Status{Version: r.Version, Name: r.Name, Applied: true, Dirty: r.Dirty,
+			Missing: true, ApplyTime: &applyTime})
+	}
+	sort.Slice(status, func(i, j int) bool {
+		return status[i].Version < status[j].Version
+	})
+	return status, nil
+}
+
+//迁移到target版本需执行的步骤, target不小于当前版本时执行up, 小于时执行down; target<0表示最新版本
+func (mg *Migrator) Plan(ctx context.Context, target int64) ([]*Step, error) {
+	records, err := mg.records(ctx, mg.db)
+	if err != nil {
+		return nil, err
+	}
+	if target < 0 {
+		target = mg.Latest()
+	}
+	return mg.plan(records, target)
+}
+
+func (mg *Migrator) plan(records []*Record, target int64) ([]*Step, error) {
+	version, dirty := current(records)
+	if dirty {
+		return nil, fmt.Errorf("schema %s is dirty, fix the failed migration manually and clear Fdirty in %s first",
+			mg.schema, migrationTable)
+	}
+	if target > mg.Latest() {
+		return nil, fmt.Errorf("target version %d not found, latest is %d", target, mg.Latest())
+	}
+	applied := make(map[int64]bool, len(records))
+	for _, r := range records {
+		applied[r.Version] = true
+	}
+	steps := make([]*Step, 0)
+	if target >= version {
+		for _, m := range mg.migrations {
+			if m.Version <= target && !applied[m.Version] {
+				steps = append(steps, &Step{Migration: m, Direction: directionUp, Statements: SplitStatements(m.Up)})
+			}
+		}
+		return steps, nil
+	}
+	byVersion := make(map[int64]*Migration, len(mg.migrations))
+	for _, m := range mg.migrations {
+		byVersion[m.Version] = m
+	}
+	for i := len(records) - 1; i >= 0; i-- {
+		r := records[i]
+		if r.Version <= target {
+			break
+		}
+		m, ok := byVersion[r.Version]
+		if !ok {
+			return nil, fmt.Errorf("migration %d_%s not found in this binary, can not roll back", r.Version, r.Name)
+		}
+		if !m.Reversible() {
+			return nil, fmt.Errorf("migration %d_%s is irreversible", m.Version, m.Name)
+		}
+		steps = append(steps, &Step{Migration: m, Direction: directionDown, Statements: SplitStatements(m.Down)})
+	}
+	return steps, nil
+}
+
+//执行到target版本, target<=0时为最新版本
+func (mg *Migrator) Up(ctx context.Context, target int64) ([]*Step, error) {
+	if target <= 0 {
+		target = mg.Latest()
+	}
+	return mg.migrate(ctx, func(version int64) (int64, error) {
+		if target < version {
+			return 0, fmt.Errorf("target version %d is lower than current version %d, use down instead", target, version)
+		}
+		return target, nil
+	})
+}
+
+//回滚到target版本, target<0时回滚最近的steps个版本
+func (mg *Migrator) Down(ctx context.Context, target int64, steps int) ([]*Step, error) {
+	if steps <= 0 {
+		steps = defaultDownStep
+	}
+	return mg.migrate(ctx, func(version int64) (int64, error) {
+		if target >= 0 {
+			if target > version {
+				return 0, fmt.Errorf("target version %d is higher than current version %d, use up instead", target, version)
+			}
+			return target, nil
+		}
+		return mg.previous(version, steps), nil
+	})
+}
+
+//version之前第steps个版本, 不足时为0
+func (mg *Migrator) previous(version int64, steps int) int64 {
+	idx := sort.Search(len(mg.migrations), func(i int) bool {
+		return mg.migrations[i].Version >= version
+	})
+	if idx-steps < 0 {
+		return 0
+	}
+	return mg.migrations[idx-steps].Version
+}
+
+type querier interface {
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+//持有迁移锁执行, 避免多个实例同时迁移同一个库; mysql ddl不支持事务, 执行前将版本标记为dirty,
+//执行成功后清除, 失败时保留dirty等待人工处理
+func (mg *Migrator) migrate(ctx context.Context, resolve func(version int64) (int64, error)) ([]*Step, error) {
+	conn, err := mg.db.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	var locked sql.NullInt64
+	if err = conn.QueryRowContext(ctx, "SELECT GET_LOCK(?, ?)", migrationLock, lockTimeout).Scan(&locked); err != nil {
+		return nil, err
+	}
+	if !locked.Valid || locked.Int64 != 1 {
+		return nil, fmt.Errorf("get migration lock timeout, another migration may be running")
+	}
+	defer conn.ExecContext(context.Background(), "SELECT RELEASE_LOCK(?)", migrationLock)
+	if _, err = conn.ExecContext(ctx, createMigrationTable); err != nil {
+		return nil, err
+	}
+	records, err := mg.records(ctx, conn)
+	if err != nil {
+		return nil, err
+	}
+	version, _ := current(records)
+	target, err := resolve(version)
+	if err != nil {
+		return nil, err
+	}
+	steps, err := mg.plan(records, target)
+	if err != nil {
+		return nil, err
+	}
+	done := make([]*Step, 0, len(steps))
+	for _, step := range steps {
+		if err = mg.apply(ctx, conn, step); err != nil {
+			return done, fmt.Errorf("%s migration %d_%s failed: %v", step.Direction, step.Version, step.Name, err)
+		}
+		logger.Entry().Infof("schema %s %s migration %d_%s done", mg.schema, step.Direction, step.Version, step.Name)
+		done = append(done, step)
+	}
+	return done, nil
+}
+
+func (mg *Migrator) apply(ctx context.Context, conn *sql.Conn, step *Step) (err error) {
+	if step.Direction == directionUp {
+		_, err = conn.ExecContext(ctx, "INSERT INTO `"+migrationTable+
+			"` (Fversion, Fname, Fchecksum, Fdirty, Fapply_time) VALUES (?, ?, ?, 1, NOW())",
+			step.Version, step.Name, step.Checksum())
+	} else {
+		_, err = conn.ExecContext(ctx, "UPDATE `"+migrationTable+"` SET Fdirty = 1 WHERE Fversion = ?", step.Version)
+	}
+	if err != nil {
+		return
+	}
+	for _, stmt := range step.Statements {
+		if _, err = conn.ExecContext(ctx, stmt); err != nil {
+			return
+		}
+	}
+	if step.Direction == directionUp {
+		_, err = conn.ExecContext(ctx, "UPDATE `"+migrationTable+"` SET Fdirty = 0 WHERE Fversion = ?", step.Version)
+	} else {
+		_, err = conn.ExecContext(ctx, "DELETE FROM `"+migrationTable+"` WHERE Fversion = ?", step.Version)
+	}
+	return
+}
+
+//表结构版本检查失败, 服务应拒绝启动
+type SchemaError struct {
+	Key     string //逻辑库配置项
+	Schema  string
+	Version int64
+	Latest  int64
+	Dirty   bool
+}
+
+func (e *SchemaError) Error() string {
+	if e.Dirty {
+		return fmt.Sprintf("%s: schema %s is dirty at version %d", e.Key, e.Schema, e.Version)
+	}
+	return fmt.Sprintf("%s: schema %s version %d is behind expected version %d, run store_server_migrate up first",
+		e.Key, e.Schema, e.Version, e.Latest)
+}
+
+func IsSchemaError(err error) bool {
+	_, ok := err.(*SchemaError)
+	return ok
+}
+
+//启动检查, 库版本低于二进制期望版本或存在执行失败的版本时返回SchemaError; 库版本较高时仅告警(滚动发布时旧实例)
+func Check(ctx context.Context, db *sql.DB, schema string) error {
+	mg, err := NewMigrator(db, schema)
+	if err != nil {
+		return err
+	}
+	version, dirty, err := mg.Version(ctx)
+	if err != nil {
+		return fmt.Errorf("get schema %s version error: %v", schema, err)
+	}
+	if dirty || version < mg.Latest() {
+		return &SchemaError{Key: schema, Schema: schema, Version: version, Latest: mg.Latest(), Dirty: dirty}
+	}
+	if version > mg.Latest() {
+		logger.Entry().Warnf("schema %s version %d is ahead of expected version %d", schema, version, mg.Latest())
+	}
+	return nil
+}
+
+//启动时检查各逻辑库, dbs的key为逻辑库配置项(music/lyric/klyric), 无对应迁移目录或未配置的库忽略
+func CheckAll(ctx context.Context, dbs map[string]*sql.DB) error {
+	for key, db := range dbs {
+		schema, ok := Schemas[key]
+		if !ok || db == nil {
+			continue
+		}
+		err := Check(ctx, db, schema)
+		if se, ok := err.(*SchemaError); ok {
+			se.Key = key
+			return se
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %v", key, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,92 @@
+package migrate
+
+import (
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoad(t *testing.T) {
+	for _, schema := range []string{MusicSchema, LyricSchema} {
+		migrations, err := Load(schema)
+		assert.Nil(t, err)
+		assert.NotEmpty(t, migrations)
+		for i, m := range migrations {
+			if i > 0 {
+				assert.True(t, m.Version > migrations[i-1].Version)
+			}
+			assert.NotEmpty(t, SplitStatements(m.Up))
+		}
+	}
+	_, err := parse(fstest.MapFS{"1_init.sql": {Data: []byte("SELECT 1;")}})
+	assert.NotNil(t, err)
+	_, err = parse(fstest.MapFS{"1_init.down.sql": {Data: []byte("SELECT 1;")}})
+	assert.NotNil(t, err) //缺少up文件
+}
+
+func TestSplitStatements(t *testing.T) {
+	stmts := SplitStatements("-- comment\nCREATE TABLE `t` (\n  `Fid` int(11)\n);\n\nDROP TABLE `a`;\nSELECT 1")
+	assert.Equal(t, []string{"CREATE TABLE `t` (\n  `Fid` int(11)\n)", "DROP TABLE `a`", "SELECT 1"}, stmts)
+}
+
+func TestPlan(t *testing.T) {
+	migrations, err := parse(fstest.MapFS{
+		"0001_init.up.sql":    {Data: []byte("CREATE TABLE a (id int);")},
+		"0002_b.up.sql":       {Data: []byte("CREATE TABLE b (id int);")},
+		"0002_b.down.sql":     {Data: []byte("DROP TABLE b;")},
+		"0003_c.up.sql":       {Data: []byte("CREATE TABLE c (id int);")},
+		"0003_c.down.sql":     {Data: []byte("DROP TABLE c;")},
+		"0004_index.up.sql":   {Data: []byte("ALTER TABLE c ADD KEY idx_id (id);\nALTER TABLE b ADD KEY idx_id (id);")},
+		"0004_index.down.sql": {Data: []byte("ALTER TABLE c DROP KEY idx_id;")},
+	})
+	assert.Nil(t, err)
+	mg := &Migrator{schema: "test", migrations: migrations}
+	assert.Equal(t, int64(4), mg.Latest())
+
+	steps, err := mg.plan(nil, mg.Latest())
+	assert.Nil(t, err)
+	assert.Equal(t, 4, len(steps))
+	assert.Equal(t, 2, len(steps[3].Statements))
+
+	records := []*Record{{Version: 1}, {Version: 2}}
+	steps, err = mg.plan(records, 3)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(steps))
+	assert.Equal(t, int64(3), steps[0].Version)
+
+	records = append(records, &Record{Version: 3}, &Record{Version: 4})
+	steps, err = mg.plan(records, mg.previous(4, 2))
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(steps))
+	assert.Equal(t, directionDown, steps[0].Direction)
+	assert.Equal(t, int64(4), steps[0].Version)
+
+	_, err = mg.plan(records, 0) //0001不可回滚
+	assert.NotNil(t, err)
+	_, err = mg.plan(records, 5)
+	assert.NotNil(t, err)
+
+	records[3].Dirty = true
+	_, err = mg.plan(records, 4)
+	assert.NotNil(t, err)
+}
+
+func TestSQLiteStatements(t *testing.T) {
+	stmts := SQLiteStatements("CREATE TABLE IF NOT EXISTS `t_a` (\n  `Fid` bigint(20) NOT NULL AUTO_INCREMENT,\n" +
+		"  `Fname` varchar(64) NOT NULL DEFAULT '' COMMENT 'name',\n  `Ftime` datetime(6) NOT NULL,\n" +
+		"  PRIMARY KEY (`Fid`),\n  UNIQUE KEY `uk_name` (`Fname`),\n  KEY `idx_time` (`Ftime`)\n) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4")
+	assert.Equal(t, []string{
+		"CREATE TABLE IF NOT EXISTS `t_a` (\n  `Fid` INTEGER PRIMARY KEY AUTOINCREMENT,\n  `Fname` varchar(64) NOT NULL DEFAULT '',\n" +
+			"  `Ftime` datetime NOT NULL,\n  UNIQUE (`Fname`)\n)",
+		"CREATE INDEX IF NOT EXISTS `t_a_idx_time` ON `t_a` (`Ftime`)",
+	}, stmts)
+	assert.Equal(t, []string{"CREATE UNIQUE INDEX IF NOT EXISTS `t_b_uk_id` ON `t_b` (`Fid`)"},
+		SQLiteStatements("ALTER TABLE `t_b` ADD UNIQUE KEY `uk_id` (`Fid`)"))
+	assert.Equal(t, []string{"DROP TABLE `t_b`"}, SQLiteStatements("DROP TABLE `t_b`"))
+
+	tables, err := Tables(MusicSchema)
+	assert.Nil(t, err)
+	assert.Contains(t, tables, "t_track")
+	assert.Contains(t, tables, "t_heartbeat")
+}
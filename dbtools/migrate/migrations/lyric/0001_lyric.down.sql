@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS `t_lyric_version`;
+DROP TABLE IF EXISTS `t_lyric`;
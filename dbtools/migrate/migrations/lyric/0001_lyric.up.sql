@@ -0,0 +1,28 @@
+-- 普通歌词库与逐字歌词库表结构相同, 两库均需执行
+CREATE TABLE IF NOT EXISTS `t_lyric` (
+  `Fid` bigint(20) NOT NULL AUTO_INCREMENT,
+  `Ftrack_id` bigint(20) NOT NULL DEFAULT '0',
+  `Fregion` int(11) NOT NULL DEFAULT '0',
+  `Fformat` varchar(16) NOT NULL DEFAULT '',
+  `Fcontent` mediumtext NOT NULL,
+  `Fversion` int(11) NOT NULL DEFAULT '1',
+  `Foperator` varchar(64) NOT NULL DEFAULT '',
+  `Fcreate_time` datetime NOT NULL,
+  `Fmodify_time` datetime NOT NULL,
+  PRIMARY KEY (`Fid`),
+  UNIQUE KEY `uk_track_region` (`Ftrack_id`, `Fregion`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+CREATE TABLE IF NOT EXISTS `t_lyric_version` (
+  `Fid` bigint(20) NOT NULL AUTO_INCREMENT,
+  `Ftrack_id` bigint(20) NOT NULL DEFAULT '0',
+  `Fregion` int(11) NOT NULL DEFAULT '0',
+  `Fversion` int(11) NOT NULL DEFAULT '1',
+  `Fformat` varchar(16) NOT NULL DEFAULT '',
+  `Fcontent` mediumtext NOT NULL,
+  `Foperator` varchar(64) NOT NULL DEFAULT '',
+  `Frequest_id` varchar(64) NOT NULL DEFAULT '',
+  `Fcreate_time` datetime NOT NULL,
+  PRIMARY KEY (`Fid`),
+  UNIQUE KEY `uk_track_region_version` (`Ftrack_id`, `Fregion`, `Fversion`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
@@ -0,0 +1 @@
+ALTER TABLE `t_lyric_version` DROP COLUMN `Faction`;
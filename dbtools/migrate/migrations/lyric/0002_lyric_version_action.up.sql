@@ -0,0 +1,2 @@
+-- 版本记录区分上传及删除, 删除版本内容为空
+ALTER TABLE `t_lyric_version` ADD COLUMN `Faction` varchar(16) NOT NULL DEFAULT 'upload';
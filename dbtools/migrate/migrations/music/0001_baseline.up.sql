@@ -0,0 +1,219 @@
+-- 基线版本: 迁移机制引入前已存在的表, 已有库执行时仅记录版本
+CREATE TABLE IF NOT EXISTS `t_track` (
+  `Ftrack_id` int(11) NOT NULL,
+  `Ftrack_name` varchar(255) NOT NULL DEFAULT '',
+  `Falbum_id` int(11) NOT NULL DEFAULT '0',
+  `Ftype` int(11) NOT NULL DEFAULT '0',
+  `Flanguage` int(11) NOT NULL DEFAULT '0',
+  `Fsinger` int(11) NOT NULL DEFAULT '0',
+  `Fmovie` varchar(255) NOT NULL DEFAULT '',
+  `Fsize` int(11) NOT NULL DEFAULT '0',
+  `Fduration` int(11) NOT NULL DEFAULT '0',
+  `Fsinger_id1` int(11) NOT NULL DEFAULT '0',
+  `Fsinger_id2` int(11) NOT NULL DEFAULT '0',
+  `Fsinger_id3` int(11) NOT NULL DEFAULT '0',
+  `Fsinger_id4` int(11) NOT NULL DEFAULT '0',
+  `Fprice1` int(11) NOT NULL DEFAULT '0',
+  `Fprice2` int(11) NOT NULL DEFAULT '0',
+  `Fprice3` int(11) NOT NULL DEFAULT '0',
+  `Fisrc` varchar(255) NOT NULL DEFAULT '',
+  `Fattribute_1` int(11) NOT NULL DEFAULT '0',
+  `Fattribute_2` int(11) NOT NULL DEFAULT '0',
+  `Fattribute_3` int(11) NOT NULL DEFAULT '0',
+  `Fattribute_4` int(11) NOT NULL DEFAULT '0',
+  `Fgenre` int(11) NOT NULL DEFAULT '0',
+  `Fsinger_all` varchar(255) NOT NULL DEFAULT '',
+  `Flocation` int(11) NOT NULL DEFAULT '0',
+  `Fvalid_time` datetime DEFAULT NULL,
+  `Fupload_time` datetime DEFAULT NULL,
+  `Fmodify_time` datetime DEFAULT NULL,
+  `Flasttest_modify_time` datetime DEFAULT NULL,
+  `Ftrack_c_id` int(11) NOT NULL DEFAULT '0',
+  `Flyric` tinyint(4) NOT NULL DEFAULT '0',
+  `Fportal_lyric` tinyint(4) NOT NULL DEFAULT '0',
+  `Fstatus` int(11) NOT NULL DEFAULT '0',
+  `Fgo_soso` int(11) NOT NULL DEFAULT '0',
+  `Fnote` int(11) NOT NULL DEFAULT '0',
+  `Fversion` int(11) NOT NULL DEFAULT '0',
+  `Fattribute_5` int(11) NOT NULL DEFAULT '0',
+  `Fattribute_6` int(11) NOT NULL DEFAULT '0',
+  `Ftrack_mid` varchar(255) NOT NULL DEFAULT '',
+  `Flink_mv` int(11) NOT NULL DEFAULT '0',
+  `Fmedia_id` int(11) NOT NULL DEFAULT '0',
+  `Flink_ring` int(11) NOT NULL DEFAULT '0',
+  `Fgenre_ids` json DEFAULT NULL,
+  PRIMARY KEY (`Ftrack_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+CREATE TABLE IF NOT EXISTS `t_track_extra_os` (
+  `Ftrack_id` int(11) NOT NULL,
+  `Fregion` tinyint(4) NOT NULL DEFAULT '0',
+  `Flocal_name` varchar(255) NOT NULL DEFAULT '',
+  `Flocal_copyright` int(11) NOT NULL DEFAULT '0',
+  `Flocal_valid_time` datetime DEFAULT NULL,
+  `Flocal_status` tinyint(4) NOT NULL DEFAULT '0',
+  `Flocal_movie` varchar(255) NOT NULL DEFAULT '',
+  `Flocal_from` tinyint(4) NOT NULL DEFAULT '0',
+  `Faction_template_id` int(11) NOT NULL DEFAULT '0',
+  `Fmv_id` int(11) NOT NULL DEFAULT '0',
+  `Fcopyright_limit` int(11) NOT NULL DEFAULT '0',
+  `Freplace_id` int(11) NOT NULL DEFAULT '0',
+  `Flocal_isrc` varchar(255) NOT NULL DEFAULT '',
+  `Flocal_label` varchar(255) NOT NULL DEFAULT '',
+  `Fsupplier` varchar(255) NOT NULL DEFAULT '',
+  `Fall_sources` varchar(255) NOT NULL DEFAULT '',
+  `Flocal_other_name` varchar(255) NOT NULL DEFAULT '',
+  `Fmodify_time` datetime DEFAULT NULL,
+  PRIMARY KEY (`Ftrack_id`, `Fregion`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+CREATE TABLE IF NOT EXISTS `t_album` (
+  `Falbum_id` int(11) NOT NULL,
+  `Falbum_name` varchar(255) NOT NULL DEFAULT '',
+  `Falbum_mid` varchar(255) NOT NULL DEFAULT '',
+  `Ftype` int(11) NOT NULL DEFAULT '0',
+  `Flanguage` int(11) NOT NULL DEFAULT '0',
+  `Fgenre` int(11) NOT NULL DEFAULT '0',
+  `Fsinger_id1` int(11) NOT NULL DEFAULT '0',
+  `Fsinger_id2` int(11) NOT NULL DEFAULT '0',
+  `Fsinger_id3` int(11) NOT NULL DEFAULT '0',
+  `Fsinger_all` varchar(255) NOT NULL DEFAULT '',
+  `Fcompany_id` int(11) NOT NULL DEFAULT '0',
+  `Ftrack_num` int(11) NOT NULL DEFAULT '0',
+  `Fupc` varchar(64) NOT NULL DEFAULT '',
+  `Fstatus` int(11) NOT NULL DEFAULT '0',
+  `Fversion` int(11) NOT NULL DEFAULT '0',
+  `Fpublic_time` datetime DEFAULT NULL,
+  `Fupload_time` datetime DEFAULT NULL,
+  `Fmodify_time` datetime DEFAULT NULL,
+  PRIMARY KEY (`Falbum_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+CREATE TABLE IF NOT EXISTS `t_singer` (
+  `Fsinger_id` int(11) NOT NULL,
+  `Fsinger_name` varchar(255) NOT NULL DEFAULT '',
+  `Fsinger_mid` varchar(255) NOT NULL DEFAULT '',
+  `Ftype` int(11) NOT NULL DEFAULT '0',
+  `Farea` int(11) NOT NULL DEFAULT '0',
+  `Flanguage` int(11) NOT NULL DEFAULT '0',
+  `Fgenre` int(11) NOT NULL DEFAULT '0',
+  `Fstatus` int(11) NOT NULL DEFAULT '0',
+  `Fversion` int(11) NOT NULL DEFAULT '0',
+  `Fupload_time` datetime DEFAULT NULL,
+  `Fmodify_time` datetime DEFAULT NULL,
+  PRIMARY KEY (`Fsinger_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+CREATE TABLE IF NOT EXISTS `t_singer_alias` (
+  `Fid` int(11) NOT NULL AUTO_INCREMENT,
+  `Fsinger_id` int(11) NOT NULL DEFAULT '0',
+  `Falias_name` varchar(255) NOT NULL DEFAULT '',
+  `Flanguage` int(11) NOT NULL DEFAULT '0',
+  `Fcreate_time` datetime DEFAULT NULL,
+  `Fmodify_time` datetime DEFAULT NULL,
+  PRIMARY KEY (`Fid`),
+  KEY `idx_singer_id` (`Fsinger_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+CREATE TABLE IF NOT EXISTS `t_video` (
+  `Fid` int(11) NOT NULL AUTO_INCREMENT,
+  `Fregion_id` int(11) NOT NULL DEFAULT '0',
+  `Ftitle` varchar(255) NOT NULL DEFAULT '',
+  `Fstatus` int(11) NOT NULL DEFAULT '0',
+  `Flocal_from` int(11) NOT NULL DEFAULT '0',
+  `Fsource` int(11) NOT NULL DEFAULT '0',
+  `Fimage` varchar(255) NOT NULL DEFAULT '',
+  `Fvideo` varchar(255) NOT NULL DEFAULT '',
+  `Fuuid` varchar(64) NOT NULL DEFAULT '',
+  `Fmd5` varchar(64) NOT NULL DEFAULT '',
+  `Fduration` varchar(32) NOT NULL DEFAULT '',
+  `Fformat` varchar(32) NOT NULL DEFAULT '',
+  `Fsize` varchar(32) NOT NULL DEFAULT '',
+  `Fupc` varchar(64) NOT NULL DEFAULT '',
+  `Fisrc` varchar(64) NOT NULL DEFAULT '',
+  `Fgrid` varchar(64) NOT NULL DEFAULT '',
+  `Fupload_status` int(11) NOT NULL DEFAULT '0',
+  `Fcreate_time` datetime DEFAULT NULL,
+  `Fmodify_time` datetime DEFAULT NULL,
+  `Fwatermark` int(11) NOT NULL DEFAULT '0',
+  `Fcreator` varchar(64) NOT NULL DEFAULT '',
+  `Fvideo_file` varchar(255) NOT NULL DEFAULT '',
+  `Flabel_modify_time` datetime DEFAULT NULL,
+  `Fimage_file` varchar(255) NOT NULL DEFAULT '',
+  `Fcopyright_setting` varchar(255) NOT NULL DEFAULT '',
+  `Flanguage_id` int(11) NOT NULL DEFAULT '0',
+  `Fvideo_type` varchar(32) NOT NULL DEFAULT '',
+  PRIMARY KEY (`Fid`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+CREATE TABLE IF NOT EXISTS `t_video_aid` (
+  `Fid` int(11) NOT NULL AUTO_INCREMENT,
+  `Flocal_v_id` int(11) NOT NULL DEFAULT '0',
+  `Fregion_id` int(11) NOT NULL DEFAULT '0',
+  `Ftype` int(11) NOT NULL DEFAULT '0',
+  `Fitem_id` int(11) NOT NULL DEFAULT '0',
+  `Fcreate_time` datetime DEFAULT NULL,
+  `Fmodify_time` datetime DEFAULT NULL,
+  PRIMARY KEY (`Fid`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+CREATE TABLE IF NOT EXISTS `t_video_upload` (
+  `Fid` int(11) NOT NULL AUTO_INCREMENT,
+  `Fregion_id` int(11) NOT NULL DEFAULT '0',
+  `Fvideo` varchar(255) NOT NULL DEFAULT '',
+  `Fmd5` varchar(64) NOT NULL DEFAULT '',
+  `Fcreate_time` datetime DEFAULT NULL,
+  `Fmodify_time` datetime DEFAULT NULL,
+  PRIMARY KEY (`Fid`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+CREATE TABLE IF NOT EXISTS `t_video_import` (
+  `Fid` int(11) NOT NULL AUTO_INCREMENT,
+  `Fv_id` int(11) NOT NULL DEFAULT '0',
+  `Flocal_path` varchar(255) NOT NULL DEFAULT '',
+  `Fsrc_path` varchar(255) NOT NULL DEFAULT '',
+  `Fstatus` int(11) NOT NULL DEFAULT '0',
+  `Fcreate_time` datetime DEFAULT NULL,
+  `Fmodify_time` datetime DEFAULT NULL,
+  PRIMARY KEY (`Fid`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+CREATE TABLE IF NOT EXISTS `t_video_extra_os` (
+  `Flocal_id` int(11) NOT NULL AUTO_INCREMENT,
+  `Fv_id` int(11) NOT NULL DEFAULT '0',
+  `Fregion_id` int(11) NOT NULL DEFAULT '0',
+  `Ftype` int(11) NOT NULL DEFAULT '0',
+  `Fdesc` text,
+  `Flocal_title` varchar(255) NOT NULL DEFAULT '',
+  `Fstatus` int(11) NOT NULL DEFAULT '0',
+  `Flocal_image` varchar(255) NOT NULL DEFAULT '',
+  `Ftrack_list` varchar(1024) NOT NULL DEFAULT '',
+  `Fsinger_list` varchar(1024) NOT NULL DEFAULT '',
+  `Ftag_list` varchar(1024) NOT NULL DEFAULT '',
+  `Fvip` int(11) NOT NULL DEFAULT '0',
+  `Fsubscript` int(11) NOT NULL DEFAULT '0',
+  `Fcreate_time` datetime DEFAULT NULL,
+  `Fpub_time` datetime DEFAULT NULL,
+  `Fmodify_time` datetime DEFAULT NULL,
+  `Fgif_pic` varchar(255) NOT NULL DEFAULT '',
+  `Fview_count` int(11) NOT NULL DEFAULT '0',
+  `Fmatch_status` varchar(32) NOT NULL DEFAULT '',
+  `Flocal_copyright` int(11) NOT NULL DEFAULT '0',
+  `Flanguage_id` int(11) NOT NULL DEFAULT '0',
+  PRIMARY KEY (`Flocal_id`),
+  KEY `idx_v_id_region` (`Fv_id`, `Fregion_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+CREATE TABLE IF NOT EXISTS `t_video_singer_track` (
+  `Fid` int(11) NOT NULL AUTO_INCREMENT,
+  `Flocal_v_id` int(11) NOT NULL DEFAULT '0',
+  `Fregion_id` int(11) NOT NULL DEFAULT '0',
+  `Ftype` int(11) NOT NULL DEFAULT '0',
+  `Fsinger_id` int(11) NOT NULL DEFAULT '0',
+  `Ftrack_id` int(11) NOT NULL DEFAULT '0',
+  `Fstatus` int(11) NOT NULL DEFAULT '0',
+  `Fcreate_time` datetime DEFAULT NULL,
+  `Fmodify_time` datetime DEFAULT NULL,
+  PRIMARY KEY (`Fid`),
+  KEY `idx_local_v_id` (`Flocal_v_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
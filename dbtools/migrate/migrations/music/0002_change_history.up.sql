@@ -0,0 +1,16 @@
+CREATE TABLE IF NOT EXISTS `t_change_history` (
+  `Fid` bigint(20) NOT NULL AUTO_INCREMENT,
+  `Ftable` varchar(64) NOT NULL DEFAULT '',
+  `Frecord_id` bigint(20) NOT NULL DEFAULT '0',
+  `Frecord_key` varchar(128) NOT NULL DEFAULT '',
+  `Faction` varchar(16) NOT NULL DEFAULT '',
+  `Fchanges` mediumtext NOT NULL,
+  `Fbefore` mediumtext NOT NULL,
+  `Fafter` mediumtext NOT NULL,
+  `Foperator` varchar(64) NOT NULL DEFAULT '',
+  `Frequest_id` varchar(64) NOT NULL DEFAULT '',
+  `Fcreate_time` datetime NOT NULL,
+  PRIMARY KEY (`Fid`),
+  KEY `idx_table_record` (`Ftable`, `Frecord_id`),
+  KEY `idx_request_id` (`Frequest_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
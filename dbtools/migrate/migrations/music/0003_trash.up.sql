@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS `t_trash` (
+  `Fid` bigint(20) NOT NULL AUTO_INCREMENT,
+  `Ftable` varchar(64) NOT NULL DEFAULT '',
+  `Frecord_id` bigint(20) NOT NULL DEFAULT '0',
+  `Fdata` mediumtext NOT NULL,
+  `Fdeleter` varchar(64) NOT NULL DEFAULT '',
+  `Freason` varchar(255) NOT NULL DEFAULT '',
+  `Fdelete_time` datetime NOT NULL,
+  PRIMARY KEY (`Fid`),
+  KEY `idx_table_record` (`Ftable`, `Frecord_id`),
+  KEY `idx_delete_time` (`Fdelete_time`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
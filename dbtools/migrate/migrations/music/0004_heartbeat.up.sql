@@ -0,0 +1,6 @@
+-- 从库延迟检测心跳表, 见replica.heartbeat_table配置
+CREATE TABLE IF NOT EXISTS `t_heartbeat` (
+  `Fid` int(11) NOT NULL,
+  `Fheartbeat_time` datetime(6) NOT NULL,
+  PRIMARY KEY (`Fid`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
@@ -0,0 +1,119 @@
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+/*-------------------------- sqlite测试库 -------------------------*/
+//单元测试使用sqlite内存库代替mysql, 表结构由迁移文件转换得到, 与线上表结构保持一致.
+//仅转换迁移文件中用到的mysql语法: 自增主键、KEY/UNIQUE KEY、表选项及datetime精度
+
+var (
+	createTableRegexp = regexp.MustCompile("(?is)^CREATE\\s+TABLE\\s+(IF\\s+NOT\\s+EXISTS\\s+)?`?(\\w+)`?\\s*\\((.*)\\)[^)]*$")
+	addIndexRegexp    = regexp.MustCompile("(?is)^ALTER\\s+TABLE\\s+`?(\\w+)`?\\s+ADD\\s+(UNIQUE\\s+)?(?:KEY|INDEX)\\s+`?(\\w+)`?\\s*(\\(.*\\))$")
+	indexRegexp       = regexp.MustCompile("(?i)^(UNIQUE\\s+)?(?:KEY|INDEX)\\s+`?(\\w+)`?\\s*(\\(.*\\))$")
+	columnRegexp      = regexp.MustCompile("^`?(\\w+)`?\\s")
+	precisionRegexp   = regexp.MustCompile(`(?i)\b(datetime|timestamp)\(\d+\)`)
+	commentRegexp     = regexp.MustCompile(`(?i)\s+COMMENT\s+'[^']*'`)
+)
+
+//迁移建表的表名, 按迁移顺序
+func Tables(schema string) ([]string, error) {
+	migrations, err := Load(schema)
+	if err != nil {
+		return nil, err
+	}
+	tables := make([]string, 0)
+	for _, m := range migrations {
+		for _, stmt := range SplitStatements(m.Up) {
+			if match := createTableRegexp.FindStringSubmatch(stmt); match != nil {
+				tables = append(tables, match[2])
+			}
+		}
+	}
+	return tables, nil
+}
+
+//将mysql语句转换为sqlite语句, 建表语句中的普通索引拆分为CREATE INDEX
+func SQLiteStatements(stmt string) []string {
+	if match := addIndexRegexp.FindStringSubmatch(stmt); match != nil {
+		return []string{createIndex(match[1], match[3], match[4], len(match[2]) != 0)}
+	}
+	match := createTableRegexp.FindStringSubmatch(stmt)
+	if match == nil {
+		return []string{stmt}
+	}
+	table := match[2]
+	defs, indexes := make([]string, 0), make([]string, 0)
+	autoIncrement := false
+	for _, line := range strings.Split(match[3], "\n") {
+		def := strings.TrimSuffix(strings.TrimSpace(line), ",")
+		if len(def) == 0 {
+			continue
+		}
+		upper := strings.ToUpper(def)
+		if im := indexRegexp.FindStringSubmatch(def); im != nil {
+			if len(im[1]) != 0 {
+				defs = append(defs, "UNIQUE "+im[3])
+			} else {
+				indexes = append(indexes, createIndex(table, im[2], im[3], false))
+			}
+			continue
+		}
+		if strings.HasPrefix(upper, "PRIMARY KEY") {
+			defs = append(defs, def)
+			continue
+		}
+		if strings.Contains(upper, "AUTO_INCREMENT") { //sqlite自增列须为INTEGER PRIMARY KEY
+			if cm := columnRegexp.FindStringSubmatch(def); cm != nil {
+				def, autoIncrement = fmt.Sprintf("`%s` INTEGER PRIMARY KEY AUTOINCREMENT", cm[1]), true
+			}
+		}
+		def = precisionRegexp.ReplaceAllString(def, "$1")
+		defs = append(defs, commentRegexp.ReplaceAllString(def, ""))
+	}
+	if autoIncrement {
+		for i := 0; i < len(defs); i++ {
+			if strings.HasPrefix(strings.ToUpper(defs[i]), "PRIMARY KEY") {
+				defs = append(defs[:i], defs[i+1:]...)
+				i--
+			}
+		}
+	}
+	stmts := []string{fmt.Sprintf("CREATE TABLE %s`%s` (\n  %s\n)", match[1], table, strings.Join(defs, ",\n  "))}
+	return append(stmts, indexes...)
+}
+
+//sqlite索引名全库唯一, 以表名为前缀
+func createIndex(table, name, columns string, unique bool) string {
+	kind := "INDEX"
+	if unique {
+		kind = "UNIQUE INDEX"
+	}
+	return fmt.Sprintf("CREATE %s IF NOT EXISTS `%s_%s` ON `%s` %s", kind, table, name, table, columns)
+}
+
+//按迁移文件创建sqlite测试库, 不记录版本
+func CreateSQLite(ctx context.Context, db *sql.DB, schema string) error {
+	migrations, err := Load(schema)
+	if err != nil {
+		return err
+	}
+	if len(migrations) == 0 {
+		return fmt.Errorf("no migrations found for schema %s", schema)
+	}
+	for _, m := range migrations {
+		for _, stmt := range SplitStatements(m.Up) {
+			for _, s := range SQLiteStatements(stmt) {
+				if _, err = db.ExecContext(ctx, s); err != nil {
+					return fmt.Errorf("migration %d_%s: %v|sql: %s", m.Version, m.Name, err, s)
+				}
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,53 @@
+package models
+
+import (
+	"encoding/json"
+	"github.com/store_server/utils/errors"
+)
+
+//t_album model
+type Album struct {
+	FalbumId    int64      `gorm:"column:Falbum_id;int(11);not null;primary_key" json:"Falbum_id" form:"Falbum_id"`
+	FalbumName  string     `gorm:"column:Falbum_name;varchar(255)" json:"Falbum_name" form:"Falbum_name"`
+	FalbumMid   string     `gorm:"column:Falbum_mid;varchar(255)" json:"Falbum_mid" form:"Falbum_mid"`
+	Ftype       int64      `gorm:"column:Ftype;int(11)" json:"Ftype" form:"Ftype"`
+	Flanguage   int64      `gorm:"column:Flanguage;int(11)" json:"Flanguage" form:"Flanguage"`
+	Fgenre      int64      `gorm:"column:Fgenre;int(11)" json:"Fgenre" form:"Fgenre"`
+	FsingerId1  int64      `gorm:"column:Fsinger_id1;int(11)" json:"Fsinger_id1" form:"Fsinger_id1"`
+	FsingerId2  int64      `gorm:"column:Fsinger_id2;int(11)" json:"Fsinger_id2" form:"Fsinger_id2"`
+	FsingerId3  int64      `gorm:"column:Fsinger_id3;int(11)" json:"Fsinger_id3" form:"Fsinger_id3"`
+	FsingerAll  string     `gorm:"column:Fsinger_all;varchar(255)" json:"Fsinger_all" form:"Fsinger_all"`
+	FcompanyId  int64      `gorm:"column:Fcompany_id;int(11)" json:"Fcompany_id" form:"Fcompany_id"`
+	FtrackNum   int64      `gorm:"column:Ftrack_num;int(11)" json:"Ftrack_num" form:"Ftrack_num"`
+	Fupc        string     `gorm:"column:Fupc;varchar(64)" json:"Fupc" form:"Fupc"`
+	Fstatus     int64      `gorm:"column:Fstatus;int(11)" json:"Fstatus" form:"Fstatus"`
+	Fversion    int64      `gorm:"column:Fversion;int(11)" json:"Fversion" form:"Fversion"`
+	FpublicTime TimeNormal `gorm:"column:Fpublic_time" json:"Fpublic_time" form:"Fpublic_time"`
+	FuploadTime TimeNormal `gorm:"column:Fupload_time" json:"Fupload_time" form:"Fupload_time"`
+	FmodifyTime TimeNormal `gorm:"column:Fmodify_time" json:"Fmodify_time" form:"Fmodify_time"`
+}
+
+func (Album) TableName() string {
+	return "t_album"
+}
+
+func (album *Album) Encoder() ([]byte, error) {
+	if album == nil {
+		return nil, errors.New("invalid album pointer")
+	}
+	s, err := json.Marshal(*album)
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (album *Album) Decoder(value []byte) error {
+	if album == nil {
+		return errors.New("invalid album pointer")
+	}
+	if err := json.Unmarshal(value, album); err != nil {
+		return err
+	}
+	return nil
+}
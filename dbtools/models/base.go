@@ -70,7 +70,13 @@ func (c Int64s) Value() (driver.Value, error) {
 }
 
 func (c *Int64s) Scan(v interface{}) error {
-	return json.Unmarshal(v.([]byte), c)
+	switch data := v.(type) {
+	case []byte:
+		return json.Unmarshal(data, c)
+	case string: //sqlite测试库json列返回string
+		return json.Unmarshal([]byte(data), c)
+	}
+	return fmt.Errorf("can not convert %v to int64s", v)
 }
 
 /******************** 使gorm支持[]string结构 ******************/
@@ -82,5 +88,11 @@ func (c Strings) Value() (driver.Value, error) {
 }
 
 func (c *Strings) Scan(v interface{}) error {
-	return json.Unmarshal(v.([]byte), c)
+	switch data := v.(type) {
+	case []byte:
+		return json.Unmarshal(data, c)
+	case string: //sqlite测试库json列返回string
+		return json.Unmarshal([]byte(data), c)
+	}
+	return fmt.Errorf("can not convert %v to strings", v)
 }
@@ -0,0 +1,64 @@
+package models
+
+import (
+	"encoding/json"
+	"github.com/store_server/utils/errors"
+)
+
+//t_change_history model, 记录写操作的字段级变更历史
+/*
+CREATE TABLE `t_change_history` (
+  `Fid` bigint(20) NOT NULL AUTO_INCREMENT,
+  `Ftable` varchar(64) NOT NULL DEFAULT '',
+  `Frecord_id` bigint(20) NOT NULL DEFAULT '0',
+  `Frecord_key` varchar(128) NOT NULL DEFAULT '',
+  `Faction` varchar(16) NOT NULL DEFAULT '',
+  `Fchanges` mediumtext NOT NULL,
+  `Fbefore` mediumtext NOT NULL,
+  `Fafter` mediumtext NOT NULL,
+  `Foperator` varchar(64) NOT NULL DEFAULT '',
+  `Frequest_id` varchar(64) NOT NULL DEFAULT '',
+  `Fcreate_time` datetime NOT NULL,
+  PRIMARY KEY (`Fid`),
+  KEY `idx_table_record` (`Ftable`, `Frecord_id`),
+  KEY `idx_request_id` (`Frequest_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+*/
+type History struct {
+	Fid         int64      `gorm:"column:Fid;bigint(20);not null;primary_key;AUTO_INCREMENT" json:"Fid" form:"Fid"`
+	Ftable      string     `gorm:"column:Ftable;varchar(64)" json:"Ftable" form:"Ftable"`
+	FrecordId   int64      `gorm:"column:Frecord_id;bigint(20)" json:"Frecord_id" form:"Frecord_id"`
+	FrecordKey  string     `gorm:"column:Frecord_key;varchar(128)" json:"Frecord_key" form:"Frecord_key"`
+	Faction     string     `gorm:"column:Faction;varchar(16)" json:"Faction" form:"Faction"`
+	Fchanges    string     `gorm:"column:Fchanges;mediumtext" json:"Fchanges" form:"Fchanges"`
+	Fbefore     string     `gorm:"column:Fbefore;mediumtext" json:"Fbefore" form:"Fbefore"`
+	Fafter      string     `gorm:"column:Fafter;mediumtext" json:"Fafter" form:"Fafter"`
+	Foperator   string     `gorm:"column:Foperator;varchar(64)" json:"Foperator" form:"Foperator"`
+	FrequestId  string     `gorm:"column:Frequest_id;varchar(64)" json:"Frequest_id" form:"Frequest_id"`
+	FcreateTime TimeNormal `gorm:"column:Fcreate_time" json:"Fcreate_time" form:"Fcreate_time"`
+}
+
+func (History) TableName() string {
+	return "t_change_history"
+}
+
+func (history *History) Encoder() ([]byte, error) {
+	if history == nil {
+		return nil, errors.New("invalid history pointer")
+	}
+	s, err := json.Marshal(*history)
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (history *History) Decoder(value []byte) error {
+	if history == nil {
+		return errors.New("invalid history pointer")
+	}
+	if err := json.Unmarshal(value, history); err != nil {
+		return err
+	}
+	return nil
+}
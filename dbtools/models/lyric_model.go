@@ -0,0 +1,94 @@
+package models
+
+import (
+	"encoding/json"
+	"github.com/store_server/utils/errors"
+)
+
+//t_lyric model, 歌曲各地区当前歌词; 普通歌词(lrc/plain)存于LyricDB, 逐字歌词(karaoke)存于KlyricDB,
+//两库表结构相同
+/*
+CREATE TABLE `t_lyric` (
+  `Fid` bigint(20) NOT NULL AUTO_INCREMENT,
+  `Ftrack_id` bigint(20) NOT NULL DEFAULT '0',
+  `Fregion` int(11) NOT NULL DEFAULT '0',
+  `Fformat` varchar(16) NOT NULL DEFAULT '',
+  `Fcontent` mediumtext NOT NULL,
+  `Fversion` int(11) NOT NULL DEFAULT '1',
+  `Foperator` varchar(64) NOT NULL DEFAULT '',
+  `Fcreate_time` datetime NOT NULL,
+  `Fmodify_time` datetime NOT NULL,
+  PRIMARY KEY (`Fid`),
+  UNIQUE KEY `uk_track_region` (`Ftrack_id`, `Fregion`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+*/
+type Lyric struct {
+	Fid         int64      `gorm:"column:Fid;bigint(20);not null;primary_key;AUTO_INCREMENT" json:"Fid" form:"Fid"`
+	FtrackId    int64      `gorm:"column:Ftrack_id;bigint(20)" json:"Ftrack_id" form:"Ftrack_id"`
+	Fregion     int64      `gorm:"column:Fregion;int(11)" json:"Fregion" form:"Fregion"`
+	Fformat     string     `gorm:"column:Fformat;varchar(16)" json:"Fformat" form:"Fformat"`
+	Fcontent    string     `gorm:"column:Fcontent;mediumtext" json:"Fcontent" form:"Fcontent"`
+	Fversion    int64      `gorm:"column:Fversion;int(11)" json:"Fversion" form:"Fversion"`
+	Foperator   string     `gorm:"column:Foperator;varchar(64)" json:"Foperator" form:"Foperator"`
+	FcreateTime TimeNormal `gorm:"column:Fcreate_time" json:"Fcreate_time" form:"Fcreate_time"`
+	FmodifyTime TimeNormal `gorm:"column:Fmodify_time" json:"Fmodify_time" form:"Fmodify_time"`
+}
+
+func (Lyric) TableName() string {
+	return "t_lyric"
+}
+
+func (lyric *Lyric) Encoder() ([]byte, error) {
+	if lyric == nil {
+		return nil, errors.New("invalid lyric pointer")
+	}
+	s, err := json.Marshal(*lyric)
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (lyric *Lyric) Decoder(value []byte) error {
+	if lyric == nil {
+		return errors.New("invalid lyric pointer")
+	}
+	if err := json.Unmarshal(value, lyric); err != nil {
+		return err
+	}
+	return nil
+}
+
+//t_lyric_version model, 歌词每次上传及删除的版本记录, 与t_lyric同库; 删除版本的Faction为delete, 内容为空
+/*
+CREATE TABLE `t_lyric_version` (
+  `Fid` bigint(20) NOT NULL AUTO_INCREMENT,
+  `Ftrack_id` bigint(20) NOT NULL DEFAULT '0',
+  `Fregion` int(11) NOT NULL DEFAULT '0',
+  `Fversion` int(11) NOT NULL DEFAULT '1',
+  `Fformat` varchar(16) NOT NULL DEFAULT '',
+  `Fcontent` mediumtext NOT NULL,
+  `Foperator` varchar(64) NOT NULL DEFAULT '',
+  `Frequest_id` varchar(64) NOT NULL DEFAULT '',
+  `Faction` varchar(16) NOT NULL DEFAULT 'upload',
+  `Fcreate_time` datetime NOT NULL,
+  PRIMARY KEY (`Fid`),
+  UNIQUE KEY `uk_track_region_version` (`Ftrack_id`, `Fregion`, `Fversion`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+*/
+type LyricVersion struct {
+	Fid         int64      `gorm:"column:Fid;bigint(20);not null;primary_key;AUTO_INCREMENT" json:"Fid" form:"Fid"`
+	FtrackId    int64      `gorm:"column:Ftrack_id;bigint(20)" json:"Ftrack_id" form:"Ftrack_id"`
+	Fregion     int64      `gorm:"column:Fregion;int(11)" json:"Fregion" form:"Fregion"`
+	Fversion    int64      `gorm:"column:Fversion;int(11)" json:"Fversion" form:"Fversion"`
+	Fformat     string     `gorm:"column:Fformat;varchar(16)" json:"Fformat" form:"Fformat"`
+	Fcontent    string     `gorm:"column:Fcontent;mediumtext" json:"Fcontent" form:"Fcontent"`
+	Foperator   string     `gorm:"column:Foperator;varchar(64)" json:"Foperator" form:"Foperator"`
+	FrequestId  string     `gorm:"column:Frequest_id;varchar(64)" json:"Frequest_id" form:"Frequest_id"`
+	Faction     string     `gorm:"column:Faction;varchar(16)" json:"Faction" form:"Faction"`
+	FcreateTime TimeNormal `gorm:"column:Fcreate_time" json:"Fcreate_time" form:"Fcreate_time"`
+}
+
+func (LyricVersion) TableName() string {
+	return "t_lyric_version"
+}
@@ -0,0 +1,81 @@
+package models
+
+import (
+	"encoding/json"
+	"github.com/store_server/utils/errors"
+)
+
+//t_singer model
+type Singer struct {
+	FsingerId   int64      `gorm:"column:Fsinger_id;int(11);not null;primary_key" json:"Fsinger_id" form:"Fsinger_id"`
+	FsingerName string     `gorm:"column:Fsinger_name;varchar(255)" json:"Fsinger_name" form:"Fsinger_name"`
+	FsingerMid  string     `gorm:"column:Fsinger_mid;varchar(255)" json:"Fsinger_mid" form:"Fsinger_mid"`
+	Ftype       int64      `gorm:"column:Ftype;int(11)" json:"Ftype" form:"Ftype"`
+	Farea       int64      `gorm:"column:Farea;int(11)" json:"Farea" form:"Farea"`
+	Flanguage   int64      `gorm:"column:Flanguage;int(11)" json:"Flanguage" form:"Flanguage"`
+	Fgenre      int64      `gorm:"column:Fgenre;int(11)" json:"Fgenre" form:"Fgenre"`
+	Fstatus     int64      `gorm:"column:Fstatus;int(11)" json:"Fstatus" form:"Fstatus"`
+	Fversion    int64      `gorm:"column:Fversion;int(11)" json:"Fversion" form:"Fversion"`
+	FuploadTime TimeNormal `gorm:"column:Fupload_time" json:"Fupload_time" form:"Fupload_time"`
+	FmodifyTime TimeNormal `gorm:"column:Fmodify_time" json:"Fmodify_time" form:"Fmodify_time"`
+}
+
+func (Singer) TableName() string {
+	return "t_singer"
+}
+
+func (singer *Singer) Encoder() ([]byte, error) {
+	if singer == nil {
+		return nil, errors.New("invalid singer pointer")
+	}
+	s, err := json.Marshal(*singer)
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (singer *Singer) Decoder(value []byte) error {
+	if singer == nil {
+		return errors.New("invalid singer pointer")
+	}
+	if err := json.Unmarshal(value, singer); err != nil {
+		return err
+	}
+	return nil
+}
+
+//t_singer_alias model, 艺人别名(译名、曾用名等), 一个艺人可有多个别名
+type SingerAlias struct {
+	Fid         int64      `gorm:"column:Fid;int(11);not null;primary_key;AUTO_INCREMENT" json:"Fid" form:"Fid"`
+	FsingerId   int64      `gorm:"column:Fsinger_id;int(11)" json:"Fsinger_id" form:"Fsinger_id"`
+	FaliasName  string     `gorm:"column:Falias_name;varchar(255)" json:"Falias_name" form:"Falias_name"`
+	Flanguage   int64      `gorm:"column:Flanguage;int(11)" json:"Flanguage" form:"Flanguage"`
+	FcreateTime TimeNormal `gorm:"column:Fcreate_time" json:"Fcreate_time" form:"Fcreate_time"`
+	FmodifyTime TimeNormal `gorm:"column:Fmodify_time" json:"Fmodify_time" form:"Fmodify_time"`
+}
+
+func (SingerAlias) TableName() string {
+	return "t_singer_alias"
+}
+
+func (alias *SingerAlias) Encoder() ([]byte, error) {
+	if alias == nil {
+		return nil, errors.New("invalid singer alias pointer")
+	}
+	s, err := json.Marshal(*alias)
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (alias *SingerAlias) Decoder(value []byte) error {
+	if alias == nil {
+		return errors.New("invalid singer alias pointer")
+	}
+	if err := json.Unmarshal(value, alias); err != nil {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,56 @@
+package models
+
+import (
+	"encoding/json"
+	"github.com/store_server/utils/errors"
+)
+
+//t_trash model, 软删除记录的回收站
+/*
+CREATE TABLE `t_trash` (
+  `Fid` bigint(20) NOT NULL AUTO_INCREMENT,
+  `Ftable` varchar(64) NOT NULL DEFAULT '',
+  `Frecord_id` bigint(20) NOT NULL DEFAULT '0',
+  `Fdata` mediumtext NOT NULL,
+  `Fdeleter` varchar(64) NOT NULL DEFAULT '',
+  `Freason` varchar(255) NOT NULL DEFAULT '',
+  `Fdelete_time` datetime NOT NULL,
+  PRIMARY KEY (`Fid`),
+  KEY `idx_table_record` (`Ftable`, `Frecord_id`),
+  KEY `idx_delete_time` (`Fdelete_time`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+*/
+type Trash struct {
+	Fid         int64      `gorm:"column:Fid;bigint(20);not null;primary_key;AUTO_INCREMENT" json:"Fid" form:"Fid"`
+	Ftable      string     `gorm:"column:Ftable;varchar(64)" json:"Ftable" form:"Ftable"`
+	FrecordId   int64      `gorm:"column:Frecord_id;bigint(20)" json:"Frecord_id" form:"Frecord_id"`
+	Fdata       string     `gorm:"column:Fdata;mediumtext" json:"Fdata" form:"Fdata"`
+	Fdeleter    string     `gorm:"column:Fdeleter;varchar(64)" json:"Fdeleter" form:"Fdeleter"`
+	Freason     string     `gorm:"column:Freason;varchar(255)" json:"Freason" form:"Freason"`
+	FdeleteTime TimeNormal `gorm:"column:Fdelete_time" json:"Fdelete_time" form:"Fdelete_time"`
+}
+
+func (Trash) TableName() string {
+	return "t_trash"
+}
+
+func (trash *Trash) Encoder() ([]byte, error) {
+	if trash == nil {
+		return nil, errors.New("invalid trash pointer")
+	}
+	s, err := json.Marshal(*trash)
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (trash *Trash) Decoder(value []byte) error {
+	if trash == nil {
+		return errors.New("invalid trash pointer")
+	}
+	if err := json.Unmarshal(value, trash); err != nil {
+		return err
+	}
+	return nil
+}
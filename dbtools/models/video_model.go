@@ -7,21 +7,21 @@ import (
 
 //t_video model
 type Video struct {
-	Fid               int64      `gorm:"column:Fid" json:"Fid" form:"Fid"`
-	FregionId         int64      `gorm:"column:Fregion_id" json:"Fregion_id" form:"Fregion_id"`
-	Ftitle            string     `gorm:"column:Ftitle" json:"Ftitle" form:"Ftitle"`
+	Fid               int64      `gorm:"column:Fid;primary_key;AUTO_INCREMENT" json:"Fid" form:"Fid"`
+	FregionId         int64      `gorm:"column:Fregion_id" json:"Fregion_id" form:"Fregion_id" validate:"region"`
+	Ftitle            string     `gorm:"column:Ftitle" json:"Ftitle" form:"Ftitle" validate:"required,maxlen=255"`
 	Fstatus           int64      `gorm:"column:Fstatus" json:"Fstatus" form:"Fstatus"`
-	FlocalFrom        int64      `gorm:"column:Flocal_from" json:"Flocal_from" form:"Flocal_from"`
+	FlocalFrom        int64      `gorm:"column:Flocal_from" json:"Flocal_from" form:"Flocal_from" validate:"source"`
 	Fsource           int64      `gorm:"column:Fsource" json:"Fsource" form:"Fsource"`
 	Fimage            string     `gorm:"column:Fimage" json:"Fimage" form:"Fimage"`
 	Fvideo            string     `gorm:"column:Fvideo" json:"Fvideo" form:"Fvideo"`
 	Fuuid             string     `gorm:"column:Fuuid" json:"Fuuid" form:"Fuuid"`
 	Fmd5              string     `gorm:"column:Fmd5" json:"Fmd5" form:"Fmd5"`
-	Fduration         string     `gorm:"column:Fduration" json:"Fduration" form:"Fduration"`
+	Fduration         string     `gorm:"column:Fduration" json:"Fduration" form:"Fduration" validate:"duration"`
 	Fformat           string     `gorm:"column:Fformat" json:"Fformat" form:"Fformat"`
 	Fsize             string     `gorm:"column:Fsize" json:"Fsize" form:"Fsize"`
-	Fupc              string     `gorm:"column:Fupc" json:"Fupc" form:"Fupc"`
-	Fisrc             string     `gorm:"column:Fisrc" json:"Fisrc" form:"Fisrc"`
+	Fupc              string     `gorm:"column:Fupc" json:"Fupc" form:"Fupc" validate:"upc"`
+	Fisrc             string     `gorm:"column:Fisrc" json:"Fisrc" form:"Fisrc" validate:"isrc"`
 	Fgrid             string     `gorm:"column:Fgrid" json:"Fgrid" form:"Fgrid"`
 	FuploadStatus     int64      `gorm:"column:Fupload_status" json:"Fupload_status" form:"Fupload_status"`
 	FcreateTime       TimeNormal `gorm:"column:Fcreate_time" json:"Fcreate_time" form:"Fcreate_time"`
@@ -63,7 +63,7 @@ func (video *Video) Decoder(value []byte) error {
 
 //t_video_aid model
 type VideoAid struct {
-	Fid         int64      `gorm:"column:Fid" json:"Fid" form:"Fid"`
+	Fid         int64      `gorm:"column:Fid;primary_key;AUTO_INCREMENT" json:"Fid" form:"Fid"`
 	FlocalVId   int64      `gorm:"column:Flocal_v_id" json:"Flocal_v_id" form:"Flocal_v_id"`
 	FregionId   int64      `gorm:"column:Fregion_id" json:"Fregion_id" form:"Fregion_id"`
 	Ftype       int64      `gorm:"column:Ftype" json:"Ftype" form:"Ftype"`
@@ -99,7 +99,7 @@ func (videoAd *VideoAid) Decoder(value []byte) error {
 
 //t_video_upload model
 type VideoUpload struct {
-	Fid         int64      `gorm:"column:Fid" json:"Fid" form:"Fid"`
+	Fid         int64      `gorm:"column:Fid;primary_key;AUTO_INCREMENT" json:"Fid" form:"Fid"`
 	FregionId   int64      `gorm:"column:Fregion_id" json:"Fregion_id" form:"Fregion_id"`
 	Fvideo      string     `gorm:"column:Fvideo" json:"Fvideo" form:"Fvideo"`
 	Fmd5        string     `gorm:"column:Fmd5" json:"Fmd5" form:"Fmd5"`
@@ -134,7 +134,7 @@ func (videoUd *VideoUpload) Decoder(value []byte) error {
 
 //t_video_import model
 type VideoImport struct {
-	Fid         int64      `gorm:"column:Fid" json:"Fid" form:"Fid"`
+	Fid         int64      `gorm:"column:Fid;primary_key;AUTO_INCREMENT" json:"Fid" form:"Fid"`
 	FvId        int64      `gorm:"column:Fv_id" json:"Fv_id" form:"Fv_id"`
 	FlocalPath  string     `gorm:"column:Flocal_path" json:"Flocal_path" form:"Flocal_path"`
 	FsrcPath    string     `gorm:"column:Fsrc_path" json:"Fsrc_path" form:"Fsrc_path"`
@@ -170,12 +170,12 @@ func (videoIt *VideoImport) Decoder(value []byte) error {
 
 //t_video_extra_os model
 type VideoExtraOs struct {
-	FlocalId        int64      `gorm:"column:Flocal_id" json:"Flocal_id" form:"Flocal_id"`
+	FlocalId        int64      `gorm:"column:Flocal_id;primary_key;AUTO_INCREMENT" json:"Flocal_id" form:"Flocal_id"`
 	FvId            int64      `gorm:"column:Fv_id" json:"Fv_id" form:"Fv_id"`
-	FregionId       int64      `gorm:"column:Fregion_id" json:"Fregion_id" form:"Fregion_id"`
+	FregionId       int64      `gorm:"column:Fregion_id" json:"Fregion_id" form:"Fregion_id" validate:"region"`
 	Ftype           int64      `gorm:"column:Ftype" json:"Ftype" form:"Ftype"`
 	Fdesc           string     `gorm:"column:Fdesc" json:"Fdesc" form:"Fdesc"`
-	FlocalTitle     string     `gorm:"column:Flocal_title" json:"Flocal_title" form:"Flocal_title"`
+	FlocalTitle     string     `gorm:"column:Flocal_title" json:"Flocal_title" form:"Flocal_title" validate:"maxlen=255"`
 	Fstatus         int64      `gorm:"column:Fstatus" json:"Fstatus" form:"Fstatus"`
 	FlocalImage     string     `gorm:"column:Flocal_image" json:"Flocal_image" form:"Flocal_image"`
 	FtrackList      string     `gorm:"column:Ftrack_list" json:"Ftrack_list" form:"Ftrack_list"`
@@ -220,7 +220,7 @@ func (videoEs *VideoExtraOs) Decoder(value []byte) error {
 
 //t_video_singer_track model
 type VideoSingerTrack struct {
-	Fid         int64      `gorm:"column:Fid" json:"Fid" form:"Fid"`
+	Fid         int64      `gorm:"column:Fid;primary_key;AUTO_INCREMENT" json:"Fid" form:"Fid"`
 	FlocalVId   int64      `gorm:"column:Flocal_v_id" json:"Flocal_v_id" form:"Flocal_v_id"`
 	FregionId   int64      `gorm:"column:Fregion_id" json:"Fregion_id" form:"Fregion_id"`
 	Ftype       int64      `gorm:"column:Ftype" json:"Ftype" form:"Ftype"`
@@ -0,0 +1,228 @@
+package mongo
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+/*-------------------------- 聚合查询 -------------------------*/
+//对music_cms库的白名单集合执行聚合管道, 只允许白名单内的stage, $lookup只能关联白名单集合;
+//管道末尾强制追加$limit并设置maxTimeMS, 结果逐条交给回调处理, 不在内存中汇总
+
+const (
+	aggregateDb = "music_cms"
+
+	defaultAggregateMaxTime    = 10 * time.Second
+	defaultAggregateMaxResults = 1000
+)
+
+var (
+	aggregateStages = map[string]bool{
+		"$match": true, "$group": true, "$project": true, "$sort": true, "$limit": true, "$count": true, "$lookup": true,
+	}
+	//可在服务端执行js的操作符
+	forbiddenOperators = map[string]bool{"$where": true, "$function": true, "$accumulator": true}
+
+	defaultAggregateCollections = []string{"auto_publish_album", "external_resources", defaultPreviewAudioCollection}
+
+	aggregateOpts = AggregateOptions{
+		Collections: defaultAggregateCollections,
+		MaxTime:     defaultAggregateMaxTime,
+		MaxResults:  defaultAggregateMaxResults,
+	}
+	aggregateLock sync.RWMutex
+)
+
+//聚合查询配置, Collections为空或MaxTime、MaxResults<=0时使用默认值
+type AggregateOptions struct {
+	Collections []string
+	MaxTime     time.Duration
+	MaxResults  int64
+}
+
+func SetAggregateOptions(opts AggregateOptions) {
+	if len(opts.Collections) == 0 {
+		opts.Collections = defaultAggregateCollections
+	}
+	if opts.MaxTime <= 0 {
+		opts.MaxTime = defaultAggregateMaxTime
+	}
+	if opts.MaxResults <= 0 {
+		opts.MaxResults = defaultAggregateMaxResults
+	}
+	aggregateLock.Lock()
+	defer aggregateLock.Unlock()
+	aggregateOpts = opts
+}
+
+func getAggregateOptions() AggregateOptions {
+	aggregateLock.RLock()
+	defer aggregateLock.RUnlock()
+	return aggregateOpts
+}
+
+//不允许执行的管道
+type PipelineError struct {
+	Stage  int    `json:"stage"`
+	Reason string `json:"reason"`
+}
+
+func (e *PipelineError) Error() string {
+	return fmt.Sprintf("invalid pipeline stage %d: %s", e.Stage, e.Reason)
+}
+
+//对白名单集合执行聚合管道, limit为返回的最大文档数, 为0或超过配置的上限时使用上限
+func (md *MongoDriver) Aggregate(col string, pipeline []bson.D, limit int64, fn func(doc bson.Raw) error) error {
+	opts := getAggregateOptions()
+	cols := md.aggregateCollections(opts.Collections)
+	if !containsString(cols, col) {
+		return &PipelineError{Stage: -1, Reason: fmt.Sprintf("collection %s is not allowed", col)}
+	}
+	if err := checkPipeline(pipeline, cols); err != nil {
+		return err
+	}
+	if limit <= 0 || limit > opts.MaxResults {
+		limit = opts.MaxResults
+	}
+	stages := append(append([]bson.D{}, pipeline...), bson.D{{"$limit", limit}})
+	aggOpts := options.Aggregate().SetMaxTime(opts.MaxTime).SetAllowDiskUse(false)
+	return md.coll(aggregateDb, col).Aggregate(md.Ctx, stages, fn, aggOpts)
+}
+
+//白名单中的preview_audio指试听音频集合, 替换为配置的集合
+func (md *MongoDriver) aggregateCollections(cols []string) []string {
+	audioCol := md.audioCollection()
+	if audioCol == defaultPreviewAudioCollection {
+		return cols
+	}
+	ret := make([]string, 0, len(cols))
+	for _, col := range cols {
+		if col == defaultPreviewAudioCollection {
+			col = audioCol
+		}
+		ret = append(ret, col)
+	}
+	return ret
+}
+
+func checkPipeline(pipeline []bson.D, cols []string) error {
+	for i, stage := range pipeline {
+		if len(stage) != 1 {
+			return &PipelineError{Stage: i, Reason: "stage must be a document with exactly one field"}
+		}
+		name := stage[0].Key
+		if !aggregateStages[name] {
+			return &PipelineError{Stage: i, Reason: fmt.Sprintf("stage %s is not allowed", name)}
+		}
+		if op := forbiddenOperator(stage[0].Value); len(op) != 0 {
+			return &PipelineError{Stage: i, Reason: fmt.Sprintf("operator %s is not allowed", op)}
+		}
+		if name != "$lookup" {
+			continue
+		}
+		spec, ok := stage[0].Value.(bson.D)
+		if !ok {
+			return &PipelineError{Stage: i, Reason: "$lookup must be a document"}
+		}
+		for _, e := range spec {
+			switch e.Key {
+			case "from": //只能关联同库的白名单集合
+				from, ok := e.Value.(string)
+				if !ok || !containsString(cols, from) {
+					return &PipelineError{Stage: i, Reason: fmt.Sprintf("$lookup from %v is not allowed", e.Value)}
+				}
+			case "pipeline":
+				sub, err := subPipeline(e.Value)
+				if err != nil {
+					return &PipelineError{Stage: i, Reason: err.Error()}
+				}
+				if err = checkPipeline(sub, cols); err != nil {
+					return &PipelineError{Stage: i, Reason: "$lookup " + err.Error()}
+				}
+			}
+		}
+	}
+	return nil
+}
+
+//递归查找禁止的操作符
+func forbiddenOperator(v interface{}) string {
+	switch val := v.(type) {
+	case bson.D:
+		for _, e := range val {
+			if forbiddenOperators[e.Key] {
+				return e.Key
+			}
+			if op := forbiddenOperator(e.Value); len(op) != 0 {
+				return op
+			}
+		}
+	case bson.M:
+		for k, item := range val {
+			if forbiddenOperators[k] {
+				return k
+			}
+			if op := forbiddenOperator(item); len(op) != 0 {
+				return op
+			}
+		}
+	case primitive.A:
+		for _, item := range val {
+			if op := forbiddenOperator(item); len(op) != 0 {
+				return op
+			}
+		}
+	case []interface{}:
+		return forbiddenOperator(primitive.A(val))
+	}
+	return ""
+}
+
+func subPipeline(v interface{}) ([]bson.D, error) {
+	var items []interface{}
+	switch val := v.(type) {
+	case primitive.A:
+		items = val
+	case []interface{}:
+		items = val
+	case []bson.D:
+		return val, nil
+	default:
+		return nil, fmt.Errorf("$lookup pipeline must be an array")
+	}
+	stages := make([]bson.D, 0, len(items))
+	for _, item := range items {
+		stage, ok := item.(bson.D)
+		if !ok {
+			return nil, fmt.Errorf("$lookup pipeline stage must be a document")
+		}
+		stages = append(stages, stage)
+	}
+	return stages, nil
+}
+
+//解析扩展json格式的管道, 如[{"$match": {"deleted": 0}}, {"$group": {"_id": "$region_id", "n": {"$sum": 1}}}]
+func ParsePipeline(data []byte) ([]bson.D, error) {
+	wrapper := struct {
+		Pipeline []bson.D `bson:"pipeline"`
+	}{}
+	doc := append(append([]byte(`{"pipeline":`), data...), '}')
+	if err := bson.UnmarshalExtJSON(doc, false, &wrapper); err != nil {
+		return nil, err
+	}
+	return wrapper.Pipeline, nil
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,202 @@
+package mongo
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+/*-------------------------- 集合操作 -------------------------*/
+//MongoDriver使用的集合操作, 线上由mongo client实现, 单元测试可替换为内存实现(见memory.go)
+
+type Collection interface {
+	FindOne(ctx context.Context, filter interface{}, opts ...*options.FindOneOptions) (bson.Raw, error)
+	Find(ctx context.Context, filter interface{}, results interface{}, opts ...*options.FindOptions) error
+	InsertOne(ctx context.Context, doc interface{}) error
+	InsertMany(ctx context.Context, docs []interface{}) error
+	UpdateOne(ctx context.Context, filter, update interface{}) error
+	UpdateMany(ctx context.Context, filter, update interface{}) error
+	FindOneAndUpdate(ctx context.Context, filter, update interface{},
+		opts ...*options.FindOneAndUpdateOptions) (bson.Raw, error)
+	DeleteOne(ctx context.Context, filter interface{}) error
+	DeleteMany(ctx context.Context, filter interface{}) error
+	//执行聚合管道, 结果文档逐条交给fn处理, fn返回错误时停止
+	Aggregate(ctx context.Context, pipeline interface{}, fn func(doc bson.Raw) error,
+		opts ...*options.AggregateOptions) error
+	ListIndexes(ctx context.Context) ([]bson.Raw, error)
+	CreateIndex(ctx context.Context, keys bson.D, opts *options.IndexOptions) error
+}
+
+//按库名及集合名获取集合
+type Backend interface {
+	Collection(db, col string) Collection
+}
+
+//mongo client实现
+type clientBackend struct {
+	client *mongo.Client
+}
+
+func NewClientBackend(client *mongo.Client) Backend {
+	return &clientBackend{client}
+}
+
+func (cb *clientBackend) Collection(db, col string) Collection {
+	return &clientCollection{cb.client.Database(db).Collection(col)}
+}
+
+type clientCollection struct {
+	collection *mongo.Collection
+}
+
+func (cc *clientCollection) FindOne(ctx context.Context, filter interface{},
+	opts ...*options.FindOneOptions) (bson.Raw, error) {
+	res := cc.collection.FindOne(ctx, filter, opts...)
+	if res.Err() != nil {
+		return nil, res.Err()
+	}
+	return res.DecodeBytes()
+}
+
+func (cc *clientCollection) Find(ctx context.Context, filter interface{}, results interface{},
+	opts ...*options.FindOptions) error {
+	cur, err := cc.collection.Find(ctx, filter, opts...)
+	if err != nil {
+		return err
+	}
+	return cur.All(ctx, results)
+}
+
+func (cc *clientCollection) InsertOne(ctx context.Context, doc interface{}) error {
+	_, err := cc.collection.InsertOne(ctx, doc)
+	return err
+}
+
+func (cc *clientCollection) InsertMany(ctx context.Context, docs []interface{}) error {
+	_, err := cc.collection.InsertMany(ctx, docs)
+	return err
+}
+
+func (cc *clientCollection) UpdateOne(ctx context.Context, filter, update interface{}) error {
+	_, err := cc.collection.UpdateOne(ctx, filter, update)
+	return err
+}
+
+func (cc *clientCollection) UpdateMany(ctx context.Context, filter, update interface{}) error {
+	_, err := cc.collection.UpdateMany(ctx, filter, update)
+	return err
+}
+
+func (cc *clientCollection) FindOneAndUpdate(ctx context.Context, filter, update interface{},
+	opts ...*options.FindOneAndUpdateOptions) (bson.Raw, error) {
+	res := cc.collection.FindOneAndUpdate(ctx, filter, update, opts...)
+	if res.Err() != nil {
+		return nil, res.Err()
+	}
+	return res.DecodeBytes()
+}
+
+func (cc *clientCollection) DeleteOne(ctx context.Context, filter interface{}) error {
+	_, err := cc.collection.DeleteOne(ctx, filter)
+	return err
+}
+
+func (cc *clientCollection) DeleteMany(ctx context.Context, filter interface{}) error {
+	_, err := cc.collection.DeleteMany(ctx, filter)
+	return err
+}
+
+func (cc *clientCollection) Aggregate(ctx context.Context, pipeline interface{}, fn func(doc bson.Raw) error,
+	opts ...*options.AggregateOptions) error {
+	cur, err := cc.collection.Aggregate(ctx, pipeline, opts...)
+	if err != nil {
+		return err
+	}
+	defer cur.Close(ctx)
+	for cur.Next(ctx) {
+		if err = fn(cur.Current); err != nil {
+			return err
+		}
+	}
+	return cur.Err()
+}
+
+func (cc *clientCollection) ListIndexes(ctx context.Context) ([]bson.Raw, error) {
+	cur, err := cc.collection.Indexes().List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	indexes := []bson.Raw{}
+	err = cur.All(ctx, &indexes)
+	return indexes, err
+}
+
+func (cc *clientCollection) CreateIndex(ctx context.Context, keys bson.D, opts *options.IndexOptions) error {
+	_, err := cc.collection.Indexes().CreateOne(ctx, mongo.IndexModel{Keys: keys, Options: opts})
+	return err
+}
+
+//将文档解码至results切片指针, 与mongo.Cursor.All行为一致
+func decodeAll(docs []bson.Raw, results interface{}) error {
+	resultsVal := reflect.ValueOf(results)
+	if resultsVal.Kind() != reflect.Ptr || resultsVal.Elem().Kind() != reflect.Slice {
+		return fmt.Errorf("results argument must be a pointer to a slice, but was a %s", resultsVal.Kind())
+	}
+	sliceVal := resultsVal.Elem()
+	elemType := sliceVal.Type().Elem()
+	sliceVal.Set(reflect.MakeSlice(sliceVal.Type(), 0, len(docs)))
+	for _, doc := range docs {
+		elem := reflect.New(elemType)
+		if err := bson.Unmarshal(doc, elem.Interface()); err != nil {
+			return err
+		}
+		sliceVal.Set(reflect.Append(sliceVal, elem.Elem()))
+	}
+	return nil
+}
+
+//导入fixture目录下的文档, 每个<集合名>.json文件为扩展json格式的文档数组, 导入前清空集合, 如:
+//[{"_id": {"$numberLong": "1"}, "track_id": {"$numberLong": "1"}, "deleted": 0}]
+func LoadFixtures(ctx context.Context, b Backend, db, dir string) error {
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return err
+	}
+	sort.Strings(files)
+	for _, file := range files {
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		fixture := struct {
+			Docs []bson.D `bson:"docs"`
+		}{}
+		wrapped := append(append([]byte(`{"docs": `), data...), '}')
+		if err = bson.UnmarshalExtJSON(wrapped, false, &fixture); err != nil {
+			return fmt.Errorf("parse fixture %s error: %v", file, err)
+		}
+		collection := b.Collection(db, strings.TrimSuffix(filepath.Base(file), ".json"))
+		if err = collection.DeleteMany(ctx, bson.D{}); err != nil {
+			return err
+		}
+		docs := make([]interface{}, 0, len(fixture.Docs))
+		for _, doc := range fixture.Docs {
+			docs = append(docs, doc)
+		}
+		if len(docs) == 0 {
+			continue
+		}
+		if err = collection.InsertMany(ctx, docs); err != nil {
+			return fmt.Errorf("load fixture %s error: %v", file, err)
+		}
+	}
+	return nil
+}
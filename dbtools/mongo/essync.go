@@ -0,0 +1,349 @@
+package mongo
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/store_server/logger"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	ies "github.com/store_server/dbtools/elastic"
+	m "github.com/store_server/dbtools/models"
+)
+
+/*-------------------------- mongo变更同步es -------------------------*/
+//监听集合的文档变更并写入es索引, 支持两种模式:
+//change_stream: 通过change stream获取insert/update/replace/delete事件, 需要副本集, resume token持久化在checkpoint集合,
+//重启后从上次写入es的位置继续; poll: 按(modify_time, _id)轮询增量, 持久化最后处理的位置, 物理删除的文档无法感知,
+//只同步deleted=1的软删除, 没有modify_time的文档不同步. 文档由按集合注册的Transformer转换为es文档, deleted=1或文档已删除时删除es文档;
+//无法解析或转换的文档记录日志后跳过, 同步位置照常前进
+
+const (
+	EsSyncCheckpointCollection = "es_sync_checkpoints"
+	EsSyncModeChangeStream     = "change_stream"
+	EsSyncModePoll             = "poll"
+
+	defaultEsSyncBatchSize    = 500
+	defaultEsSyncPollInterval = 10 * time.Second
+)
+
+//将mongo文档转换为es文档内容, 返回nil时忽略该文档
+type Transformer func(doc bson.Raw) (interface{}, error)
+
+//es批量写入, *elastic.ESClient实现该接口
+type BulkWriter interface {
+	BulkWrite(sources []*ies.DocDecl) error
+}
+
+var (
+	transformers = map[string]Transformer{
+		"external_resources": modelTransformer(func() interface{} { return &m.ExternalResource{} }),
+		"auto_publish_album": modelTransformer(func() interface{} { return &m.PublishedAlbum{} }),
+	}
+	transformerLock sync.RWMutex
+)
+
+//注册集合的文档转换, 覆盖已有的转换; 未注册的集合使用文档全部字段
+func RegisterTransformer(col string, t Transformer) {
+	transformerLock.Lock()
+	defer transformerLock.Unlock()
+	transformers[col] = t
+}
+
+func transformerOf(col string) Transformer {
+	transformerLock.RLock()
+	defer transformerLock.RUnlock()
+	if t, ok := transformers[col]; ok {
+		return t
+	}
+	return func(doc bson.Raw) (interface{}, error) {
+		fields := bson.M{}
+		err := bson.Unmarshal(doc, &fields)
+		delete(fields, "_id")
+		return fields, err
+	}
+}
+
+//解码为文档模型, es文档字段与模型json字段一致
+func modelTransformer(newModel func() interface{}) Transformer {
+	return func(doc bson.Raw) (interface{}, error) {
+		model := newModel()
+		if err := bson.Unmarshal(doc, model); err != nil {
+			return nil, err
+		}
+		return model, nil
+	}
+}
+
+//集合写入的es索引
+type EsSyncIndex struct {
+	Index string
+	Type  string
+}
+
+type EsSyncOptions struct {
+	Db           string
+	Collections  map[string]EsSyncIndex //集合名->es索引
+	Mode         string                 //change_stream或poll, 默认change_stream
+	PollInterval time.Duration          //poll模式的轮询间隔及出错后的重试间隔
+	BatchSize    int                    //单次写入es的最大文档数
+}
+
+//mongo变更同步es
+type EsSyncer struct {
+	md     *MongoDriver
+	writer BulkWriter
+	opts   EsSyncOptions
+}
+
+func (md *MongoDriver) NewEsSyncer(writer BulkWriter, opts EsSyncOptions) *EsSyncer {
+	if len(opts.Mode) == 0 {
+		opts.Mode = EsSyncModeChangeStream
+	}
+	if opts.PollInterval <= 0 {
+		opts.PollInterval = defaultEsSyncPollInterval
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = defaultEsSyncBatchSize
+	}
+	return &EsSyncer{md: md, writer: writer, opts: opts}
+}
+
+//每个集合一个同步协程, ctx结束时返回
+func (s *EsSyncer) Run(ctx context.Context) {
+	wg := sync.WaitGroup{}
+	for col := range s.opts.Collections {
+		wg.Add(1)
+		go func(col string) {
+			defer wg.Done()
+			s.runCollection(ctx, col)
+		}(col)
+	}
+	wg.Wait()
+}
+
+func (s *EsSyncer) runCollection(ctx context.Context, col string) {
+	for {
+		var err error
+		if s.opts.Mode == EsSyncModePoll {
+			err = s.syncPending(ctx, col)
+		} else {
+			err = s.watch(ctx, col)
+		}
+		if err != nil && ctx.Err() == nil {
+			logger.Entry().Errorf("es sync %s.%s error: %v", s.opts.Db, col, err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(s.opts.PollInterval):
+		}
+	}
+}
+
+/************************ change stream ************************/
+type changeEvent struct {
+	OperationType string   `bson:"operationType"`
+	DocumentKey   bson.Raw `bson:"documentKey"`
+	FullDocument  bson.Raw `bson:"fullDocument"`
+}
+
+func (s *EsSyncer) watch(ctx context.Context, col string) error {
+	if s.md.MongoClient == nil {
+		return fmt.Errorf("invalid mongo client")
+	}
+	cp, err := s.loadCheckpoint(col)
+	if err != nil {
+		return err
+	}
+	opts := options.ChangeStream().SetFullDocument(options.UpdateLookup)
+	if len(cp.Token) != 0 {
+		opts.SetResumeAfter(cp.Token)
+	}
+	pipeline := mongo.Pipeline{{{"$match", bson.M{
+		"operationType": bson.M{"$in": []string{"insert", "update", "replace", "delete"}}}}}}
+	cs, err := s.md.MongoClient.Database(s.opts.Db).Collection(col).Watch(ctx, pipeline, opts)
+	if err != nil {
+		return err
+	}
+	defer cs.Close(context.Background())
+	batch := make([]*ies.DocDecl, 0, s.opts.BatchSize)
+	consumed := 0 //上次保存checkpoint后处理的事件数, 含跳过的事件
+	for {
+		if cs.TryNext(ctx) { //无新事件时等待服务端maxAwaitTime后返回false
+			consumed++
+			decl, err := s.eventDecl(col, cs)
+			if err != nil { //跳过无法解析或转换的文档, 避免阻塞后续同步
+				logger.Entry().Errorf("es sync %s.%s skip event: %v", s.opts.Db, col, err)
+			} else if decl != nil {
+				batch = append(batch, decl)
+			}
+			if consumed < s.opts.BatchSize {
+				continue
+			}
+		} else if err = cs.Err(); err != nil {
+			return err
+		} else if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if consumed == 0 {
+			continue
+		}
+		if len(batch) != 0 {
+			if err = s.writer.BulkWrite(batch); err != nil {
+				return err
+			}
+		}
+		cp.Token = cs.ResumeToken()
+		if err = s.saveCheckpoint(col, cp); err != nil {
+			return err
+		}
+		batch, consumed = batch[:0], 0
+	}
+}
+
+func (s *EsSyncer) eventDecl(col string, cs *mongo.ChangeStream) (*ies.DocDecl, error) {
+	event := &changeEvent{}
+	if err := cs.Decode(event); err != nil {
+		return nil, fmt.Errorf("decode %s change event error: %v", col, err)
+	}
+	doc := event.FullDocument
+	if event.OperationType == "delete" {
+		doc = nil
+	}
+	return s.docDecl(col, event.DocumentKey.Lookup("_id"), doc)
+}
+
+/************************ 轮询 ************************/
+//连续同步直到返回不足一批, 积压时不等待轮询间隔
+func (s *EsSyncer) syncPending(ctx context.Context, col string) error {
+	for ctx.Err() == nil {
+		n, err := s.SyncOnce(col)
+		if err != nil || n < s.opts.BatchSize {
+			return err
+		}
+	}
+	return nil
+}
+
+//按(modify_time, _id)顺序同步上次位置之后的一批文档, 返回处理的文档数(含跳过的文档)
+func (s *EsSyncer) SyncOnce(col string) (int, error) {
+	cp, err := s.loadCheckpoint(col)
+	if err != nil {
+		return 0, err
+	}
+	filter := bson.M{"modify_time": bson.M{"$exists": true}} //无modify_time的文档无法记录同步位置, 不同步
+	if cp.ModifyTime != nil {
+		filter["$or"] = []bson.M{
+			{"modify_time": bson.M{"$gt": cp.ModifyTime}},
+			{"modify_time": cp.ModifyTime, "_id": bson.M{"$gt": cp.LastId}},
+		}
+	}
+	opts := options.Find().SetSort(bson.D{{"modify_time", 1}, {"_id", 1}}).SetLimit(int64(s.opts.BatchSize))
+	docs := []bson.Raw{}
+	if err = s.md.coll(s.opts.Db, col).Find(s.md.Ctx, filter, &docs, opts); err != nil {
+		return 0, err
+	}
+	if len(docs) == 0 {
+		return 0, nil
+	}
+	batch := make([]*ies.DocDecl, 0, len(docs))
+	for _, doc := range docs {
+		decl, err := s.docDecl(col, doc.Lookup("_id"), doc)
+		if err != nil { //跳过无法转换的文档, checkpoint照常前进
+			logger.Entry().Errorf("es sync %s.%s skip doc: %v", s.opts.Db, col, err)
+			continue
+		}
+		if decl != nil {
+			batch = append(batch, decl)
+		}
+	}
+	if len(batch) != 0 {
+		if err = s.writer.BulkWrite(batch); err != nil {
+			return 0, err
+		}
+	}
+	last := docs[len(docs)-1]
+	if err = last.Lookup("modify_time").Unmarshal(&cp.ModifyTime); err != nil {
+		return 0, err
+	}
+	if err = last.Lookup("_id").Unmarshal(&cp.LastId); err != nil {
+		return 0, err
+	}
+	return len(docs), s.saveCheckpoint(col, cp)
+}
+
+//文档转换为es写入声明, doc为空或deleted=1时删除es文档
+func (s *EsSyncer) docDecl(col string, id bson.RawValue, doc bson.Raw) (*ies.DocDecl, error) {
+	idx := s.opts.Collections[col]
+	decl := &ies.DocDecl{Index: idx.Index, Type: idx.Type, Id: rawString(id)}
+	if len(doc) == 0 {
+		decl.Delete = true
+		return decl, nil
+	}
+	if deleted, ok := int64Value(doc.Lookup("deleted")); ok && deleted == 1 {
+		decl.Delete = true
+		return decl, nil
+	}
+	body, err := transformerOf(col)(doc)
+	if err != nil {
+		return nil, fmt.Errorf("transform %s doc %s error: %v", col, decl.Id, err)
+	}
+	if body == nil {
+		return nil, nil
+	}
+	decl.Doc = body
+	return decl, nil
+}
+
+func rawString(v bson.RawValue) string {
+	if n, ok := int64Value(v); ok {
+		return fmt.Sprint(n)
+	}
+	if str, ok := v.StringValueOK(); ok {
+		return str
+	}
+	if oid, ok := v.ObjectIDOK(); ok {
+		return oid.Hex()
+	}
+	return v.String()
+}
+
+/************************ checkpoint ************************/
+//同步位置, change_stream模式记录resume token, poll模式记录最后处理文档的modify_time及_id
+type esSyncCheckpoint struct {
+	Token      bson.Raw    `bson:"token,omitempty"`
+	ModifyTime *time.Time  `bson:"modify_time,omitempty"`
+	LastId     interface{} `bson:"last_id,omitempty"`
+}
+
+func (s *EsSyncer) checkpointKey(col string) string {
+	return fmt.Sprintf("%s.%s.%s", s.opts.Db, col, s.opts.Mode)
+}
+
+func (s *EsSyncer) loadCheckpoint(col string) (*esSyncCheckpoint, error) {
+	cp := &esSyncCheckpoint{}
+	raw, err := s.md.coll(s.opts.Db, EsSyncCheckpointCollection).FindOne(s.md.Ctx,
+		bson.M{"_id": s.checkpointKey(col)})
+	if err == mongo.ErrNoDocuments {
+		return cp, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return cp, bson.Unmarshal(raw, cp)
+}
+
+func (s *EsSyncer) saveCheckpoint(col string, cp *esSyncCheckpoint) error {
+	opts := options.FindOneAndUpdate().SetUpsert(true)
+	_, err := s.md.coll(s.opts.Db, EsSyncCheckpointCollection).FindOneAndUpdate(s.md.Ctx,
+		bson.M{"_id": s.checkpointKey(col)}, bson.M{"$set": cp}, opts)
+	if err != nil && err != mongo.ErrNoDocuments { //upsert新建时返回ErrNoDocuments
+		return err
+	}
+	return nil
+}
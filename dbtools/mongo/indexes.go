@@ -0,0 +1,238 @@
+package mongo
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+/*-------------------------- 索引管理 -------------------------*/
+//按集合声明music_cms库需要的索引, 启动时与实际索引比对: 创建缺失的索引, 报告未声明的索引及
+//键相同但选项(unique/sparse)不一致的索引. 索引按键(字段及顺序)匹配, 名称不同视为同一索引
+
+const indexDb = "music_cms"
+
+//索引键, order为1(升序)或-1(降序)
+type IndexKey struct {
+	Field string `json:"field"`
+	Order int    `json:"order"`
+}
+
+//索引声明, name为空时使用mongo默认命名(字段_顺序)
+type IndexSpec struct {
+	Name   string     `json:"name"`
+	Keys   []IndexKey `json:"keys"`
+	Unique bool       `json:"unique,omitempty"`
+	Sparse bool       `json:"sparse,omitempty"`
+}
+
+func (s *IndexSpec) keyString() string {
+	parts := make([]string, 0, len(s.Keys))
+	for _, k := range s.Keys {
+		parts = append(parts, fmt.Sprintf("%s_%d", k.Field, k.Order))
+	}
+	return strings.Join(parts, "_")
+}
+
+func (s *IndexSpec) indexName() string {
+	if len(s.Name) != 0 {
+		return s.Name
+	}
+	return s.keyString()
+}
+
+//集合索引比对结果
+type IndexReport struct {
+	Collection string       `json:"collection"`
+	Declared   []*IndexSpec `json:"declared"`
+	Actual     []*IndexSpec `json:"actual"`
+	Missing    []*IndexSpec `json:"missing,omitempty"`  //声明但不存在的索引
+	Created    []string     `json:"created,omitempty"`  //本次创建的索引
+	Extra      []*IndexSpec `json:"extra,omitempty"`    //存在但未声明的索引(_id除外)
+	Conflict   []*IndexSpec `json:"conflict,omitempty"` //键相同但选项与声明不一致的实际索引
+	Error      string       `json:"error,omitempty"`
+}
+
+var (
+	declaredIndexes = map[string][]*IndexSpec{
+		"auto_publish_album": {
+			{Keys: []IndexKey{{"album_id", 1}, {"region_id", 1}}},
+			{Keys: []IndexKey{{"region_id", 1}, {"local_status", 1}}},
+			{Keys: []IndexKey{{"modify_time", 1}}},
+		},
+		"external_resources": {
+			{Keys: []IndexKey{{"external_id", 1}}},
+			{Keys: []IndexKey{{"internal_file_id", 1}}},
+			{Keys: []IndexKey{{"modify_time", 1}}},
+		},
+		"preview_audio": {
+			{Keys: []IndexKey{{"track_id", 1}}},
+			{Keys: []IndexKey{{"uuid", 1}}},
+			{Keys: []IndexKey{{"inner_file_id", 1}}},
+		},
+	}
+	indexLock sync.RWMutex
+)
+
+//追加集合的索引声明(如来自配置), 与已有声明键相同的忽略
+func DeclareIndexes(col string, specs ...*IndexSpec) {
+	indexLock.Lock()
+	defer indexLock.Unlock()
+	for _, spec := range specs {
+		exists := false
+		for _, declared := range declaredIndexes[col] {
+			if declared.keyString() == spec.keyString() {
+				exists = true
+				break
+			}
+		}
+		if !exists {
+			declaredIndexes[col] = append(declaredIndexes[col], spec)
+		}
+	}
+}
+
+//声明的索引, 未指定名称的使用默认名称
+func declaredCollections() map[string][]*IndexSpec {
+	indexLock.RLock()
+	defer indexLock.RUnlock()
+	decls := make(map[string][]*IndexSpec, len(declaredIndexes))
+	for col, specs := range declaredIndexes {
+		for _, spec := range specs {
+			named := *spec
+			named.Name = spec.indexName()
+			decls[col] = append(decls[col], &named)
+		}
+	}
+	return decls
+}
+
+//比对声明与实际索引, 不做修改
+func (md *MongoDriver) IndexReports() ([]*IndexReport, error) {
+	return md.reconcileIndexes(false)
+}
+
+//创建缺失的索引并返回比对结果, 创建失败的索引保留在Missing中
+func (md *MongoDriver) EnsureIndexes() ([]*IndexReport, error) {
+	return md.reconcileIndexes(true)
+}
+
+func (md *MongoDriver) reconcileIndexes(create bool) ([]*IndexReport, error) {
+	decls := declaredCollections()
+	if col := md.audioCollection(); col != defaultPreviewAudioCollection { //试听音频索引声明在配置的集合上
+		decls[col] = append(decls[col], decls[defaultPreviewAudioCollection]...)
+		delete(decls, defaultPreviewAudioCollection)
+	}
+	cols := make([]string, 0, len(decls))
+	for col := range decls {
+		cols = append(cols, col)
+	}
+	sort.Strings(cols)
+	reports := make([]*IndexReport, 0, len(cols))
+	for _, col := range cols {
+		report, err := md.reconcileCollection(col, decls[col], create)
+		if err != nil {
+			return reports, fmt.Errorf("reconcile indexes of %s error: %v", col, err)
+		}
+		reports = append(reports, report)
+	}
+	return reports, nil
+}
+
+func (md *MongoDriver) reconcileCollection(col string, declared []*IndexSpec, create bool) (*IndexReport, error) {
+	report := &IndexReport{Collection: col, Declared: declared}
+	actual, err := md.listIndexes(col)
+	if err != nil {
+		return nil, err
+	}
+	report.Actual = actual
+	actualByKey := make(map[string]*IndexSpec, len(actual))
+	for _, index := range actual {
+		actualByKey[index.keyString()] = index
+	}
+	declaredKeys := make(map[string]bool, len(declared))
+	for _, spec := range declared {
+		key := spec.keyString()
+		declaredKeys[key] = true
+		if index, ok := actualByKey[key]; ok {
+			if index.Unique != spec.Unique || index.Sparse != spec.Sparse {
+				report.Conflict = append(report.Conflict, index)
+			}
+			continue
+		}
+		if !create {
+			report.Missing = append(report.Missing, spec)
+			continue
+		}
+		if err = md.createIndex(col, spec); err != nil {
+			report.Missing = append(report.Missing, spec)
+			report.Error = fmt.Sprintf("create index %s error: %v", spec.indexName(), err)
+			continue
+		}
+		report.Created = append(report.Created, spec.indexName())
+	}
+	for _, index := range actual {
+		if !declaredKeys[index.keyString()] && index.Name != "_id_" {
+			report.Extra = append(report.Extra, index)
+		}
+	}
+	return report, nil
+}
+
+func (md *MongoDriver) listIndexes(col string) ([]*IndexSpec, error) {
+	raws, err := md.coll(indexDb, col).ListIndexes(md.Ctx)
+	if err != nil {
+		return nil, err
+	}
+	indexes := make([]*IndexSpec, 0, len(raws))
+	for _, raw := range raws {
+		index := struct {
+			Name   string `bson:"name"`
+			Key    bson.D `bson:"key"`
+			Unique bool   `bson:"unique"`
+			Sparse bool   `bson:"sparse"`
+		}{}
+		if err = bson.Unmarshal(raw, &index); err != nil {
+			return nil, err
+		}
+		spec := &IndexSpec{Name: index.Name, Unique: index.Unique, Sparse: index.Sparse}
+		for _, k := range index.Key {
+			order, ok := toFloat(k.Value)
+			if !ok { //text、hashed等特殊索引按0记录
+				order = 0
+			}
+			spec.Keys = append(spec.Keys, IndexKey{Field: k.Key, Order: int(order)})
+		}
+		indexes = append(indexes, spec)
+	}
+	return indexes, nil
+}
+
+func (md *MongoDriver) createIndex(col string, spec *IndexSpec) error {
+	keys := bson.D{}
+	for _, k := range spec.Keys {
+		keys = append(keys, bson.E{Key: k.Field, Value: k.Order})
+	}
+	opts := options.Index().SetName(spec.indexName()).SetBackground(true)
+	if spec.Unique {
+		opts.SetUnique(true)
+	}
+	if spec.Sparse {
+		opts.SetSparse(true)
+	}
+	return md.coll(indexDb, col).CreateIndex(md.Ctx, keys, opts)
+}
+
+//比对结果中存在未创建、未声明或选项不一致的索引
+func IndexesInconsistent(reports []*IndexReport) bool {
+	for _, r := range reports {
+		if len(r.Missing) != 0 || len(r.Extra) != 0 || len(r.Conflict) != 0 {
+			return true
+		}
+	}
+	return false
+}
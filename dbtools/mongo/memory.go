@@ -0,0 +1,910 @@
+package mongo
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+/*-------------------------- 内存集合 -------------------------*/
+//单元测试使用的进程内mongo实现, 支持MongoDriver用到的操作:
+//过滤条件支持等值、$eq/$ne/$gt/$gte/$lt/$lte/$in/$nin/$exists及$and/$or/$nor, 字段可为a.b形式;
+//更新支持$set/$unset/$inc/$max; 查询选项支持sort/skip/limit, findOneAndUpdate支持upsert及returnDocument;
+//索引只记录定义, 不校验唯一性; 聚合支持$match/$sort/$skip/$limit/$count, $group的$sum/$min/$max/$first, $project的字段包含、排除及"$字段"引用,
+//$lookup的localField/foreignField形式; 其余选项忽略
+
+type MemoryBackend struct {
+	collections map[string]*memoryCollection
+	sync.Mutex
+}
+
+func NewMemoryBackend() *MemoryBackend {
+	return &MemoryBackend{collections: make(map[string]*memoryCollection)}
+}
+
+func (mb *MemoryBackend) Collection(db, col string) Collection {
+	mb.Lock()
+	defer mb.Unlock()
+	key := db + "." + col
+	mc, ok := mb.collections[key]
+	if !ok {
+		mc = &memoryCollection{backend: mb, db: db}
+		mb.collections[key] = mc
+	}
+	return mc
+}
+
+//清空所有集合
+func (mb *MemoryBackend) Reset() {
+	mb.Lock()
+	defer mb.Unlock()
+	mb.collections = make(map[string]*memoryCollection)
+}
+
+//文档按插入顺序保存, 未指定sort时按插入顺序返回
+type memoryCollection struct {
+	docs    []bson.D
+	indexes []bson.D
+	backend *MemoryBackend
+	db      string
+	sync.RWMutex
+}
+
+func (mc *memoryCollection) FindOne(ctx context.Context, filter interface{},
+	opts ...*options.FindOneOptions) (bson.Raw, error) {
+	fo := options.MergeFindOneOptions(opts...)
+	docs, err := mc.find(filter, fo.Sort, fo.Skip, nil)
+	if err != nil {
+		return nil, err
+	}
+	if len(docs) == 0 {
+		return nil, mongo.ErrNoDocuments
+	}
+	return bson.Marshal(docs[0])
+}
+
+func (mc *memoryCollection) Find(ctx context.Context, filter interface{}, results interface{},
+	opts ...*options.FindOptions) error {
+	fo := options.MergeFindOptions(opts...)
+	docs, err := mc.find(filter, fo.Sort, fo.Skip, fo.Limit)
+	if err != nil {
+		return err
+	}
+	raws := make([]bson.Raw, 0, len(docs))
+	for _, doc := range docs {
+		raw, err := bson.Marshal(doc)
+		if err != nil {
+			return err
+		}
+		raws = append(raws, raw)
+	}
+	return decodeAll(raws, results)
+}
+
+func (mc *memoryCollection) find(filter, sortBy interface{}, skip, limit *int64) ([]bson.D, error) {
+	cond, err := toDoc(filter)
+	if err != nil {
+		return nil, err
+	}
+	mc.RLock()
+	docs := make([]bson.D, 0)
+	for _, doc := range mc.docs {
+		ok, err := matchDoc(doc, cond)
+		if err != nil {
+			mc.RUnlock()
+			return nil, err
+		}
+		if ok {
+			docs = append(docs, doc)
+		}
+	}
+	mc.RUnlock()
+	if sortBy != nil {
+		keys, err := toDoc(sortBy)
+		if err != nil {
+			return nil, err
+		}
+		sortDocs(docs, keys)
+	}
+	if skip != nil && *skip > 0 {
+		if *skip >= int64(len(docs)) {
+			return nil, nil
+		}
+		docs = docs[*skip:]
+	}
+	if limit != nil && *limit > 0 && *limit < int64(len(docs)) {
+		docs = docs[:*limit]
+	}
+	return docs, nil
+}
+
+func sortDocs(docs []bson.D, keys bson.D) {
+	sort.SliceStable(docs, func(i, j int) bool {
+		for _, k := range keys {
+			vi, _ := lookupValue(docs[i], k.Key)
+			vj, _ := lookupValue(docs[j], k.Key)
+			c := compareValues(vi, vj)
+			if c == 0 {
+				continue
+			}
+			if n, ok := toFloat(k.Value); ok && n < 0 {
+				return c > 0
+			}
+			return c < 0
+		}
+		return false
+	})
+}
+
+func (mc *memoryCollection) InsertOne(ctx context.Context, doc interface{}) error {
+	return mc.InsertMany(ctx, []interface{}{doc})
+}
+
+func (mc *memoryCollection) InsertMany(ctx context.Context, docs []interface{}) error {
+	mc.Lock()
+	defer mc.Unlock()
+	for i, v := range docs {
+		doc, err := toDoc(v)
+		if err != nil {
+			return err
+		}
+		id, ok := lookupValue(doc, "_id")
+		if !ok {
+			id = primitive.NewObjectID()
+			doc = append(bson.D{{Key: "_id", Value: id}}, doc...)
+		}
+		for _, exist := range mc.docs {
+			if eid, _ := lookupValue(exist, "_id"); compareValues(eid, id) == 0 {
+				return mongo.WriteException{WriteErrors: mongo.WriteErrors{{
+					Index: i, Code: 11000, Message: fmt.Sprintf("E11000 duplicate key error dup key: { _id: %v }", id),
+				}}}
+			}
+		}
+		mc.docs = append(mc.docs, doc)
+	}
+	return nil
+}
+
+func (mc *memoryCollection) UpdateOne(ctx context.Context, filter, update interface{}) error {
+	_, err := mc.update(filter, update, false)
+	return err
+}
+
+func (mc *memoryCollection) UpdateMany(ctx context.Context, filter, update interface{}) error {
+	_, err := mc.update(filter, update, true)
+	return err
+}
+
+func (mc *memoryCollection) FindOneAndUpdate(ctx context.Context, filter, update interface{},
+	opts ...*options.FindOneAndUpdateOptions) (bson.Raw, error) {
+	fo := options.MergeFindOneAndUpdateOptions(opts...)
+	cond, err := toDoc(filter)
+	if err != nil {
+		return nil, err
+	}
+	ops, err := toDoc(update)
+	if err != nil {
+		return nil, err
+	}
+	after := fo.ReturnDocument != nil && *fo.ReturnDocument == options.After
+	mc.Lock()
+	defer mc.Unlock()
+	for i, doc := range mc.docs {
+		ok, err := matchDoc(doc, cond)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			continue
+		}
+		if mc.docs[i], err = applyUpdate(doc, ops); err != nil {
+			return nil, err
+		}
+		if after {
+			return bson.Marshal(mc.docs[i])
+		}
+		return bson.Marshal(doc)
+	}
+	if fo.Upsert == nil || !*fo.Upsert {
+		return nil, mongo.ErrNoDocuments
+	}
+	doc := bson.D{} //upsert时以过滤条件中的等值字段生成新文档
+	for _, e := range cond {
+		if _, isOp := e.Value.(bson.D); !isOp && !strings.HasPrefix(e.Key, "$") {
+			doc = setValue(doc, e.Key, e.Value)
+		}
+	}
+	if doc, err = applyUpdate(doc, ops); err != nil {
+		return nil, err
+	}
+	if _, ok := lookupValue(doc, "_id"); !ok {
+		doc = append(bson.D{{Key: "_id", Value: primitive.NewObjectID()}}, doc...)
+	}
+	mc.docs = append(mc.docs, doc)
+	if after {
+		return bson.Marshal(doc)
+	}
+	return nil, mongo.ErrNoDocuments
+}
+
+func (mc *memoryCollection) update(filter, update interface{}, many bool) (int, error) {
+	cond, err := toDoc(filter)
+	if err != nil {
+		return 0, err
+	}
+	ops, err := toDoc(update)
+	if err != nil {
+		return 0, err
+	}
+	mc.Lock()
+	defer mc.Unlock()
+	matched := 0
+	for i, doc := range mc.docs {
+		ok, err := matchDoc(doc, cond)
+		if err != nil {
+			return matched, err
+		}
+		if !ok {
+			continue
+		}
+		if mc.docs[i], err = applyUpdate(doc, ops); err != nil {
+			return matched, err
+		}
+		matched++
+		if !many {
+			break
+		}
+	}
+	return matched, nil
+}
+
+func (mc *memoryCollection) DeleteOne(ctx context.Context, filter interface{}) error {
+	return mc.delete(filter, false)
+}
+
+func (mc *memoryCollection) DeleteMany(ctx context.Context, filter interface{}) error {
+	return mc.delete(filter, true)
+}
+
+func (mc *memoryCollection) delete(filter interface{}, many bool) error {
+	cond, err := toDoc(filter)
+	if err != nil {
+		return err
+	}
+	mc.Lock()
+	defer mc.Unlock()
+	kept := make([]bson.D, 0, len(mc.docs))
+	deleted := false
+	for _, doc := range mc.docs {
+		if !deleted || many {
+			ok, err := matchDoc(doc, cond)
+			if err != nil {
+				return err
+			}
+			if ok {
+				deleted = true
+				continue
+			}
+		}
+		kept = append(kept, doc)
+	}
+	mc.docs = kept
+	return nil
+}
+
+func (mc *memoryCollection) Aggregate(ctx context.Context, pipeline interface{}, fn func(doc bson.Raw) error,
+	opts ...*options.AggregateOptions) error {
+	stages, err := toDoc(bson.M{"pipeline": pipeline})
+	if err != nil {
+		return err
+	}
+	list, _ := stages[0].Value.(primitive.A)
+	docs, err := mc.find(bson.M{}, nil, nil, nil)
+	if err != nil {
+		return err
+	}
+	for _, item := range list {
+		stage, ok := item.(bson.D)
+		if !ok || len(stage) != 1 {
+			return fmt.Errorf("pipeline stage must be a document with exactly one field")
+		}
+		if docs, err = mc.aggregateStage(docs, stage[0]); err != nil {
+			return err
+		}
+	}
+	for _, doc := range docs {
+		raw, err := bson.Marshal(doc)
+		if err != nil {
+			return err
+		}
+		if err = fn(raw); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (mc *memoryCollection) ListIndexes(ctx context.Context) ([]bson.Raw, error) {
+	mc.RLock()
+	defer mc.RUnlock()
+	indexes := []bson.Raw{}
+	for _, index := range append([]bson.D{{{Key: "v", Value: int32(2)}, {Key: "key", Value: bson.D{{Key: "_id", Value: int32(1)}}},
+		{Key: "name", Value: "_id_"}}}, mc.indexes...) {
+		raw, err := bson.Marshal(index)
+		if err != nil {
+			return nil, err
+		}
+		indexes = append(indexes, raw)
+	}
+	return indexes, nil
+}
+
+func (mc *memoryCollection) CreateIndex(ctx context.Context, keys bson.D, opts *options.IndexOptions) error {
+	index := bson.D{{Key: "v", Value: int32(2)}, {Key: "key", Value: keys}}
+	if opts != nil && opts.Name != nil {
+		index = append(index, bson.E{Key: "name", Value: *opts.Name})
+	}
+	if opts != nil && opts.Unique != nil && *opts.Unique {
+		index = append(index, bson.E{Key: "unique", Value: true})
+	}
+	if opts != nil && opts.Sparse != nil && *opts.Sparse {
+		index = append(index, bson.E{Key: "sparse", Value: true})
+	}
+	doc, err := toDoc(index)
+	if err != nil {
+		return err
+	}
+	mc.Lock()
+	defer mc.Unlock()
+	for _, existing := range mc.indexes { //与mongo一致, 重复创建相同索引无影响
+		if reflect.DeepEqual(existing, doc) {
+			return nil
+		}
+	}
+	mc.indexes = append(mc.indexes, doc)
+	return nil
+}
+
+func (mc *memoryCollection) aggregateStage(docs []bson.D, stage bson.E) ([]bson.D, error) {
+	switch stage.Key {
+	case "$match":
+		cond, _ := stage.Value.(bson.D)
+		matched := make([]bson.D, 0, len(docs))
+		for _, doc := range docs {
+			ok, err := matchDoc(doc, cond)
+			if err != nil {
+				return nil, err
+			}
+			if ok {
+				matched = append(matched, doc)
+			}
+		}
+		return matched, nil
+	case "$sort":
+		keys, _ := stage.Value.(bson.D)
+		sortDocs(docs, keys)
+		return docs, nil
+	case "$skip", "$limit":
+		n, ok := toFloat(stage.Value)
+		if !ok || n < 0 {
+			return nil, fmt.Errorf("%s must be a non-negative number", stage.Key)
+		}
+		if stage.Key == "$skip" {
+			if int(n) >= len(docs) {
+				return nil, nil
+			}
+			return docs[int(n):], nil
+		}
+		if int(n) < len(docs) {
+			docs = docs[:int(n)]
+		}
+		return docs, nil
+	case "$count":
+		field, _ := stage.Value.(string)
+		if len(docs) == 0 {
+			return nil, nil
+		}
+		return []bson.D{{{Key: field, Value: int32(len(docs))}}}, nil
+	case "$group":
+		spec, _ := stage.Value.(bson.D)
+		return groupDocs(docs, spec)
+	case "$project":
+		spec, _ := stage.Value.(bson.D)
+		return projectDocs(docs, spec), nil
+	case "$lookup":
+		spec, _ := stage.Value.(bson.D)
+		return mc.lookupDocs(docs, spec)
+	}
+	return nil, fmt.Errorf("unsupported pipeline stage %s", stage.Key)
+}
+
+//表达式取值, "$a.b"为字段引用, 其余为常量
+func exprValue(doc bson.D, expr interface{}) interface{} {
+	if ref, ok := expr.(string); ok && strings.HasPrefix(ref, "$") {
+		v, _ := lookupValue(doc, ref[1:])
+		return v
+	}
+	if sub, ok := expr.(bson.D); ok {
+		ret := bson.D{}
+		for _, e := range sub {
+			ret = append(ret, bson.E{Key: e.Key, Value: exprValue(doc, e.Value)})
+		}
+		return ret
+	}
+	return expr
+}
+
+func groupDocs(docs []bson.D, spec bson.D) ([]bson.D, error) {
+	var idExpr interface{}
+	for _, e := range spec {
+		if e.Key == "_id" {
+			idExpr = e.Value
+		}
+	}
+	groups := make([]bson.D, 0)
+	for _, doc := range docs {
+		id := exprValue(doc, idExpr)
+		idx := -1
+		for i, g := range groups {
+			if compareValues(g[0].Value, id) == 0 {
+				idx = i
+				break
+			}
+		}
+		if idx < 0 {
+			groups, idx = append(groups, bson.D{{Key: "_id", Value: id}}), len(groups)
+		}
+		group := groups[idx]
+		for _, e := range spec {
+			if e.Key == "_id" {
+				continue
+			}
+			acc, ok := e.Value.(bson.D)
+			if !ok || len(acc) != 1 {
+				return nil, fmt.Errorf("accumulator of %s must be a document with exactly one field", e.Key)
+			}
+			v := exprValue(doc, acc[0].Value)
+			old, exists := lookupValue(group, e.Key)
+			switch acc[0].Key {
+			case "$sum":
+				if _, isNum := toFloat(v); !isNum {
+					v = int32(0)
+				}
+				sum, err := addNumbers(old, v)
+				if err != nil {
+					return nil, err
+				}
+				group = setValue(group, e.Key, sum)
+			case "$min", "$max":
+				c := compareValues(v, old)
+				if !exists || (acc[0].Key == "$min" && c < 0) || (acc[0].Key == "$max" && c > 0) {
+					group = setValue(group, e.Key, v)
+				}
+			case "$first":
+				if !exists {
+					group = setValue(group, e.Key, v)
+				}
+			default:
+				return nil, fmt.Errorf("unsupported accumulator %s", acc[0].Key)
+			}
+		}
+		groups[idx] = group
+	}
+	return groups, nil
+}
+
+//字段值为0/false时排除该字段, 为1/true时包含, 为表达式时计算新字段; 未显式排除时包含_id
+func projectDocs(docs []bson.D, spec bson.D) []bson.D {
+	exclude, keepId := false, true
+	for _, e := range spec {
+		if n, ok := toFloat(e.Value); (ok && n == 0) || e.Value == false {
+			if e.Key == "_id" {
+				keepId = false
+			} else {
+				exclude = true
+			}
+		}
+	}
+	projected := make([]bson.D, 0, len(docs))
+	for _, doc := range docs {
+		if exclude {
+			ret := append(bson.D{}, doc...)
+			for _, e := range spec {
+				ret = unsetValue(ret, e.Key)
+			}
+			projected = append(projected, ret)
+			continue
+		}
+		ret := bson.D{}
+		if id, ok := lookupValue(doc, "_id"); ok && keepId {
+			ret = append(ret, bson.E{Key: "_id", Value: id})
+		}
+		for _, e := range spec {
+			if e.Key == "_id" {
+				continue
+			}
+			n, isNum := toFloat(e.Value)
+			if (isNum && n != 0) || e.Value == true {
+				if v, ok := lookupValue(doc, e.Key); ok {
+					ret = setValue(ret, e.Key, v)
+				}
+				continue
+			}
+			ret = setValue(ret, e.Key, exprValue(doc, e.Value))
+		}
+		projected = append(projected, ret)
+	}
+	return projected
+}
+
+func (mc *memoryCollection) lookupDocs(docs []bson.D, spec bson.D) ([]bson.D, error) {
+	var from, localField, foreignField, as string
+	for _, e := range spec {
+		v, _ := e.Value.(string)
+		switch e.Key {
+		case "from":
+			from = v
+		case "localField":
+			localField = v
+		case "foreignField":
+			foreignField = v
+		case "as":
+			as = v
+		default:
+			return nil, fmt.Errorf("unsupported $lookup field %s", e.Key)
+		}
+	}
+	if mc.backend == nil {
+		return nil, fmt.Errorf("$lookup is not supported")
+	}
+	foreign, err := mc.backend.Collection(mc.db, from).(*memoryCollection).find(bson.M{}, nil, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	joined := make([]bson.D, 0, len(docs))
+	for _, doc := range docs {
+		local, exists := lookupValue(doc, localField)
+		matched := primitive.A{}
+		for _, f := range foreign {
+			fv, fexists := lookupValue(f, foreignField)
+			if equalsAny(fv, fexists, local) || (!exists && !fexists) {
+				matched = append(matched, f)
+			}
+		}
+		joined = append(joined, setValue(append(bson.D{}, doc...), as, matched))
+	}
+	return joined, nil
+}
+
+//经bson编解码统一为bson.D, 数值、时间等类型与读取mongo时一致
+func toDoc(v interface{}) (bson.D, error) {
+	if v == nil {
+		return bson.D{}, nil
+	}
+	data, err := bson.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	doc := bson.D{}
+	err = bson.Unmarshal(data, &doc)
+	return doc, err
+}
+
+func matchDoc(doc, cond bson.D) (bool, error) {
+	for _, c := range cond {
+		switch c.Key {
+		case "$and", "$or", "$nor":
+			subs, ok := c.Value.(primitive.A)
+			if !ok {
+				return false, fmt.Errorf("%s must be an array", c.Key)
+			}
+			matched := 0
+			for _, sub := range subs {
+				subCond, ok := sub.(bson.D)
+				if !ok {
+					return false, fmt.Errorf("%s entries must be documents", c.Key)
+				}
+				ok, err := matchDoc(doc, subCond)
+				if err != nil {
+					return false, err
+				}
+				if ok {
+					matched++
+				}
+			}
+			if (c.Key == "$and" && matched != len(subs)) || (c.Key == "$or" && matched == 0) ||
+				(c.Key == "$nor" && matched != 0) {
+				return false, nil
+			}
+		default:
+			if strings.HasPrefix(c.Key, "$") {
+				return false, fmt.Errorf("unsupported query operator %s", c.Key)
+			}
+			ok, err := matchField(doc, c.Key, c.Value)
+			if err != nil || !ok {
+				return false, err
+			}
+		}
+	}
+	return true, nil
+}
+
+func matchField(doc bson.D, key string, cond interface{}) (bool, error) {
+	value, exists := lookupValue(doc, key)
+	ops, isOps := cond.(bson.D)
+	if !isOps || len(ops) == 0 || !strings.HasPrefix(ops[0].Key, "$") {
+		return equalsAny(value, exists, cond), nil
+	}
+	for _, op := range ops {
+		var ok bool
+		switch op.Key {
+		case "$eq":
+			ok = equalsAny(value, exists, op.Value)
+		case "$ne":
+			ok = !equalsAny(value, exists, op.Value)
+		case "$gt", "$gte", "$lt", "$lte":
+			ok = exists && compareAny(value, op.Key, op.Value)
+		case "$in", "$nin":
+			list, isList := op.Value.(primitive.A)
+			if !isList {
+				return false, fmt.Errorf("%s needs an array", op.Key)
+			}
+			for _, item := range list {
+				if equalsAny(value, exists, item) {
+					ok = true
+					break
+				}
+			}
+			if op.Key == "$nin" {
+				ok = !ok
+			}
+		case "$exists":
+			want, _ := op.Value.(bool)
+			if n, isNum := toFloat(op.Value); isNum {
+				want = n != 0
+			}
+			ok = exists == want
+		default:
+			return false, fmt.Errorf("unsupported query operator %s", op.Key)
+		}
+		if !ok {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+//数组字段与数组本身或任一元素相等即匹配, 与mongo一致
+func equalsAny(value interface{}, exists bool, target interface{}) bool {
+	if !exists {
+		return target == nil
+	}
+	if compareValues(value, target) == 0 {
+		return true
+	}
+	if arr, ok := value.(primitive.A); ok {
+		for _, item := range arr {
+			if compareValues(item, target) == 0 {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func compareAny(value interface{}, op string, target interface{}) bool {
+	candidates := []interface{}{value}
+	if arr, ok := value.(primitive.A); ok {
+		candidates = arr
+	}
+	for _, v := range candidates {
+		if !sameKind(v, target) {
+			continue
+		}
+		c := compareValues(v, target)
+		if (op == "$gt" && c > 0) || (op == "$gte" && c >= 0) || (op == "$lt" && c < 0) || (op == "$lte" && c <= 0) {
+			return true
+		}
+	}
+	return false
+}
+
+//按a.b形式的路径取值
+func lookupValue(doc bson.D, path string) (interface{}, bool) {
+	var cur interface{} = doc
+	for _, key := range strings.Split(path, ".") {
+		d, ok := cur.(bson.D)
+		if !ok {
+			return nil, false
+		}
+		found := false
+		for _, e := range d {
+			if e.Key == key {
+				cur, found = e.Value, true
+				break
+			}
+		}
+		if !found {
+			return nil, false
+		}
+	}
+	return cur, true
+}
+
+func applyUpdate(doc, ops bson.D) (bson.D, error) {
+	updated := append(bson.D{}, doc...)
+	for _, op := range ops {
+		fields, ok := op.Value.(bson.D)
+		if !ok {
+			return nil, fmt.Errorf("update document must contain atomic operators")
+		}
+		for _, f := range fields {
+			switch op.Key {
+			case "$set":
+				updated = setValue(updated, f.Key, f.Value)
+			case "$unset":
+				updated = unsetValue(updated, f.Key)
+			case "$inc":
+				old, _ := lookupValue(updated, f.Key)
+				sum, err := addNumbers(old, f.Value)
+				if err != nil {
+					return nil, err
+				}
+				updated = setValue(updated, f.Key, sum)
+			case "$max":
+				if old, ok := lookupValue(updated, f.Key); !ok || compareValues(old, f.Value) < 0 {
+					updated = setValue(updated, f.Key, f.Value)
+				}
+			default:
+				return nil, fmt.Errorf("unsupported update operator %s", op.Key)
+			}
+		}
+	}
+	return updated, nil
+}
+
+func setValue(doc bson.D, path string, value interface{}) bson.D {
+	keys := strings.SplitN(path, ".", 2)
+	for i, e := range doc {
+		if e.Key != keys[0] {
+			continue
+		}
+		if len(keys) == 1 {
+			doc[i].Value = value
+		} else {
+			sub, _ := e.Value.(bson.D)
+			doc[i].Value = setValue(append(bson.D{}, sub...), keys[1], value)
+		}
+		return doc
+	}
+	if len(keys) == 1 {
+		return append(doc, bson.E{Key: keys[0], Value: value})
+	}
+	return append(doc, bson.E{Key: keys[0], Value: setValue(bson.D{}, keys[1], value)})
+}
+
+func unsetValue(doc bson.D, path string) bson.D {
+	keys := strings.SplitN(path, ".", 2)
+	for i, e := range doc {
+		if e.Key != keys[0] {
+			continue
+		}
+		if len(keys) == 1 {
+			return append(doc[:i:i], doc[i+1:]...)
+		}
+		if sub, ok := e.Value.(bson.D); ok {
+			doc[i].Value = unsetValue(append(bson.D{}, sub...), keys[1])
+		}
+		return doc
+	}
+	return doc
+}
+
+func addNumbers(a, b interface{}) (interface{}, error) {
+	if a == nil {
+		return b, nil
+	}
+	switch x := a.(type) {
+	case int32:
+		if y, ok := b.(int32); ok {
+			return x + y, nil
+		}
+	case int64:
+		switch y := b.(type) {
+		case int32:
+			return x + int64(y), nil
+		case int64:
+			return x + y, nil
+		}
+	}
+	fa, ok1 := toFloat(a)
+	fb, ok2 := toFloat(b)
+	if !ok1 || !ok2 {
+		return nil, fmt.Errorf("cannot apply $inc to a value of non-numeric type")
+	}
+	return fa + fb, nil
+}
+
+func toFloat(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case int32:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case int:
+		return float64(n), true
+	case float64:
+		return n, true
+	}
+	return 0, false
+}
+
+//同类(数值、字符串、时间等)值可比较大小
+func sameKind(a, b interface{}) bool {
+	_, aNum := toFloat(a)
+	_, bNum := toFloat(b)
+	if aNum || bNum {
+		return aNum && bNum
+	}
+	return reflect.TypeOf(a) == reflect.TypeOf(b)
+}
+
+//比较两个值, 类型不同时按类型名排序, nil最小
+func compareValues(a, b interface{}) int {
+	if a == nil || b == nil {
+		switch {
+		case a == nil && b == nil:
+			return 0
+		case a == nil:
+			return -1
+		}
+		return 1
+	}
+	if fa, ok := toFloat(a); ok {
+		if fb, ok := toFloat(b); ok {
+			switch {
+			case fa < fb:
+				return -1
+			case fa > fb:
+				return 1
+			}
+			return 0
+		}
+	}
+	switch x := a.(type) {
+	case string:
+		if y, ok := b.(string); ok {
+			return strings.Compare(x, y)
+		}
+	case bool:
+		if y, ok := b.(bool); ok {
+			if x == y {
+				return 0
+			}
+			if !x {
+				return -1
+			}
+			return 1
+		}
+	case primitive.DateTime:
+		if y, ok := b.(primitive.DateTime); ok {
+			return compareValues(int64(x), int64(y))
+		}
+	case primitive.ObjectID:
+		if y, ok := b.(primitive.ObjectID); ok {
+			return strings.Compare(x.Hex(), y.Hex())
+		}
+	}
+	if reflect.DeepEqual(a, b) {
+		return 0
+	}
+	return strings.Compare(fmt.Sprintf("%T%v", a, a), fmt.Sprintf("%T%v", b, b))
+}
@@ -1,16 +1,20 @@
 package mongo
 
 import (
+	"errors"
 	"fmt"
 	"reflect"
+	"sort"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/store_server/dbtools/driver"
 	"github.com/store_server/logger"
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
-	//"go.mongodb.org/mongo-driver/mongo"
 
 	m "github.com/store_server/dbtools/models"
 )
@@ -21,10 +25,42 @@ type MongoDriver struct {
 
 	lock       sync.RWMutex
 	collection string
+
+	//集合操作实现, 为空时使用CMSDriver的mongo client
+	backend       Backend
+	importBackend Backend
+
+	//已按集合最大_id初始化的序列(库名.集合名)
+	seeded sync.Map
+
+	//试听音频集合名, 为空时使用preview_audio
+	audioCol string
 }
 
 func NewMongoDriver(cmsDriver *driver.CMSDriver) *MongoDriver {
-	return &MongoDriver{cmsDriver, sync.RWMutex{}, ""}
+	return &MongoDriver{CMSDriver: cmsDriver}
+}
+
+//指定集合操作实现的driver, 单元测试使用内存实现
+func NewMongoDriverWithBackend(cmsDriver *driver.CMSDriver, backend, importBackend Backend) *MongoDriver {
+	return &MongoDriver{CMSDriver: cmsDriver, backend: backend, importBackend: importBackend}
+}
+
+func (md *MongoDriver) coll(db, col string) Collection {
+	if md.backend != nil {
+		return md.backend.Collection(db, col)
+	}
+	return NewClientBackend(md.MongoClient).Collection(db, col)
+}
+
+func (md *MongoDriver) importColl(db, col string) (Collection, error) {
+	if md.importBackend != nil {
+		return md.importBackend.Collection(db, col), nil
+	}
+	if md.ImportMongo == nil {
+		return nil, fmt.Errorf("invalid import mongo client")
+	}
+	return NewClientBackend(md.ImportMongo).Collection(db, col), nil
 }
 
 var (
@@ -35,142 +71,75 @@ var (
 func (md *MongoDriver) FindLastDoc(db, col string) (bson.Raw, error) {
 	opts := options.FindOne()
 	opts.SetSort(bson.D{{"_id", -1}})
-	collection := md.MongoClient.Database(db).Collection(col)
-	res := collection.FindOne(md.Ctx, bson.M{}, opts)
-	if res.Err() != nil {
-		return nil, res.Err()
-	}
-	return res.DecodeBytes()
+	return md.coll(db, col).FindOne(md.Ctx, bson.M{}, opts)
 }
 
 func (md *MongoDriver) FindOneById(db, col string, id interface{}) (bson.Raw, error) {
 	filter := bson.M{"_id": id}
-	collection := md.MongoClient.Database(db).Collection(col)
-	res := collection.FindOne(md.Ctx, filter)
-	if res.Err() != nil {
-		return nil, res.Err()
-	}
-	return res.DecodeBytes()
+	return md.coll(db, col).FindOne(md.Ctx, filter)
 }
 
 func (md *MongoDriver) FindOneByFilter(db, col string, filter interface{}) (bson.Raw, error) {
-	collection := md.MongoClient.Database(db).Collection(col)
-	res := collection.FindOne(md.Ctx, filter)
-	if res.Err() != nil {
-		return nil, res.Err()
-	}
-	return res.DecodeBytes()
+	return md.coll(db, col).FindOne(md.Ctx, filter)
 }
 
 func (md *MongoDriver) FindImportManyByFilter(db, col string, filter interface{},
 	opt *options.FindOptions, results interface{}) error {
-	if md.ImportMongo == nil {
-		return fmt.Errorf("invalid import mongo client")
-	}
-	collection := md.ImportMongo.Database(db).Collection(col)
-	cur, err := collection.Find(md.Ctx, filter, opt)
+	collection, err := md.importColl(db, col)
 	if err != nil {
 		return err
 	}
-	return cur.All(md.Ctx, results)
+	return collection.Find(md.Ctx, filter, results, opt)
 }
 
 func (md *MongoDriver) FindOneImportByFilter(db, col string, filter interface{},
 	opts ...*options.FindOneOptions) (bson.Raw, error) {
-	if md.ImportMongo == nil {
-		return nil, fmt.Errorf("invalid import mongo client")
-	}
-	collection := md.ImportMongo.Database(db).Collection(col)
-	res := collection.FindOne(md.Ctx, filter, opts...)
-	if res.Err() != nil {
-		return nil, res.Err()
+	collection, err := md.importColl(db, col)
+	if err != nil {
+		return nil, err
 	}
-	return res.DecodeBytes()
+	return collection.FindOne(md.Ctx, filter, opts...)
 }
 
 func (md *MongoDriver) FindManyByFilter(db, col string, filter interface{},
 	opt *options.FindOptions, results interface{}) error {
-	collection := md.MongoClient.Database(db).Collection(col)
-	cur, err := collection.Find(md.Ctx, filter, opt)
-	if err != nil {
-		return err
-	}
-	return cur.All(md.Ctx, results)
+	return md.coll(db, col).Find(md.Ctx, filter, results, opt)
 }
 
 func (md *MongoDriver) InsertOneDoc(db, col string, doc interface{}) error {
-	collection := md.MongoClient.Database(db).Collection(col)
-	_, err := collection.InsertOne(md.Ctx, doc)
-	if err != nil {
-		return err
-	}
-	return nil
+	return md.coll(db, col).InsertOne(md.Ctx, doc)
 }
 
 func (md *MongoDriver) InsertManyDoc(db, col string, docs []interface{}) error {
-	collection := md.MongoClient.Database(db).Collection(col)
-	_, err := collection.InsertMany(md.Ctx, docs)
-	if err != nil {
-		return err
-	}
-	return nil
+	return md.coll(db, col).InsertMany(md.Ctx, docs)
 }
 
 func (md *MongoDriver) UpdateOneByID(db, col string, id interface{}, update interface{}) error {
 	filter := bson.M{"_id": id}
-	collection := md.MongoClient.Database(db).Collection(col)
-	_, err := collection.UpdateOne(md.Ctx, filter, update)
-	if err != nil {
-		return err
-	}
-	return err
+	return md.coll(db, col).UpdateOne(md.Ctx, filter, update)
 }
 
 func (md *MongoDriver) UpdateOneByFilter(db, col string, filter interface{}, update interface{}) error {
-	collection := md.MongoClient.Database(db).Collection(col)
 	//TODO query for sharded findAndModify must have shardkey
-	res := collection.FindOneAndUpdate(md.Ctx, filter, update)
-	if res.Err() != nil {
-		return res.Err()
-	}
-	return nil
+	_, err := md.coll(db, col).FindOneAndUpdate(md.Ctx, filter, update)
+	return err
 }
 
 func (md *MongoDriver) UpdateManyByFilter(db, col string, filter interface{}, update interface{}) error {
-	collection := md.MongoClient.Database(db).Collection(col)
-	_, err := collection.UpdateMany(md.Ctx, filter, update)
-	if err != nil {
-		return err
-	}
-	return err
+	return md.coll(db, col).UpdateMany(md.Ctx, filter, update)
 }
 
 func (md *MongoDriver) DeleteOneByID(db, col string, id interface{}) error {
 	filter := bson.M{"_id": id}
-	collection := md.MongoClient.Database(db).Collection(col)
-	_, err := collection.DeleteOne(md.Ctx, filter)
-	if err != nil {
-		return err
-	}
-	return err
+	return md.coll(db, col).DeleteOne(md.Ctx, filter)
 }
 
 func (md *MongoDriver) DeleteOneByFilter(db, col string, filter interface{}) error {
-	collection := md.MongoClient.Database(db).Collection(col)
-	_, err := collection.DeleteOne(md.Ctx, filter)
-	if err != nil {
-		return err
-	}
-	return err
+	return md.coll(db, col).DeleteOne(md.Ctx, filter)
 }
 
 func (md *MongoDriver) DeleteManyByFilter(db, col string, filter interface{}) error {
-	collection := md.MongoClient.Database(db).Collection(col)
-	_, err := collection.DeleteMany(md.Ctx, filter)
-	if err != nil {
-		return err
-	}
-	return err
+	return md.coll(db, col).DeleteMany(md.Ctx, filter)
 }
 
 /*********************** 封装 **********************/
@@ -232,10 +201,14 @@ func (md *MongoDriver) GetDocsByFilter(db, col string, filter, docs interface{},
 	return md.FindManyByFilter(db, col, filter, opt, docs)
 }
 
+//最后一个文档的id, 空集合返回int64(0); 仅用于查询, 分配新文档id使用AllocIds
 func (md *MongoDriver) FindLastDocId(db, col string, mod interface{}) (interface{}, error) {
 	lastDoc, err := md.FindLastDoc(db, col)
+	if err == mongo.ErrNoDocuments {
+		return int64(0), nil
+	}
 	if err != nil {
-		return -1, err
+		return int64(-1), err
 	}
 	modVal := reflect.ValueOf(mod)
 	if modVal.Kind() != reflect.Ptr {
@@ -244,7 +217,7 @@ func (md *MongoDriver) FindLastDocId(db, col string, mod interface{}) (interface
 		err = bson.Unmarshal(lastDoc, mod)
 	}
 	if err != nil {
-		return -1, err
+		return int64(-1), err
 	}
 	var ok1, ok2, isPtr bool
 	modType := reflect.TypeOf(mod)
@@ -270,7 +243,7 @@ func (md *MongoDriver) FindLastDocId(db, col string, mod interface{}) (interface
 		}
 		return idValue.Interface(), nil
 	}
-	return -1, fmt.Errorf("get last doc id error by model type")
+	return int64(-1), fmt.Errorf("get last doc id error by model type")
 }
 
 /************************ track related ************************/
@@ -303,13 +276,12 @@ func (md *MongoDriver) InsertPublishAlbum(phAlbum *m.PublishedAlbum) (int64, err
 	current := time.Now()
 	phAlbum.CreateTime, phAlbum.ModifyTime = current, current
 	phAlbum.Deleted = 0
-	lastEr := &m.PublishedAlbum{}
-	lastId, err := md.FindLastDocId("music_cms", "auto_publish_album", lastEr)
+	id, err := md.allocDocIds("music_cms", "auto_publish_album", 1)
 	if err != nil {
-		logger.Entry().Errorf("find last doc id error: %v", err)
+		logger.Entry().Errorf("alloc publish album id error: %v", err)
+		return -1, err
 	}
-	id := lastId.(int64)
-	phAlbum.Id = id + 1
+	phAlbum.Id = id
 	err = md.InsertOneDoc("music_cms", "auto_publish_album", phAlbum)
 	if err != nil {
 		return -1, err
@@ -317,6 +289,30 @@ func (md *MongoDriver) InsertPublishAlbum(phAlbum *m.PublishedAlbum) (int64, err
 	return phAlbum.Id, nil
 }
 
+//批量写入, 一次预分配全部id, 返回按顺序分配的id
+func (md *MongoDriver) InsertManyPublishAlbum(phAlbums []*m.PublishedAlbum) ([]int64, error) {
+	if len(phAlbums) == 0 {
+		return nil, nil
+	}
+	first, err := md.allocDocIds("music_cms", "auto_publish_album", int64(len(phAlbums)))
+	if err != nil {
+		logger.Entry().Errorf("alloc publish album ids error: %v", err)
+		return nil, err
+	}
+	current := time.Now()
+	ids, docs := make([]int64, 0, len(phAlbums)), make([]interface{}, 0, len(phAlbums))
+	for i, phAlbum := range phAlbums {
+		phAlbum.CreateTime, phAlbum.ModifyTime = current, current
+		phAlbum.Deleted = 0
+		phAlbum.Id = first + int64(i)
+		ids, docs = append(ids, phAlbum.Id), append(docs, phAlbum)
+	}
+	if err = md.InsertManyDoc("music_cms", "auto_publish_album", docs); err != nil {
+		return nil, err
+	}
+	return ids, nil
+}
+
 func (md *MongoDriver) UpdatePublishAlbumById(id interface{}, update bson.M) error {
 	update["modify_time"] = time.Now()
 	update = bson.M{"$set": update}
@@ -371,13 +367,12 @@ func (md *MongoDriver) InsertExternalResources(extResource *m.ExternalResource)
 	current := time.Now()
 	extResource.CreateTime, extResource.ModifyTime = current, current
 	extResource.Deleted = 0
-	lastEr := &m.ExternalResource{}
-	lastId, err := md.FindLastDocId("music_cms", "external_resources", lastEr)
+	id, err := md.allocDocIds("music_cms", "external_resources", 1)
 	if err != nil {
-		logger.Entry().Errorf("find last doc id error: %v", err)
+		logger.Entry().Errorf("alloc external resource id error: %v", err)
+		return -1, err
 	}
-	id := lastId.(int64)
-	extResource.Id = id + 1
+	extResource.Id = id
 	err = md.InsertOneDoc("music_cms", "external_resources", extResource)
 	if err != nil {
 		return -1, err
@@ -385,6 +380,30 @@ func (md *MongoDriver) InsertExternalResources(extResource *m.ExternalResource)
 	return extResource.Id, nil
 }
 
+//批量写入, 一次预分配全部id, 返回按顺序分配的id
+func (md *MongoDriver) InsertManyExternalResources(extResources []*m.ExternalResource) ([]int64, error) {
+	if len(extResources) == 0 {
+		return nil, nil
+	}
+	first, err := md.allocDocIds("music_cms", "external_resources", int64(len(extResources)))
+	if err != nil {
+		logger.Entry().Errorf("alloc external resource ids error: %v", err)
+		return nil, err
+	}
+	current := time.Now()
+	ids, docs := make([]int64, 0, len(extResources)), make([]interface{}, 0, len(extResources))
+	for i, extResource := range extResources {
+		extResource.CreateTime, extResource.ModifyTime = current, current
+		extResource.Deleted = 0
+		extResource.Id = first + int64(i)
+		ids, docs = append(ids, extResource.Id), append(docs, extResource)
+	}
+	if err = md.InsertManyDoc("music_cms", "external_resources", docs); err != nil {
+		return nil, err
+	}
+	return ids, nil
+}
+
 func (md *MongoDriver) UpdateExternalResourcesById(id interface{}, update bson.M) error {
 	update["modify_time"] = time.Now()
 	update = bson.M{"$set": update}
@@ -414,3 +433,262 @@ func (md *MongoDriver) DeleteExternalResources(filter interface{}) error {
 func (md *MongoDriver) DeleteManyExternalResources(filter interface{}) error {
 	return md.DeleteManyByFilter("music_cms", "external_resources", filter)
 }
+
+/************************ preview_audio ************************/
+const (
+	previewAudioDb                = "music_cms"
+	defaultPreviewAudioCollection = "preview_audio"
+)
+
+//设置试听音频集合名(配置mongodb.audio_col), 为空时使用preview_audio
+func (md *MongoDriver) SetAudioCollection(col string) {
+	md.lock.Lock()
+	defer md.lock.Unlock()
+	md.audioCol = col
+}
+
+func (md *MongoDriver) audioCollection() string {
+	md.lock.RLock()
+	defer md.lock.RUnlock()
+	if len(md.audioCol) == 0 {
+		return defaultPreviewAudioCollection
+	}
+	return md.audioCol
+}
+
+//转码状态: 待转码->转码中->成功/失败, 失败可重新转码, 成功后可重新转码(如新增码率)
+const (
+	EncodeStatPending  = 0
+	EncodeStatEncoding = 1
+	EncodeStatSuccess  = 2
+	EncodeStatFailed   = 3
+)
+
+var encodeStatTransitions = map[int][]int{
+	EncodeStatPending:  {EncodeStatEncoding},
+	EncodeStatEncoding: {EncodeStatSuccess, EncodeStatFailed},
+	EncodeStatSuccess:  {EncodeStatEncoding},
+	EncodeStatFailed:   {EncodeStatEncoding},
+}
+
+var ErrEncodeStatChanged = errors.New("encode_stat has been changed by others, please query and retry")
+
+//非法的转码状态变更
+type EncodeStatError struct {
+	Id   int64 `json:"id"`
+	From int   `json:"from"`
+	To   int   `json:"to"`
+}
+
+func (e *EncodeStatError) Error() string {
+	return fmt.Sprintf("invalid encode_stat transition of preview audio %d: %d -> %d", e.Id, e.From, e.To)
+}
+
+func canTransitEncodeStat(from, to int) bool {
+	for _, next := range encodeStatTransitions[from] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
+
+//转码状态只能通过TransitPreviewAudioEncodeStat变更
+func checkPreviewAudioUpdate(update bson.M) error {
+	for _, key := range []string{"_id", "encode_stat"} {
+		if _, ok := update[key]; ok {
+			return fmt.Errorf("field %s of preview audio can not be updated directly", key)
+		}
+	}
+	return nil
+}
+
+func (md *MongoDriver) GetPreviewAudioById(id interface{}) (*m.PreviewAudio, error) {
+	pa := &m.PreviewAudio{}
+	err := md.GetDocById(previewAudioDb, md.audioCollection(), id, pa)
+	return pa, err
+}
+
+func (md *MongoDriver) GetPreviewAudio(filter interface{}) (*m.PreviewAudio, error) {
+	pa := &m.PreviewAudio{}
+	err := md.GetDocByFilter(previewAudioDb, md.audioCollection(), filter, pa)
+	return pa, err
+}
+
+func (md *MongoDriver) GetManyPreviewAudio(filter interface{},
+	page, pagesize int64) ([]*m.PreviewAudio, error) {
+	pas := []*m.PreviewAudio{}
+	err := md.GetDocsByFilter(previewAudioDb, md.audioCollection(), filter, &pas, page, pagesize)
+	return pas, err
+}
+
+//歌曲未删除的试听音频, 每个码率一条
+func (md *MongoDriver) GetPreviewAudioByTrackId(trackId int64) ([]*m.PreviewAudio, error) {
+	return md.GetManyPreviewAudio(bson.M{"track_id": trackId, "deleted": 0}, 0, 0)
+}
+
+func (md *MongoDriver) GetPreviewAudioByUuid(uuid string) (*m.PreviewAudio, error) {
+	return md.GetPreviewAudio(bson.M{"uuid": uuid, "deleted": 0})
+}
+
+func (md *MongoDriver) GetPreviewAudioByInnerFileId(innerFileId string) ([]*m.PreviewAudio, error) {
+	return md.GetManyPreviewAudio(bson.M{"inner_file_id": innerFileId, "deleted": 0}, 0, 0)
+}
+
+func (md *MongoDriver) InsertPreviewAudio(audio *m.PreviewAudio) (int64, error) {
+	if audio.EncodeStat != EncodeStatPending { //新建的试听音频只能是待转码, 之后通过TransitPreviewAudioEncodeStat变更
+		return -1, fmt.Errorf("encode_stat of new preview audio must be %d, got %d", EncodeStatPending, audio.EncodeStat)
+	}
+	current := time.Now()
+	audio.CreateTime, audio.ModifyTime = current, current
+	audio.Deleted = 0
+	id, err := md.allocDocIds(previewAudioDb, md.audioCollection(), 1)
+	if err != nil {
+		logger.Entry().Errorf("alloc preview audio id error: %v", err)
+		return -1, err
+	}
+	audio.Id = id
+	err = md.InsertOneDoc(previewAudioDb, md.audioCollection(), audio)
+	if err != nil {
+		return -1, err
+	}
+	return audio.Id, nil
+}
+
+func (md *MongoDriver) UpdatePreviewAudioById(id interface{}, update bson.M) error {
+	if err := checkPreviewAudioUpdate(update); err != nil {
+		return err
+	}
+	update["modify_time"] = time.Now()
+	update = bson.M{"$set": update}
+	return md.UpdateOneByID(previewAudioDb, md.audioCollection(), id, update)
+}
+
+func (md *MongoDriver) UpdatePreviewAudio(filter interface{}, update bson.M) error {
+	if err := checkPreviewAudioUpdate(update); err != nil {
+		return err
+	}
+	update["modify_time"] = time.Now()
+	update = bson.M{"$set": update}
+	return md.UpdateOneByFilter(previewAudioDb, md.audioCollection(), filter, update)
+}
+
+func (md *MongoDriver) UpdateManyPreviewAudio(filter interface{}, update bson.M) error {
+	if err := checkPreviewAudioUpdate(update); err != nil {
+		return err
+	}
+	update["modify_time"] = time.Now()
+	update = bson.M{"$set": update}
+	return md.UpdateManyByFilter(previewAudioDb, md.audioCollection(), filter, update)
+}
+
+//变更转码状态, 只允许encodeStatTransitions中的状态变更, fields为同时更新的字段(如dst_path、download_url);
+//以当前状态为条件更新, 期间状态被其他请求修改时返回ErrEncodeStatChanged
+func (md *MongoDriver) TransitPreviewAudioEncodeStat(id int64, to int, fields bson.M) (*m.PreviewAudio, error) {
+	if err := checkPreviewAudioUpdate(fields); err != nil {
+		return nil, err
+	}
+	audio, err := md.GetPreviewAudioById(id)
+	if err != nil {
+		return nil, err
+	}
+	if !canTransitEncodeStat(audio.EncodeStat, to) {
+		return nil, &EncodeStatError{Id: id, From: audio.EncodeStat, To: to}
+	}
+	filter := bson.M{"_id": id, "encode_stat": audio.EncodeStat}
+	if audio.EncodeStat == EncodeStatPending { //未设置encode_stat的文档视为待转码
+		filter["encode_stat"] = bson.M{"$in": []interface{}{EncodeStatPending, nil}}
+	}
+	update := bson.M{}
+	for k, v := range fields {
+		update[k] = v
+	}
+	update["encode_stat"], update["modify_time"] = to, time.Now()
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	raw, err := md.coll(previewAudioDb, md.audioCollection()).FindOneAndUpdate(md.Ctx, filter, bson.M{"$set": update}, opts)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrEncodeStatChanged
+	}
+	if err != nil {
+		return nil, err
+	}
+	audio = &m.PreviewAudio{}
+	return audio, bson.Unmarshal(raw, audio)
+}
+
+func (md *MongoDriver) DeletePreviewAudioById(id interface{}) error {
+	return md.DeleteOneByID(previewAudioDb, md.audioCollection(), id)
+}
+
+func (md *MongoDriver) DeletePreviewAudio(filter interface{}) error {
+	return md.DeleteOneByFilter(previewAudioDb, md.audioCollection(), filter)
+}
+
+func (md *MongoDriver) DeleteManyPreviewAudio(filter interface{}) error {
+	return md.DeleteManyByFilter(previewAudioDb, md.audioCollection(), filter)
+}
+
+/************************ track play url ************************/
+//从下载链接中选取码率最高的链接, key非码率时按key排序取第一个
+func bestDownloadURL(urls map[string]string) string {
+	keys := make([]string, 0, len(urls))
+	for k, v := range urls {
+		if len(v) != 0 {
+			keys = append(keys, k)
+		}
+	}
+	if len(keys) == 0 {
+		return ""
+	}
+	rate := func(k string) int64 {
+		r, _ := strconv.ParseInt(strings.TrimRightFunc(k, func(c rune) bool { return c < '0' || c > '9' }), 10, 64)
+		return r
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		ri, rj := rate(keys[i]), rate(keys[j])
+		if ri != rj {
+			return ri > rj
+		}
+		return keys[i] < keys[j]
+	})
+	return urls[keys[0]]
+}
+
+//获取歌曲最佳播放链接, 优先使用external_resources下载链接, 其次使用preview_audio下载链接
+func (md *MongoDriver) GetTrackPlayURL(trackId int64) (string, error) {
+	audios, err := md.GetManyPreviewAudio(bson.M{"track_id": trackId, "deleted": 0}, 0, 0)
+	if err != nil {
+		return "", err
+	}
+	innerIds := make([]string, 0, len(audios))
+	for _, a := range audios {
+		if len(a.InnerFileId) != 0 {
+			innerIds = append(innerIds, a.InnerFileId)
+		}
+	}
+	if len(innerIds) != 0 {
+		filter := bson.M{"internal_file_id": bson.M{"$in": innerIds}, "deleted": 0}
+		ers, err := md.GetManyExternalResources(filter, 0, 0)
+		if err != nil {
+			return "", err
+		}
+		for _, er := range ers {
+			if url := bestDownloadURL(er.DownloadUrl); len(url) != 0 {
+				return url, nil
+			}
+		}
+		for _, er := range ers {
+			if len(er.FileUrl) != 0 {
+				return er.FileUrl, nil
+			}
+		}
+	}
+	for _, a := range audios {
+		for _, du := range a.DownloadUrl {
+			if url, ok := du["url"].(string); ok && len(url) != 0 {
+				return url, nil
+			}
+		}
+	}
+	return "", nil
+}
@@ -0,0 +1,404 @@
+package mongo
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/store_server/dbtools/driver"
+	"github.com/store_server/logger"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	ies "github.com/store_server/dbtools/elastic"
+	m "github.com/store_server/dbtools/models"
+)
+
+var (
+	mgDriver      *MongoDriver
+	memoryBackend = NewMemoryBackend()
+)
+
+func init() {
+	logger.InitStructLog("error", filepath.Join(os.TempDir(), "store_server_test.log"), "store_server_test")
+}
+
+//embedded后端使用内存集合, integration后端使用MONGO_*环境变量指定的mongo; 每个用例重新导入fixture
+func mgSetup(t *testing.T) {
+	ctx := context.Background()
+	cmsDriver := &driver.CMSDriver{Ctx: ctx}
+	var backend Backend = memoryBackend
+	if driver.TestBackend() == driver.TestBackendIntegration {
+		cmsDriver.MongoClient = driver.DefaultTestMongoScheme.DB()
+		backend = NewClientBackend(cmsDriver.MongoClient)
+	}
+	memoryBackend.Reset()
+	if err := LoadFixtures(ctx, backend, "music_cms", "testdata/music_cms"); err != nil {
+		t.Fatal(err)
+	}
+	for _, col := range []string{CountersCollection, EsSyncCheckpointCollection} {
+		if err := backend.Collection("music_cms", col).DeleteMany(ctx, bson.M{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	mgDriver = NewMongoDriverWithBackend(cmsDriver, backend, backend)
+}
+
+func TestGetTrackPlayURL(t *testing.T) {
+	mgSetup(t)
+	url, err := mgDriver.GetTrackPlayURL(1) //码率最高的下载链接
+	assert.Nil(t, err)
+	assert.Equal(t, "http://dl/inner_1_320.mp3", url)
+
+	url, err = mgDriver.GetTrackPlayURL(2) //无下载链接时使用静态链接
+	assert.Nil(t, err)
+	assert.Equal(t, "http://static/inner_2.mp3", url)
+
+	url, err = mgDriver.GetTrackPlayURL(3)
+	assert.Nil(t, err)
+	assert.Equal(t, "http://preview/3.mp3", url)
+
+	url, err = mgDriver.GetTrackPlayURL(4) //已删除
+	assert.Nil(t, err)
+	assert.Equal(t, "", url)
+}
+
+func TestExternalResources(t *testing.T) {
+	mgSetup(t)
+	id, err := mgDriver.InsertExternalResources(&m.ExternalResource{InternalFileId: "inner_3", BizName: "video"})
+	assert.Nil(t, err)
+	assert.Equal(t, int64(3), id)
+
+	er, err := mgDriver.GetExternalResourcesById(id)
+	assert.Nil(t, err)
+	assert.Equal(t, "inner_3", er.InternalFileId)
+
+	err = mgDriver.UpdateExternalResourcesById(id, bson.M{"file_url": "http://static/inner_3.mp4"})
+	assert.Nil(t, err)
+	er, err = mgDriver.GetExternalResources(bson.M{"internal_file_id": "inner_3"})
+	assert.Nil(t, err)
+	assert.Equal(t, "http://static/inner_3.mp4", er.FileUrl)
+
+	ers, err := mgDriver.GetManyExternalResources(bson.M{"deleted": 0}, 1, 2) //按_id倒序分页
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(ers))
+	assert.Equal(t, int64(3), ers[0].Id)
+
+	err = mgDriver.UpdateExternalResources(bson.M{"internal_file_id": "not_exist"}, bson.M{"deleted": 1})
+	assert.Equal(t, mongo.ErrNoDocuments, err)
+
+	assert.Nil(t, mgDriver.DeleteExternalResourcesById(id))
+	_, err = mgDriver.GetExternalResourcesById(id)
+	assert.Equal(t, mongo.ErrNoDocuments, err)
+}
+
+func TestPublishAlbum(t *testing.T) {
+	mgSetup(t)
+	albums, err := mgDriver.GetManyPublishAlbum(bson.M{"region_id": 1}, 0, 0)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(albums))
+
+	err = mgDriver.UpdateManyPublishAlbum(bson.M{"album_id": bson.M{"$in": []int64{1001, 1003}}}, bson.M{"deleted": 1})
+	assert.Nil(t, err)
+	albums, err = mgDriver.GetManyPublishAlbum(bson.M{"deleted": 0, "region_id": bson.M{"$gte": 1}}, 0, 0)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(albums))
+	assert.Equal(t, int64(1002), albums[0].AlbumId)
+
+	assert.Nil(t, mgDriver.DeleteManyPublishAlbum(bson.M{"deleted": 1}))
+	albums, err = mgDriver.GetManyPublishAlbum(bson.M{}, 0, 0)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(albums))
+}
+
+func TestAllocIds(t *testing.T) {
+	mgSetup(t)
+	//空集合从1开始分配
+	assert.Nil(t, mgDriver.DeleteManyPublishAlbum(bson.M{}))
+	lastId, err := mgDriver.FindLastDocId("music_cms", "auto_publish_album", &m.PublishedAlbum{})
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), lastId)
+	id, err := mgDriver.InsertPublishAlbum(&m.PublishedAlbum{AlbumId: 2001})
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), id)
+
+	//批量写入预分配连续id
+	ids, err := mgDriver.InsertManyPublishAlbum([]*m.PublishedAlbum{{AlbumId: 2002}, {AlbumId: 2003}})
+	assert.Nil(t, err)
+	assert.Equal(t, []int64{2, 3}, ids)
+
+	//并发分配不重复
+	var wg sync.WaitGroup
+	var lock sync.Mutex
+	allocated := make(map[int64]bool)
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			first, err := mgDriver.AllocIds("music_cms", "auto_publish_album", 2)
+			assert.Nil(t, err)
+			lock.Lock()
+			defer lock.Unlock()
+			allocated[first], allocated[first+1] = true, true
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, 40, len(allocated))
+	next, err := mgDriver.NextId("music_cms", "auto_publish_album")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(44), next)
+
+	//序列初始化为集合当前最大_id, 不回退
+	assert.Nil(t, mgDriver.SeedSequence("music_cms", "external_resources", "external_resources"))
+	id, err = mgDriver.NextId("music_cms", "external_resources")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(3), id)
+	assert.Nil(t, mgDriver.SeedSequence("music_cms", "external_resources", "external_resources"))
+	id, err = mgDriver.NextId("music_cms", "external_resources")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(4), id)
+}
+
+type fakeBulkWriter struct {
+	docs []*ies.DocDecl
+}
+
+func (w *fakeBulkWriter) BulkWrite(sources []*ies.DocDecl) error {
+	w.docs = append(w.docs, sources...)
+	return nil
+}
+
+func TestEsSyncPoll(t *testing.T) {
+	mgSetup(t)
+	writer := &fakeBulkWriter{}
+	syncer := mgDriver.NewEsSyncer(writer, EsSyncOptions{
+		Db:          "music_cms",
+		Collections: map[string]EsSyncIndex{"external_resources": {Index: "external_resources"}},
+		Mode:        EsSyncModePoll,
+		BatchSize:   1,
+	})
+	//modify_time相同时按_id继续
+	for i := 0; i < 2; i++ {
+		n, err := syncer.SyncOnce("external_resources")
+		assert.Nil(t, err)
+		assert.Equal(t, 1, n)
+	}
+	n, err := syncer.SyncOnce("external_resources")
+	assert.Nil(t, err)
+	assert.Equal(t, 0, n)
+	assert.Equal(t, 2, len(writer.docs))
+	assert.Equal(t, "1", writer.docs[0].Id)
+	assert.Equal(t, "inner_1", writer.docs[0].Doc.(*m.ExternalResource).InternalFileId)
+
+	//更新及软删除, checkpoint持久化, 新建的syncer从上次位置继续
+	assert.Nil(t, mgDriver.UpdateExternalResourcesById(int64(2), bson.M{"deleted": 1}))
+	writer.docs = nil
+	syncer = mgDriver.NewEsSyncer(writer, syncer.opts)
+	n, err = syncer.SyncOnce("external_resources")
+	assert.Nil(t, err)
+	assert.Equal(t, 1, n)
+	assert.Equal(t, "2", writer.docs[0].Id)
+	assert.True(t, writer.docs[0].Delete)
+	n, err = syncer.SyncOnce("external_resources")
+	assert.Nil(t, err)
+	assert.Equal(t, 0, n)
+}
+
+func TestEsSyncSkipAndDrain(t *testing.T) {
+	mgSetup(t)
+	writer := &fakeBulkWriter{}
+	syncer := mgDriver.NewEsSyncer(writer, EsSyncOptions{
+		Db:          "music_cms",
+		Collections: map[string]EsSyncIndex{"external_resources": {Index: "external_resources"}},
+		Mode:        EsSyncModePoll,
+		BatchSize:   1,
+	})
+	defer RegisterTransformer("external_resources", transformerOf("external_resources"))
+	RegisterTransformer("external_resources", func(doc bson.Raw) (interface{}, error) {
+		if id, _ := int64Value(doc.Lookup("_id")); id == 1 {
+			return nil, errors.New("bad doc")
+		}
+		return bson.M{"internal_file_id": doc.Lookup("internal_file_id").StringValue()}, nil
+	})
+	//无法转换的文档跳过, 积压的文档不等待轮询间隔连续同步
+	assert.Nil(t, syncer.syncPending(context.Background(), "external_resources"))
+	assert.Equal(t, 1, len(writer.docs))
+	assert.Equal(t, "2", writer.docs[0].Id)
+	n, err := syncer.SyncOnce("external_resources")
+	assert.Nil(t, err)
+	assert.Equal(t, 0, n)
+}
+
+func TestEsSyncPollWithoutModifyTime(t *testing.T) {
+	mgSetup(t)
+	writer := &fakeBulkWriter{}
+	syncer := mgDriver.NewEsSyncer(writer, EsSyncOptions{
+		Db:          "music_cms",
+		Collections: map[string]EsSyncIndex{"external_resources": {Index: "external_resources"}},
+		Mode:        EsSyncModePoll,
+		BatchSize:   1,
+	})
+	//没有modify_time的文档不同步, 不影响checkpoint
+	assert.Nil(t, mgDriver.InsertOneDoc("music_cms", "external_resources",
+		bson.M{"_id": int64(3), "internal_file_id": "inner_3", "deleted": 0}))
+	assert.Nil(t, syncer.syncPending(context.Background(), "external_resources"))
+	assert.Equal(t, 2, len(writer.docs))
+	assert.Equal(t, "1", writer.docs[0].Id)
+	assert.Equal(t, "2", writer.docs[1].Id)
+	n, err := syncer.SyncOnce("external_resources")
+	assert.Nil(t, err)
+	assert.Equal(t, 0, n)
+}
+
+func TestPreviewAudio(t *testing.T) {
+	mgSetup(t)
+	audios, err := mgDriver.GetPreviewAudioByInnerFileId("inner_1") //忽略已删除
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(audios))
+	assert.Equal(t, int64(1), audios[0].Id)
+
+	id, err := mgDriver.InsertPreviewAudio(&m.PreviewAudio{Uuid: "uuid_5", TrackId: 5, SrcPath: "/src/5.flac"})
+	assert.Nil(t, err)
+	assert.Equal(t, int64(5), id)
+	audio, err := mgDriver.GetPreviewAudioByUuid("uuid_5")
+	assert.Nil(t, err)
+	assert.Equal(t, "/src/5.flac", audio.SrcPath)
+	audios, err = mgDriver.GetPreviewAudioByTrackId(5)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(audios))
+	_, err = mgDriver.InsertPreviewAudio(&m.PreviewAudio{EncodeStat: 9})
+	assert.NotNil(t, err)
+	_, err = mgDriver.InsertPreviewAudio(&m.PreviewAudio{Uuid: "uuid_6", EncodeStat: EncodeStatSuccess}) //新建只能是待转码
+	assert.NotNil(t, err)
+
+	//转码状态只能按顺序变更, 不能直接更新
+	assert.NotNil(t, mgDriver.UpdatePreviewAudioById(id, bson.M{"encode_stat": EncodeStatSuccess}))
+	_, err = mgDriver.TransitPreviewAudioEncodeStat(id, EncodeStatSuccess, nil)
+	assert.Equal(t, &EncodeStatError{Id: id, From: EncodeStatPending, To: EncodeStatSuccess}, err)
+	audio, err = mgDriver.TransitPreviewAudioEncodeStat(id, EncodeStatEncoding, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, EncodeStatEncoding, audio.EncodeStat)
+	audio, err = mgDriver.TransitPreviewAudioEncodeStat(id, EncodeStatSuccess, bson.M{"dst_path": "/dst/5.mp3"})
+	assert.Nil(t, err)
+	assert.Equal(t, EncodeStatSuccess, audio.EncodeStat)
+	assert.Equal(t, "/dst/5.mp3", audio.DstPath)
+	_, err = mgDriver.TransitPreviewAudioEncodeStat(id, EncodeStatFailed, nil)
+	assert.IsType(t, &EncodeStatError{}, err)
+
+	//未设置encode_stat的文档视为待转码
+	audio, err = mgDriver.TransitPreviewAudioEncodeStat(2, EncodeStatEncoding, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, EncodeStatEncoding, audio.EncodeStat)
+	_, err = mgDriver.TransitPreviewAudioEncodeStat(100, EncodeStatEncoding, nil)
+	assert.Equal(t, mongo.ErrNoDocuments, err)
+
+	//读写配置的集合
+	mgDriver.SetAudioCollection("preview_audio_v2")
+	id, err = mgDriver.InsertPreviewAudio(&m.PreviewAudio{Uuid: "uuid_7", TrackId: 7})
+	assert.Nil(t, err)
+	audio, err = mgDriver.GetPreviewAudioById(id)
+	assert.Nil(t, err)
+	assert.Equal(t, "uuid_7", audio.Uuid)
+	audios, err = mgDriver.GetPreviewAudioByInnerFileId("inner_1")
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(audios))
+	_, err = memoryBackend.Collection("music_cms", "preview_audio").FindOne(context.Background(), bson.M{"uuid": "uuid_7"})
+	assert.Equal(t, mongo.ErrNoDocuments, err)
+}
+
+func TestAggregate(t *testing.T) {
+	mgSetup(t)
+	pipeline, err := ParsePipeline([]byte(`[{"$match": {"deleted": 0}},
+		{"$group": {"_id": {"region": "$region_id"}, "albums": {"$sum": 1}}}, {"$sort": {"_id.region": -1}}]`))
+	assert.Nil(t, err)
+	results := []bson.M{}
+	err = mgDriver.Aggregate("auto_publish_album", pipeline, 0, func(doc bson.Raw) error {
+		ret := bson.M{}
+		results = append(results, ret)
+		return bson.Unmarshal(doc, &ret)
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, []bson.M{{"_id": bson.M{"region": int32(2)}, "albums": int32(1)},
+		{"_id": bson.M{"region": int32(1)}, "albums": int32(2)}}, results)
+
+	//服务端限制返回条数
+	type resourceAudios struct {
+		Id     int64             `bson:"_id"`
+		Audios []*m.PreviewAudio `bson:"audios"`
+	}
+	joined := []*resourceAudios{}
+	pipeline, _ = ParsePipeline([]byte(`[{"$lookup": {"from": "preview_audio", "localField": "_id",
+		"foreignField": "track_id", "as": "audios"}}, {"$project": {"audios": 1}}]`))
+	err = mgDriver.Aggregate("external_resources", pipeline, 1, func(doc bson.Raw) error {
+		ret := &resourceAudios{}
+		joined = append(joined, ret)
+		return bson.Unmarshal(doc, ret)
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(joined))
+	assert.Equal(t, int64(1), joined[0].Id)
+	assert.Equal(t, "inner_1", joined[0].Audios[0].InnerFileId)
+
+	//白名单外的集合、stage、操作符
+	for col, p := range map[string]string{
+		"counters":           `[{"$match": {}}]`,
+		"external_resources": `[{"$out": "copy"}]`,
+		"preview_audio":      `[{"$match": {"$where": "sleep(1000)"}}]`,
+		"auto_publish_album": `[{"$lookup": {"from": "counters", "localField": "_id", "foreignField": "_id", "as": "c"}}]`,
+	} {
+		pipeline, err = ParsePipeline([]byte(p))
+		assert.Nil(t, err)
+		err = mgDriver.Aggregate(col, pipeline, 0, func(doc bson.Raw) error { return nil })
+		assert.IsType(t, &PipelineError{}, err, p)
+	}
+
+	//试听音频使用配置的集合
+	mgDriver.SetAudioCollection("preview_audio_v2")
+	_, err = mgDriver.InsertPreviewAudio(&m.PreviewAudio{Uuid: "uuid_7", TrackId: 7})
+	assert.Nil(t, err)
+	pipeline, _ = ParsePipeline([]byte(`[{"$match": {"track_id": 7}}]`))
+	audios := []*m.PreviewAudio{}
+	err = mgDriver.Aggregate("preview_audio_v2", pipeline, 0, func(doc bson.Raw) error {
+		audio := &m.PreviewAudio{}
+		audios = append(audios, audio)
+		return bson.Unmarshal(doc, audio)
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(audios))
+	assert.Equal(t, "uuid_7", audios[0].Uuid)
+	err = mgDriver.Aggregate("preview_audio", pipeline, 0, func(doc bson.Raw) error { return nil })
+	assert.IsType(t, &PipelineError{}, err)
+}
+
+func TestEnsureIndexes(t *testing.T) {
+	mgSetup(t)
+	reports, err := mgDriver.IndexReports()
+	assert.Nil(t, err)
+	assert.True(t, IndexesInconsistent(reports))
+	assert.Equal(t, "auto_publish_album", reports[0].Collection)
+	assert.Equal(t, 3, len(reports[0].Missing))
+
+	//未声明及选项不一致的索引
+	ctx := context.Background()
+	unique := options.Index().SetName("uuid_1").SetUnique(true)
+	assert.Nil(t, memoryBackend.Collection("music_cms", "preview_audio").CreateIndex(ctx, bson.D{{"uuid", 1}}, unique))
+	assert.Nil(t, memoryBackend.Collection("music_cms", "preview_audio").CreateIndex(ctx, bson.D{{"rate", -1}}, nil))
+	reports, err = mgDriver.EnsureIndexes()
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"album_id_1_region_id_1", "region_id_1_local_status_1", "modify_time_1"}, reports[0].Created)
+	audio := reports[2]
+	assert.Equal(t, "preview_audio", audio.Collection)
+	assert.Equal(t, []string{"track_id_1", "inner_file_id_1"}, audio.Created)
+	assert.Equal(t, "uuid_1", audio.Conflict[0].Name)
+	assert.Equal(t, []IndexKey{{"rate", -1}}, audio.Extra[0].Keys)
+
+	reports, err = mgDriver.IndexReports()
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(reports[0].Missing)+len(reports[1].Missing)+len(reports[2].Missing))
+	assert.True(t, IndexesInconsistent(reports))
+}
@@ -0,0 +1,98 @@
+package mongo
+
+import (
+	"fmt"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+/*-------------------------- 自增id分配 -------------------------*/
+//文档的自增_id由计数集合分配, 每个序列一条计数文档{_id: 序列名, seq: 已分配的最大id},
+//通过findOneAndUpdate+$inc原子递增, 并发写入不会分配到相同id; 批量写入一次预分配连续的一段id.
+//按集合分配时序列名即集合名, 首次使用时以集合当前最大_id初始化序列($max, 只增不减), 兼容已有数据
+
+const (
+	CountersCollection = "counters"
+	sequenceField      = "seq"
+)
+
+//以集合当前最大_id初始化序列, 序列已超过该值时不变
+func (md *MongoDriver) SeedSequence(db, name, col string) error {
+	maxId, err := md.maxDocId(db, col)
+	if err != nil {
+		return err
+	}
+	opts := options.FindOneAndUpdate().SetUpsert(true)
+	_, err = md.coll(db, CountersCollection).FindOneAndUpdate(md.Ctx, bson.M{"_id": name},
+		bson.M{"$max": bson.M{sequenceField: maxId}}, opts)
+	if err != nil && err != mongo.ErrNoDocuments { //upsert新建时返回ErrNoDocuments
+		return err
+	}
+	return nil
+}
+
+//从序列分配n个连续id, 返回第一个id, 分配的id为[first, first+n)
+func (md *MongoDriver) AllocIds(db, name string, n int64) (int64, error) {
+	if n <= 0 {
+		return 0, fmt.Errorf("invalid id count %d", n)
+	}
+	opts := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
+	raw, err := md.coll(db, CountersCollection).FindOneAndUpdate(md.Ctx, bson.M{"_id": name},
+		bson.M{"$inc": bson.M{sequenceField: n}}, opts)
+	if err != nil {
+		return 0, err
+	}
+	last, ok := int64Value(raw.Lookup(sequenceField))
+	if !ok {
+		return 0, fmt.Errorf("sequence %s of %s is not an integer", name, db)
+	}
+	return last - n + 1, nil
+}
+
+//从序列分配1个id
+func (md *MongoDriver) NextId(db, name string) (int64, error) {
+	return md.AllocIds(db, name, 1)
+}
+
+//为集合分配n个文档_id, 进程内首次分配前初始化序列
+func (md *MongoDriver) allocDocIds(db, col string, n int64) (int64, error) {
+	key := db + "." + col
+	if _, ok := md.seeded.Load(key); !ok {
+		if err := md.SeedSequence(db, col, col); err != nil {
+			return 0, fmt.Errorf("seed sequence %s error: %v", key, err)
+		}
+		md.seeded.Store(key, true)
+	}
+	return md.AllocIds(db, col, n)
+}
+
+//集合当前最大的整数_id, 空集合返回0
+func (md *MongoDriver) maxDocId(db, col string) (int64, error) {
+	lastDoc, err := md.FindLastDoc(db, col)
+	if err == mongo.ErrNoDocuments {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	id, ok := int64Value(lastDoc.Lookup("_id"))
+	if !ok {
+		return 0, fmt.Errorf("_id of %s.%s is not an integer", db, col)
+	}
+	return id, nil
+}
+
+func int64Value(v bson.RawValue) (int64, bool) {
+	switch v.Type {
+	case bsontype.Int32:
+		return int64(v.Int32()), true
+	case bsontype.Int64:
+		return v.Int64(), true
+	case bsontype.Double:
+		return int64(v.Double()), true
+	}
+	return 0, false
+}
@@ -61,6 +61,19 @@ var AlbumPublishCounter = prometheus.NewCounterVec(prometheus.CounterOpts{
 	Help:      "total desc of auto published albums",
 }, []string{ServerTag, "type", "subtype"})
 
+var DBStatsGauge = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+	Subsystem: "mysql_pool",
+	Name:      "stats",
+	Help:      "sql.DBStats of mysql connection pool, wait_count and *_closed are totals since db opened.",
+}, []string{ServerTag, "db", "stat"})
+
+var DBQueryHistogram = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+	Subsystem: "mysql_query",
+	Name:      "latency",
+	Help:      "Latency of mysql query in seconds.",
+	Buckets:   prometheus.ExponentialBuckets(0.0005, 2, 16), // ~ 16s
+}, []string{ServerTag, "db", "op", "table"})
+
 func init() {
 	prometheus.MustRegister(
 		RequestTotalCounter,
@@ -71,5 +84,7 @@ func init() {
 		RequestSummary,
 		RequestClassifySummary,
 		AlbumPublishCounter,
+		DBStatsGauge,
+		DBQueryHistogram,
 	)
 }
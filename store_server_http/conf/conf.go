@@ -9,6 +9,8 @@ type StoreServerHttpConfig struct {
 	Http         HttpConfig            `json:"http,omitempty" yaml:"http"`
 	IpWhiteList  string                `json:"ip_white_list,omitempty" yaml:"ip_white_list"`
 	Mysql        string                `json:"mysql,omitempty" yaml:"mysql"`
+	LyricMysql   string                `json:"lyric_mysql,omitempty" yaml:"lyric_mysql"`   //普通歌词库, 为空时不开启歌词服务
+	KlyricMysql  string                `json:"klyric_mysql,omitempty" yaml:"klyric_mysql"` //逐字歌词库, 为空时不支持逐字歌词
 	MongoDb      MongoDB               `json:"mongodb" yaml:"mongodb"`
 	Es           EsConfig              `json:"es,omitempty" yaml:"es"`
 	Es7          EsConfig              `json:"es7,omitempty" yaml:"es7"`
@@ -19,6 +21,120 @@ type StoreServerHttpConfig struct {
 	ExportAllOpen bool      `json:"export_all_open" yaml:"export_all_open"`
 	Cls           ClsConfig `json:"cls" yaml:"cls"`
 	ValidRegions  []int     `json:"valid_regions" yaml:"valid_regions"`
+	//地区id与地区简码(HK, TH...)映射, 用于匹配来源版权, 未配置的地区播放查询返回地区未知
+	RegionCodes map[int]string `json:"region_codes" yaml:"region_codes"`
+	//原生sql查询开关(rawSql), 仅管理场景开启, 默认关闭
+	RawSqlOpen bool `json:"raw_sql_open" yaml:"raw_sql_open"`
+	//软删除开关, 开启后删除记录移入回收站(t_trash), 保留trash_retention_days天
+	SoftDeleteOpen     bool `json:"soft_delete_open" yaml:"soft_delete_open"`
+	TrashRetentionDays int  `json:"trash_retention_days" yaml:"trash_retention_days"`
+	//变更历史开关, 开启后写操作记录字段级变更(t_change_history), 支持回滚
+	HistoryOpen bool `json:"history_open" yaml:"history_open"`
+	//批量update/delete无需确认的最大影响行数, confirm_thresholds按表配置, 超过时需预演并携带token确认
+	ConfirmThreshold  int64            `json:"confirm_threshold" yaml:"confirm_threshold"`
+	ConfirmThresholds map[string]int64 `json:"confirm_thresholds" yaml:"confirm_thresholds"`
+	//只读从库, 查询优先使用健康的从库
+	Replica ReplicaConfig `json:"replica" yaml:"replica"`
+	//各逻辑库(music/import/ktrack/klyric/lyric)结构化配置, 未配置时使用mysql等dsn配置
+	Databases map[string]*MysqlConfig `json:"databases" yaml:"databases"`
+	//连接池状态上报间隔(秒), 默认15秒
+	DBStatsInterval int `json:"db_stats_interval" yaml:"db_stats_interval"`
+	//跳过启动时的表结构版本检查, 仅用于紧急情况, 正常应先执行store_server_migrate up
+	SkipSchemaCheck bool `json:"skip_schema_check" yaml:"skip_schema_check"`
+	//慢查询记录, threshold为0时关闭
+	SlowQuery SlowQueryConfig `json:"slow_query" yaml:"slow_query"`
+	//写入校验, 按model字段声明的规则校验insert/update
+	Validation ValidationConfig `json:"validation" yaml:"validation"`
+	//mongo文档变更同步es索引
+	EsSync EsSyncConfig `json:"es_sync" yaml:"es_sync"`
+	//mongo聚合查询
+	MongoAggregate MongoAggregateConfig `json:"mongo_aggregate" yaml:"mongo_aggregate"`
+	//mongo索引管理, 启动时创建代码及配置中声明的缺失索引
+	MongoIndex MongoIndexConfig `json:"mongo_index" yaml:"mongo_index"`
+}
+
+//mysql config, dsn不为空时直接使用, 否则由host等字段拼接; 超时及连接时长单位为秒, 连接池参数为0时使用默认值
+type MysqlConfig struct {
+	Dsn             string            `json:"dsn,omitempty" yaml:"dsn"`
+	Host            string            `json:"host" yaml:"host"`
+	Port            int               `json:"port" yaml:"port"`
+	User            string            `json:"user" yaml:"user"`
+	Passwd          string            `json:"passwd" yaml:"passwd"`
+	Database        string            `json:"database" yaml:"database"`
+	Charset         string            `json:"charset" yaml:"charset"`
+	Params          map[string]string `json:"params" yaml:"params"`
+	Timeout         int               `json:"timeout" yaml:"timeout"`
+	ReadTimeout     int               `json:"read_timeout" yaml:"read_timeout"`
+	WriteTimeout    int               `json:"write_timeout" yaml:"write_timeout"`
+	MaxOpenConns    int               `json:"max_open_conns" yaml:"max_open_conns"`
+	MaxIdleConns    int               `json:"max_idle_conns" yaml:"max_idle_conns"`
+	ConnMaxLifetime int               `json:"conn_max_lifetime" yaml:"conn_max_lifetime"`
+	ConnMaxIdleTime int               `json:"conn_max_idle_time" yaml:"conn_max_idle_time"`
+}
+
+//read replica config, dsns按逻辑库(musicDB/lyricDB/klyricDB)配置一个或多个从库
+type ReplicaConfig struct {
+	Dsns           map[string][]string `json:"dsns" yaml:"dsns"`
+	MaxLag         int                 `json:"max_lag" yaml:"max_lag"`                 //最大复制延迟(秒), 超过时不使用该从库
+	CheckInterval  int                 `json:"check_interval" yaml:"check_interval"`   //健康检查间隔(秒)
+	HeartbeatTable string              `json:"heartbeat_table" yaml:"heartbeat_table"` //心跳表, 为空时通过SHOW SLAVE STATUS获取延迟
+}
+
+//slow query config
+type SlowQueryConfig struct {
+	Threshold int  `json:"threshold" yaml:"threshold"` //慢查询阈值(毫秒), 为0时不记录
+	TopN      int  `json:"top_n" yaml:"top_n"`         //保留耗时最长的记录数, 默认100
+	Explain   bool `json:"explain" yaml:"explain"`     //是否对慢select语句执行EXPLAIN
+}
+
+//write validation config, disabled_rules为全局关闭的规则(如isrc、region)
+type ValidationConfig struct {
+	Disabled      bool     `json:"disabled" yaml:"disabled"`
+	DisabledRules []string `json:"disabled_rules" yaml:"disabled_rules"`
+}
+
+//mongo to es sync config, mode为change_stream(需要副本集)或poll(按modify_time轮询), collections为集合名到es索引的映射
+type EsSyncConfig struct {
+	Enabled      bool                         `json:"enabled" yaml:"enabled"`
+	Db           string                       `json:"db" yaml:"db"`
+	Mode         string                       `json:"mode" yaml:"mode"`
+	Target       string                       `json:"target" yaml:"target"`               //写入的es集群, es或es7
+	PollInterval int                          `json:"poll_interval" yaml:"poll_interval"` //轮询及出错重试间隔(秒)
+	BatchSize    int                          `json:"batch_size" yaml:"batch_size"`
+	Collections  map[string]EsSyncIndexConfig `json:"collections" yaml:"collections"`
+}
+
+type EsSyncIndexConfig struct {
+	Index string `json:"index" yaml:"index"`
+	Type  string `json:"type" yaml:"type"`
+}
+
+//mongo aggregate config, collections为允许聚合的music_cms集合, 为空时使用默认白名单; preview_audio指mongo_db.audio_col配置的集合
+type MongoAggregateConfig struct {
+	Collections []string `json:"collections" yaml:"collections"`
+	MaxTimeMs   int      `json:"max_time_ms" yaml:"max_time_ms"` //单次聚合的最大执行时间(毫秒), 默认10000
+	MaxResults  int64    `json:"max_results" yaml:"max_results"` //单次聚合的最大返回文档数, 默认1000
+}
+
+//mongo index config, strict为true时存在未创建、未声明或选项不一致的索引则拒绝启动;
+//indexes为代码声明之外追加的music_cms集合索引
+type MongoIndexConfig struct {
+	Disabled bool                        `json:"disabled" yaml:"disabled"`
+	Strict   bool                        `json:"strict" yaml:"strict"`
+	Indexes  map[string][]MongoIndexSpec `json:"indexes" yaml:"indexes"`
+}
+
+//索引声明, keys为有序的字段及顺序(1升序, -1降序), name为空时使用mongo默认命名
+type MongoIndexSpec struct {
+	Name   string          `json:"name" yaml:"name"`
+	Keys   []MongoIndexKey `json:"keys" yaml:"keys"`
+	Unique bool            `json:"unique" yaml:"unique"`
+	Sparse bool            `json:"sparse" yaml:"sparse"`
+}
+
+type MongoIndexKey struct {
+	Field string `json:"field" yaml:"field"`
+	Order int    `json:"order" yaml:"order"`
 }
 
 //http config
@@ -40,6 +156,7 @@ type MongoDB struct {
 	TimeOut  int    `json:"time_out" yaml:"time_out"`
 	PoolSize int    `json:"pool_size" yaml:"pool_size"`
 	Direct   bool   `json:"direct" yaml:"direct"`
+	AudioCol string `json:"audio_col" yaml:"audio_col"` //试听音频集合, 为空时使用preview_audio
 }
 
 //es config
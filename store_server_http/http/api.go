@@ -1,13 +1,19 @@
 package http
 
 import (
+	"encoding/json"
+	"fmt"
 	"net/http"
+	"strconv"
 
 	"github.com/gin-gonic/gin"
+	"github.com/store_server/dbtools/dblogic"
+	"github.com/store_server/dbtools/driver"
 	"github.com/store_server/logger"
 	"github.com/store_server/store_server_http/kits"
 	"github.com/store_server/store_server_http/op"
 	"github.com/store_server/utils/common"
+	"github.com/store_server/utils/rest"
 )
 
 /*HTTP Server相关api*/
@@ -36,10 +42,28 @@ func configServerAPI() {
 
 	configTracksAPI()
 	configVideosAPI()
+	configAlbumsAPI()
+	configSingersAPI()
+	configLyricsAPI()
+	configTransactionAPI()
 	configMatchesAPI()
 	configMongosAPI()
+	configMongoAggregateAPI()
 	configEsAPI()
 	configDataplatformAPI()
+	configAdminAPI()
+}
+
+//写操作请求未携带requestId时, 使用请求头中的X-request-id
+func bindOpInfo(c *gin.Context, info *dblogic.OpInfo) {
+	if len(info.RequestId) == 0 {
+		info.RequestId = c.GetHeader(rest.HeaderRequestId)
+	}
+}
+
+//查询请求的来源(路由及请求头中的X-request-id), 记录于慢查询
+func queryTrace(c *gin.Context) *driver.QueryTrace {
+	return &driver.QueryTrace{Route: c.FullPath(), RequestId: c.GetHeader(rest.HeaderRequestId)}
 }
 
 func configTracksAPI() {
@@ -67,6 +91,7 @@ func configTracksQueryAPI() {
 				c.AbortWithError(http.StatusBadRequest, err)
 				return
 			}
+			queryReq.Trace = queryTrace(c)
 			//rsp, err := op.TracksQuery(c.Request)
 			rsp, err := op.TracksQuery(queryReq)
 			if err != nil {
@@ -80,6 +105,7 @@ func configTracksQueryAPI() {
 				c.AbortWithError(http.StatusBadRequest, err)
 				return
 			}
+			queryReq.Trace = queryTrace(c)
 			rsp, err := op.TrackExtraOsQuery(queryReq)
 			if err != nil {
 				logger.Entry().Errorf("query track extra os error: %v", err)
@@ -122,6 +148,7 @@ func configTracksUpdateAPI() {
 				c.AbortWithError(http.StatusBadRequest, err)
 				return
 			}
+			bindOpInfo(c, &updateReq.OpInfo)
 			rsp, err := op.TracksUpdate(updateReq)
 			if err != nil {
 				logger.Entry().Errorf("update track error: %v", err)
@@ -134,6 +161,7 @@ func configTracksUpdateAPI() {
 				c.AbortWithError(http.StatusBadRequest, err)
 				return
 			}
+			bindOpInfo(c, &updateReq.OpInfo)
 			rsp, err := op.TrackExtraOsUpdate(updateReq)
 			if err != nil {
 				logger.Entry().Errorf("update track extra os error: %v", err)
@@ -152,6 +180,7 @@ func configTracksDeleteAPI() {
 				c.AbortWithError(http.StatusBadRequest, err)
 				return
 			}
+			bindOpInfo(c, &deleteReq.OpInfo)
 			rsp, err := op.TracksDelete(deleteReq)
 			if err != nil {
 				logger.Entry().Errorf("delete track error: %v", err)
@@ -164,6 +193,7 @@ func configTracksDeleteAPI() {
 				c.AbortWithError(http.StatusBadRequest, err)
 				return
 			}
+			bindOpInfo(c, &deleteReq.OpInfo)
 			rsp, err := op.TrackExtraOsDelete(deleteReq)
 			if err != nil {
 				logger.Entry().Errorf("delete track extra os error: %v", err)
@@ -182,6 +212,7 @@ func configTracksInsertAPI() {
 				c.AbortWithError(http.StatusBadRequest, err)
 				return
 			}
+			bindOpInfo(c, &insertReq.OpInfo)
 			rsp, err := op.TracksInsert(insertReq)
 			if err != nil {
 				logger.Entry().Errorf("insert track error: %v", err)
@@ -200,6 +231,7 @@ func configTracksJoinAPI() {
 				c.AbortWithError(http.StatusBadRequest, err)
 				return
 			}
+			jqReq.Trace = queryTrace(c)
 			rsp, err := op.TracksJoinQuery(jqReq)
 			if err != nil {
 				logger.Entry().Errorf("join query track error: %v", err)
@@ -224,6 +256,44 @@ func configTracksOtherAPI() {
 			}
 			c.JSON(http.StatusOK, rsp)
 		})
+		tog.POST("/restore", func(c *gin.Context) {
+			rReq := &op.RestoreTrackReq{}
+			if err := c.BindJSON(rReq); err != nil {
+				c.AbortWithError(http.StatusBadRequest, err)
+				return
+			}
+			bindOpInfo(c, &rReq.OpInfo)
+			rsp, err := op.TracksRestore(rReq)
+			if err != nil {
+				logger.Entry().Errorf("restore track error: %v", err)
+			}
+			c.JSON(http.StatusOK, rsp)
+		})
+		tog.POST("/history", func(c *gin.Context) {
+			hReq := &op.QueryTrackHistoryReq{}
+			if err := c.BindJSON(hReq); err != nil {
+				c.AbortWithError(http.StatusBadRequest, err)
+				return
+			}
+			rsp, err := op.TrackHistoryQuery(hReq)
+			if err != nil {
+				logger.Entry().Errorf("query track history error: %v", err)
+			}
+			c.JSON(http.StatusOK, rsp)
+		})
+		tog.POST("/rollback", func(c *gin.Context) {
+			rbReq := &op.RollbackTrackReq{}
+			if err := c.BindJSON(rbReq); err != nil {
+				c.AbortWithError(http.StatusBadRequest, err)
+				return
+			}
+			bindOpInfo(c, &rbReq.OpInfo)
+			rsp, err := op.TracksRollback(rbReq)
+			if err != nil {
+				logger.Entry().Errorf("rollback track error: %v", err)
+			}
+			c.JSON(http.StatusOK, rsp)
+		})
 	}
 }
 
@@ -237,6 +307,7 @@ func configVideosAPI() {
 				c.AbortWithError(http.StatusBadRequest, err)
 				return
 			}
+			queryReq.Trace = queryTrace(c)
 			rsp, err := op.VideosQuery(queryReq)
 			if err != nil {
 				logger.Entry().Errorf("query video error: %v", err)
@@ -249,6 +320,7 @@ func configVideosAPI() {
 				c.AbortWithError(http.StatusBadRequest, err)
 				return
 			}
+			queryReq.Trace = queryTrace(c)
 			rsp, err := op.VideoExtraOsQuery(queryReq)
 			if err != nil {
 				logger.Entry().Errorf("query video extra os error: %v", err)
@@ -261,6 +333,7 @@ func configVideosAPI() {
 				c.AbortWithError(http.StatusBadRequest, err)
 				return
 			}
+			queryReq.Trace = queryTrace(c)
 			rsp, err := op.VideoSingerTrackQuery(queryReq)
 			if err != nil {
 				logger.Entry().Errorf("query video singer track error: %v", err)
@@ -276,6 +349,7 @@ func configVideosAPI() {
 				c.AbortWithError(http.StatusBadRequest, err)
 				return
 			}
+			jqReq.Trace = queryTrace(c)
 			rsp, err := op.VideosJoinQuery(jqReq)
 			if err != nil {
 				logger.Entry().Errorf("join query video error: %v", err)
@@ -283,6 +357,311 @@ func configVideosAPI() {
 			c.JSON(http.StatusOK, rsp)
 		})
 	}
+	vur := router.Group("/store_server/videos/update")
+	{
+		vur.POST("/video", func(c *gin.Context) {
+			updateReq := &op.UpdateVideoReq{}
+			if err := c.BindJSON(updateReq); err != nil {
+				c.AbortWithError(http.StatusBadRequest, err)
+				return
+			}
+			bindOpInfo(c, &updateReq.OpInfo)
+			rsp, err := op.VideosUpdate(updateReq)
+			if err != nil {
+				logger.Entry().Errorf("update video error: %v", err)
+			}
+			c.JSON(http.StatusOK, rsp)
+		})
+	}
+	vog := router.Group("/store_server/videos")
+	{
+		vog.POST("/restore", func(c *gin.Context) {
+			rReq := &op.RestoreVideoReq{}
+			if err := c.BindJSON(rReq); err != nil {
+				c.AbortWithError(http.StatusBadRequest, err)
+				return
+			}
+			bindOpInfo(c, &rReq.OpInfo)
+			rsp, err := op.VideosRestore(rReq)
+			if err != nil {
+				logger.Entry().Errorf("restore video error: %v", err)
+			}
+			c.JSON(http.StatusOK, rsp)
+		})
+		vog.POST("/history", func(c *gin.Context) {
+			hReq := &op.QueryVideoHistoryReq{}
+			if err := c.BindJSON(hReq); err != nil {
+				c.AbortWithError(http.StatusBadRequest, err)
+				return
+			}
+			rsp, err := op.VideoHistoryQuery(hReq)
+			if err != nil {
+				logger.Entry().Errorf("query video history error: %v", err)
+			}
+			c.JSON(http.StatusOK, rsp)
+		})
+		vog.POST("/rollback", func(c *gin.Context) {
+			rbReq := &op.RollbackVideoReq{}
+			if err := c.BindJSON(rbReq); err != nil {
+				c.AbortWithError(http.StatusBadRequest, err)
+				return
+			}
+			bindOpInfo(c, &rbReq.OpInfo)
+			rsp, err := op.VideosRollback(rbReq)
+			if err != nil {
+				logger.Entry().Errorf("rollback video error: %v", err)
+			}
+			c.JSON(http.StatusOK, rsp)
+		})
+	}
+}
+
+//专辑数据存储操作API定义
+func configAlbumsAPI() {
+	aqr := router.Group("/store_server/albums/query")
+	{
+		aqr.POST("/album", func(c *gin.Context) {
+			queryReq := &op.QueryAlbumReq{}
+			if err := c.BindJSON(queryReq); err != nil {
+				c.AbortWithError(http.StatusBadRequest, err)
+				return
+			}
+			queryReq.Trace = queryTrace(c)
+			rsp, err := op.AlbumsQuery(queryReq)
+			if err != nil {
+				logger.Entry().Errorf("query album error: %v", err)
+			}
+			c.JSON(http.StatusOK, rsp)
+		})
+	}
+	aur := router.Group("/store_server/albums/update")
+	{
+		aur.POST("/album", func(c *gin.Context) {
+			updateReq := &op.UpdateAlbumReq{}
+			if err := c.BindJSON(updateReq); err != nil {
+				c.AbortWithError(http.StatusBadRequest, err)
+				return
+			}
+			bindOpInfo(c, &updateReq.OpInfo)
+			rsp, err := op.AlbumsUpdate(updateReq)
+			if err != nil {
+				logger.Entry().Errorf("update album error: %v", err)
+			}
+			c.JSON(http.StatusOK, rsp)
+		})
+	}
+	air := router.Group("/store_server/albums/insert")
+	{
+		air.POST("/album", func(c *gin.Context) {
+			insertReq := &op.InsertAlbumReq{}
+			if err := c.BindJSON(insertReq); err != nil {
+				c.AbortWithError(http.StatusBadRequest, err)
+				return
+			}
+			bindOpInfo(c, &insertReq.OpInfo)
+			rsp, err := op.AlbumsInsert(insertReq)
+			if err != nil {
+				logger.Entry().Errorf("insert album error: %v", err)
+			}
+			c.JSON(http.StatusOK, rsp)
+		})
+	}
+	adr := router.Group("/store_server/albums/delete")
+	{
+		adr.POST("/album", func(c *gin.Context) {
+			deleteReq := &op.DeleteAlbumReq{}
+			if err := c.BindJSON(deleteReq); err != nil {
+				c.AbortWithError(http.StatusBadRequest, err)
+				return
+			}
+			bindOpInfo(c, &deleteReq.OpInfo)
+			rsp, err := op.AlbumsDelete(deleteReq)
+			if err != nil {
+				logger.Entry().Errorf("delete album error: %v", err)
+			}
+			c.JSON(http.StatusOK, rsp)
+		})
+	}
+}
+
+//艺人数据存储操作API定义
+func configSingersAPI() {
+	sqr := router.Group("/store_server/singers/query")
+	{
+		sqr.POST("/singer", func(c *gin.Context) {
+			queryReq := &op.QuerySingerReq{}
+			if err := c.BindJSON(queryReq); err != nil {
+				c.AbortWithError(http.StatusBadRequest, err)
+				return
+			}
+			queryReq.Trace = queryTrace(c)
+			rsp, err := op.SingersQuery(queryReq)
+			if err != nil {
+				logger.Entry().Errorf("query singer error: %v", err)
+			}
+			c.JSON(http.StatusOK, rsp)
+		})
+		sqr.POST("/singer_alias", func(c *gin.Context) {
+			queryReq := &op.QuerySingerAliasReq{}
+			if err := c.BindJSON(queryReq); err != nil {
+				c.AbortWithError(http.StatusBadRequest, err)
+				return
+			}
+			rsp, err := op.SingerAliasQuery(queryReq)
+			if err != nil {
+				logger.Entry().Errorf("query singer alias error: %v", err)
+			}
+			c.JSON(http.StatusOK, rsp)
+		})
+	}
+	sur := router.Group("/store_server/singers/update")
+	{
+		sur.POST("/singer", func(c *gin.Context) {
+			updateReq := &op.UpdateSingerReq{}
+			if err := c.BindJSON(updateReq); err != nil {
+				c.AbortWithError(http.StatusBadRequest, err)
+				return
+			}
+			bindOpInfo(c, &updateReq.OpInfo)
+			rsp, err := op.SingersUpdate(updateReq)
+			if err != nil {
+				logger.Entry().Errorf("update singer error: %v", err)
+			}
+			c.JSON(http.StatusOK, rsp)
+		})
+		sur.POST("/singer_alias", func(c *gin.Context) {
+			updateReq := &op.UpdateSingerAliasReq{}
+			if err := c.BindJSON(updateReq); err != nil {
+				c.AbortWithError(http.StatusBadRequest, err)
+				return
+			}
+			bindOpInfo(c, &updateReq.OpInfo)
+			rsp, err := op.SingerAliasUpdate(updateReq)
+			if err != nil {
+				logger.Entry().Errorf("update singer alias error: %v", err)
+			}
+			c.JSON(http.StatusOK, rsp)
+		})
+	}
+	sir := router.Group("/store_server/singers/insert")
+	{
+		sir.POST("/singer", func(c *gin.Context) {
+			insertReq := &op.InsertSingerReq{}
+			if err := c.BindJSON(insertReq); err != nil {
+				c.AbortWithError(http.StatusBadRequest, err)
+				return
+			}
+			bindOpInfo(c, &insertReq.OpInfo)
+			rsp, err := op.SingersInsert(insertReq)
+			if err != nil {
+				logger.Entry().Errorf("insert singer error: %v", err)
+			}
+			c.JSON(http.StatusOK, rsp)
+		})
+	}
+	sdr := router.Group("/store_server/singers/delete")
+	{
+		sdr.POST("/singer", func(c *gin.Context) {
+			deleteReq := &op.DeleteSingerReq{}
+			if err := c.BindJSON(deleteReq); err != nil {
+				c.AbortWithError(http.StatusBadRequest, err)
+				return
+			}
+			bindOpInfo(c, &deleteReq.OpInfo)
+			rsp, err := op.SingersDelete(deleteReq)
+			if err != nil {
+				logger.Entry().Errorf("delete singer error: %v", err)
+			}
+			c.JSON(http.StatusOK, rsp)
+		})
+		sdr.POST("/singer_alias", func(c *gin.Context) {
+			deleteReq := &op.DeleteSingerAliasReq{}
+			if err := c.BindJSON(deleteReq); err != nil {
+				c.AbortWithError(http.StatusBadRequest, err)
+				return
+			}
+			bindOpInfo(c, &deleteReq.OpInfo)
+			rsp, err := op.SingerAliasDelete(deleteReq)
+			if err != nil {
+				logger.Entry().Errorf("delete singer alias error: %v", err)
+			}
+			c.JSON(http.StatusOK, rsp)
+		})
+	}
+}
+
+//歌词存储API定义
+func configLyricsAPI() {
+	lqr := router.Group("/store_server/lyrics/query")
+	{
+		lqr.POST("/lyric", func(c *gin.Context) {
+			queryReq := &op.QueryLyricReq{}
+			if err := c.BindJSON(queryReq); err != nil {
+				c.AbortWithError(http.StatusBadRequest, err)
+				return
+			}
+			rsp, err := op.LyricsQuery(queryReq)
+			if err != nil {
+				logger.Entry().Errorf("query lyric error: %v", err)
+			}
+			c.JSON(http.StatusOK, rsp)
+		})
+		lqr.POST("/versions", func(c *gin.Context) {
+			queryReq := &op.QueryLyricVersionsReq{}
+			if err := c.BindJSON(queryReq); err != nil {
+				c.AbortWithError(http.StatusBadRequest, err)
+				return
+			}
+			rsp, err := op.LyricVersionsQuery(queryReq)
+			if err != nil {
+				logger.Entry().Errorf("query lyric versions error: %v", err)
+			}
+			c.JSON(http.StatusOK, rsp)
+		})
+	}
+	router.POST("/store_server/lyrics/upload/lyric", func(c *gin.Context) {
+		uploadReq := &op.UploadLyricReq{}
+		if err := c.BindJSON(uploadReq); err != nil {
+			c.AbortWithError(http.StatusBadRequest, err)
+			return
+		}
+		bindOpInfo(c, &uploadReq.OpInfo)
+		rsp, err := op.LyricsUpload(uploadReq)
+		if err != nil {
+			logger.Entry().Errorf("upload lyric error: %v", err)
+		}
+		c.JSON(http.StatusOK, rsp)
+	})
+	router.POST("/store_server/lyrics/delete/lyric", func(c *gin.Context) {
+		deleteReq := &op.DeleteLyricReq{}
+		if err := c.BindJSON(deleteReq); err != nil {
+			c.AbortWithError(http.StatusBadRequest, err)
+			return
+		}
+		bindOpInfo(c, &deleteReq.OpInfo)
+		rsp, err := op.LyricsDelete(deleteReq)
+		if err != nil {
+			logger.Entry().Errorf("delete lyric error: %v", err)
+		}
+		c.JSON(http.StatusOK, rsp)
+	})
+}
+
+//跨表多操作事务API定义
+func configTransactionAPI() {
+	router.POST("/store_server/transaction", func(c *gin.Context) {
+		txReq := &op.TransactionReq{}
+		if err := c.BindJSON(txReq); err != nil {
+			c.AbortWithError(http.StatusBadRequest, err)
+			return
+		}
+		bindOpInfo(c, &txReq.OpInfo)
+		rsp, err := op.Transaction(txReq)
+		if err != nil {
+			logger.Entry().Errorf("transaction error: %v", err)
+		}
+		c.JSON(http.StatusOK, rsp)
+	})
 }
 
 //视频、歌曲、艺人等匹配逻辑API定义
@@ -341,6 +720,18 @@ func configMongosAPI() {
 			}
 			c.JSON(http.StatusOK, rsp)
 		})
+		mqs.POST("/preview_audio", func(c *gin.Context) {
+			queryReq := &op.QueryPreviewAudioReq{}
+			if err := c.BindJSON(queryReq); err != nil {
+				c.AbortWithError(http.StatusBadRequest, err)
+				return
+			}
+			rsp, err := op.PreviewAudioQuery(queryReq)
+			if err != nil {
+				logger.Entry().Errorf("query preview audio info error: %v", err)
+			}
+			c.JSON(http.StatusOK, rsp)
+		})
 		mqs.POST("/publish_albums", func(c *gin.Context) {
 			if err := c.BindJSON(""); err != nil {
 				c.AbortWithError(http.StatusBadRequest, err)
@@ -377,6 +768,30 @@ func configMongosAPI() {
 			}
 			c.JSON(http.StatusOK, rsp)
 		})
+		mus.POST("/preview_audio", func(c *gin.Context) {
+			updateReq := &op.UpdatePreviewAudioReq{}
+			if err := c.BindJSON(updateReq); err != nil {
+				c.AbortWithError(http.StatusBadRequest, err)
+				return
+			}
+			rsp, err := op.PreviewAudioUpdate(updateReq)
+			if err != nil {
+				logger.Entry().Errorf("update preview audio info error: %v", err)
+			}
+			c.JSON(http.StatusOK, rsp)
+		})
+		mus.POST("/preview_audio/encode_stat", func(c *gin.Context) { //转码状态变更
+			transitReq := &op.TransitEncodeStatReq{}
+			if err := c.BindJSON(transitReq); err != nil {
+				c.AbortWithError(http.StatusBadRequest, err)
+				return
+			}
+			rsp, err := op.PreviewAudioEncodeStatTransit(transitReq)
+			if err != nil {
+				logger.Entry().Errorf("transit preview audio encode stat error: %v", err)
+			}
+			c.JSON(http.StatusOK, rsp)
+		})
 		mus.POST("/publish_albums", func(c *gin.Context) {
 			if err := c.BindJSON(""); err != nil {
 				c.AbortWithError(http.StatusBadRequest, err)
@@ -413,6 +828,18 @@ func configMongosAPI() {
 			}
 			c.JSON(http.StatusOK, rsp)
 		})
+		mcs.POST("/preview_audio", func(c *gin.Context) {
+			insertReq := &op.InsertPreviewAudioReq{}
+			if err := c.BindJSON(insertReq); err != nil {
+				c.AbortWithError(http.StatusBadRequest, err)
+				return
+			}
+			rsp, err := op.PreviewAudioInsert(insertReq)
+			if err != nil {
+				logger.Entry().Errorf("insert preview audio info error: %v", err)
+			}
+			c.JSON(http.StatusOK, rsp)
+		})
 		mcs.POST("/publish_albums", func(c *gin.Context) {
 			if err := c.BindJSON(""); err != nil {
 				c.AbortWithError(http.StatusBadRequest, err)
@@ -449,6 +876,18 @@ func configMongosAPI() {
 			}
 			c.JSON(http.StatusOK, rsp)
 		})
+		mds.POST("/preview_audio", func(c *gin.Context) {
+			deleteReq := &op.DeletePreviewAudioReq{}
+			if err := c.BindJSON(deleteReq); err != nil {
+				c.AbortWithError(http.StatusBadRequest, err)
+				return
+			}
+			rsp, err := op.PreviewAudioDelete(deleteReq)
+			if err != nil {
+				logger.Entry().Errorf("delete preview audio info error: %v", err)
+			}
+			c.JSON(http.StatusOK, rsp)
+		})
 		mds.POST("/publish_albums", func(c *gin.Context) {
 			if err := c.BindJSON(""); err != nil {
 				c.AbortWithError(http.StatusBadRequest, err)
@@ -473,6 +912,49 @@ func configMongosAPI() {
 	}
 }
 
+//mongo聚合查询API, 结果以ndjson流式返回, 每行一个文档; 执行前出错时返回json格式的错误响应,
+//输出过程中出错时最后一行为{"error": "..."}
+func configMongoAggregateAPI() {
+	router.POST("/store_server/mongo/aggregate/:collection", func(c *gin.Context) {
+		aggReq := &op.AggregateReq{}
+		if err := c.BindJSON(aggReq); err != nil {
+			c.AbortWithError(http.StatusBadRequest, err)
+			return
+		}
+		aggReq.Collection = c.Param("collection")
+		started := false
+		rsp, err := op.MongoAggregate(aggReq, func(doc []byte) error {
+			if !started {
+				c.Header("Content-Type", "application/x-ndjson")
+				c.Status(http.StatusOK)
+				started = true
+			}
+			if _, err := c.Writer.Write(append(doc, '\n')); err != nil {
+				return err
+			}
+			c.Writer.Flush()
+			return nil
+		})
+		if err != nil {
+			logger.Entry().Errorf("mongo aggregate error: %v", err)
+		}
+		if rsp == nil {
+			rsp = kits.APIWrapRsp(kits.ErrOther, fmt.Sprint(err), nil)
+		}
+		if !started && rsp.Code != 0 {
+			c.JSON(http.StatusOK, rsp)
+			return
+		}
+		if !started { //无结果文档
+			c.Header("Content-Type", "application/x-ndjson")
+			c.Status(http.StatusOK)
+		} else if rsp.Code != 0 {
+			line, _ := json.Marshal(map[string]string{"error": rsp.ErrMsg})
+			c.Writer.Write(append(line, '\n'))
+		}
+	})
+}
+
 //elasticsearch数据操作API定义
 func configEsSearchAPI() {
 	ess := router.Group("/store_server/es/search")
@@ -684,3 +1166,49 @@ func configDataplatformAPI() {
 		})
 	}
 }
+
+//管理接口
+func configAdminAPI() {
+	adm := router.Group("/store_server/admin")
+	{
+		adm.GET("/slow_queries", func(c *gin.Context) { //耗时最长的慢查询, limit为返回条数
+			limit, err := strconv.Atoi(c.DefaultQuery("limit", "0"))
+			if err != nil {
+				c.AbortWithError(http.StatusBadRequest, err)
+				return
+			}
+			rsp, err := op.SlowQueriesQuery(limit)
+			if err != nil {
+				logger.Entry().Errorf("query slow queries error: %v", err)
+			}
+			c.JSON(http.StatusOK, rsp)
+		})
+		adm.POST("/slow_queries/reset", func(c *gin.Context) {
+			rsp, err := op.SlowQueriesReset()
+			if err != nil {
+				logger.Entry().Errorf("reset slow queries error: %v", err)
+			}
+			c.JSON(http.StatusOK, rsp)
+		})
+		adm.GET("/mongo_indexes", func(c *gin.Context) { //声明与实际的mongo索引
+			rsp, err := op.MongoIndexesQuery()
+			if err != nil {
+				logger.Entry().Errorf("query mongo indexes error: %v", err)
+			}
+			c.JSON(http.StatusOK, rsp)
+		})
+		adm.POST("/raw_sql", func(c *gin.Context) { //原生写sql, 需开启raw_sql_open
+			execReq := &op.ExecRawSqlReq{}
+			if err := c.BindJSON(execReq); err != nil {
+				c.AbortWithError(http.StatusBadRequest, err)
+				return
+			}
+			bindOpInfo(c, &execReq.OpInfo)
+			rsp, err := op.RawSqlExec(execReq)
+			if err != nil {
+				logger.Entry().Errorf("exec raw sql error: %v", err)
+			}
+			c.JSON(http.StatusOK, rsp)
+		})
+	}
+}
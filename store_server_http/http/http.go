@@ -14,6 +14,7 @@ import (
 	"github.com/gin-gonic/contrib/expvar"
 	"github.com/gin-gonic/gin"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/store_server/dbtools/migrate"
 	"github.com/store_server/logger"
 	"github.com/store_server/store_server_http/g"
 	"github.com/store_server/store_server_http/kits"
@@ -93,8 +94,16 @@ func (sh *StoreServerHttp) Start() (err error) {
 	ul, err := NewDefaultDBEnv(ctx)
 	if err != nil {
 		logger.Entry().Errorf("init mysql, mongo and elastic engine error in starting store server http: %v", err)
+		if migrate.IsSchemaError(err) { //表结构版本落后时拒绝启动
+			cancel()
+			return
+		}
+	}
+	if err = ul.Start(); err != nil { //db环境启动失败(如strict模式下mongo索引不一致)时拒绝启动
+		logger.Entry().Errorf("start db env error in starting store server http: %v", err)
+		cancel()
+		return
 	}
-	ul.Start()
 
 	/*err = kits.InitInfluxEnv(ctx)
 	if err != nil {
@@ -12,6 +12,7 @@ import (
 	"github.com/store_server/dbtools/dataplatform"
 	"github.com/store_server/dbtools/dblogic"
 	"github.com/store_server/dbtools/driver"
+	"github.com/store_server/dbtools/migrate"
 	"github.com/store_server/logger"
 	"github.com/store_server/store_server_http/g"
 	"github.com/store_server/store_server_http/kits"
@@ -41,6 +42,9 @@ func ReloadConfig(path string) (rsp *kits.WrapRsp, err error) {
 	}
 	logger.Entry().Infof("after reload config, ip white list is: %v", g.Config().IpWhiteList)
 	InitIpWhiteList(g.Config().IpWhiteList)
+	setSlowQueryOptions()
+	setValidationOptions()
+	setAggregateOptions()
 	rsp = kits.APIWrapRsp(0, "ok", nil)
 	return
 }
@@ -50,6 +54,7 @@ func ReloadConfig(path string) (rsp *kits.WrapRsp, err error) {
 //db util define
 type DBUtil struct {
 	dbs          map[string]*gorm.DB
+	replicas     map[string][]*gorm.DB
 	rawdbs       map[string]*sql.DB
 	mgoclient    *mongo.Client
 	importclient *mongo.Client
@@ -59,12 +64,43 @@ type DBUtil struct {
 	ctx context.Context
 }
 
-func InitDB(cfg string) (db *gorm.DB, err error) {
-	return driver.CreateDB(cfg)
+func InitDB(name string, cfg *driver.MysqlConfig) (db *gorm.DB, err error) {
+	return driver.CreateDBWithConfig(name, cfg)
 }
 
-func InitRawDB(cfg string) (db *sql.DB, err error) {
-	return driver.CreateRawDB(cfg)
+func InitRawDB(name string, cfg *driver.MysqlConfig) (db *sql.DB, err error) {
+	return driver.CreateRawDBWithConfig(name, cfg)
+}
+
+//逻辑库mysql配置, key为databases配置项, 未配置时使用dsn, 均未配置时返回nil
+func mysqlConfig(key, dsn string) *driver.MysqlConfig {
+	c := g.Config().Databases[key]
+	if c == nil {
+		if len(dsn) == 0 {
+			return nil
+		}
+		return &driver.MysqlConfig{Dsn: dsn}
+	}
+	second := func(n int) time.Duration {
+		return time.Duration(n) * time.Second
+	}
+	return &driver.MysqlConfig{
+		Dsn:             c.Dsn,
+		Host:            c.Host,
+		Port:            c.Port,
+		User:            c.User,
+		Passwd:          c.Passwd,
+		Database:        c.Database,
+		Charset:         c.Charset,
+		Params:          c.Params,
+		Timeout:         second(c.Timeout),
+		ReadTimeout:     second(c.ReadTimeout),
+		WriteTimeout:    second(c.WriteTimeout),
+		MaxOpenConns:    c.MaxOpenConns,
+		MaxIdleConns:    c.MaxIdleConns,
+		ConnMaxLifetime: second(c.ConnMaxLifetime),
+		ConnMaxIdleTime: second(c.ConnMaxIdleTime),
+	}
 }
 
 func NewMongoClientOpts(host, database, user, passwd string) (opts *options.ClientOptions) { //mongo client配置参数
@@ -122,11 +158,145 @@ func InitElastic7(ctx context.Context) (client *ies7.ESClient, err error) {
 	return ies7.NewEsClient(ctx, ec.Address, ec.Timeout, ec.Sniff, ec.Proxy, args...)
 }
 
+//校验各库表结构版本, 低于当前二进制期望的版本时拒绝启动
+func checkSchema(ctx context.Context, dbs map[string]*gorm.DB) error {
+	if g.Config().SkipSchemaCheck {
+		logger.Entry().Warnf("schema check skipped")
+		return nil
+	}
+	keys := map[string]string{"music": driver.MusicDBName, "lyric": driver.LyricDBName, "klyric": driver.KlyricDBName}
+	sqlDBs := make(map[string]*sql.DB)
+	for key, name := range keys {
+		if db := dbs[name]; db != nil {
+			sqlDBs[key] = db.DB()
+		}
+	}
+	return migrate.CheckAll(ctx, sqlDBs)
+}
+
+//慢查询配置, 支持配置重载
+func setSlowQueryOptions() {
+	sc := g.Config().SlowQuery
+	driver.SetSlowQueryOptions(driver.SlowQueryOptions{
+		Threshold: time.Duration(sc.Threshold) * time.Millisecond,
+		TopN:      sc.TopN,
+		Explain:   sc.Explain,
+	})
+}
+
+//写入校验配置, 支持配置重载
+func setValidationOptions() {
+	vc := g.Config().Validation
+	regions := make([]int64, 0, len(g.Config().ValidRegions))
+	for _, r := range g.Config().ValidRegions {
+		regions = append(regions, int64(r))
+	}
+	if len(regions) == 0 && !vc.Disabled {
+		logger.Entry().Warnf("valid_regions not configured, region rule accepts any region id")
+	}
+	dblogic.SetValidationOptions(dblogic.ValidationOptions{
+		Disabled:      vc.Disabled,
+		DisabledRules: vc.DisabledRules,
+		Regions:       regions,
+	})
+}
+
+//mongo聚合查询配置, 支持配置重载
+func setAggregateOptions() {
+	ac := g.Config().MongoAggregate
+	im.SetAggregateOptions(im.AggregateOptions{
+		Collections: ac.Collections,
+		MaxTime:     time.Duration(ac.MaxTimeMs) * time.Millisecond,
+		MaxResults:  ac.MaxResults,
+	})
+}
+
+//创建声明的缺失索引, strict模式下索引与声明不一致时拒绝启动
+func ensureMongoIndexes() error {
+	ic := g.Config().MongoIndex
+	if ic.Disabled {
+		logger.Entry().Warnf("mongo index reconcile skipped")
+		return nil
+	}
+	for col, specs := range ic.Indexes {
+		for _, spec := range specs {
+			keys := make([]im.IndexKey, 0, len(spec.Keys))
+			for _, k := range spec.Keys {
+				keys = append(keys, im.IndexKey{Field: k.Field, Order: k.Order})
+			}
+			im.DeclareIndexes(col, &im.IndexSpec{Name: spec.Name, Keys: keys, Unique: spec.Unique, Sparse: spec.Sparse})
+		}
+	}
+	reports, err := im.MgDriver.EnsureIndexes()
+	for _, r := range reports {
+		if len(r.Created) != 0 {
+			logger.Entry().Infof("mongo indexes created|collection: %s|indexes: %v", r.Collection, r.Created)
+		}
+		for _, spec := range r.Missing {
+			logger.Entry().Errorf("mongo index missing|collection: %s|index: %s|error: %s", r.Collection, spec.Name, r.Error)
+		}
+		for _, spec := range r.Extra {
+			logger.Entry().Warnf("mongo index not declared|collection: %s|index: %s", r.Collection, spec.Name)
+		}
+		for _, spec := range r.Conflict {
+			logger.Entry().Warnf("mongo index options differ from declaration|collection: %s|index: %s", r.Collection, spec.Name)
+		}
+	}
+	if err != nil {
+		logger.Entry().Errorf("ensure mongo indexes error: %v", err)
+		if ic.Strict {
+			return err
+		}
+		return nil
+	}
+	if ic.Strict && im.IndexesInconsistent(reports) {
+		return fmt.Errorf("mongo indexes are inconsistent with declarations, see /store_server/admin/mongo_indexes")
+	}
+	return nil
+}
+
+//mongo变更同步es配置
+func esSyncOptions() im.EsSyncOptions {
+	sc := g.Config().EsSync
+	cols := make(map[string]im.EsSyncIndex)
+	for col, idx := range sc.Collections {
+		cols[col] = im.EsSyncIndex{Index: idx.Index, Type: idx.Type}
+	}
+	return im.EsSyncOptions{
+		Db:           sc.Db,
+		Collections:  cols,
+		Mode:         sc.Mode,
+		PollInterval: time.Duration(sc.PollInterval) * time.Second,
+		BatchSize:    sc.BatchSize,
+	}
+}
+
+//es7写入, 转换为es7的文档声明
+type es7BulkWriter struct {
+	*ies7.ESClient
+}
+
+func (w es7BulkWriter) BulkWrite(sources []*ies.DocDecl) error {
+	docs := make([]*ies7.DocDecl, 0, len(sources))
+	for _, s := range sources {
+		docs = append(docs, &ies7.DocDecl{Index: s.Index, Type: s.Type, Id: s.Id, Doc: s.Doc, Delete: s.Delete})
+	}
+	return w.ESClient.BulkWrite(docs)
+}
+
+func esSyncWriter() im.BulkWriter {
+	if g.Config().EsSync.Target == "es7" {
+		return es7BulkWriter{ies7.EsDriver}
+	}
+	return ies.EsDriver
+}
+
 func NewDefaultDBEnv(ctx context.Context) (ul *DBUtil, err error) {
 	ul = &DBUtil{
-		dbs:    make(map[string]*gorm.DB),
-		rawdbs: make(map[string]*sql.DB),
-		ctx:    ctx}
+		dbs:      make(map[string]*gorm.DB),
+		replicas: make(map[string][]*gorm.DB),
+		rawdbs:   make(map[string]*sql.DB),
+		ctx:      ctx}
 	defer func() {
 		if err != nil {
 			logger.Entry().Errorf("init db error: %v", err)
@@ -137,16 +307,52 @@ func NewDefaultDBEnv(ctx context.Context) (ul *DBUtil, err error) {
 	case <-ctx.Done():
 		ul.Stop()
 	default:
-		ul.dbs["musicDB"], err = InitDB(g.Config().Mysql)
+		cfgs := map[string]*driver.MysqlConfig{
+			driver.MusicDBName:  mysqlConfig("music", g.Config().Mysql),
+			driver.ImportDBName: mysqlConfig("import", ""),
+			driver.KtrackDBName: mysqlConfig("ktrack", ""),
+			driver.LyricDBName:  mysqlConfig("lyric", g.Config().LyricMysql),
+			driver.KlyricDBName: mysqlConfig("klyric", g.Config().KlyricMysql),
+		}
+		ul.dbs[driver.MusicDBName], err = InitDB(driver.MusicDBName, cfgs[driver.MusicDBName])
 		if err != nil {
 			logger.Entry().Errorf("InitDb() failed, err:%s", err)
 			return
 		}
-		ul.rawdbs["rawDB"], err = InitRawDB(g.Config().Mysql)
+		ul.rawdbs["rawDB"], err = InitRawDB("rawDB", cfgs[driver.MusicDBName])
 		if err != nil {
 			logger.Entry().Errorf("InitRawDb() failed, err:%s", err)
 			return
 		}
+		for name, cfg := range cfgs { //其他逻辑库可选
+			if name == driver.MusicDBName || cfg == nil {
+				continue
+			}
+			ul.dbs[name], err = InitDB(name, cfg)
+			if err != nil {
+				logger.Entry().Errorf("InitDb() %s failed, err:%s", name, err)
+				return
+			}
+		}
+		if err = checkSchema(ctx, ul.dbs); err != nil {
+			logger.Entry().Errorf("checkSchema() failed, err:%s", err)
+			return
+		}
+		for name, dsns := range g.Config().Replica.Dsns { //只读从库, 连接池配置与主库一致
+			for i, dsn := range dsns {
+				cfg := &driver.MysqlConfig{}
+				if cfgs[name] != nil {
+					*cfg = *cfgs[name]
+				}
+				cfg.Dsn = dsn
+				db, e := InitDB(fmt.Sprintf("%s_replica_%d", name, i), cfg)
+				if e != nil { //从库不可用时不影响启动, 查询使用主库
+					logger.Entry().Errorf("init replica of %s failed, err:%s", name, e)
+					continue
+				}
+				ul.replicas[name] = append(ul.replicas[name], db)
+			}
+		}
 		ul.mgoclient, err = InitMongo(g.Config().MongoDb.ModId, g.Config().MongoDb.CmdId,
 			g.Config().MongoDb.DbName, g.Config().MongoDb.User, g.Config().MongoDb.Passwd)
 		if err != nil {
@@ -173,14 +379,64 @@ func (ul *DBUtil) Start() (err error) {
 	if err != nil {
 		return
 	}
+	go driver.RunDBStats(ul.ctx, time.Duration(g.Config().DBStatsInterval)*time.Second)
+	setSlowQueryOptions()
+	setValidationOptions()
+	setAggregateOptions()
+	rc := g.Config().Replica
+	opts := driver.ReplicaOptions{
+		MaxLag:         time.Duration(rc.MaxLag) * time.Second,
+		CheckInterval:  time.Duration(rc.CheckInterval) * time.Second,
+		HeartbeatTable: rc.HeartbeatTable,
+	}
+	driver.CmsDriver.Replicas = make(map[string]*driver.ReplicaSet)
+	for name, dbs := range ul.replicas {
+		if ul.dbs[name] == nil { //主库未配置时忽略从库
+			logger.Entry().Warnf("replicas of %s ignored, primary not configured", name)
+			for _, db := range dbs {
+				db.Close()
+			}
+			continue
+		}
+		rs := driver.NewReplicaSet(name, ul.dbs[name], dbs, opts)
+		driver.CmsDriver.Replicas[name] = rs
+		go rs.Run(ul.ctx)
+	}
 	dblogic.TkDriver = dblogic.NewTracksDriver(driver.CmsDriver)
 	dblogic.VoDriver = dblogic.NewVideosDriver(driver.CmsDriver)
+	dblogic.AlDriver = dblogic.NewAlbumsDriver(driver.CmsDriver)
+	dblogic.SgDriver = dblogic.NewSingersDriver(driver.CmsDriver)
+	dblogic.TkDriver.SetSoftDelete(g.Config().SoftDeleteOpen)
+	dblogic.VoDriver.SetSoftDelete(g.Config().SoftDeleteOpen)
+	dblogic.AlDriver.SetSoftDelete(g.Config().SoftDeleteOpen)
+	dblogic.SgDriver.SetSoftDelete(g.Config().SoftDeleteOpen)
+	dblogic.TkDriver.SetHistory(g.Config().HistoryOpen)
+	dblogic.VoDriver.SetHistory(g.Config().HistoryOpen)
+	dblogic.AlDriver.SetHistory(g.Config().HistoryOpen)
+	dblogic.SgDriver.SetHistory(g.Config().HistoryOpen)
+	dblogic.TkDriver.SetConfirmThresholds(g.Config().ConfirmThreshold, g.Config().ConfirmThresholds)
+	dblogic.VoDriver.SetConfirmThresholds(g.Config().ConfirmThreshold, g.Config().ConfirmThresholds)
+	dblogic.AlDriver.SetConfirmThresholds(g.Config().ConfirmThreshold, g.Config().ConfirmThresholds)
+	dblogic.SgDriver.SetConfirmThresholds(g.Config().ConfirmThreshold, g.Config().ConfirmThresholds)
+	dblogic.LyDriver = dblogic.NewLyricsDriver(driver.CmsDriver, dblogic.TkDriver)
+	go dblogic.LyDriver.RunLyricFlagRetry(ul.ctx)
+	if g.Config().SoftDeleteOpen && g.Config().TrashRetentionDays > 0 { //回收站过期清理
+		retention := time.Duration(g.Config().TrashRetentionDays) * 24 * time.Hour
+		go dblogic.TkDriver.RunTrashPurge(ul.ctx, retention)
+	}
 	dataplatform.DpDriver = dataplatform.NewDataplatformDriver(ul.ctx)
 	im.MgDriver = im.NewMongoDriver(driver.CmsDriver)
+	im.MgDriver.SetAudioCollection(g.Config().MongoDb.AudioCol)
 	ies.EsDriver = ul.esclient
 	ies7.EsDriver = ul.esclient7
 	go ies.EsDriver.Run()
 	go ies7.EsDriver.Run()
+	if err = ensureMongoIndexes(); err != nil { //strict模式下索引不一致时返回错误, 由调用方终止启动
+		return err
+	}
+	if g.Config().EsSync.Enabled { //mongo变更同步es
+		go im.MgDriver.NewEsSyncer(esSyncWriter(), esSyncOptions()).Run(ul.ctx)
+	}
 	return nil
 }
 
@@ -26,10 +26,17 @@ const (
 	ErrOther = iota + 402
 )
 
+const (
+	ErrConflict = 409 //乐观锁前置条件不满足
+	ErrConfirm  = 428 //批量写操作需携带确认token
+)
+
 var ErrMap = map[int]string{
 	ErrInnerServer: "Inner Server Error",
 	ErrParams:      "Parameters Error",
 	ErrOther:       "",
+	ErrConflict:    "Update Conflict",
+	ErrConfirm:     "Confirm Required",
 }
 
 //定义错误捕获处理
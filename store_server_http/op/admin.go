@@ -0,0 +1,120 @@
+package op
+
+import (
+	"fmt"
+
+	"github.com/store_server/dbtools/dblogic"
+	"github.com/store_server/dbtools/driver"
+	m "github.com/store_server/dbtools/models"
+	"github.com/store_server/dbtools/mongo"
+	"github.com/store_server/logger"
+	"github.com/store_server/store_server_http/g"
+	"github.com/store_server/store_server_http/kits"
+)
+
+/************************ 慢查询相关 ***************************/
+//query slow queries response, queries按耗时倒序, total为累计慢查询数(含已被淘汰的记录)
+type QuerySlowQueriesRsp struct {
+	Queries []*driver.SlowQuery `json:"queries"`
+	Total   int64               `json:"total"`
+}
+
+func SlowQueriesQuery(limit int) (rsp *kits.WrapRsp, err error) {
+	defer kits.CatchErr("http.SlowQueriesQuery", &err, logger.Entry())
+	ret := QuerySlowQueriesRsp{}
+	ret.Queries, ret.Total = driver.SlowQueries(limit)
+	rsp = kits.APIWrapRsp(0, "ok", ret)
+	return
+}
+
+func SlowQueriesReset() (rsp *kits.WrapRsp, err error) {
+	defer kits.CatchErr("http.SlowQueriesReset", &err, logger.Entry())
+	driver.ResetSlowQueries()
+	rsp = kits.APIWrapRsp(0, "ok", nil)
+	return
+}
+
+/************************ mongo索引相关 ***************************/
+//query mongo indexes response, 每个集合声明的索引、实际索引及差异
+type QueryMongoIndexesRsp struct {
+	Collections  []*mongo.IndexReport `json:"collections"`
+	Inconsistent bool                 `json:"inconsistent"`
+}
+
+func MongoIndexesQuery() (rsp *kits.WrapRsp, err error) {
+	defer kits.CatchErr("http.MongoIndexesQuery", &err, logger.Entry())
+	ret := QueryMongoIndexesRsp{}
+	ret.Collections, err = mongo.MgDriver.IndexReports()
+	if err != nil {
+		logger.Entry().Errorf("query mongo indexes error: %v", err)
+		rsp = kits.APIWrapRsp(kits.ErrOther, err.Error(), ret)
+		return
+	}
+	ret.Inconsistent = mongo.IndexesInconsistent(ret.Collections)
+	rsp = kits.APIWrapRsp(0, "ok", ret)
+	return
+}
+
+/************************ 原生写sql相关 ***************************/
+//exec raw sql request, rawSql为table上的单条update/insert/delete语句, update/delete须带where条件,
+//预演或影响行数超过阈值时返回confirm, 携带confirmToken重新请求后执行
+type ExecRawSqlReq struct {
+	dblogic.OpInfo
+	dblogic.WriteConfirm
+	Table  string `json:"table"`
+	RawSql string `json:"rawSql"`
+}
+
+//exec raw sql response, 预演或需确认时confirm为预演结果
+type ExecRawSqlRsp struct {
+	Affected int64                         `json:"affected,omitempty"`
+	Confirm  *dblogic.ConfirmRequiredError `json:"confirm,omitempty"`
+}
+
+func RawSqlExec(req *ExecRawSqlReq) (rsp *kits.WrapRsp, err error) {
+	defer kits.CatchErr("http.RawSqlExec", &err, logger.Entry())
+	ret := ExecRawSqlRsp{}
+	if !g.Config().RawSqlOpen {
+		rsp = kits.APIWrapRsp(kits.ErrParams, errRawSqlDisabled, ret)
+		return
+	}
+	if len(req.RawSql) == 0 {
+		rsp = kits.APIWrapRsp(kits.ErrParams, "rawSql is empty", ret)
+		return
+	}
+	confirm := &req.WriteConfirm
+	switch req.Table {
+	case "t_track":
+		ret.Affected, err = dblogic.TkDriver.WithConfirm(confirm).ExecRawUpdateOrInsertOrDeleteSql(req.RawSql, &m.Track{})
+	case "t_track_extra_os":
+		ret.Affected, err = dblogic.TkDriver.WithConfirm(confirm).ExecRawUpdateOrInsertOrDeleteSql(req.RawSql, &m.TrackExtraOs{})
+	case "t_video":
+		ret.Affected, err = dblogic.VoDriver.WithConfirm(confirm).ExecRawUpdateOrInsertOrDeleteSql(req.RawSql, &m.Video{})
+	case "t_video_extra_os":
+		ret.Affected, err = dblogic.VoDriver.WithConfirm(confirm).ExecRawUpdateOrInsertOrDeleteSql(req.RawSql, &m.VideoExtraOs{})
+	case "t_album":
+		ret.Affected, err = dblogic.AlDriver.WithConfirm(confirm).ExecRawUpdateOrInsertOrDeleteSql(req.RawSql, &m.Album{})
+	case "t_singer":
+		ret.Affected, err = dblogic.SgDriver.WithConfirm(confirm).ExecRawUpdateOrInsertOrDeleteSql(req.RawSql, &m.Singer{})
+	default:
+		rsp = kits.APIWrapRsp(kits.ErrParams, fmt.Sprintf("table %s not support raw sql", req.Table), ret)
+		return
+	}
+	if r, ok := writeConfirmRsp(err, &ret.Confirm, &ret); ok {
+		rsp = r
+		return
+	}
+	if dblogic.IsRawSqlError(err) {
+		rsp = kits.APIWrapRsp(kits.ErrParams, err.Error(), ret)
+		return
+	}
+	if err != nil {
+		logger.Entry().Errorf("exec raw sql error: %v|request: %v", err, *req)
+		rsp = kits.APIWrapRsp(kits.ErrOther, err.Error(), ret)
+		return
+	}
+	logger.Entry().Infof("exec raw sql|operator: %s|requestId: %s|table: %s|affected: %d|sql: %s",
+		req.Operator, req.RequestId, req.Table, ret.Affected, req.RawSql)
+	rsp = kits.APIWrapRsp(0, "ok", ret)
+	return
+}
@@ -0,0 +1,190 @@
+package op
+
+import (
+	"fmt"
+
+	"github.com/store_server/dbtools/dblogic"
+	"github.com/store_server/dbtools/driver"
+	m "github.com/store_server/dbtools/models"
+	"github.com/store_server/logger"
+	"github.com/store_server/store_server_http/g"
+	"github.com/store_server/store_server_http/kits"
+)
+
+/************************ 专辑查询相关 ***************************/
+//query album request
+type QueryAlbumReq struct {
+	RawSql   string                 `json:"rawSql"`
+	Query    *dblogic.QueryDSL      `json:"query,omitempty"`
+	Ids      []int64                `json:"ids"`
+	Page     int64                  `json:"page,omitempty"`
+	PageSize int64                  `json:"pageSize,omitempty"`
+	Fields   map[string]interface{} `json:"fields,omitempty"`
+	Count    dblogic.CountMode      `json:"count,omitempty"`
+	Select   []string               `json:"select,omitempty"` //投影字段(gorm column), 为空时返回所有字段
+
+	//读己之写, 为true时查询主库, 用于写入后立即读取
+	ReadYourWrites bool `json:"readYourWrites,omitempty"`
+	//查询来源, 由http层设置, 用于慢查询记录
+	Trace *driver.QueryTrace `json:"-"`
+}
+
+//query album response, 指定select时albums仅包含投影字段
+type QueryAlbumRsp struct {
+	Albums interface{} `json:"albums"`
+	Total  int64       `json:"total,omitempty"`
+}
+
+func AlbumsQuery(req *QueryAlbumReq) (rsp *kits.WrapRsp, err error) {
+	defer kits.CatchErr("http.AlbumsQuery", &err, logger.Entry())
+	ret := QueryAlbumRsp{}
+	var albums []*m.Album
+	if _, err = dblogic.SelectColumns(&m.Album{}, req.Select); err != nil {
+		rsp = kits.APIWrapRsp(kits.ErrParams, err.Error(), ret)
+		return
+	}
+	ad := dblogic.AlDriver.WithFields(req.Select).WithPrimary(req.ReadYourWrites).WithTrace(req.Trace)
+	if len(req.RawSql) != 0 {
+		if !g.Config().RawSqlOpen {
+			rsp = kits.APIWrapRsp(kits.ErrParams, errRawSqlDisabled, ret)
+			return
+		}
+		albums, ret.Total, err = ad.ExecRawQuerySql4Album(req.RawSql, req.Page, req.PageSize, req.Count)
+	} else if req.Query != nil {
+		albums, ret.Total, err = ad.GetAlbumsByQuery(req.Query, req.Page, req.PageSize, req.Count)
+	} else if len(req.Ids) != 0 && req.Ids[0] != 0 {
+		albums, ret.Total, err = ad.GetAlbumsByIds(req.Ids)
+	} else {
+		if len(req.Fields) == 0 && req.Page == 0 && req.PageSize == 0 {
+			logger.Entry().Errorf("query albums fields conditions is nil")
+			rsp = kits.APIWrapRsp(kits.ErrOther, "query albums fields conditions is invalid", ret)
+			return
+		}
+		albums, ret.Total, err = ad.GetAlbumsByCondition(req.Fields, req.Page, req.PageSize, req.Count)
+	}
+	if err != nil {
+		logger.Entry().Errorf("query albums error: %v|request: %v", err, *req)
+		ret.Total = 0
+		rsp = kits.APIWrapRsp(kits.ErrOther, err.Error(), ret)
+		return
+	}
+	if len(req.Select) != 0 { //仅返回投影字段
+		ret.Albums = dblogic.TrimFields(albums, req.Select)
+	} else {
+		ret.Albums = albums
+	}
+	rsp = kits.APIWrapRsp(0, "ok", ret)
+	return
+}
+
+/************************ 专辑更新相关 ***************************/
+//update album request, precondition为可选的乐观锁条件(期望的Fversion或Fmodify_time),
+//dryRun为true时仅预演, 影响行数超过阈值时需携带预演返回的confirmToken
+type UpdateAlbumReq struct {
+	dblogic.OpInfo
+	dblogic.WriteConfirm
+	Ids     []int64                `json:"ids"`
+	Conds   map[string]interface{} `json:"conditions,omitempty"`
+	Fields  map[string]interface{} `json:"updateFields,omitempty"`
+	Precond *dblogic.UpdatePrecond `json:"precondition,omitempty"`
+}
+
+//update album response, 冲突时current为当前记录, 预演或需确认时confirm为预演结果
+type UpdateAlbumRsp struct {
+	Affected int64                         `json:"affected,omitempty"`
+	Current  interface{}                   `json:"current,omitempty"`
+	Confirm  *dblogic.ConfirmRequiredError `json:"confirm,omitempty"`
+}
+
+func AlbumsUpdate(req *UpdateAlbumReq) (rsp *kits.WrapRsp, err error) {
+	defer kits.CatchErr("http.AlbumsUpdate", &err, logger.Entry())
+	ret := UpdateAlbumRsp{}
+	ad := dblogic.AlDriver.WithOp(&req.OpInfo).WithConfirm(&req.WriteConfirm)
+	ret.Affected, err = ad.UpdateAlbumsAttr(req.Ids, req.Conds, req.Fields, req.Precond)
+	if r, ok := writeConfirmRsp(err, &ret.Confirm, &ret); ok {
+		rsp = r
+		return
+	}
+	if ce, ok := err.(*dblogic.ConflictError); ok {
+		logger.Entry().Warnf("update albums conflict|request: %v", *req)
+		ret.Current = ce.Current
+		rsp = kits.APIWrapRsp(kits.ErrConflict, err.Error(), ret)
+		return
+	}
+	if err != nil {
+		logger.Entry().Errorf("update albums error: %v|request: %v", err, *req)
+		rsp = kits.APIWrapRsp(kits.ErrOther, err.Error(), ret)
+		return
+	}
+	rsp = kits.APIWrapRsp(0, "ok", ret)
+	return
+}
+
+/************************ 专辑插入相关 ***************************/
+//insert album request, policy为主键冲突策略(skip/overwrite/fail, 默认fail)
+type InsertAlbumReq struct {
+	dblogic.OpInfo
+	Albums    []*m.Album `json:"albums"`
+	Policy    string     `json:"policy,omitempty"`
+	ChunkSize int        `json:"chunkSize,omitempty"`
+}
+
+//insert album response
+type InsertAlbumRsp struct {
+	BatchInsertRsp
+}
+
+func AlbumsInsert(req *InsertAlbumReq) (rsp *kits.WrapRsp, err error) {
+	defer kits.CatchErr("http.AlbumsInsert", &err, logger.Entry())
+	ret := InsertAlbumRsp{}
+	if len(req.Albums) == 0 {
+		rsp = kits.APIWrapRsp(kits.ErrParams, "albums needed", ret)
+		return
+	}
+	opts := dblogic.BatchOptions{Policy: req.Policy, ChunkSize: req.ChunkSize}
+	ret.Results, err = dblogic.AlDriver.WithOp(&req.OpInfo).BatchUpsertAlbums(req.Albums, opts)
+	if err != nil {
+		logger.Entry().Errorf("insert albums error: %v|request: %v", err, *req)
+		rsp = kits.APIWrapRsp(kits.ErrOther, err.Error(), ret)
+		return
+	}
+	ret.summarize()
+	if ret.Failed != 0 {
+		rsp = kits.APIWrapRsp(kits.ErrOther, fmt.Sprintf("%d rows insert failed", ret.Failed), ret)
+		return
+	}
+	rsp = kits.APIWrapRsp(0, "ok", ret)
+	return
+}
+
+/************************ 专辑删除相关 ***************************/
+//delete album request, 影响行数超过阈值时需携带confirmToken
+type DeleteAlbumReq struct {
+	dblogic.OpInfo
+	dblogic.WriteConfirm
+	Ids   []int64                `json:"ids"`
+	Conds map[string]interface{} `json:"conditions,omitempty"`
+}
+
+//delete album response
+type DeleteAlbumRsp struct {
+	Affected int64                         `json:"affected,omitempty"`
+	Confirm  *dblogic.ConfirmRequiredError `json:"confirm,omitempty"`
+}
+
+func AlbumsDelete(req *DeleteAlbumReq) (rsp *kits.WrapRsp, err error) {
+	defer kits.CatchErr("http.AlbumsDelete", &err, logger.Entry())
+	ret := DeleteAlbumRsp{}
+	ret.Affected, err = dblogic.AlDriver.WithOp(&req.OpInfo).WithConfirm(&req.WriteConfirm).DeleteAlbums(req.Ids, req.Conds)
+	if r, ok := writeConfirmRsp(err, &ret.Confirm, &ret); ok {
+		rsp = r
+		return
+	}
+	if err != nil {
+		logger.Entry().Errorf("delete albums error: %v|request: %v", err, *req)
+		rsp = kits.APIWrapRsp(kits.ErrOther, err.Error(), ret)
+		return
+	}
+	rsp = kits.APIWrapRsp(0, "ok", ret)
+	return
+}
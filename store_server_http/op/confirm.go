@@ -0,0 +1,20 @@
+package op
+
+import (
+	"github.com/store_server/dbtools/dblogic"
+	"github.com/store_server/store_server_http/kits"
+)
+
+/************************ 写操作预演及确认相关 ***************************/
+//预演或需确认时写入confirm并返回ErrConfirm, token无效时返回ErrConflict; ret需为响应指针,
+//handled为false时err不是预演/确认错误, 由调用方继续处理
+func writeConfirmRsp(err error, confirm **dblogic.ConfirmRequiredError, ret interface{}) (*kits.WrapRsp, bool) {
+	if ce, ok := err.(*dblogic.ConfirmRequiredError); ok {
+		*confirm = ce
+		return kits.APIWrapRsp(kits.ErrConfirm, err.Error(), ret), true
+	}
+	if err == dblogic.ErrConfirmToken {
+		return kits.APIWrapRsp(kits.ErrConflict, err.Error(), ret), true
+	}
+	return nil, false
+}
@@ -0,0 +1,165 @@
+package op
+
+import (
+	"fmt"
+
+	"github.com/store_server/dbtools/dblogic"
+	m "github.com/store_server/dbtools/models"
+	"github.com/store_server/logger"
+	"github.com/store_server/store_server_http/kits"
+)
+
+const (
+	maxLyricQueryIds = 200
+)
+
+/************************ 歌词查询相关 ***************************/
+//query lyric request, 按trackIds批量查询, 指定地区无歌词时返回默认地区歌词;
+//version不为0时查询单曲的指定版本
+type QueryLyricReq struct {
+	TrackIds []int64 `json:"trackIds"`
+	Region   int64   `json:"region"`
+	Karaoke  bool    `json:"karaoke,omitempty"` //逐字歌词
+	Version  int64   `json:"version,omitempty"`
+
+	//读己之写, 为true时查询主库, 用于写入后立即读取
+	ReadYourWrites bool `json:"readYourWrites,omitempty"`
+}
+
+//query lyric response, 查询指定版本时lyrics为空, version为版本记录
+type QueryLyricRsp struct {
+	Lyrics  []*m.Lyric      `json:"lyrics,omitempty"`
+	Version *m.LyricVersion `json:"version,omitempty"`
+}
+
+func LyricsQuery(req *QueryLyricReq) (rsp *kits.WrapRsp, err error) {
+	defer kits.CatchErr("http.LyricsQuery", &err, logger.Entry())
+	ret := QueryLyricRsp{}
+	if len(req.TrackIds) == 0 || len(req.TrackIds) > maxLyricQueryIds {
+		rsp = kits.APIWrapRsp(kits.ErrParams, fmt.Sprintf("trackIds count should be 1~%d", maxLyricQueryIds), ret)
+		return
+	}
+	if req.Version != 0 {
+		if len(req.TrackIds) != 1 {
+			rsp = kits.APIWrapRsp(kits.ErrParams, "only one track id allowed when query version", ret)
+			return
+		}
+		ret.Version, err = dblogic.LyDriver.WithPrimary(req.ReadYourWrites).GetLyricVersion(req.TrackIds[0], req.Region, req.Version, req.Karaoke)
+	} else {
+		ret.Lyrics, err = dblogic.LyDriver.WithPrimary(req.ReadYourWrites).GetLyrics(req.TrackIds, req.Region, req.Karaoke)
+	}
+	if err != nil {
+		logger.Entry().Errorf("query lyrics error: %v|request: %v", err, *req)
+		rsp = kits.APIWrapRsp(kits.ErrOther, err.Error(), ret)
+		return
+	}
+	rsp = kits.APIWrapRsp(0, "ok", ret)
+	return
+}
+
+//query lyric versions request
+type QueryLyricVersionsReq struct {
+	TrackId     int64 `json:"trackId"`
+	Region      int64 `json:"region"`
+	Karaoke     bool  `json:"karaoke,omitempty"`
+	WithContent bool  `json:"withContent,omitempty"` //是否返回歌词内容
+
+	//读己之写, 为true时查询主库, 用于写入后立即读取
+	ReadYourWrites bool `json:"readYourWrites,omitempty"`
+}
+
+//query lyric versions response, 按版本号倒序
+type QueryLyricVersionsRsp struct {
+	Versions []*m.LyricVersion `json:"versions"`
+}
+
+func LyricVersionsQuery(req *QueryLyricVersionsReq) (rsp *kits.WrapRsp, err error) {
+	defer kits.CatchErr("http.LyricVersionsQuery", &err, logger.Entry())
+	ret := QueryLyricVersionsRsp{}
+	if req.TrackId <= 0 {
+		rsp = kits.APIWrapRsp(kits.ErrParams, "trackId is invalid", ret)
+		return
+	}
+	ret.Versions, err = dblogic.LyDriver.WithPrimary(req.ReadYourWrites).GetLyricVersions(req.TrackId, req.Region, req.Karaoke, req.WithContent)
+	if err != nil {
+		logger.Entry().Errorf("query lyric versions error: %v|request: %v", err, *req)
+		rsp = kits.APIWrapRsp(kits.ErrOther, err.Error(), ret)
+		return
+	}
+	rsp = kits.APIWrapRsp(0, "ok", ret)
+	return
+}
+
+/************************ 歌词上传相关 ***************************/
+//upload lyric request, lyric需指定Ftrack_id、Fregion、Fformat(lrc/plain/karaoke)及Fcontent;
+//version不为空时为期望的当前版本号(无歌词时为0), 不一致时返回冲突, 歌词不存在时返回参数错误
+type UploadLyricReq struct {
+	dblogic.OpInfo
+	Lyric   *m.Lyric `json:"lyric"`
+	Version *int64   `json:"version,omitempty"`
+}
+
+//upload lyric response, 冲突时current为当前歌词
+type UploadLyricRsp struct {
+	Lyric   *m.Lyric    `json:"lyric,omitempty"`
+	Current interface{} `json:"current,omitempty"`
+}
+
+func LyricsUpload(req *UploadLyricReq) (rsp *kits.WrapRsp, err error) {
+	defer kits.CatchErr("http.LyricsUpload", &err, logger.Entry())
+	ret := UploadLyricRsp{}
+	if req.Lyric == nil || req.Lyric.FtrackId <= 0 {
+		rsp = kits.APIWrapRsp(kits.ErrParams, "lyric or track id is invalid", ret)
+		return
+	}
+	ret.Lyric, err = dblogic.LyDriver.WithOp(&req.OpInfo).UploadLyric(req.Lyric, req.Version)
+	if dblogic.IsLyricFormatError(err) || err == dblogic.ErrLyricNotFound {
+		rsp = kits.APIWrapRsp(kits.ErrParams, err.Error(), ret)
+		return
+	}
+	if ce, ok := err.(*dblogic.ConflictError); ok {
+		logger.Entry().Warnf("upload lyric conflict|trackId: %d|region: %d", req.Lyric.FtrackId, req.Lyric.Fregion)
+		ret.Lyric, ret.Current = nil, ce.Current
+		rsp = kits.APIWrapRsp(kits.ErrConflict, err.Error(), ret)
+		return
+	}
+	if err != nil {
+		logger.Entry().Errorf("upload lyric error: %v|trackId: %d|region: %d|format: %s", err,
+			req.Lyric.FtrackId, req.Lyric.Fregion, req.Lyric.Fformat)
+		rsp = kits.APIWrapRsp(kits.ErrOther, err.Error(), ret)
+		return
+	}
+	rsp = kits.APIWrapRsp(0, "ok", ret)
+	return
+}
+
+/************************ 歌词删除相关 ***************************/
+//delete lyric request, 仅删除当前歌词, 版本记录保留并追加删除版本
+type DeleteLyricReq struct {
+	dblogic.OpInfo
+	TrackId int64 `json:"trackId"`
+	Region  int64 `json:"region"`
+	Karaoke bool  `json:"karaoke,omitempty"`
+}
+
+//delete lyric response
+type DeleteLyricRsp struct {
+	Deleted bool `json:"deleted"`
+}
+
+func LyricsDelete(req *DeleteLyricReq) (rsp *kits.WrapRsp, err error) {
+	defer kits.CatchErr("http.LyricsDelete", &err, logger.Entry())
+	ret := DeleteLyricRsp{}
+	if req.TrackId <= 0 {
+		rsp = kits.APIWrapRsp(kits.ErrParams, "trackId is invalid", ret)
+		return
+	}
+	ret.Deleted, err = dblogic.LyDriver.WithOp(&req.OpInfo).DeleteLyric(req.TrackId, req.Region, req.Karaoke)
+	if err != nil {
+		logger.Entry().Errorf("delete lyric error: %v|request: %v", err, *req)
+		rsp = kits.APIWrapRsp(kits.ErrOther, err.Error(), ret)
+		return
+	}
+	rsp = kits.APIWrapRsp(0, "ok", ret)
+	return
+}
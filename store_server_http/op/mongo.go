@@ -1,10 +1,13 @@
 package op
 
 import (
+	"encoding/json"
+
 	m "github.com/store_server/dbtools/models"
 	"github.com/store_server/dbtools/mongo"
 	"github.com/store_server/logger"
 	"github.com/store_server/store_server_http/kits"
+	"go.mongodb.org/mongo-driver/bson"
 )
 
 /************************ ExternalResources查询相关 ***************************/
@@ -129,3 +132,219 @@ func ExternalResourcesDelete(req *DeleteExternalResourcesReq) (rsp *kits.WrapRsp
 	rsp = kits.APIWrapRsp(0, "ok", ret)
 	return
 }
+
+/************************ PreviewAudio查询相关 ***************************/
+//query preview audio request, 按id、uuid、trackId、innerFileId依次优先, 均为空时按filter分页查询
+type QueryPreviewAudioReq struct {
+	Id          int64                  `json:"id,omitempty"`
+	Uuid        string                 `json:"uuid,omitempty"`
+	TrackId     int64                  `json:"trackId,omitempty"`
+	InnerFileId string                 `json:"innerFileId,omitempty"`
+	Page        int64                  `json:"page,omitempty"`
+	PageSize    int64                  `json:"pageSize,omitempty"`
+	Filter      map[string]interface{} `json:"filter,omitempty"`
+}
+
+//query preview audio response
+type QueryPreviewAudioRsp struct {
+	PreviewAudio interface{} `json:"preview_audio"`
+}
+
+func PreviewAudioQuery(req *QueryPreviewAudioReq) (rsp *kits.WrapRsp, err error) {
+	defer kits.CatchErr("http.PreviewAudioQuery", &err, logger.Entry())
+	ret := QueryPreviewAudioRsp{}
+	var pas interface{}
+	switch {
+	case req.Id != 0:
+		pas, err = mongo.MgDriver.GetPreviewAudioById(req.Id)
+	case len(req.Uuid) != 0:
+		pas, err = mongo.MgDriver.GetPreviewAudioByUuid(req.Uuid)
+	case req.TrackId != 0:
+		pas, err = mongo.MgDriver.GetPreviewAudioByTrackId(req.TrackId)
+	case len(req.InnerFileId) != 0:
+		pas, err = mongo.MgDriver.GetPreviewAudioByInnerFileId(req.InnerFileId)
+	default: //others query condition
+		if len(req.Filter) == 0 && req.Page == 0 && req.PageSize == 0 {
+			logger.Entry().Errorf("query preview audio filter conditions is invalid")
+			rsp = kits.APIWrapRsp(kits.ErrParams, "query preview audio filter conditions is invalid", ret)
+			return
+		}
+		pas, err = mongo.MgDriver.GetManyPreviewAudio(req.Filter, req.Page, req.PageSize)
+	}
+	if err != nil {
+		logger.Entry().Errorf("query preview audio error: %v|request: %v", err, *req)
+		rsp = kits.APIWrapRsp(kits.ErrOther, err.Error(), ret)
+		return
+	}
+	ret.PreviewAudio = pas
+	rsp = kits.APIWrapRsp(0, "ok", ret)
+	return
+}
+
+/************************ PreviewAudio更新相关 ***************************/
+//update preview audio request, encode_stat需通过转码状态接口变更
+type UpdatePreviewAudioReq struct {
+	Id     int64                  `json:"id"`
+	Conds  map[string]interface{} `json:"condition,omitempty"`
+	Fields map[string]interface{} `json:"updateDoc,omitempty"`
+}
+
+//update preview audio response
+type UpdatePreviewAudioRsp struct {
+	Affected int64 `json:"affected,omitempty"`
+}
+
+func PreviewAudioUpdate(req *UpdatePreviewAudioReq) (rsp *kits.WrapRsp, err error) {
+	defer kits.CatchErr("http.PreviewAudioUpdate", &err, logger.Entry())
+	ret := UpdatePreviewAudioRsp{}
+	if len(req.Fields) == 0 || (req.Id == 0 && len(req.Conds) == 0) {
+		rsp = kits.APIWrapRsp(kits.ErrParams, "update preview audio conditions or fields is empty", ret)
+		return
+	}
+	if req.Id != 0 {
+		err = mongo.MgDriver.UpdatePreviewAudioById(req.Id, req.Fields)
+	} else {
+		err = mongo.MgDriver.UpdatePreviewAudio(req.Conds, req.Fields)
+	}
+	if err != nil {
+		logger.Entry().Errorf("update preview audio error: %v|request: %v", err, *req)
+		rsp = kits.APIWrapRsp(kits.ErrOther, err.Error(), ret)
+		return
+	}
+	rsp = kits.APIWrapRsp(0, "ok", ret)
+	return
+}
+
+//transit preview audio encode status request, updateDoc为同时更新的字段(如dst_path、download_url)
+type TransitEncodeStatReq struct {
+	Id         int64                  `json:"id"`
+	EncodeStat int                    `json:"encodeStat"`
+	Fields     map[string]interface{} `json:"updateDoc,omitempty"`
+}
+
+//transit preview audio encode status response
+type TransitEncodeStatRsp struct {
+	PreviewAudio *m.PreviewAudio `json:"preview_audio,omitempty"`
+}
+
+func PreviewAudioEncodeStatTransit(req *TransitEncodeStatReq) (rsp *kits.WrapRsp, err error) {
+	defer kits.CatchErr("http.PreviewAudioEncodeStatTransit", &err, logger.Entry())
+	ret := TransitEncodeStatRsp{}
+	if req.Id == 0 {
+		rsp = kits.APIWrapRsp(kits.ErrParams, "preview audio id is empty", ret)
+		return
+	}
+	ret.PreviewAudio, err = mongo.MgDriver.TransitPreviewAudioEncodeStat(req.Id, req.EncodeStat, req.Fields)
+	if _, ok := err.(*mongo.EncodeStatError); ok || err == mongo.ErrEncodeStatChanged {
+		logger.Entry().Warnf("transit preview audio encode stat conflict: %v|request: %v", err, *req)
+		rsp = kits.APIWrapRsp(kits.ErrConflict, err.Error(), ret)
+		return
+	}
+	if err != nil {
+		logger.Entry().Errorf("transit preview audio encode stat error: %v|request: %v", err, *req)
+		rsp = kits.APIWrapRsp(kits.ErrOther, err.Error(), ret)
+		return
+	}
+	rsp = kits.APIWrapRsp(0, "ok", ret)
+	return
+}
+
+/************************ PreviewAudio创建相关 ***************************/
+//insert preview audio request
+type InsertPreviewAudioReq struct {
+	PreviewAudio *m.PreviewAudio `json:"previewAudio"`
+}
+
+//insert preview audio response
+type InsertPreviewAudioRsp struct {
+	Id int64 `json:"id"`
+}
+
+func PreviewAudioInsert(req *InsertPreviewAudioReq) (rsp *kits.WrapRsp, err error) {
+	defer kits.CatchErr("http.PreviewAudioInsert", &err, logger.Entry())
+	ret := InsertPreviewAudioRsp{-1}
+	if req.PreviewAudio == nil {
+		rsp = kits.APIWrapRsp(kits.ErrParams, "preview audio is empty", ret)
+		return
+	}
+	var id int64
+	id, err = mongo.MgDriver.InsertPreviewAudio(req.PreviewAudio)
+	if err != nil {
+		logger.Entry().Errorf("insert preview audio error: %v|request: %v", err, *req)
+		rsp = kits.APIWrapRsp(kits.ErrOther, err.Error(), ret)
+		return
+	}
+	ret.Id = id
+	rsp = kits.APIWrapRsp(0, "ok", ret)
+	return
+}
+
+/************************ PreviewAudio删除相关 ***************************/
+//delete preview audio request
+type DeletePreviewAudioReq struct {
+	Id    int64                  `json:"id"`
+	Conds map[string]interface{} `json:"condition,omitempty"`
+}
+
+//delete preview audio response
+type DeletePreviewAudioRsp struct {
+	Affected int64 `json:"affected,omitempty"`
+}
+
+func PreviewAudioDelete(req *DeletePreviewAudioReq) (rsp *kits.WrapRsp, err error) {
+	defer kits.CatchErr("http.PreviewAudioDelete", &err, logger.Entry())
+	ret := DeletePreviewAudioRsp{}
+	if req.Id == 0 && len(req.Conds) == 0 {
+		rsp = kits.APIWrapRsp(kits.ErrParams, "delete preview audio conditions is empty", ret)
+		return
+	}
+	if req.Id != 0 {
+		err = mongo.MgDriver.DeletePreviewAudioById(req.Id)
+	} else {
+		err = mongo.MgDriver.DeletePreviewAudio(req.Conds)
+	}
+	if err != nil {
+		logger.Entry().Errorf("delete preview audio error: %v|request: %v", err, *req)
+		rsp = kits.APIWrapRsp(kits.ErrOther, err.Error(), ret)
+		return
+	}
+	rsp = kits.APIWrapRsp(0, "ok", ret)
+	return
+}
+
+/************************ 聚合查询相关 ***************************/
+//aggregate request, pipeline为扩展json格式的聚合管道, limit为最大返回文档数, 不能超过配置上限
+type AggregateReq struct {
+	Collection string          `json:"-"` //路由参数
+	Pipeline   json.RawMessage `json:"pipeline"`
+	Limit      int64           `json:"limit,omitempty"`
+}
+
+//执行聚合管道, 结果文档转换为扩展json(relaxed)后逐条交给fn输出; 返回的rsp仅在fn未被调用时有效
+func MongoAggregate(req *AggregateReq, fn func(doc []byte) error) (rsp *kits.WrapRsp, err error) {
+	defer kits.CatchErr("http.MongoAggregate", &err, logger.Entry())
+	pipeline, err := mongo.ParsePipeline(req.Pipeline)
+	if err != nil {
+		rsp = kits.APIWrapRsp(kits.ErrParams, err.Error(), nil)
+		return
+	}
+	err = mongo.MgDriver.Aggregate(req.Collection, pipeline, req.Limit, func(doc bson.Raw) error {
+		data, err := bson.MarshalExtJSON(doc, false, false)
+		if err != nil {
+			return err
+		}
+		return fn(data)
+	})
+	if pe, ok := err.(*mongo.PipelineError); ok {
+		logger.Entry().Warnf("aggregate pipeline rejected: %v|collection: %s", err, req.Collection)
+		rsp = kits.APIWrapRsp(kits.ErrParams, err.Error(), pe)
+		return
+	}
+	if err != nil {
+		logger.Entry().Errorf("aggregate error: %v|collection: %s|pipeline: %s", err, req.Collection, req.Pipeline)
+		rsp = kits.APIWrapRsp(kits.ErrOther, err.Error(), nil)
+		return
+	}
+	rsp = kits.APIWrapRsp(0, "ok", nil)
+	return
+}
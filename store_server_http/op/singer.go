@@ -0,0 +1,305 @@
+package op
+
+import (
+	"fmt"
+
+	"github.com/store_server/dbtools/dblogic"
+	"github.com/store_server/dbtools/driver"
+	m "github.com/store_server/dbtools/models"
+	"github.com/store_server/logger"
+	"github.com/store_server/store_server_http/g"
+	"github.com/store_server/store_server_http/kits"
+)
+
+/************************ 艺人查询相关 ***************************/
+//query singer request
+type QuerySingerReq struct {
+	RawSql   string                 `json:"rawSql"`
+	Query    *dblogic.QueryDSL      `json:"query,omitempty"`
+	Ids      []int64                `json:"ids"`
+	Page     int64                  `json:"page,omitempty"`
+	PageSize int64                  `json:"pageSize,omitempty"`
+	Fields   map[string]interface{} `json:"fields,omitempty"`
+	Count    dblogic.CountMode      `json:"count,omitempty"`
+	Select   []string               `json:"select,omitempty"` //投影字段(gorm column), 为空时返回所有字段
+
+	//读己之写, 为true时查询主库, 用于写入后立即读取
+	ReadYourWrites bool `json:"readYourWrites,omitempty"`
+	//查询来源, 由http层设置, 用于慢查询记录
+	Trace *driver.QueryTrace `json:"-"`
+}
+
+//query singer response, 指定select时singers仅包含投影字段
+type QuerySingerRsp struct {
+	Singers interface{} `json:"singers"`
+	Total   int64       `json:"total,omitempty"`
+}
+
+func SingersQuery(req *QuerySingerReq) (rsp *kits.WrapRsp, err error) {
+	defer kits.CatchErr("http.SingersQuery", &err, logger.Entry())
+	ret := QuerySingerRsp{}
+	var singers []*m.Singer
+	if _, err = dblogic.SelectColumns(&m.Singer{}, req.Select); err != nil {
+		rsp = kits.APIWrapRsp(kits.ErrParams, err.Error(), ret)
+		return
+	}
+	sd := dblogic.SgDriver.WithFields(req.Select).WithPrimary(req.ReadYourWrites).WithTrace(req.Trace)
+	if len(req.RawSql) != 0 {
+		if !g.Config().RawSqlOpen {
+			rsp = kits.APIWrapRsp(kits.ErrParams, errRawSqlDisabled, ret)
+			return
+		}
+		singers, ret.Total, err = sd.ExecRawQuerySql4Singer(req.RawSql, req.Page, req.PageSize, req.Count)
+	} else if req.Query != nil {
+		singers, ret.Total, err = sd.GetSingersByQuery(req.Query, req.Page, req.PageSize, req.Count)
+	} else if len(req.Ids) != 0 && req.Ids[0] != 0 {
+		singers, ret.Total, err = sd.GetSingersByIds(req.Ids)
+	} else {
+		if len(req.Fields) == 0 && req.Page == 0 && req.PageSize == 0 {
+			logger.Entry().Errorf("query singers fields conditions is nil")
+			rsp = kits.APIWrapRsp(kits.ErrOther, "query singers fields conditions is invalid", ret)
+			return
+		}
+		singers, ret.Total, err = sd.GetSingersByCondition(req.Fields, req.Page, req.PageSize, req.Count)
+	}
+	if err != nil {
+		logger.Entry().Errorf("query singers error: %v|request: %v", err, *req)
+		ret.Total = 0
+		rsp = kits.APIWrapRsp(kits.ErrOther, err.Error(), ret)
+		return
+	}
+	if len(req.Select) != 0 { //仅返回投影字段
+		ret.Singers = dblogic.TrimFields(singers, req.Select)
+	} else {
+		ret.Singers = singers
+	}
+	rsp = kits.APIWrapRsp(0, "ok", ret)
+	return
+}
+
+//query singer alias request, singerIds与fields二选一
+type QuerySingerAliasReq struct {
+	SingerIds []int64                `json:"singerIds"`
+	Page      int64                  `json:"page,omitempty"`
+	PageSize  int64                  `json:"pageSize,omitempty"`
+	Fields    map[string]interface{} `json:"fields,omitempty"`
+	Count     dblogic.CountMode      `json:"count,omitempty"`
+
+	//读己之写, 为true时查询主库, 用于写入后立即读取
+	ReadYourWrites bool `json:"readYourWrites,omitempty"`
+}
+
+//query singer alias response
+type QuerySingerAliasRsp struct {
+	Aliases []*m.SingerAlias `json:"aliases"`
+	Total   int64            `json:"total,omitempty"`
+}
+
+func SingerAliasQuery(req *QuerySingerAliasReq) (rsp *kits.WrapRsp, err error) {
+	defer kits.CatchErr("http.SingerAliasQuery", &err, logger.Entry())
+	ret := QuerySingerAliasRsp{}
+	if len(req.SingerIds) != 0 {
+		ret.Aliases, err = dblogic.SgDriver.WithPrimary(req.ReadYourWrites).GetSingerAliases(req.SingerIds)
+		ret.Total = int64(len(ret.Aliases))
+	} else {
+		if len(req.Fields) == 0 && req.Page == 0 && req.PageSize == 0 {
+			logger.Entry().Errorf("query singer aliases fields conditions is nil")
+			rsp = kits.APIWrapRsp(kits.ErrOther, "query singer aliases fields conditions is invalid", ret)
+			return
+		}
+		ret.Aliases, ret.Total, err = dblogic.SgDriver.WithPrimary(req.ReadYourWrites).GetSingerAliasesByCondition(req.Fields, req.Page, req.PageSize, req.Count)
+	}
+	if err != nil {
+		logger.Entry().Errorf("query singer aliases error: %v|request: %v", err, *req)
+		ret.Total = 0
+		rsp = kits.APIWrapRsp(kits.ErrOther, err.Error(), ret)
+		return
+	}
+	rsp = kits.APIWrapRsp(0, "ok", ret)
+	return
+}
+
+/************************ 艺人更新相关 ***************************/
+//update singer request, precondition为可选的乐观锁条件(期望的Fversion或Fmodify_time),
+//dryRun为true时仅预演, 影响行数超过阈值时需携带预演返回的confirmToken
+type UpdateSingerReq struct {
+	dblogic.OpInfo
+	dblogic.WriteConfirm
+	Ids     []int64                `json:"ids"`
+	Conds   map[string]interface{} `json:"conditions,omitempty"`
+	Fields  map[string]interface{} `json:"updateFields,omitempty"`
+	Precond *dblogic.UpdatePrecond `json:"precondition,omitempty"`
+}
+
+//update singer response, 冲突时current为当前记录, 预演或需确认时confirm为预演结果
+type UpdateSingerRsp struct {
+	Affected int64                         `json:"affected,omitempty"`
+	Current  interface{}                   `json:"current,omitempty"`
+	Confirm  *dblogic.ConfirmRequiredError `json:"confirm,omitempty"`
+}
+
+func SingersUpdate(req *UpdateSingerReq) (rsp *kits.WrapRsp, err error) {
+	defer kits.CatchErr("http.SingersUpdate", &err, logger.Entry())
+	ret := UpdateSingerRsp{}
+	sd := dblogic.SgDriver.WithOp(&req.OpInfo).WithConfirm(&req.WriteConfirm)
+	ret.Affected, err = sd.UpdateSingersAttr(req.Ids, req.Conds, req.Fields, req.Precond)
+	if r, ok := writeConfirmRsp(err, &ret.Confirm, &ret); ok {
+		rsp = r
+		return
+	}
+	if ce, ok := err.(*dblogic.ConflictError); ok {
+		logger.Entry().Warnf("update singers conflict|request: %v", *req)
+		ret.Current = ce.Current
+		rsp = kits.APIWrapRsp(kits.ErrConflict, err.Error(), ret)
+		return
+	}
+	if err != nil {
+		logger.Entry().Errorf("update singers error: %v|request: %v", err, *req)
+		rsp = kits.APIWrapRsp(kits.ErrOther, err.Error(), ret)
+		return
+	}
+	rsp = kits.APIWrapRsp(0, "ok", ret)
+	return
+}
+
+//update singer alias request
+type UpdateSingerAliasReq struct {
+	dblogic.OpInfo
+	dblogic.WriteConfirm
+	Ids    []int64                `json:"ids"`
+	Conds  map[string]interface{} `json:"conditions,omitempty"`
+	Fields map[string]interface{} `json:"updateFields,omitempty"`
+}
+
+//update singer alias response
+type UpdateSingerAliasRsp struct {
+	Affected int64                         `json:"affected,omitempty"`
+	Confirm  *dblogic.ConfirmRequiredError `json:"confirm,omitempty"`
+}
+
+func SingerAliasUpdate(req *UpdateSingerAliasReq) (rsp *kits.WrapRsp, err error) {
+	defer kits.CatchErr("http.SingerAliasUpdate", &err, logger.Entry())
+	ret := UpdateSingerAliasRsp{}
+	sd := dblogic.SgDriver.WithOp(&req.OpInfo).WithConfirm(&req.WriteConfirm)
+	ret.Affected, err = sd.UpdateSingerAliasesAttr(req.Ids, req.Conds, req.Fields)
+	if r, ok := writeConfirmRsp(err, &ret.Confirm, &ret); ok {
+		rsp = r
+		return
+	}
+	if err != nil {
+		logger.Entry().Errorf("update singer aliases error: %v|request: %v", err, *req)
+		rsp = kits.APIWrapRsp(kits.ErrOther, err.Error(), ret)
+		return
+	}
+	rsp = kits.APIWrapRsp(0, "ok", ret)
+	return
+}
+
+/************************ 艺人插入相关 ***************************/
+//insert singer request, policy为主键冲突策略(skip/overwrite/fail, 默认fail)
+type InsertSingerReq struct {
+	dblogic.OpInfo
+	Singers   []*m.Singer      `json:"singers,omitempty"`
+	Aliases   []*m.SingerAlias `json:"aliases,omitempty"`
+	Policy    string           `json:"policy,omitempty"`
+	ChunkSize int              `json:"chunkSize,omitempty"`
+}
+
+//insert singer response
+type InsertSingerRsp struct {
+	BatchInsertRsp
+}
+
+func SingersInsert(req *InsertSingerReq) (rsp *kits.WrapRsp, err error) {
+	defer kits.CatchErr("http.SingersInsert", &err, logger.Entry())
+	ret := InsertSingerRsp{}
+	opts := dblogic.BatchOptions{Policy: req.Policy, ChunkSize: req.ChunkSize}
+	var table string
+	if len(req.Singers) != 0 {
+		ret.Results, err = dblogic.SgDriver.WithOp(&req.OpInfo).BatchUpsertSingers(req.Singers, opts)
+		table = "t_singer"
+	} else if len(req.Aliases) != 0 {
+		ret.Results, err = dblogic.SgDriver.WithOp(&req.OpInfo).BatchUpsertSingerAliases(req.Aliases, opts)
+		table = "t_singer_alias"
+	} else {
+		logger.Entry().Errorf("invalid insert params")
+		rsp = kits.APIWrapRsp(kits.ErrParams, "singers or aliases needed", ret)
+		return
+	}
+	if err != nil {
+		logger.Entry().Errorf("insert singers error: %v|table: %s|request: %v", err, table, *req)
+		rsp = kits.APIWrapRsp(kits.ErrOther, err.Error(), ret)
+		return
+	}
+	ret.summarize()
+	if ret.Failed != 0 {
+		rsp = kits.APIWrapRsp(kits.ErrOther, fmt.Sprintf("%d rows insert failed", ret.Failed), ret)
+		return
+	}
+	rsp = kits.APIWrapRsp(0, "ok", ret)
+	return
+}
+
+/************************ 艺人删除相关 ***************************/
+//delete singer request, 影响行数超过阈值时需携带confirmToken
+type DeleteSingerReq struct {
+	dblogic.OpInfo
+	dblogic.WriteConfirm
+	Ids   []int64                `json:"ids"`
+	Conds map[string]interface{} `json:"conditions,omitempty"`
+}
+
+//delete singer response
+type DeleteSingerRsp struct {
+	Affected int64                         `json:"affected,omitempty"`
+	Confirm  *dblogic.ConfirmRequiredError `json:"confirm,omitempty"`
+}
+
+func SingersDelete(req *DeleteSingerReq) (rsp *kits.WrapRsp, err error) {
+	defer kits.CatchErr("http.SingersDelete", &err, logger.Entry())
+	ret := DeleteSingerRsp{}
+	ret.Affected, err = dblogic.SgDriver.WithOp(&req.OpInfo).WithConfirm(&req.WriteConfirm).DeleteSingers(req.Ids, req.Conds)
+	if r, ok := writeConfirmRsp(err, &ret.Confirm, &ret); ok {
+		rsp = r
+		return
+	}
+	if err != nil {
+		logger.Entry().Errorf("delete singers error: %v|request: %v", err, *req)
+		rsp = kits.APIWrapRsp(kits.ErrOther, err.Error(), ret)
+		return
+	}
+	rsp = kits.APIWrapRsp(0, "ok", ret)
+	return
+}
+
+//delete singer alias request
+type DeleteSingerAliasReq struct {
+	dblogic.OpInfo
+	dblogic.WriteConfirm
+	Ids   []int64                `json:"ids"`
+	Conds map[string]interface{} `json:"conditions,omitempty"`
+}
+
+//delete singer alias response
+type DeleteSingerAliasRsp struct {
+	Affected int64                         `json:"affected,omitempty"`
+	Confirm  *dblogic.ConfirmRequiredError `json:"confirm,omitempty"`
+}
+
+func SingerAliasDelete(req *DeleteSingerAliasReq) (rsp *kits.WrapRsp, err error) {
+	defer kits.CatchErr("http.SingerAliasDelete", &err, logger.Entry())
+	ret := DeleteSingerAliasRsp{}
+	sd := dblogic.SgDriver.WithOp(&req.OpInfo).WithConfirm(&req.WriteConfirm)
+	ret.Affected, err = sd.DeleteSingerAliases(req.Ids, req.Conds)
+	if r, ok := writeConfirmRsp(err, &ret.Confirm, &ret); ok {
+		rsp = r
+		return
+	}
+	if err != nil {
+		logger.Entry().Errorf("delete singer aliases error: %v|request: %v", err, *req)
+		rsp = kits.APIWrapRsp(kits.ErrOther, err.Error(), ret)
+		return
+	}
+	rsp = kits.APIWrapRsp(0, "ok", ret)
+	return
+}
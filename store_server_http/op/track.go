@@ -1,43 +1,75 @@
 package op
 
 import (
+	"fmt"
+
 	"github.com/store_server/dbtools/dblogic"
+	"github.com/store_server/dbtools/driver"
 	m "github.com/store_server/dbtools/models"
+	"github.com/store_server/dbtools/mongo"
 	"github.com/store_server/logger"
+	"github.com/store_server/store_server_http/g"
 	"github.com/store_server/store_server_http/kits"
 )
 
+const (
+	errRawSqlDisabled = "raw sql is disabled, please use structured query instead"
+)
+
 /************************ 歌曲查询相关 ***************************/
-//query track request
+//query track request, cursorPage不为空时使用游标分页(可与query或fields条件组合)
 type QueryTrackReq struct {
-	RawSql   string                 `json:"rawSql"`
-	Ids      []int64                `json:"ids"`
-	Page     int64                  `json:"page,omitempty"`
-	PageSize int64                  `json:"pageSize,omitempty"`
-	Fields   map[string]interface{} `json:"fields,omitempty"`
-}
-
-//query track response
+	RawSql     string                 `json:"rawSql"`
+	Query      *dblogic.QueryDSL      `json:"query,omitempty"`
+	Ids        []int64                `json:"ids"`
+	Page       int64                  `json:"page,omitempty"`
+	PageSize   int64                  `json:"pageSize,omitempty"`
+	Fields     map[string]interface{} `json:"fields,omitempty"`
+	Count      dblogic.CountMode      `json:"count,omitempty"`
+	CursorPage *dblogic.CursorPage    `json:"cursorPage,omitempty"`
+	Select     []string               `json:"select,omitempty"` //投影字段(gorm column), 为空时返回所有字段
+
+	//读己之写, 为true时查询主库, 用于写入后立即读取
+	ReadYourWrites bool `json:"readYourWrites,omitempty"`
+	//查询来源, 由http层设置, 用于慢查询记录
+	Trace *driver.QueryTrace `json:"-"`
+}
+
+//query track response, 指定select时tracks仅包含投影字段
 type QueryTrackRsp struct {
-	Tracks []*m.Track `json:"tracks"`
-	Total  int64      `json:"total,omitempty"`
+	Tracks     interface{} `json:"tracks"`
+	Total      int64       `json:"total,omitempty"`
+	NextCursor string      `json:"next_cursor,omitempty"`
 }
 
 func TracksQuery(req *QueryTrackReq) (rsp *kits.WrapRsp, err error) {
 	defer kits.CatchErr("http.TracksQuery", &err, logger.Entry())
 	ret := QueryTrackRsp{}
 	var tracks []*m.Track
+	if _, err = dblogic.SelectColumns(&m.Track{}, req.Select); err != nil {
+		rsp = kits.APIWrapRsp(kits.ErrParams, err.Error(), ret)
+		return
+	}
+	td := dblogic.TkDriver.WithFields(req.Select).WithPrimary(req.ReadYourWrites).WithTrace(req.Trace)
 	if len(req.RawSql) != 0 {
-		tracks, ret.Total, err = dblogic.TkDriver.ExecRawQuerySql4Track(req.RawSql, req.Page, req.PageSize)
+		if !g.Config().RawSqlOpen {
+			rsp = kits.APIWrapRsp(kits.ErrParams, errRawSqlDisabled, ret)
+			return
+		}
+		tracks, ret.Total, err = td.ExecRawQuerySql4Track(req.RawSql, req.Page, req.PageSize, req.Count)
+	} else if req.CursorPage != nil {
+		tracks, ret.NextCursor, err = td.GetTracksByCursor(req.Query, req.Fields, req.CursorPage)
+	} else if req.Query != nil {
+		tracks, ret.Total, err = td.GetTracksByQuery(req.Query, req.Page, req.PageSize, req.Count)
 	} else if len(req.Ids) != 0 && req.Ids[0] != 0 {
-		tracks, ret.Total, err = dblogic.TkDriver.GetTracksByIds(req.Ids)
+		tracks, ret.Total, err = td.GetTracksByIds(req.Ids)
 	} else { //others query condition
 		if len(req.Fields) == 0 && req.Page == 0 && req.PageSize == 0 {
 			logger.Entry().Errorf("query tracks fields conditions is nil")
 			rsp = kits.APIWrapRsp(kits.ErrOther, "query tracks fields conditions is invalid", ret)
 			return
 		}
-		tracks, ret.Total, err = dblogic.TkDriver.GetTracksByCondition(req.Fields, req.Page, req.PageSize)
+		tracks, ret.Total, err = td.GetTracksByCondition(req.Fields, req.Page, req.PageSize, req.Count)
 	}
 	if err != nil {
 		logger.Entry().Errorf("query tracks error: %v|request: %v", err, *req)
@@ -45,7 +77,11 @@ func TracksQuery(req *QueryTrackReq) (rsp *kits.WrapRsp, err error) {
 		rsp = kits.APIWrapRsp(kits.ErrOther, err.Error(), ret)
 		return
 	}
-	ret.Tracks = tracks
+	if len(req.Select) != 0 { //仅返回投影字段
+		ret.Tracks = dblogic.TrimFields(tracks, req.Select)
+	} else {
+		ret.Tracks = tracks
+	}
 	rsp = kits.APIWrapRsp(0, "ok", ret)
 	return
 }
@@ -53,28 +89,47 @@ func TracksQuery(req *QueryTrackReq) (rsp *kits.WrapRsp, err error) {
 //query track extra os request
 type QueryTrackExtraOsReq struct {
 	RawSql   string                 `json:"rawSql"`
+	Query    *dblogic.QueryDSL      `json:"query,omitempty"`
 	Id       int64                  `json:"id"`
 	Region   int64                  `json:"region"`
 	Page     int64                  `json:"page,omitempty"`
 	PageSize int64                  `json:"pageSize,omitempty"`
 	Fields   map[string]interface{} `json:"fields,omitempty"`
+	Count    dblogic.CountMode      `json:"count,omitempty"`
+	Select   []string               `json:"select,omitempty"` //投影字段(gorm column), 为空时返回所有字段
+
+	//读己之写, 为true时查询主库, 用于写入后立即读取
+	ReadYourWrites bool `json:"readYourWrites,omitempty"`
+	//查询来源, 由http层设置, 用于慢查询记录
+	Trace *driver.QueryTrace `json:"-"`
 }
 
-//query track extra os response
+//query track extra os response, 指定select时trackExtraOs仅包含投影字段
 type QueryTrackExtraOsRsp struct {
-	Tracks []*m.TrackExtraOs `json:"trackExtraOs"`
-	Total  int64             `json:"total,omitempty"`
+	Tracks interface{} `json:"trackExtraOs"`
+	Total  int64       `json:"total,omitempty"`
 }
 
 func TrackExtraOsQuery(req *QueryTrackExtraOsReq) (rsp *kits.WrapRsp, err error) {
 	defer kits.CatchErr("http.TrackExtraOsQuery", &err, logger.Entry())
 	ret := QueryTrackExtraOsRsp{}
 	var tracks []*m.TrackExtraOs
+	if _, err = dblogic.SelectColumns(&m.TrackExtraOs{}, req.Select); err != nil {
+		rsp = kits.APIWrapRsp(kits.ErrParams, err.Error(), ret)
+		return
+	}
+	td := dblogic.TkDriver.WithFields(req.Select).WithPrimary(req.ReadYourWrites).WithTrace(req.Trace)
 	if len(req.RawSql) != 0 {
-		tracks, ret.Total, err = dblogic.TkDriver.ExecRawQuerySql4TrackExtraOs(req.RawSql, req.Page, req.PageSize)
+		if !g.Config().RawSqlOpen {
+			rsp = kits.APIWrapRsp(kits.ErrParams, errRawSqlDisabled, ret)
+			return
+		}
+		tracks, ret.Total, err = td.ExecRawQuerySql4TrackExtraOs(req.RawSql, req.Page, req.PageSize, req.Count)
+	} else if req.Query != nil {
+		tracks, ret.Total, err = td.GetTrackExtraOsByQuery(req.Query, req.Page, req.PageSize, req.Count)
 	} else if req.Id != 0 {
 		var track *m.TrackExtraOs
-		track, err = dblogic.TkDriver.GetOneTrackExtraOs(req.Id, req.Region)
+		track, err = td.GetOneTrackExtraOs(req.Id, req.Region)
 		tracks = []*m.TrackExtraOs{track}
 		ret.Total = 1
 	} else {
@@ -83,7 +138,7 @@ func TrackExtraOsQuery(req *QueryTrackExtraOsReq) (rsp *kits.WrapRsp, err error)
 			rsp = kits.APIWrapRsp(kits.ErrOther, "query track extra os fields conditions is invalid", ret)
 			return
 		}
-		tracks, ret.Total, err = dblogic.TkDriver.GetTrackExtraOsByCondition(req.Fields, req.Page, req.PageSize)
+		tracks, ret.Total, err = td.GetTrackExtraOsByCondition(req.Fields, req.Page, req.PageSize, req.Count)
 	}
 	if err != nil {
 		logger.Entry().Errorf("query track extra os error: %v|request: %v", err, *req)
@@ -91,28 +146,56 @@ func TrackExtraOsQuery(req *QueryTrackExtraOsReq) (rsp *kits.WrapRsp, err error)
 		rsp = kits.APIWrapRsp(kits.ErrOther, err.Error(), ret)
 		return
 	}
-	ret.Tracks = tracks
+	if len(req.Select) != 0 { //仅返回投影字段
+		ret.Tracks = dblogic.TrimFields(tracks, req.Select)
+	} else {
+		ret.Tracks = tracks
+	}
 	rsp = kits.APIWrapRsp(0, "ok", ret)
 	return
 }
 
 /************************ 歌曲更新相关 ***************************/
-//update track request
+//update track request, precondition为可选的乐观锁条件(期望的Fversion或Fmodify_time),
+//dryRun为true时仅预演, 影响行数超过阈值时需携带预演返回的confirmToken, skipRules为跳过的校验规则
 type UpdateTrackReq struct {
-	Ids    []int64                `json:"ids"`
-	Conds  map[string]interface{} `json:"conditions,omitempty"`
-	Fields map[string]interface{} `json:"updateFields,omitempty"`
+	dblogic.OpInfo
+	dblogic.WriteConfirm
+	Ids       []int64                `json:"ids"`
+	Conds     map[string]interface{} `json:"conditions,omitempty"`
+	Fields    map[string]interface{} `json:"updateFields,omitempty"`
+	Precond   *dblogic.UpdatePrecond `json:"precondition,omitempty"`
+	SkipRules []string               `json:"skipRules,omitempty"`
 }
 
-//update track response
+//update track response, 冲突时current为当前记录, 预演或需确认时confirm为预演结果, 校验失败时invalid为字段错误
 type UpdateTrackRsp struct {
-	Affected int64 `json:"affected,omitempty"`
+	Affected int64                         `json:"affected,omitempty"`
+	Current  interface{}                   `json:"current,omitempty"`
+	Confirm  *dblogic.ConfirmRequiredError `json:"confirm,omitempty"`
+	Invalid  []*dblogic.FieldError         `json:"invalid,omitempty"`
 }
 
 func TracksUpdate(req *UpdateTrackReq) (rsp *kits.WrapRsp, err error) {
 	defer kits.CatchErr("http.TracksUpdate", &err, logger.Entry())
 	ret := UpdateTrackRsp{}
-	ret.Affected, err = dblogic.TkDriver.UpdateTracksAttr(req.Ids, req.Conds, req.Fields)
+	td := dblogic.TkDriver.WithOp(&req.OpInfo).WithConfirm(&req.WriteConfirm).WithValidation(req.SkipRules)
+	ret.Affected, err = td.UpdateTracksAttr(req.Ids, req.Conds, req.Fields, req.Precond)
+	if ve, ok := err.(*dblogic.ValidationError); ok {
+		ret.Invalid = ve.Fields
+		rsp = kits.APIWrapRsp(kits.ErrParams, err.Error(), ret)
+		return
+	}
+	if r, ok := writeConfirmRsp(err, &ret.Confirm, &ret); ok {
+		rsp = r
+		return
+	}
+	if ce, ok := err.(*dblogic.ConflictError); ok {
+		logger.Entry().Warnf("update tracks conflict|request: %v", *req)
+		ret.Current = ce.Current
+		rsp = kits.APIWrapRsp(kits.ErrConflict, err.Error(), ret)
+		return
+	}
 	if err != nil {
 		logger.Entry().Errorf("update tracks error: %v|request: %v", err, *req)
 		rsp = kits.APIWrapRsp(kits.ErrOther, err.Error(), ret)
@@ -124,20 +207,35 @@ func TracksUpdate(req *UpdateTrackReq) (rsp *kits.WrapRsp, err error) {
 
 //update track extra os request
 type UpdateTrackExtraOsReq struct {
-	Ids    []int64                `json:"ids"`
-	Conds  map[string]interface{} `json:"conditions,omitempty"`
-	Fields map[string]interface{} `json:"updateFields,omitempty"`
+	dblogic.OpInfo
+	dblogic.WriteConfirm
+	Ids       []int64                `json:"ids"`
+	Conds     map[string]interface{} `json:"conditions,omitempty"`
+	Fields    map[string]interface{} `json:"updateFields,omitempty"`
+	SkipRules []string               `json:"skipRules,omitempty"`
 }
 
 //update track extra os response
 type UpdateTrackExtraOsRsp struct {
-	Affected int64 `json:"affected,omitempty"`
+	Affected int64                         `json:"affected,omitempty"`
+	Confirm  *dblogic.ConfirmRequiredError `json:"confirm,omitempty"`
+	Invalid  []*dblogic.FieldError         `json:"invalid,omitempty"`
 }
 
 func TrackExtraOsUpdate(req *UpdateTrackExtraOsReq) (rsp *kits.WrapRsp, err error) {
 	defer kits.CatchErr("http.TrackExtraOsUpdate", &err, logger.Entry())
 	ret := UpdateTrackExtraOsRsp{}
-	ret.Affected, err = dblogic.TkDriver.UpdateTrackExtraOsAttr(req.Ids, req.Conds, req.Fields)
+	td := dblogic.TkDriver.WithOp(&req.OpInfo).WithConfirm(&req.WriteConfirm).WithValidation(req.SkipRules)
+	ret.Affected, err = td.UpdateTrackExtraOsAttr(req.Ids, req.Conds, req.Fields)
+	if ve, ok := err.(*dblogic.ValidationError); ok {
+		ret.Invalid = ve.Fields
+		rsp = kits.APIWrapRsp(kits.ErrParams, err.Error(), ret)
+		return
+	}
+	if r, ok := writeConfirmRsp(err, &ret.Confirm, &ret); ok {
+		rsp = r
+		return
+	}
 	if err != nil {
 		logger.Entry().Errorf("update track extra os error: %v|request: %v", err, *req)
 		rsp = kits.APIWrapRsp(kits.ErrOther, err.Error(), ret)
@@ -148,21 +246,28 @@ func TrackExtraOsUpdate(req *UpdateTrackExtraOsReq) (rsp *kits.WrapRsp, err erro
 }
 
 /************************ 歌曲删除相关 ***************************/
-//delete track request
+//delete track request, 软删除模式下记录operator及reason, 影响行数超过阈值时需携带confirmToken
 type DeleteTrackReq struct {
+	dblogic.OpInfo
+	dblogic.WriteConfirm
 	Ids   []int64                `json:"ids"`
 	Conds map[string]interface{} `json:"conditions,omitempty"`
 }
 
 //delete track response
 type DeleteTrackRsp struct {
-	Affected int64 `json:"affected,omitempty"`
+	Affected int64                         `json:"affected,omitempty"`
+	Confirm  *dblogic.ConfirmRequiredError `json:"confirm,omitempty"`
 }
 
 func TracksDelete(req *DeleteTrackReq) (rsp *kits.WrapRsp, err error) {
 	defer kits.CatchErr("http.TracksDelete", &err, logger.Entry())
 	ret := DeleteTrackRsp{}
-	ret.Affected, err = dblogic.TkDriver.DeleteTracks(req.Ids, req.Conds)
+	ret.Affected, err = dblogic.TkDriver.WithOp(&req.OpInfo).WithConfirm(&req.WriteConfirm).DeleteTracks(req.Ids, req.Conds)
+	if r, ok := writeConfirmRsp(err, &ret.Confirm, &ret); ok {
+		rsp = r
+		return
+	}
 	if err != nil {
 		logger.Entry().Errorf("delete tracks error: %v|request: %v", err, *req)
 		rsp = kits.APIWrapRsp(kits.ErrOther, err.Error(), ret)
@@ -174,19 +279,27 @@ func TracksDelete(req *DeleteTrackReq) (rsp *kits.WrapRsp, err error) {
 
 //delete track extra os request
 type DeleteTrackExtraOsReq struct {
+	dblogic.OpInfo
+	dblogic.WriteConfirm
 	Ids   []int64                `json:"ids"`
 	Conds map[string]interface{} `json:"conditions,omitempty"`
 }
 
 //delete track extra os response
 type DeleteTrackExtraOsRsp struct {
-	Affected int64 `json:"affected,omitempty"`
+	Affected int64                         `json:"affected,omitempty"`
+	Confirm  *dblogic.ConfirmRequiredError `json:"confirm,omitempty"`
 }
 
 func TrackExtraOsDelete(req *DeleteTrackExtraOsReq) (rsp *kits.WrapRsp, err error) {
 	defer kits.CatchErr("http.TrackExtraOsDelete", &err, logger.Entry())
 	ret := DeleteTrackExtraOsRsp{}
-	ret.Affected, err = dblogic.TkDriver.DeleteTrackExtraOs(req.Ids, req.Conds)
+	td := dblogic.TkDriver.WithOp(&req.OpInfo).WithConfirm(&req.WriteConfirm)
+	ret.Affected, err = td.DeleteTrackExtraOs(req.Ids, req.Conds)
+	if r, ok := writeConfirmRsp(err, &ret.Confirm, &ret); ok {
+		rsp = r
+		return
+	}
 	if err != nil {
 		logger.Entry().Errorf("delete track extra os error: %v|request: %v", err, *req)
 		rsp = kits.APIWrapRsp(kits.ErrOther, err.Error(), ret)
@@ -196,38 +309,172 @@ func TrackExtraOsDelete(req *DeleteTrackExtraOsReq) (rsp *kits.WrapRsp, err erro
 	return
 }
 
+/************************ 歌曲恢复相关 ***************************/
+//restore track request, ids为歌曲id, trashIds为回收站记录id, 二选一
+type RestoreTrackReq struct {
+	dblogic.OpInfo
+	Ids      []int64 `json:"ids,omitempty"`
+	TrashIds []int64 `json:"trashIds,omitempty"`
+}
+
+//restore track response
+type RestoreTrackRsp struct {
+	*dblogic.RestoreResult
+}
+
+func TracksRestore(req *RestoreTrackReq) (rsp *kits.WrapRsp, err error) {
+	defer kits.CatchErr("http.TracksRestore", &err, logger.Entry())
+	ret := RestoreTrackRsp{}
+	if len(req.Ids) == 0 && len(req.TrashIds) == 0 {
+		rsp = kits.APIWrapRsp(kits.ErrParams, "ids or trashIds needed", ret)
+		return
+	}
+	ret.RestoreResult, err = dblogic.TkDriver.WithOp(&req.OpInfo).RestoreTracks(req.Ids, req.TrashIds)
+	if err != nil {
+		logger.Entry().Errorf("restore tracks error: %v|request: %v", err, *req)
+		rsp = kits.APIWrapRsp(kits.ErrOther, err.Error(), ret)
+		return
+	}
+	if len(ret.Failed) != 0 {
+		rsp = kits.APIWrapRsp(kits.ErrOther, fmt.Sprintf("%d records restore failed", len(ret.Failed)), ret)
+		return
+	}
+	rsp = kits.APIWrapRsp(0, "ok", ret)
+	return
+}
+
+/************************ 歌曲变更历史相关 ***************************/
+//query track history request, id为歌曲id, requestId为写操作的请求id, 均为可选条件
+type QueryTrackHistoryReq struct {
+	Id        int64  `json:"id,omitempty"`
+	RequestId string `json:"requestId,omitempty"`
+	Page      int64  `json:"page,omitempty"`
+	PageSize  int64  `json:"pageSize,omitempty"`
+}
+
+//query track history response
+type QueryTrackHistoryRsp struct {
+	Histories []*m.History `json:"histories"`
+	Total     int64        `json:"total,omitempty"`
+}
+
+func TrackHistoryQuery(req *QueryTrackHistoryReq) (rsp *kits.WrapRsp, err error) {
+	defer kits.CatchErr("http.TrackHistoryQuery", &err, logger.Entry())
+	ret := QueryTrackHistoryRsp{}
+	ret.Histories, ret.Total, err = dblogic.TkDriver.GetTrackHistory(req.Id, req.RequestId, req.Page, req.PageSize)
+	if err != nil {
+		logger.Entry().Errorf("query track history error: %v|request: %v", err, *req)
+		rsp = kits.APIWrapRsp(kits.ErrOther, err.Error(), ret)
+		return
+	}
+	rsp = kits.APIWrapRsp(0, "ok", ret)
+	return
+}
+
+//rollback track request, historyId为待回滚的变更历史id
+type RollbackTrackReq struct {
+	dblogic.OpInfo
+	HistoryId int64 `json:"historyId"`
+}
+
+//rollback track response, 冲突时current为当前记录
+type RollbackTrackRsp struct {
+	Affected int64       `json:"affected,omitempty"`
+	Current  interface{} `json:"current,omitempty"`
+}
+
+func TracksRollback(req *RollbackTrackReq) (rsp *kits.WrapRsp, err error) {
+	defer kits.CatchErr("http.TracksRollback", &err, logger.Entry())
+	ret := RollbackTrackRsp{}
+	if req.HistoryId == 0 {
+		rsp = kits.APIWrapRsp(kits.ErrParams, "historyId needed", ret)
+		return
+	}
+	ret.Affected, err = dblogic.TkDriver.WithOp(&req.OpInfo).RollbackTrackHistory(req.HistoryId)
+	if ce, ok := err.(*dblogic.ConflictError); ok {
+		logger.Entry().Warnf("rollback track conflict|request: %v", *req)
+		ret.Current = ce.Current
+		rsp = kits.APIWrapRsp(kits.ErrConflict, err.Error(), ret)
+		return
+	}
+	if err != nil {
+		logger.Entry().Errorf("rollback track error: %v|request: %v", err, *req)
+		rsp = kits.APIWrapRsp(kits.ErrOther, err.Error(), ret)
+		return
+	}
+	rsp = kits.APIWrapRsp(0, "ok", ret)
+	return
+}
+
 /************************ 歌曲插入相关 ***************************/
-//insert track request
+//insert track request, policy为主键冲突策略(skip/overwrite/fail, 默认fail), 校验失败的行不写入
 type InsertTrackReq struct {
+	dblogic.OpInfo
 	Tracks       []*m.Track        `json:"tracks,omitempty"`
 	TrackExtraOs []*m.TrackExtraOs `json:"trackExtraOs,omitempty"`
+	Policy       string            `json:"policy,omitempty"`
+	ChunkSize    int               `json:"chunkSize,omitempty"`
+	SkipRules    []string          `json:"skipRules,omitempty"`
+}
+
+//batch insert response, 按行统计写入结果
+type BatchInsertRsp struct {
+	Affected int64                     `json:"affected,omitempty"`
+	Created  int64                     `json:"created"`
+	Updated  int64                     `json:"updated"`
+	Skipped  int64                     `json:"skipped"`
+	Failed   int64                     `json:"failed"`
+	Results  []*dblogic.BatchRowResult `json:"results"`
+}
+
+func (ret *BatchInsertRsp) summarize() {
+	for _, r := range ret.Results {
+		switch r.Action {
+		case dblogic.BatchCreated:
+			ret.Created++
+		case dblogic.BatchUpdated:
+			ret.Updated++
+		case dblogic.BatchSkipped:
+			ret.Skipped++
+		default:
+			ret.Failed++
+		}
+	}
+	ret.Affected = ret.Created + ret.Updated
 }
 
 //insert track response
 type InsertTrackRsp struct {
-	Affected int64 `json:"affected,omitempty"`
+	BatchInsertRsp
 }
 
 func TracksInsert(req *InsertTrackReq) (rsp *kits.WrapRsp, err error) {
 	defer kits.CatchErr("http.TracksInsert", &err, logger.Entry())
 	ret := InsertTrackRsp{}
+	opts := dblogic.BatchOptions{Policy: req.Policy, ChunkSize: req.ChunkSize}
 	var table string
+	td := dblogic.TkDriver.WithOp(&req.OpInfo).WithValidation(req.SkipRules)
 	if len(req.Tracks) != 0 {
-		ret.Affected, err = dblogic.TkDriver.InsertTracks(req.Tracks)
+		ret.Results, err = td.BatchUpsertTracks(req.Tracks, opts)
 		table = "t_track"
 	} else if len(req.TrackExtraOs) != 0 {
-		ret.Affected, err = dblogic.TkDriver.InsertTrackExtraOs(req.TrackExtraOs)
+		ret.Results, err = td.BatchUpsertTrackExtraOs(req.TrackExtraOs, opts)
 		table = "t_track_extra_os"
 	} else {
-		logger.Entry().Errorf("insert tracks error: %v|table: %s|request: %v", err, table, *req)
-		rsp = kits.APIWrapRsp(kits.ErrOther, err.Error(), ret)
+		logger.Entry().Errorf("invalid insert params")
+		rsp = kits.APIWrapRsp(kits.ErrParams, "tracks or trackExtraOs needed", ret)
 		return
 	}
 	if err != nil {
-		logger.Entry().Errorf("invalid insert params")
+		logger.Entry().Errorf("insert tracks error: %v|table: %s|request: %v", err, table, *req)
 		rsp = kits.APIWrapRsp(kits.ErrOther, err.Error(), ret)
 		return
 	}
+	ret.summarize()
+	if ret.Failed != 0 {
+		rsp = kits.APIWrapRsp(kits.ErrOther, fmt.Sprintf("%d rows insert failed", ret.Failed), ret)
+		return
+	}
 	rsp = kits.APIWrapRsp(0, "ok", ret)
 	return
 }
@@ -238,6 +485,8 @@ type JoinQueryTrackReq struct {
 	RawSql   string `json:"rawSql"`
 	Page     int64  `json:"page,omitempty"`
 	PageSize int64  `json:"pageSize,omitempty"`
+	//查询来源, 由http层设置, 用于慢查询记录
+	Trace *driver.QueryTrace `json:"-"`
 }
 
 //join query track response
@@ -249,7 +498,11 @@ type JoinQueryTrackRsp struct {
 func TracksJoinQuery(req *JoinQueryTrackReq) (rsp *kits.WrapRsp, err error) {
 	defer kits.CatchErr("http.TracksJoinQuery", &err, logger.Entry())
 	ret := JoinQueryTrackRsp{}
-	results, err := dblogic.TkDriver.JoinQueryWithRawSql(req.RawSql, req.Page, req.PageSize)
+	if !g.Config().RawSqlOpen {
+		rsp = kits.APIWrapRsp(kits.ErrParams, errRawSqlDisabled, ret)
+		return
+	}
+	results, err := dblogic.TkDriver.WithTrace(req.Trace).JoinQueryWithRawSql(req.RawSql, req.Page, req.PageSize)
 	if err != nil {
 		logger.Entry().Errorf("join query tracks error: %v|request: %v", err, *req)
 		ret.Total = 0
@@ -263,22 +516,52 @@ func TracksJoinQuery(req *JoinQueryTrackReq) (rsp *kits.WrapRsp, err error) {
 /************************ 查询歌曲是否能播放等信息 ***************************/
 //query track play info request
 type QueryTrackPlayReq struct {
-	Id int64 `json:"id"`
+	Id     int64 `json:"id"`
+	Region int64 `json:"region"`
 }
 
 //query track play info response
 type QueryTrackPlayRsp struct {
-	CanPlay bool `json:"can_play"`
+	CanPlay   bool   `json:"can_play"`
+	Reason    int    `json:"reason"`
+	ReasonMsg string `json:"reason_msg"`
+	URL       string `json:"url,omitempty"`
+}
+
+//综合曲库状态、地区版权及mongo资源判定歌曲在地区是否可播放, 可播放时返回最佳播放链接
+func resolveTrackPlay(id, region int64) (*dblogic.TrackPlayInfo, string, error) {
+	//地区简码只取配置region_codes, 未配置的地区为空, 判定为地区未知
+	regionCode := g.Config().RegionCodes[int(region)]
+	info, err := dblogic.TkDriver.ResolveTrackPlay(id, region, regionCode)
+	if err != nil || !info.CanPlay {
+		return info, "", err
+	}
+	url, err := mongo.MgDriver.GetTrackPlayURL(id)
+	if err != nil {
+		return info, "", err
+	}
+	if len(url) == 0 {
+		info.CanPlay, info.Reason = false, dblogic.PlayNoURL
+	}
+	return info, url, nil
 }
 
 func TrackPlayQuery(req *QueryTrackPlayReq) (rsp *kits.WrapRsp, err error) {
 	defer kits.CatchErr("http.TrackPlayQuery", &err, logger.Entry())
 	ret := QueryTrackPlayRsp{}
-	if req.Id == 0 {
+	if req.Id == 0 || req.Region == 0 {
 		logger.Entry().Errorf("query track play info conditions is nil")
 		rsp = kits.APIWrapRsp(kits.ErrOther, "query track play info conditions is invalid", ret)
 		return
 	}
+	info, url, err := resolveTrackPlay(req.Id, req.Region)
+	if err != nil {
+		logger.Entry().Errorf("query track play info error: %v|request: %v", err, *req)
+		rsp = kits.APIWrapRsp(kits.ErrOther, err.Error(), ret)
+		return
+	}
+	ret.CanPlay, ret.Reason, ret.URL = info.CanPlay, info.Reason, url
+	ret.ReasonMsg = dblogic.PlayReasonMap[info.Reason]
 	rsp = kits.APIWrapRsp(0, "ok", ret)
 	return
 }
@@ -300,21 +583,22 @@ type QueryTrackSingerRsp struct {
 func TrackSingerQuery(req *QueryTrackSingerReq) (rsp *kits.WrapRsp, err error) {
 	defer kits.CatchErr("http.TrackSingerQuery", &err, logger.Entry())
 	ret := QueryTrackSingerRsp{}
-	if req.Id == 0 && req.Region == 0 && len(req.Ids) == 0 {
+	if req.Id == 0 && len(req.Ids) == 0 {
 		logger.Entry().Errorf("query track singer info conditions is nil")
 		rsp = kits.APIWrapRsp(kits.ErrOther, "query track singer info conditions is invalid", ret)
 		return
 	}
-	var hasSinger bool
+	ids := req.Ids
 	if req.Id != 0 {
-	} else if len(req.Ids) != 0 {
+		ids = []int64{req.Id}
 	}
+	ret.InvalidIds, err = dblogic.TkDriver.CheckTracksSinger(ids, req.Region)
 	if err != nil {
 		logger.Entry().Errorf("query track singer info error: %v|request: %v", err, *req)
 		rsp = kits.APIWrapRsp(kits.ErrOther, err.Error(), ret)
 		return
 	}
-	ret.NoSinger = !hasSinger
+	ret.NoSinger = len(ret.InvalidIds) != 0
 	rsp = kits.APIWrapRsp(0, "ok", ret)
 	return
 }
@@ -328,17 +612,26 @@ type QueryTrackPlayURLReq struct {
 
 //query track play url response
 type QueryTrackPlayURLRsp struct {
-	URL string `json:"url"`
+	URL     string `json:"url"`
+	CanPlay bool   `json:"can_play"`
+	Reason  int    `json:"reason"`
 }
 
 func TrackPlayURLQuery(req *QueryTrackPlayURLReq) (rsp *kits.WrapRsp, err error) {
 	defer kits.CatchErr("http.TrackPlayURLQuery", &err, logger.Entry())
 	ret := QueryTrackPlayURLRsp{}
-	if req.Id == 0 {
+	if req.Id == 0 || req.Region == 0 {
 		logger.Entry().Errorf("query track play url conditions is nil")
 		rsp = kits.APIWrapRsp(kits.ErrOther, "query track play url conditions is invalid", ret)
 		return
 	}
+	info, url, err := resolveTrackPlay(req.Id, req.Region)
+	if err != nil {
+		logger.Entry().Errorf("query track play url error: %v|request: %v", err, *req)
+		rsp = kits.APIWrapRsp(kits.ErrOther, err.Error(), ret)
+		return
+	}
+	ret.URL, ret.CanPlay, ret.Reason = url, info.CanPlay, info.Reason
 	rsp = kits.APIWrapRsp(0, "ok", ret)
 	return
 }
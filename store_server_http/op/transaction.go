@@ -0,0 +1,279 @@
+package op
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+
+	"github.com/store_server/dbtools/dblogic"
+	m "github.com/store_server/dbtools/models"
+	"github.com/store_server/logger"
+	"github.com/store_server/store_server_http/kits"
+)
+
+/************************ 多操作事务相关 ***************************/
+const (
+	maxTxOperations = 200
+)
+
+var (
+	//data中形如"$0"的字段值引用第0个insert操作写入记录的id
+	txRefPattern = regexp.MustCompile(`^\$(\d+)$`)
+	//预演完成, 回滚全部操作
+	errTxDryRun = errors.New("transaction dry run")
+)
+
+//transaction operation, op为insert/update/delete, table为操作的表, confirmToken为该操作预演返回的token
+type TxOperation struct {
+	Op           string                 `json:"op"`
+	Table        string                 `json:"table"`
+	Data         json.RawMessage        `json:"data,omitempty"` //insert记录
+	Ids          []int64                `json:"ids,omitempty"`
+	Conds        map[string]interface{} `json:"conditions,omitempty"`
+	Fields       map[string]interface{} `json:"updateFields,omitempty"`
+	Precond      *dblogic.UpdatePrecond `json:"precondition,omitempty"`
+	ConfirmToken string                 `json:"confirmToken,omitempty"`
+}
+
+//transaction request, 所有操作在同一事务内执行, 任一操作失败时全部回滚;
+//dryRun为true时预演全部update/delete操作并回滚, 返回各操作的确认token; 请求中的confirmToken
+//仅在只有一个update/delete操作时使用, 多个操作需确认时在各操作中携带confirmToken
+type TransactionReq struct {
+	dblogic.OpInfo
+	dblogic.WriteConfirm
+	Operations []*TxOperation `json:"operations"`
+	SkipRules  []string       `json:"skipRules,omitempty"` //跳过的写入校验规则
+}
+
+//transaction operation result
+type TxOpResult struct {
+	Index    int   `json:"index"`
+	Id       int64 `json:"id,omitempty"`
+	Affected int64 `json:"affected,omitempty"`
+}
+
+//transaction operation confirm, 操作的预演结果
+type TxConfirm struct {
+	Index int `json:"index"`
+	*dblogic.ConfirmRequiredError
+}
+
+//transaction response, 失败时failedIndex为失败操作的下标, 校验失败时invalid为字段错误,
+//预演或需确认时confirms为各操作的预演结果
+type TransactionRsp struct {
+	Results     []*TxOpResult         `json:"results"`
+	FailedIndex *int                  `json:"failedIndex,omitempty"`
+	Current     interface{}           `json:"current,omitempty"`
+	Invalid     []*dblogic.FieldError `json:"invalid,omitempty"`
+	Confirms    []*TxConfirm          `json:"confirms,omitempty"`
+}
+
+//替换data中对之前insert结果id的引用
+func resolveTxRefs(data json.RawMessage, results []*TxOpResult) ([]byte, error) {
+	fields := make(map[string]interface{})
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if err := dec.Decode(&fields); err != nil {
+		return nil, err
+	}
+	for k, v := range fields {
+		s, ok := v.(string)
+		if !ok {
+			continue
+		}
+		match := txRefPattern.FindStringSubmatch(s)
+		if match == nil {
+			continue
+		}
+		i, _ := strconv.Atoi(match[1])
+		if i >= len(results) || results[i].Id == 0 {
+			return nil, fmt.Errorf("field %s reference operation[%d] has no id", k, i)
+		}
+		fields[k] = results[i].Id
+	}
+	return json.Marshal(fields)
+}
+
+func decodeTxData(op *TxOperation, results []*TxOpResult, value interface{}) error {
+	if len(op.Data) == 0 {
+		return fmt.Errorf("insert data is empty")
+	}
+	data, err := resolveTxRefs(op.Data, results)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, value)
+}
+
+func txInsert(uow *dblogic.UnitOfWork, op *TxOperation, results []*TxOpResult) (id int64, err error) {
+	switch op.Table {
+	case "t_track":
+		track := &m.Track{}
+		if err = decodeTxData(op, results, track); err == nil {
+			id, err = uow.Tracks.InsertOneTrack(track)
+		}
+	case "t_track_extra_os":
+		track := &m.TrackExtraOs{}
+		if err = decodeTxData(op, results, track); err == nil {
+			id, err = uow.Tracks.InsertOneTrackExtraOs(track)
+		}
+	case "t_video":
+		video := &m.Video{}
+		if err = decodeTxData(op, results, video); err == nil {
+			id, err = uow.Videos.InsertOneVideo(video)
+		}
+	case "t_video_extra_os":
+		video := &m.VideoExtraOs{}
+		if err = decodeTxData(op, results, video); err == nil {
+			id, err = uow.Videos.InsertOneVideoExtraOs(video)
+		}
+	case "t_video_singer_track":
+		video := &m.VideoSingerTrack{}
+		if err = decodeTxData(op, results, video); err == nil {
+			id, err = uow.Videos.InsertOneVideoSingerTrack(video)
+		}
+	default:
+		err = fmt.Errorf("table %s not support insert", op.Table)
+	}
+	return
+}
+
+func txUpdate(uow *dblogic.UnitOfWork, op *TxOperation, confirm *dblogic.WriteConfirm) (int64, error) {
+	if len(op.Ids) == 0 && len(op.Conds) == 0 {
+		return 0, fmt.Errorf("update ids or conditions needed")
+	}
+	switch op.Table {
+	case "t_track":
+		return uow.Tracks.WithConfirm(confirm).UpdateTracksAttr(op.Ids, op.Conds, op.Fields, op.Precond)
+	case "t_video":
+		return uow.Videos.WithConfirm(confirm).UpdateVideoAttr(op.Ids, op.Conds, op.Fields, op.Precond)
+	}
+	if op.Precond != nil { //其余表不支持前置条件, 不能静默忽略
+		return 0, fmt.Errorf("table %s not support precondition", op.Table)
+	}
+	switch op.Table {
+	case "t_track_extra_os":
+		return uow.Tracks.WithConfirm(confirm).UpdateTrackExtraOsAttr(op.Ids, op.Conds, op.Fields)
+	case "t_video_singer_track":
+		return uow.Videos.WithConfirm(confirm).UpdateVideoSingerTrackAttr(op.Ids, op.Conds, op.Fields)
+	}
+	return 0, fmt.Errorf("table %s not support update", op.Table)
+}
+
+func txDelete(uow *dblogic.UnitOfWork, op *TxOperation, confirm *dblogic.WriteConfirm) (int64, error) {
+	if len(op.Ids) == 0 && len(op.Conds) == 0 {
+		return 0, fmt.Errorf("delete ids or conditions needed")
+	}
+	switch op.Table {
+	case "t_track":
+		return uow.Tracks.WithConfirm(confirm).DeleteTracks(op.Ids, op.Conds)
+	case "t_track_extra_os":
+		return uow.Tracks.WithConfirm(confirm).DeleteTrackExtraOs(op.Ids, op.Conds)
+	case "t_video":
+		return uow.Videos.WithConfirm(confirm).DeleteVideos(op.Ids, op.Conds)
+	case "t_video_extra_os":
+		return uow.Videos.WithConfirm(confirm).DeleteVideoExtraOs(op.Ids, op.Conds)
+	}
+	return 0, fmt.Errorf("table %s not support delete", op.Table)
+}
+
+//操作的预演/确认信息, 请求中的confirmToken仅在只有一个update/delete操作时使用
+func txConfirm(req *TransactionReq, op *TxOperation) *dblogic.WriteConfirm {
+	confirm := &dblogic.WriteConfirm{DryRun: req.DryRun, Token: op.ConfirmToken}
+	if len(confirm.Token) != 0 || len(req.Token) == 0 {
+		return confirm
+	}
+	writes := 0
+	for _, o := range req.Operations {
+		if o != nil && (o.Op == "update" || o.Op == "delete") {
+			writes++
+		}
+	}
+	if writes == 1 {
+		confirm.Token = req.Token
+	}
+	return confirm
+}
+
+func Transaction(req *TransactionReq) (rsp *kits.WrapRsp, err error) {
+	defer kits.CatchErr("http.Transaction", &err, logger.Entry())
+	ret := TransactionRsp{}
+	if len(req.Operations) == 0 || len(req.Operations) > maxTxOperations {
+		rsp = kits.APIWrapRsp(kits.ErrParams, fmt.Sprintf("operations count should be 1~%d", maxTxOperations), ret)
+		return
+	}
+	results := make([]*TxOpResult, 0, len(req.Operations))
+	failed := -1
+	td := dblogic.TkDriver.WithOp(&req.OpInfo).WithValidation(req.SkipRules)
+	vod := dblogic.VoDriver.WithOp(&req.OpInfo).WithValidation(req.SkipRules)
+	err = dblogic.RunUnitOfWork(td, vod, func(uow *dblogic.UnitOfWork) error {
+		for i, op := range req.Operations {
+			if op == nil {
+				failed = i
+				return fmt.Errorf("operation is nil")
+			}
+			r := &TxOpResult{Index: i}
+			var e error
+			switch op.Op {
+			case "insert":
+				r.Id, e = txInsert(uow, op, results)
+				r.Affected = 1
+			case "update":
+				r.Affected, e = txUpdate(uow, op, txConfirm(req, op))
+			case "delete":
+				r.Affected, e = txDelete(uow, op, txConfirm(req, op))
+			default:
+				e = fmt.Errorf("op[%s] not supported", op.Op)
+			}
+			if ce, ok := e.(*dblogic.ConfirmRequiredError); ok {
+				ret.Confirms = append(ret.Confirms, &TxConfirm{Index: i, ConfirmRequiredError: ce})
+				if ce.DryRun { //预演时操作已回滚到savepoint, 继续预演后续操作
+					r.Affected, e = ce.Affected, nil
+				}
+			}
+			if e != nil {
+				failed = i
+				return e
+			}
+			results = append(results, r)
+		}
+		if req.DryRun {
+			return errTxDryRun
+		}
+		return nil
+	})
+	if err == errTxDryRun {
+		ret.Results = results
+		rsp = kits.APIWrapRsp(kits.ErrConfirm, err.Error(), ret)
+		err = nil
+		return
+	}
+	if err != nil {
+		logger.Entry().Errorf("transaction error: %v|failed: %d|request: %v", err, failed, *req)
+		code := kits.ErrOther
+		if ce, ok := err.(*dblogic.ConflictError); ok {
+			code, ret.Current = kits.ErrConflict, ce.Current
+		}
+		if dblogic.IsConfirmRequired(err) {
+			code = kits.ErrConfirm
+		}
+		if err == dblogic.ErrConfirmToken {
+			code = kits.ErrConflict
+		}
+		if ve, ok := err.(*dblogic.ValidationError); ok {
+			code, ret.Invalid = kits.ErrParams, ve.Fields
+		}
+		if failed >= 0 {
+			ret.FailedIndex = &failed
+			err = fmt.Errorf("operation[%d] failed: %v", failed, err)
+		}
+		rsp = kits.APIWrapRsp(code, err.Error(), ret)
+		return
+	}
+	ret.Results = results
+	rsp = kits.APIWrapRsp(0, "ok", ret)
+	return
+}
@@ -0,0 +1,100 @@
+package op
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/store_server/dbtools/dblogic"
+	"github.com/store_server/dbtools/driver"
+	"github.com/store_server/logger"
+	"github.com/store_server/store_server_http/kits"
+	"github.com/stretchr/testify/assert"
+
+	_ "github.com/jinzhu/gorm/dialects/sqlite" //embedded测试后端
+)
+
+func init() {
+	logger.InitStructLog("error", filepath.Join(os.TempDir(), "store_server_test.log"), "store_server_test")
+}
+
+func txSetup() *driver.Scheme {
+	scheme := &driver.Scheme{Mysql: driver.DefaultTestScheme.Mysql}
+	scheme.Setup()
+	cms := &driver.CMSDriver{MusicDB: scheme.DB(), ImportDB: scheme.DB()}
+	dblogic.TkDriver = dblogic.NewTracksDriver(cms)
+	dblogic.VoDriver = dblogic.NewVideosDriver(cms)
+	return scheme
+}
+
+//data中的"$N"引用第N个insert操作写入记录的id
+func TestTransactionRefs(t *testing.T) {
+	scheme := txSetup()
+	defer scheme.Cleanup()
+	req := &TransactionReq{Operations: []*TxOperation{
+		{Op: "insert", Table: "t_track", Data: json.RawMessage(`{"Ftrack_id": 10, "Ftrack_name": "tx_track"}`)},
+		{Op: "insert", Table: "t_track_extra_os", Data: json.RawMessage(`{"Ftrack_id": "$0", "Fregion": 1}`)},
+		{Op: "update", Table: "t_track", Ids: []int64{10}, Fields: map[string]interface{}{"Fnote": 5}},
+	}}
+	rsp, err := Transaction(req)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, rsp.Code)
+	ret := rsp.Data.(TransactionRsp)
+	assert.Equal(t, 3, len(ret.Results))
+	assert.Equal(t, int64(10), ret.Results[0].Id)
+	extra, err := dblogic.TkDriver.GetOneTrackExtraOs(10, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(10), extra.FtrackId)
+
+	//引用非insert操作, 整个事务回滚
+	req = &TransactionReq{Operations: []*TxOperation{
+		{Op: "insert", Table: "t_track", Data: json.RawMessage(`{"Ftrack_id": 11, "Ftrack_name": "tx_track"}`)},
+		{Op: "update", Table: "t_track", Ids: []int64{10}, Fields: map[string]interface{}{"Fnote": 6}},
+		{Op: "insert", Table: "t_track_extra_os", Data: json.RawMessage(`{"Ftrack_id": "$1", "Fregion": 1}`)},
+	}}
+	rsp, err = Transaction(req)
+	assert.Error(t, err)
+	assert.Equal(t, kits.ErrOther, rsp.Code)
+	ret = rsp.Data.(TransactionRsp)
+	assert.Equal(t, 2, *ret.FailedIndex)
+	_, err = dblogic.TkDriver.GetOneTrack(11)
+	assert.Error(t, err)
+	track, err := dblogic.TkDriver.GetOneTrack(10)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(5), track.Fnote)
+}
+
+//视频与关联歌曲在同一事务中写入, 关联记录引用新视频的自增id
+func TestTransactionVideoRefs(t *testing.T) {
+	scheme := txSetup()
+	defer scheme.Cleanup()
+	req := &TransactionReq{Operations: []*TxOperation{
+		{Op: "insert", Table: "t_video", Data: json.RawMessage(`{"Fregion_id": 1, "Ftitle": "tx_video"}`)},
+		{Op: "insert", Table: "t_video_singer_track", Data: json.RawMessage(`{"Flocal_v_id": "$0", "Fsinger_id": 71, "Ftrack_id": 1}`)},
+	}}
+	rsp, err := Transaction(req)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, rsp.Code)
+	ret := rsp.Data.(TransactionRsp)
+	assert.Equal(t, int64(1), ret.Results[0].Id)
+	assert.Equal(t, int64(1), ret.Results[1].Id)
+	tracks, _, err := dblogic.VoDriver.GetVideoSingerTrackByCondition(map[string]interface{}{"Flocal_v_id": 1}, 1, 10, dblogic.CountExact)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(tracks))
+}
+
+//不支持前置条件的表携带precondition时报错, 不静默忽略
+func TestTransactionPrecondUnsupported(t *testing.T) {
+	scheme := txSetup()
+	defer scheme.Cleanup()
+	version := int64(1)
+	req := &TransactionReq{Operations: []*TxOperation{
+		{Op: "update", Table: "t_track_extra_os", Ids: []int64{1}, Fields: map[string]interface{}{"Flocal_status": 0},
+			Precond: &dblogic.UpdatePrecond{Version: &version}},
+	}}
+	rsp, err := Transaction(req)
+	assert.Error(t, err)
+	assert.NotEqual(t, 0, rsp.Code)
+	assert.Contains(t, rsp.ErrMsg, "not support precondition")
+}
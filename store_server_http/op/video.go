@@ -9,6 +9,7 @@ import (
 	"time"
 
 	"github.com/store_server/dbtools/dblogic"
+	"github.com/store_server/dbtools/driver"
 	"github.com/store_server/logger"
 	"github.com/store_server/store_server_http/g"
 	"github.com/store_server/store_server_http/kits"
@@ -18,36 +19,59 @@ import (
 )
 
 /************************ 视频查询相关 ***************************/
-//query video request
+//query video request, cursorPage不为空时使用游标分页(可与query或fields条件组合)
 type QueryVideoReq struct {
-	RawSql   string                 `json:"rawSql"`
-	Ids      []int64                `json:"ids"`
-	Page     int64                  `json:"page,omitempty"`
-	PageSize int64                  `json:"pageSize,omitempty"`
-	Fields   map[string]interface{} `json:"fields,omitempty"`
-}
-
-//query video response
+	RawSql     string                 `json:"rawSql"`
+	Query      *dblogic.QueryDSL      `json:"query,omitempty"`
+	Ids        []int64                `json:"ids"`
+	Page       int64                  `json:"page,omitempty"`
+	PageSize   int64                  `json:"pageSize,omitempty"`
+	Fields     map[string]interface{} `json:"fields,omitempty"`
+	Count      dblogic.CountMode      `json:"count,omitempty"`
+	CursorPage *dblogic.CursorPage    `json:"cursorPage,omitempty"`
+	Select     []string               `json:"select,omitempty"` //投影字段(gorm column), 为空时返回所有字段
+
+	//读己之写, 为true时查询主库, 用于写入后立即读取
+	ReadYourWrites bool `json:"readYourWrites,omitempty"`
+	//查询来源, 由http层设置, 用于慢查询记录
+	Trace *driver.QueryTrace `json:"-"`
+}
+
+//query video response, 指定select时videos仅包含投影字段
 type QueryVideoRsp struct {
-	Videos []*m.Video `json:"videos"`
-	Total  int64      `json:"total,omitempty"`
+	Videos     interface{} `json:"videos"`
+	Total      int64       `json:"total,omitempty"`
+	NextCursor string      `json:"next_cursor,omitempty"`
 }
 
 func VideosQuery(req *QueryVideoReq) (rsp *kits.WrapRsp, err error) {
 	defer kits.CatchErr("http.VideosQuery", &err, logger.Entry())
 	ret := QueryVideoRsp{}
 	var videos []*m.Video
+	if _, err = dblogic.SelectColumns(&m.Video{}, req.Select); err != nil {
+		rsp = kits.APIWrapRsp(kits.ErrParams, err.Error(), ret)
+		return
+	}
+	vod := dblogic.VoDriver.WithFields(req.Select).WithPrimary(req.ReadYourWrites).WithTrace(req.Trace)
 	if len(req.RawSql) != 0 {
-		videos, ret.Total, err = dblogic.VoDriver.ExecRawQuerySql4Video(req.RawSql, req.Page, req.PageSize)
+		if !g.Config().RawSqlOpen {
+			rsp = kits.APIWrapRsp(kits.ErrParams, errRawSqlDisabled, ret)
+			return
+		}
+		videos, ret.Total, err = vod.ExecRawQuerySql4Video(req.RawSql, req.Page, req.PageSize, req.Count)
+	} else if req.CursorPage != nil {
+		videos, ret.NextCursor, err = vod.GetVideosByCursor(req.Query, req.Fields, req.CursorPage)
+	} else if req.Query != nil {
+		videos, ret.Total, err = vod.GetVideosByQuery(req.Query, req.Page, req.PageSize, req.Count)
 	} else if len(req.Ids) != 0 {
-		videos, ret.Total, err = dblogic.VoDriver.GetVideosByIds(req.Ids)
+		videos, ret.Total, err = vod.GetVideosByIds(req.Ids)
 	} else { //others query condition
 		if len(req.Fields) == 0 && req.Page == 0 && req.PageSize == 0 {
 			logger.Entry().Errorf("query videos fields conditions is nil")
 			rsp = kits.APIWrapRsp(kits.ErrOther, "query videos fields conditions is invalid", ret)
 			return
 		}
-		videos, ret.Total, err = dblogic.VoDriver.GetVideosByCondition(req.Fields, req.Page, req.PageSize)
+		videos, ret.Total, err = vod.GetVideosByCondition(req.Fields, req.Page, req.PageSize, req.Count)
 	}
 	if err != nil {
 		logger.Entry().Errorf("query videos error: %v|request: %v", err, *req)
@@ -55,7 +79,11 @@ func VideosQuery(req *QueryVideoReq) (rsp *kits.WrapRsp, err error) {
 		rsp = kits.APIWrapRsp(kits.ErrOther, err.Error(), ret)
 		return
 	}
-	ret.Videos = videos
+	if len(req.Select) != 0 { //仅返回投影字段
+		ret.Videos = dblogic.TrimFields(videos, req.Select)
+	} else {
+		ret.Videos = videos
+	}
 	rsp = kits.APIWrapRsp(0, "ok", ret)
 	return
 }
@@ -63,11 +91,18 @@ func VideosQuery(req *QueryVideoReq) (rsp *kits.WrapRsp, err error) {
 //query video extra os request
 type QueryVideoExtraOsReq struct {
 	RawSql   string                 `json:"rawSql"`
+	Query    *dblogic.QueryDSL      `json:"query,omitempty"`
 	Id       int64                  `json:"id"`
 	Region   int64                  `json:"region"`
 	Page     int64                  `json:"page,omitempty"`
 	PageSize int64                  `json:"pageSize,omitempty"`
 	Fields   map[string]interface{} `json:"fields,omitempty"`
+	Count    dblogic.CountMode      `json:"count,omitempty"`
+
+	//读己之写, 为true时查询主库, 用于写入后立即读取
+	ReadYourWrites bool `json:"readYourWrites,omitempty"`
+	//查询来源, 由http层设置, 用于慢查询记录
+	Trace *driver.QueryTrace `json:"-"`
 }
 
 //query video extra os response
@@ -80,17 +115,24 @@ func VideoExtraOsQuery(req *QueryVideoExtraOsReq) (rsp *kits.WrapRsp, err error)
 	defer kits.CatchErr("http.VideoExtraOsQuery", &err, logger.Entry())
 	ret := QueryVideoExtraOsRsp{}
 	var videos []*m.VideoExtraOs
+	vod := dblogic.VoDriver.WithPrimary(req.ReadYourWrites).WithTrace(req.Trace)
 	if len(req.RawSql) != 0 {
-		videos, ret.Total, err = dblogic.VoDriver.ExecRawQuerySql4VideoExtraOs(req.RawSql, req.Page, req.PageSize)
+		if !g.Config().RawSqlOpen {
+			rsp = kits.APIWrapRsp(kits.ErrParams, errRawSqlDisabled, ret)
+			return
+		}
+		videos, ret.Total, err = vod.ExecRawQuerySql4VideoExtraOs(req.RawSql, req.Page, req.PageSize, req.Count)
+	} else if req.Query != nil {
+		videos, ret.Total, err = vod.GetVideoExtraOsByQuery(req.Query, req.Page, req.PageSize, req.Count)
 	} else if req.Id != 0 {
-		videos, ret.Total, err = dblogic.VoDriver.GetVideoExtraOs(req.Id, req.Region)
+		videos, ret.Total, err = vod.GetVideoExtraOs(req.Id, req.Region)
 	} else {
 		if len(req.Fields) == 0 && req.Page == 0 && req.PageSize == 0 {
 			logger.Entry().Errorf("query video extra os fields conditions is nil")
 			rsp = kits.APIWrapRsp(kits.ErrOther, "query video extra os fields conditions is invalid", ret)
 			return
 		}
-		videos, ret.Total, err = dblogic.VoDriver.GetVideoExtraOsByCondition(req.Fields, req.Page, req.PageSize)
+		videos, ret.Total, err = vod.GetVideoExtraOsByCondition(req.Fields, req.Page, req.PageSize, req.Count)
 	}
 	if err != nil {
 		logger.Entry().Errorf("query video extra os error: %v|request: %v", err, *req)
@@ -106,11 +148,18 @@ func VideoExtraOsQuery(req *QueryVideoExtraOsReq) (rsp *kits.WrapRsp, err error)
 //query video singer track request
 type QueryVideoSingerTrackReq struct {
 	RawSql   string                 `json:"rawSql"`
+	Query    *dblogic.QueryDSL      `json:"query,omitempty"`
 	Id       int64                  `json:"id"`
 	Region   int64                  `json:"region"`
 	Page     int64                  `json:"page,omitempty"`
 	PageSize int64                  `json:"pageSize,omitempty"`
 	Fields   map[string]interface{} `json:"fields,omitempty"`
+	Count    dblogic.CountMode      `json:"count,omitempty"`
+
+	//读己之写, 为true时查询主库, 用于写入后立即读取
+	ReadYourWrites bool `json:"readYourWrites,omitempty"`
+	//查询来源, 由http层设置, 用于慢查询记录
+	Trace *driver.QueryTrace `json:"-"`
 }
 
 //query video singer track response
@@ -123,17 +172,24 @@ func VideoSingerTrackQuery(req *QueryVideoSingerTrackReq) (rsp *kits.WrapRsp, er
 	defer kits.CatchErr("http.VideoSingerTrackQuery", &err, logger.Entry())
 	ret := QueryVideoSingerTrackRsp{}
 	var videos []*m.VideoSingerTrack
+	vod := dblogic.VoDriver.WithPrimary(req.ReadYourWrites).WithTrace(req.Trace)
 	if len(req.RawSql) != 0 {
-		videos, ret.Total, err = dblogic.VoDriver.ExecRawQuerySql4VideoSingerTrack(req.RawSql, req.Page, req.PageSize)
+		if !g.Config().RawSqlOpen {
+			rsp = kits.APIWrapRsp(kits.ErrParams, errRawSqlDisabled, ret)
+			return
+		}
+		videos, ret.Total, err = vod.ExecRawQuerySql4VideoSingerTrack(req.RawSql, req.Page, req.PageSize, req.Count)
+	} else if req.Query != nil {
+		videos, ret.Total, err = vod.GetVideoSingerTrackByQuery(req.Query, req.Page, req.PageSize, req.Count)
 	} else if req.Id != 0 {
-		videos, ret.Total, err = dblogic.VoDriver.GetVideoSingerTrack(req.Id, req.Region)
+		videos, ret.Total, err = vod.GetVideoSingerTrack(req.Id, req.Region)
 	} else {
 		if len(req.Fields) == 0 && req.Page == 0 && req.PageSize == 0 {
 			logger.Entry().Errorf("query video singer track fields conditions is nil")
 			rsp = kits.APIWrapRsp(kits.ErrOther, "query video singer track fields conditions is invalid", ret)
 			return
 		}
-		videos, ret.Total, err = dblogic.VoDriver.GetVideoSingerTrackByCondition(req.Fields, req.Page, req.PageSize)
+		videos, ret.Total, err = vod.GetVideoSingerTrackByCondition(req.Fields, req.Page, req.PageSize, req.Count)
 	}
 	if err != nil {
 		logger.Entry().Errorf("query video singer track error: %v|request: %v", err, *req)
@@ -152,6 +208,8 @@ type JoinQueryVideoReq struct {
 	RawSql   string `json:"rawSql"`
 	Page     int64  `json:"page,omitempty"`
 	PageSize int64  `json:"pageSize,omitempty"`
+	//查询来源, 由http层设置, 用于慢查询记录
+	Trace *driver.QueryTrace `json:"-"`
 }
 
 //join query video response
@@ -163,7 +221,11 @@ type JoinQueryVideoRsp struct {
 func VideosJoinQuery(req *JoinQueryVideoReq) (rsp *kits.WrapRsp, err error) {
 	defer kits.CatchErr("http.VideosJoinQuery", &err, logger.Entry())
 	ret := JoinQueryVideoRsp{}
-	results, err := dblogic.VoDriver.JoinQueryWithRawSql(req.RawSql, req.Page, req.PageSize)
+	if !g.Config().RawSqlOpen {
+		rsp = kits.APIWrapRsp(kits.ErrParams, errRawSqlDisabled, ret)
+		return
+	}
+	results, err := dblogic.VoDriver.WithTrace(req.Trace).JoinQueryWithRawSql(req.RawSql, req.Page, req.PageSize)
 	if err != nil {
 		logger.Entry().Errorf("join query videos error: %v|request: %v", err, *req)
 		ret.Total = 0
@@ -174,6 +236,150 @@ func VideosJoinQuery(req *JoinQueryVideoReq) (rsp *kits.WrapRsp, err error) {
 	return
 }
 
+/************************ 视频更新相关 ***************************/
+//update video request, precondition为可选的乐观锁条件(t_video无Fversion, 仅支持Fmodify_time),
+//dryRun为true时仅预演, 影响行数超过阈值时需携带预演返回的confirmToken, skipRules为跳过的校验规则
+type UpdateVideoReq struct {
+	dblogic.OpInfo
+	dblogic.WriteConfirm
+	Ids       []int64                `json:"ids"`
+	Conds     map[string]interface{} `json:"conditions,omitempty"`
+	Fields    map[string]interface{} `json:"updateFields,omitempty"`
+	Precond   *dblogic.UpdatePrecond `json:"precondition,omitempty"`
+	SkipRules []string               `json:"skipRules,omitempty"`
+}
+
+//update video response, 冲突时current为当前记录
+type UpdateVideoRsp struct {
+	Affected int64                         `json:"affected,omitempty"`
+	Current  interface{}                   `json:"current,omitempty"`
+	Confirm  *dblogic.ConfirmRequiredError `json:"confirm,omitempty"`
+	Invalid  []*dblogic.FieldError         `json:"invalid,omitempty"`
+}
+
+func VideosUpdate(req *UpdateVideoReq) (rsp *kits.WrapRsp, err error) {
+	defer kits.CatchErr("http.VideosUpdate", &err, logger.Entry())
+	ret := UpdateVideoRsp{}
+	if len(req.Ids) == 0 && len(req.Conds) == 0 {
+		rsp = kits.APIWrapRsp(kits.ErrParams, "ids or conditions needed", ret)
+		return
+	}
+	vd := dblogic.VoDriver.WithOp(&req.OpInfo).WithConfirm(&req.WriteConfirm).WithValidation(req.SkipRules)
+	ret.Affected, err = vd.UpdateVideoAttr(req.Ids, req.Conds, req.Fields, req.Precond)
+	if ve, ok := err.(*dblogic.ValidationError); ok {
+		ret.Invalid = ve.Fields
+		rsp = kits.APIWrapRsp(kits.ErrParams, err.Error(), ret)
+		return
+	}
+	if r, ok := writeConfirmRsp(err, &ret.Confirm, &ret); ok {
+		rsp = r
+		return
+	}
+	if ce, ok := err.(*dblogic.ConflictError); ok {
+		logger.Entry().Warnf("update videos conflict|request: %v", *req)
+		ret.Current = ce.Current
+		rsp = kits.APIWrapRsp(kits.ErrConflict, err.Error(), ret)
+		return
+	}
+	if err != nil {
+		logger.Entry().Errorf("update videos error: %v|request: %v", err, *req)
+		rsp = kits.APIWrapRsp(kits.ErrOther, err.Error(), ret)
+		return
+	}
+	rsp = kits.APIWrapRsp(0, "ok", ret)
+	return
+}
+
+/************************ 视频恢复相关 ***************************/
+//restore video request, ids为视频相关记录id, trashIds为回收站记录id, 二选一
+type RestoreVideoReq struct {
+	dblogic.OpInfo
+	Ids      []int64 `json:"ids,omitempty"`
+	TrashIds []int64 `json:"trashIds,omitempty"`
+}
+
+//restore video response
+type RestoreVideoRsp struct {
+	*dblogic.RestoreResult
+}
+
+func VideosRestore(req *RestoreVideoReq) (rsp *kits.WrapRsp, err error) {
+	defer kits.CatchErr("http.VideosRestore", &err, logger.Entry())
+	ret := RestoreVideoRsp{}
+	if len(req.Ids) == 0 && len(req.TrashIds) == 0 {
+		rsp = kits.APIWrapRsp(kits.ErrParams, "ids or trashIds needed", ret)
+		return
+	}
+	ret.RestoreResult, err = dblogic.VoDriver.WithOp(&req.OpInfo).RestoreVideos(req.Ids, req.TrashIds)
+	if err != nil {
+		logger.Entry().Errorf("restore videos error: %v|request: %v", err, *req)
+		rsp = kits.APIWrapRsp(kits.ErrOther, err.Error(), ret)
+		return
+	}
+	if len(ret.Failed) != 0 {
+		rsp = kits.APIWrapRsp(kits.ErrOther, fmt.Sprintf("%d records restore failed", len(ret.Failed)), ret)
+		return
+	}
+	rsp = kits.APIWrapRsp(0, "ok", ret)
+	return
+}
+
+/************************ 视频变更历史相关 ***************************/
+//query video history request, id为视频相关记录id, requestId为写操作的请求id, 均为可选条件
+type QueryVideoHistoryReq struct {
+	Id        int64  `json:"id,omitempty"`
+	RequestId string `json:"requestId,omitempty"`
+	Page      int64  `json:"page,omitempty"`
+	PageSize  int64  `json:"pageSize,omitempty"`
+}
+
+//query video history response
+type QueryVideoHistoryRsp struct {
+	Histories []*m.History `json:"histories"`
+	Total     int64        `json:"total,omitempty"`
+}
+
+func VideoHistoryQuery(req *QueryVideoHistoryReq) (rsp *kits.WrapRsp, err error) {
+	defer kits.CatchErr("http.VideoHistoryQuery", &err, logger.Entry())
+	ret := QueryVideoHistoryRsp{}
+	ret.Histories, ret.Total, err = dblogic.VoDriver.GetVideoHistory(req.Id, req.RequestId, req.Page, req.PageSize)
+	if err != nil {
+		logger.Entry().Errorf("query video history error: %v|request: %v", err, *req)
+		rsp = kits.APIWrapRsp(kits.ErrOther, err.Error(), ret)
+		return
+	}
+	rsp = kits.APIWrapRsp(0, "ok", ret)
+	return
+}
+
+//rollback video request, historyId为待回滚的变更历史id
+type RollbackVideoReq struct {
+	dblogic.OpInfo
+	HistoryId int64 `json:"historyId"`
+}
+
+//rollback video response
+type RollbackVideoRsp struct {
+	Affected int64 `json:"affected,omitempty"`
+}
+
+func VideosRollback(req *RollbackVideoReq) (rsp *kits.WrapRsp, err error) {
+	defer kits.CatchErr("http.VideosRollback", &err, logger.Entry())
+	ret := RollbackVideoRsp{}
+	if req.HistoryId == 0 {
+		rsp = kits.APIWrapRsp(kits.ErrParams, "historyId needed", ret)
+		return
+	}
+	ret.Affected, err = dblogic.VoDriver.WithOp(&req.OpInfo).RollbackVideoHistory(req.HistoryId)
+	if err != nil {
+		logger.Entry().Errorf("rollback video error: %v|request: %v", err, *req)
+		rsp = kits.APIWrapRsp(kits.ErrOther, err.Error(), ret)
+		return
+	}
+	rsp = kits.APIWrapRsp(0, "ok", ret)
+	return
+}
+
 /************************ 视频匹配相关 ***************************/
 var (
 	fullTracks            = []*matchTrackInfo{}
@@ -214,7 +420,11 @@ func exportAllTracks() error {
 
 //导出曲库全量艺人数据
 func exportAllSingers() error {
-	res := []string{}
+	res, err := dblogic.SgDriver.ExportSingersWithAliases()
+	if err != nil {
+		logger.Entry().Errorf("export all singers timely error: %v", err)
+		return err
+	}
 	fullSingers = fullSingers[0:0]
 	for _, sr := range res {
 		if len(sr) == 3 {
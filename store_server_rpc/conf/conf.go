@@ -13,6 +13,67 @@ type StoreServerRpcConfig struct {
 	Rpc     RpcConfig `json:"rpc"`
 	RpcPort int       `json:"rpc_port,omitempty" yaml:"rpc_port"`
 	Cls     ClsConfig `json:"cls" yaml:"cls"`
+	//普通歌词库及逐字歌词库, 为空时不开启对应歌词服务
+	LyricMysql  string `json:"lyric_mysql" yaml:"lyric_mysql"`
+	KlyricMysql string `json:"klyric_mysql" yaml:"klyric_mysql"`
+	//软删除开关, 需与http服务保持一致, 回收站清理由http服务负责
+	SoftDeleteOpen bool `json:"soft_delete_open" yaml:"soft_delete_open"`
+	//变更历史开关, 需与http服务保持一致
+	HistoryOpen bool `json:"history_open" yaml:"history_open"`
+	//只读从库, 查询优先使用健康的从库
+	Replica ReplicaConfig `json:"replica" yaml:"replica"`
+	//各逻辑库(music/import/ktrack/klyric/lyric)结构化配置, 未配置时使用mysql等dsn配置
+	Databases map[string]*MysqlConfig `json:"databases" yaml:"databases"`
+	//连接池状态上报间隔(秒), 默认15秒
+	DBStatsInterval int `json:"db_stats_interval" yaml:"db_stats_interval"`
+	//跳过启动时的表结构版本检查, 仅用于紧急情况, 正常应先执行store_server_migrate up
+	SkipSchemaCheck bool `json:"skip_schema_check" yaml:"skip_schema_check"`
+	//慢查询记录, threshold为0时关闭
+	SlowQuery SlowQueryConfig `json:"slow_query" yaml:"slow_query"`
+	//合法地区id, 写入校验使用, 为空时不校验地区
+	ValidRegions []int `json:"valid_regions" yaml:"valid_regions"`
+	//写入校验, 按model字段声明的规则校验insert/update
+	Validation ValidationConfig `json:"validation" yaml:"validation"`
+}
+
+//mysql config, dsn不为空时直接使用, 否则由host等字段拼接; 超时及连接时长单位为秒, 连接池参数为0时使用默认值
+type MysqlConfig struct {
+	Dsn             string            `json:"dsn,omitempty" yaml:"dsn"`
+	Host            string            `json:"host" yaml:"host"`
+	Port            int               `json:"port" yaml:"port"`
+	User            string            `json:"user" yaml:"user"`
+	Passwd          string            `json:"passwd" yaml:"passwd"`
+	Database        string            `json:"database" yaml:"database"`
+	Charset         string            `json:"charset" yaml:"charset"`
+	Params          map[string]string `json:"params" yaml:"params"`
+	Timeout         int               `json:"timeout" yaml:"timeout"`
+	ReadTimeout     int               `json:"read_timeout" yaml:"read_timeout"`
+	WriteTimeout    int               `json:"write_timeout" yaml:"write_timeout"`
+	MaxOpenConns    int               `json:"max_open_conns" yaml:"max_open_conns"`
+	MaxIdleConns    int               `json:"max_idle_conns" yaml:"max_idle_conns"`
+	ConnMaxLifetime int               `json:"conn_max_lifetime" yaml:"conn_max_lifetime"`
+	ConnMaxIdleTime int               `json:"conn_max_idle_time" yaml:"conn_max_idle_time"`
+}
+
+//read replica config, dsns按逻辑库(musicDB/lyricDB/klyricDB)配置一个或多个从库
+type ReplicaConfig struct {
+	Dsns           map[string][]string `json:"dsns" yaml:"dsns"`
+	MaxLag         int                 `json:"max_lag" yaml:"max_lag"`                 //最大复制延迟(秒), 超过时不使用该从库
+	CheckInterval  int                 `json:"check_interval" yaml:"check_interval"`   //健康检查间隔(秒)
+	HeartbeatTable string              `json:"heartbeat_table" yaml:"heartbeat_table"` //心跳表, 为空时通过SHOW SLAVE STATUS获取延迟
+}
+
+//slow query config
+type SlowQueryConfig struct {
+	Threshold int  `json:"threshold" yaml:"threshold"` //慢查询阈值(毫秒), 为0时不记录
+	TopN      int  `json:"top_n" yaml:"top_n"`         //保留耗时最长的记录数, 默认100
+	Explain   bool `json:"explain" yaml:"explain"`     //是否对慢select语句执行EXPLAIN
+}
+
+//write validation config, disabled_rules为全局关闭的规则(如isrc、region)
+type ValidationConfig struct {
+	Disabled      bool     `json:"disabled" yaml:"disabled"`
+	DisabledRules []string `json:"disabled_rules" yaml:"disabled_rules"`
 }
 
 //mongo db config
@@ -8,6 +8,7 @@ var RpcErrMap = map[int]string{
 	2: "参数错误",
 	3: "签名错误",
 	4: "内部服务器错误",
+	5: "数据已被修改",
 }
 
 //common rpc response
@@ -0,0 +1,64 @@
+package common
+
+import (
+	"github.com/store_server/dbtools/dblogic"
+	"github.com/store_server/dbtools/models"
+)
+
+/*lyric rpc 公共参数*/
+
+//get lyric rpc request, 指定地区无歌词时返回默认地区歌词, version不为0时查询指定版本
+type GetLyricRpcReq struct {
+	TrackId int64 `json:"track_id,omitempty"`
+	Region  int64 `json:"region,omitempty"`
+	Karaoke bool  `json:"karaoke,omitempty"`
+	Version int64 `json:"version,omitempty"`
+
+	//读己之写, 为true时查询主库
+	ReadYourWrites bool `json:"read_your_writes,omitempty"`
+}
+
+//get lyric rpc response, 查询指定版本时返回version
+type GetLyricRpcRsp struct {
+	Lyric   *models.Lyric        `json:"lyric,omitempty"`
+	Version *models.LyricVersion `json:"version,omitempty"`
+}
+
+//list lyric versions rpc request
+type ListLyricVersionsRpcReq struct {
+	TrackId     int64 `json:"track_id,omitempty"`
+	Region      int64 `json:"region,omitempty"`
+	Karaoke     bool  `json:"karaoke,omitempty"`
+	WithContent bool  `json:"with_content,omitempty"`
+}
+
+//list lyric versions rpc response
+type ListLyricVersionsRpcRsp struct {
+	Versions []*models.LyricVersion `json:"versions"`
+}
+
+//upload lyric rpc request, version不为空时为期望的当前版本号(无歌词时为0)
+type UploadLyricRpcReq struct {
+	dblogic.OpInfo
+	Lyric   *models.Lyric `json:"lyric,omitempty"`
+	Version *int64        `json:"version,omitempty"`
+}
+
+//upload lyric rpc response, 冲突时current为当前歌词
+type UploadLyricRpcRsp struct {
+	Lyric   *models.Lyric `json:"lyric,omitempty"`
+	Current *models.Lyric `json:"current,omitempty"`
+}
+
+//delete lyric rpc request
+type DeleteLyricRpcReq struct {
+	dblogic.OpInfo
+	TrackId int64 `json:"track_id,omitempty"`
+	Region  int64 `json:"region,omitempty"`
+	Karaoke bool  `json:"karaoke,omitempty"`
+}
+
+//delete lyric rpc response
+type DeleteLyricRpcRsp struct {
+	Deleted bool `json:"deleted,omitempty"`
+}
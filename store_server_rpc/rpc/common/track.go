@@ -1,6 +1,7 @@
 package common
 
 import (
+	"github.com/store_server/dbtools/dblogic"
 	"github.com/store_server/dbtools/models"
 )
 
@@ -8,16 +9,20 @@ import (
 
 //create track rpc request
 type CreateTrackRpcReq struct {
+	dblogic.OpInfo
 	CreateDoc *models.Track `json:"track,omitempty"`
+	SkipRules []string      `json:"skip_rules,omitempty"` //跳过的写入校验规则
 }
 
-//create track rpc response
+//create track rpc response, 校验失败时invalid为字段错误
 type CreateTrackRpcRsp struct {
-	Id int64 `json:"id"`
+	Id      int64                 `json:"id"`
+	Invalid []*dblogic.FieldError `json:"invalid,omitempty"`
 }
 
 //delete track rpc request
 type DeleteTrackRpcReq struct {
+	dblogic.OpInfo
 	Id int64 `json:"id,omitempty"`
 }
 
@@ -29,14 +34,19 @@ type DeleteTrackRpcRsp struct {
 
 //update track rpc request
 type UpdateTrackRpcReq struct {
-	Id        int64         `json:"id,omitempty"`
-	UpdateDoc *models.Track `json:"track,omitempty"`
+	dblogic.OpInfo
+	Id        int64                  `json:"id,omitempty"`
+	UpdateDoc *models.Track          `json:"track,omitempty"`
+	Precond   *dblogic.UpdatePrecond `json:"precondition,omitempty"`
+	SkipRules []string               `json:"skip_rules,omitempty"` //跳过的写入校验规则
 }
 
-//update track rpc response
+//update track rpc response, 冲突时current为当前记录, 校验失败时invalid为字段错误
 type UpdateTrackRpcRsp struct {
-	Id      int64 `json:"id,omitempty"`
-	Changed bool  `json:"changed,omitempty"`
+	Id      int64                 `json:"id,omitempty"`
+	Changed bool                  `json:"changed,omitempty"`
+	Current *models.Track         `json:"current,omitempty"`
+	Invalid []*dblogic.FieldError `json:"invalid,omitempty"`
 }
 
 //search track rpc filter info for request
@@ -54,20 +64,31 @@ type SearchTrackRpcReq_SortInfo struct {
 	ModifyTime int   `json:"modify_time,omitempty"`
 }
 
-//search track rpc request
+//search track rpc request, cursor_page不为空时使用游标分页, 忽略start;
+//fields为投影字段(gorm column), 不为空时结果仅包含指定字段
 type SearchTrackRpcReq struct {
-	Start  int64                         `json:"start,omitempty"`
-	Count  int64                         `json:"count,omitempty"`
-	Filter *SearchTrackRpcReq_FilterInfo `json:"filter,omitempty"`
-	Sort   []*SearchTrackRpcReq_SortInfo `json:"sort,omitempty"`
+	Start      int64                         `json:"start,omitempty"`
+	Count      int64                         `json:"count,omitempty"`
+	Filter     *SearchTrackRpcReq_FilterInfo `json:"filter,omitempty"`
+	Sort       []*SearchTrackRpcReq_SortInfo `json:"sort,omitempty"`
+	CursorPage *dblogic.CursorPage           `json:"cursor_page,omitempty"`
+	Fields     []string                      `json:"fields,omitempty"`
+
+	//读己之写, 为true时查询主库
+	ReadYourWrites bool `json:"read_your_writes,omitempty"`
+}
+
+//search track rpc response data, 请求指定fields时结果在rows中返回
+type SearchTrackRpcRsp_Data struct {
+	Total      int64                    `json:"total,omitempty"`
+	Start      int64                    `json:"start,omitempty"`
+	Count      int64                    `json:"count,omitempty"`
+	List       []*models.Track          `json:"list,omitempty"`
+	Rows       []map[string]interface{} `json:"rows,omitempty"`
+	NextCursor string                   `json:"next_cursor,omitempty"`
 }
 
 //search track rpc response
 type SearchTrackRpcRsp struct {
-	Data *struct {
-		Total int64           `json:"total,omitempty"`
-		Start int64           `json:"start,omitempty"`
-		Count int64           `json:"count,omitempty"`
-		List  []*models.Track `json:"list,omitempty"`
-	}
+	Data *SearchTrackRpcRsp_Data
 }
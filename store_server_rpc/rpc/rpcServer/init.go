@@ -10,6 +10,7 @@ import (
 	"github.com/jinzhu/gorm"
 	"github.com/store_server/dbtools/dblogic"
 	"github.com/store_server/dbtools/driver"
+	"github.com/store_server/dbtools/migrate"
 	"github.com/store_server/logger"
 	"github.com/store_server/store_server_rpc/g"
 	"go.mongodb.org/mongo-driver/mongo"
@@ -23,6 +24,7 @@ import (
 //db util define
 type DBUtil struct {
 	dbs          map[string]*gorm.DB
+	replicas     map[string][]*gorm.DB
 	rawdbs       map[string]*sql.DB
 	mgoclient    *mongo.Client
 	importclient *mongo.Client
@@ -32,12 +34,43 @@ type DBUtil struct {
 	ctx context.Context
 }
 
-func InitDB(cfg string) (db *gorm.DB, err error) {
-	return driver.CreateDB(cfg)
+func InitDB(name string, cfg *driver.MysqlConfig) (db *gorm.DB, err error) {
+	return driver.CreateDBWithConfig(name, cfg)
 }
 
-func InitRawDB(cfg string) (db *sql.DB, err error) {
-	return driver.CreateRawDB(cfg)
+func InitRawDB(name string, cfg *driver.MysqlConfig) (db *sql.DB, err error) {
+	return driver.CreateRawDBWithConfig(name, cfg)
+}
+
+//逻辑库mysql配置, key为databases配置项, 未配置时使用dsn, 均未配置时返回nil
+func mysqlConfig(key, dsn string) *driver.MysqlConfig {
+	c := g.Config().Databases[key]
+	if c == nil {
+		if len(dsn) == 0 {
+			return nil
+		}
+		return &driver.MysqlConfig{Dsn: dsn}
+	}
+	second := func(n int) time.Duration {
+		return time.Duration(n) * time.Second
+	}
+	return &driver.MysqlConfig{
+		Dsn:             c.Dsn,
+		Host:            c.Host,
+		Port:            c.Port,
+		User:            c.User,
+		Passwd:          c.Passwd,
+		Database:        c.Database,
+		Charset:         c.Charset,
+		Params:          c.Params,
+		Timeout:         second(c.Timeout),
+		ReadTimeout:     second(c.ReadTimeout),
+		WriteTimeout:    second(c.WriteTimeout),
+		MaxOpenConns:    c.MaxOpenConns,
+		MaxIdleConns:    c.MaxIdleConns,
+		ConnMaxLifetime: second(c.ConnMaxLifetime),
+		ConnMaxIdleTime: second(c.ConnMaxIdleTime),
+	}
 }
 
 func NewMongoClientOpts(host, database, user, passwd string) (opts *options.ClientOptions) { //mongo client配置参数
@@ -95,11 +128,55 @@ func InitElastic7(ctx context.Context) (client *ies7.ESClient, err error) {
 	return ies7.NewEsClient(ctx, ec.Address, ec.Timeout, ec.Sniff, ec.Proxy, args...)
 }
 
+//校验各库表结构版本, 低于当前二进制期望的版本时拒绝启动
+func checkSchema(ctx context.Context, dbs map[string]*gorm.DB) error {
+	if g.Config().SkipSchemaCheck {
+		logger.Entry().Warnf("schema check skipped")
+		return nil
+	}
+	keys := map[string]string{"music": driver.MusicDBName, "lyric": driver.LyricDBName, "klyric": driver.KlyricDBName}
+	sqlDBs := make(map[string]*sql.DB)
+	for key, name := range keys {
+		if db := dbs[name]; db != nil {
+			sqlDBs[key] = db.DB()
+		}
+	}
+	return migrate.CheckAll(ctx, sqlDBs)
+}
+
+//慢查询配置, 支持配置重载
+func setSlowQueryOptions() {
+	sc := g.Config().SlowQuery
+	driver.SetSlowQueryOptions(driver.SlowQueryOptions{
+		Threshold: time.Duration(sc.Threshold) * time.Millisecond,
+		TopN:      sc.TopN,
+		Explain:   sc.Explain,
+	})
+}
+
+//写入校验配置, 支持配置重载
+func setValidationOptions() {
+	vc := g.Config().Validation
+	regions := make([]int64, 0, len(g.Config().ValidRegions))
+	for _, r := range g.Config().ValidRegions {
+		regions = append(regions, int64(r))
+	}
+	if len(regions) == 0 && !vc.Disabled {
+		logger.Entry().Warnf("valid_regions not configured, region rule accepts any region id")
+	}
+	dblogic.SetValidationOptions(dblogic.ValidationOptions{
+		Disabled:      vc.Disabled,
+		DisabledRules: vc.DisabledRules,
+		Regions:       regions,
+	})
+}
+
 func NewDefaultDBEnv(ctx context.Context) (ul *DBUtil, err error) {
 	ul = &DBUtil{
-		dbs:    make(map[string]*gorm.DB),
-		rawdbs: make(map[string]*sql.DB),
-		ctx:    ctx}
+		dbs:      make(map[string]*gorm.DB),
+		replicas: make(map[string][]*gorm.DB),
+		rawdbs:   make(map[string]*sql.DB),
+		ctx:      ctx}
 	defer func() {
 		if err != nil {
 			ul.Stop()
@@ -109,14 +186,48 @@ func NewDefaultDBEnv(ctx context.Context) (ul *DBUtil, err error) {
 	case <-ctx.Done():
 		ul.Stop()
 	default:
-		ul.dbs["musicDB"], err = InitDB(g.Config().Mysql)
+		cfgs := map[string]*driver.MysqlConfig{
+			driver.MusicDBName:  mysqlConfig("music", g.Config().Mysql),
+			driver.ImportDBName: mysqlConfig("import", ""),
+			driver.KtrackDBName: mysqlConfig("ktrack", ""),
+			driver.LyricDBName:  mysqlConfig("lyric", g.Config().LyricMysql),
+			driver.KlyricDBName: mysqlConfig("klyric", g.Config().KlyricMysql),
+		}
+		ul.dbs[driver.MusicDBName], err = InitDB(driver.MusicDBName, cfgs[driver.MusicDBName])
 		if err != nil {
 			return
 		}
-		ul.rawdbs["rawDB"], err = InitRawDB(g.Config().Mysql)
+		ul.rawdbs["rawDB"], err = InitRawDB("rawDB", cfgs[driver.MusicDBName])
 		if err != nil {
 			return
 		}
+		for name, cfg := range cfgs { //其他逻辑库可选
+			if name == driver.MusicDBName || cfg == nil {
+				continue
+			}
+			ul.dbs[name], err = InitDB(name, cfg)
+			if err != nil {
+				return
+			}
+		}
+		if err = checkSchema(ctx, ul.dbs); err != nil {
+			return
+		}
+		for name, dsns := range g.Config().Replica.Dsns { //只读从库, 连接池配置与主库一致
+			for i, dsn := range dsns {
+				cfg := &driver.MysqlConfig{}
+				if cfgs[name] != nil {
+					*cfg = *cfgs[name]
+				}
+				cfg.Dsn = dsn
+				db, e := InitDB(fmt.Sprintf("%s_replica_%d", name, i), cfg)
+				if e != nil { //从库不可用时不影响启动, 查询使用主库
+					logger.Entry().Errorf("init replica of %s failed, err:%s", name, e)
+					continue
+				}
+				ul.replicas[name] = append(ul.replicas[name], db)
+			}
+		}
 		ul.mgoclient, err = InitMongo(g.Config().MongoDb.ModId, g.Config().MongoDb.CmdId,
 			g.Config().MongoDb.DbName, g.Config().MongoDb.User, g.Config().MongoDb.Passwd)
 		if err != nil {
@@ -136,13 +247,42 @@ func NewDefaultDBEnv(ctx context.Context) (ul *DBUtil, err error) {
 
 func (ul *DBUtil) Start() (err error) {
 	driver.CmsDriver, err = driver.NewCMSDriver(ul.ctx, ul.dbs["musicDB"], ul.dbs["importDB"],
-		ul.dbs["KtrackDB"], ul.dbs["klyricDB"], ul.dbs["lyricDB"], ul.rawdbs["rawDB"], ul.mgoclient, ul.importclient)
+		ul.dbs["ktrackDB"], ul.dbs["klyricDB"], ul.dbs["lyricDB"], ul.rawdbs["rawDB"], ul.mgoclient, ul.importclient)
 	if err != nil {
 		return
 	}
+	go driver.RunDBStats(ul.ctx, time.Duration(g.Config().DBStatsInterval)*time.Second)
+	setSlowQueryOptions()
+	setValidationOptions()
+	rc := g.Config().Replica
+	opts := driver.ReplicaOptions{
+		MaxLag:         time.Duration(rc.MaxLag) * time.Second,
+		CheckInterval:  time.Duration(rc.CheckInterval) * time.Second,
+		HeartbeatTable: rc.HeartbeatTable,
+	}
+	driver.CmsDriver.Replicas = make(map[string]*driver.ReplicaSet)
+	for name, dbs := range ul.replicas {
+		if ul.dbs[name] == nil { //主库未配置时忽略从库
+			logger.Entry().Warnf("replicas of %s ignored, primary not configured", name)
+			for _, db := range dbs {
+				db.Close()
+			}
+			continue
+		}
+		rs := driver.NewReplicaSet(name, ul.dbs[name], dbs, opts)
+		driver.CmsDriver.Replicas[name] = rs
+		go rs.Run(ul.ctx)
+	}
 	dblogic.TkDriver = dblogic.NewTracksDriver(driver.CmsDriver)
 	dblogic.VoDriver = dblogic.NewVideosDriver(driver.CmsDriver)
+	dblogic.TkDriver.SetSoftDelete(g.Config().SoftDeleteOpen)
+	dblogic.VoDriver.SetSoftDelete(g.Config().SoftDeleteOpen)
+	dblogic.TkDriver.SetHistory(g.Config().HistoryOpen)
+	dblogic.VoDriver.SetHistory(g.Config().HistoryOpen)
+	dblogic.LyDriver = dblogic.NewLyricsDriver(driver.CmsDriver, dblogic.TkDriver)
+	go dblogic.LyDriver.RunLyricFlagRetry(ul.ctx)
 	im.MgDriver = im.NewMongoDriver(driver.CmsDriver)
+	im.MgDriver.SetAudioCollection(g.Config().MongoDb.AudioCol)
 	ies.EsDriver = ul.esclient
 	ies7.EsDriver = ul.esclient7
 	go ies.EsDriver.Run()
@@ -0,0 +1,106 @@
+package rpcServer
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/store_server/dbtools/dblogic"
+	"github.com/store_server/dbtools/models"
+	"github.com/store_server/logger"
+	"github.com/store_server/utils/common"
+
+	lm "github.com/store_server/store_server_rpc/rpc/common"
+)
+
+//lyric rpc service
+type LyricService struct{}
+
+func (s *LyricService) GetLyric(hr *http.Request, req *lm.GetLyricRpcReq, rsp *lm.CommRpcRsp) (err error) {
+	defer common.TimeCostTrack(time.Now(), "LyricService rpc", "GetLyric", err)
+	payload := &lm.GetLyricRpcRsp{}
+	if err = lm.CheckParamsIsNil(req); err != nil {
+		lm.WrapRpcRsp(2, "", payload, rsp)
+		return
+	}
+	if req.TrackId <= 0 {
+		err = fmt.Errorf("invalid track id: %d", req.TrackId)
+		lm.WrapRpcRsp(2, "", payload, rsp)
+		return
+	}
+	ld := dblogic.LyDriver.WithPrimary(req.ReadYourWrites)
+	if req.Version != 0 {
+		payload.Version, err = ld.GetLyricVersion(req.TrackId, req.Region, req.Version, req.Karaoke)
+	} else {
+		payload.Lyric, err = ld.GetLyric(req.TrackId, req.Region, req.Karaoke)
+	}
+	if err != nil {
+		logger.Entry().Errorf("rpc to get lyric error: %v|%v", *req, err)
+		lm.WrapRpcRsp(-1, "get lyric failed.", payload, rsp)
+		return
+	}
+	lm.WrapRpcRsp(1, "succeed.", payload, rsp)
+	return nil
+}
+
+func (s *LyricService) ListLyricVersions(hr *http.Request, req *lm.ListLyricVersionsRpcReq, rsp *lm.CommRpcRsp) (err error) {
+	defer common.TimeCostTrack(time.Now(), "LyricService rpc", "ListLyricVersions", err)
+	payload := &lm.ListLyricVersionsRpcRsp{}
+	if err = lm.CheckParamsIsNil(req); err != nil {
+		lm.WrapRpcRsp(2, "", payload, rsp)
+		return
+	}
+	payload.Versions, err = dblogic.LyDriver.GetLyricVersions(req.TrackId, req.Region, req.Karaoke, req.WithContent)
+	if err != nil {
+		logger.Entry().Errorf("rpc to list lyric versions error: %v|%v", *req, err)
+		lm.WrapRpcRsp(-1, "list lyric versions failed.", payload, rsp)
+		return
+	}
+	lm.WrapRpcRsp(1, "succeed.", payload, rsp)
+	return nil
+}
+
+func (s *LyricService) UploadLyric(hr *http.Request, req *lm.UploadLyricRpcReq, rsp *lm.CommRpcRsp) (err error) {
+	defer common.TimeCostTrack(time.Now(), "LyricService rpc", "UploadLyric", err)
+	payload := &lm.UploadLyricRpcRsp{}
+	if err = lm.CheckParamsIsNil(req); err != nil {
+		lm.WrapRpcRsp(2, "", payload, rsp)
+		return
+	}
+	payload.Lyric, err = dblogic.LyDriver.WithOp(bindOpInfo(hr, &req.OpInfo)).UploadLyric(req.Lyric, req.Version)
+	if dblogic.IsLyricFormatError(err) || err == dblogic.ErrLyricNotFound {
+		lm.WrapRpcRsp(2, "", payload, rsp)
+		return
+	}
+	if ce, ok := err.(*dblogic.ConflictError); ok {
+		logger.Entry().Warnf("rpc to upload lyric conflict: %v", *req)
+		payload.Lyric = nil
+		payload.Current, _ = ce.Current.(*models.Lyric)
+		lm.WrapRpcRsp(5, "", payload, rsp)
+		return
+	}
+	if err != nil {
+		logger.Entry().Errorf("rpc to upload lyric error: %v|%v", *req, err)
+		lm.WrapRpcRsp(-1, "upload lyric failed.", payload, rsp)
+		return
+	}
+	lm.WrapRpcRsp(1, "succeed.", payload, rsp)
+	return nil
+}
+
+func (s *LyricService) DeleteLyric(hr *http.Request, req *lm.DeleteLyricRpcReq, rsp *lm.CommRpcRsp) (err error) {
+	defer common.TimeCostTrack(time.Now(), "LyricService rpc", "DeleteLyric", err)
+	payload := &lm.DeleteLyricRpcRsp{}
+	if err = lm.CheckParamsIsNil(req); err != nil {
+		lm.WrapRpcRsp(2, "", payload, rsp)
+		return
+	}
+	payload.Deleted, err = dblogic.LyDriver.WithOp(bindOpInfo(hr, &req.OpInfo)).DeleteLyric(req.TrackId, req.Region, req.Karaoke)
+	if err != nil {
+		logger.Entry().Errorf("rpc to delete lyric error: %v|%v", *req, err)
+		lm.WrapRpcRsp(-1, "delete lyric failed.", payload, rsp)
+		return
+	}
+	lm.WrapRpcRsp(1, "succeed.", payload, rsp)
+	return nil
+}
@@ -10,6 +10,7 @@ import (
 	"github.com/gorilla/rpc"
 	"github.com/gorilla/rpc/json"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/store_server/dbtools/migrate"
 	"github.com/store_server/logger"
 	"github.com/store_server/store_server_rpc/g"
 
@@ -58,12 +59,21 @@ func (s *RpcSvr) Start() (err error) {
 	server.RegisterCodec(json.NewCodec(), "application/json")
 
 	server.RegisterService(new(TrackService), "track")
+	server.RegisterService(new(LyricService), "lyric")
 
 	ul, err := NewDefaultDBEnv(ctx) //初始化各DB环境
 	if err != nil {
 		logger.Entry().Errorf("init mysql and mongo db engine error in starting rpc server: %v", err)
+		if migrate.IsSchemaError(err) { //表结构版本落后时拒绝启动
+			cancel()
+			return
+		}
+	}
+	if err = ul.Start(); err != nil { //db环境启动失败时拒绝启动
+		logger.Entry().Errorf("start db env error in starting rpc server: %v", err)
+		cancel()
+		return
 	}
-	ul.Start()
 
 	router := mux.NewRouter()
 	router.Handle("/rpc", server)
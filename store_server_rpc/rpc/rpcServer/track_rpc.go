@@ -9,6 +9,7 @@ import (
 	"github.com/store_server/dbtools/models"
 	"github.com/store_server/logger"
 	"github.com/store_server/utils/common"
+	"github.com/store_server/utils/rest"
 
 	lm "github.com/store_server/store_server_rpc/rpc/common"
 )
@@ -16,6 +17,14 @@ import (
 //track rpc service
 type TrackService struct{}
 
+//rpc写操作请求未携带requestId时, 使用请求头中的X-request-id
+func bindOpInfo(hr *http.Request, info *dblogic.OpInfo) *dblogic.OpInfo {
+	if len(info.RequestId) == 0 {
+		info.RequestId = hr.Header.Get(rest.HeaderRequestId)
+	}
+	return info
+}
+
 func (s *TrackService) CreateTrack(hr *http.Request, req *lm.CreateTrackRpcReq, rsp *lm.CommRpcRsp) (err error) {
 	defer common.TimeCostTrack(time.Now(), "TrackService rpc", "CreateTrack", err)
 	payload := &lm.CreateTrackRpcRsp{}
@@ -23,7 +32,13 @@ func (s *TrackService) CreateTrack(hr *http.Request, req *lm.CreateTrackRpcReq,
 		lm.WrapRpcRsp(2, "", payload, rsp)
 		return err
 	}
-	lastId, e := dblogic.TkDriver.InsertOneTrack(req.CreateDoc)
+	lastId, e := dblogic.TkDriver.WithOp(bindOpInfo(hr, &req.OpInfo)).WithValidation(req.SkipRules).InsertOneTrack(req.CreateDoc)
+	if ve, ok := e.(*dblogic.ValidationError); ok {
+		err = e
+		payload.Id, payload.Invalid = -1, ve.Fields
+		lm.WrapRpcRsp(2, e.Error(), payload, rsp)
+		return err
+	}
 	if e != nil {
 		err = e
 		logger.Entry().Errorf("rpc to create track error: %v|%v", *req, err)
@@ -43,7 +58,7 @@ func (s *TrackService) DeleteTrack(hr *http.Request, req *lm.DeleteTrackRpcReq,
 		lm.WrapRpcRsp(2, "", payload, rsp)
 		return err
 	}
-	err = dblogic.TkDriver.DeleteOneTrack(req.Id)
+	err = dblogic.TkDriver.WithOp(bindOpInfo(hr, &req.OpInfo)).DeleteOneTrack(req.Id)
 	if err != nil {
 		logger.Entry().Errorf("rpc to delete track error: %v|%v", *req, err)
 		payload.Id = -1
@@ -62,7 +77,20 @@ func (s *TrackService) UpdateTrack(hr *http.Request, req *lm.UpdateTrackRpcReq,
 		lm.WrapRpcRsp(2, "", payload, rsp)
 		return
 	}
-	_, err = dblogic.TkDriver.UpdateOneTrack(req.Id, req.UpdateDoc)
+	td := dblogic.TkDriver.WithOp(bindOpInfo(hr, &req.OpInfo)).WithValidation(req.SkipRules)
+	_, err = td.UpdateOneTrack(req.Id, req.UpdateDoc, req.Precond)
+	if ve, ok := err.(*dblogic.ValidationError); ok {
+		payload.Id, payload.Changed, payload.Invalid = -1, false, ve.Fields
+		lm.WrapRpcRsp(2, err.Error(), payload, rsp)
+		return
+	}
+	if ce, ok := err.(*dblogic.ConflictError); ok {
+		logger.Entry().Warnf("rpc to update track conflict: %v", *req)
+		payload.Id, payload.Changed = req.Id, false
+		payload.Current, _ = ce.Current.(*models.Track)
+		lm.WrapRpcRsp(5, "", payload, rsp)
+		return
+	}
 	if err != nil {
 		logger.Entry().Errorf("rpc to update track error: %v|%v", *req, err)
 		payload.Id, payload.Changed = -1, false
@@ -76,11 +104,16 @@ func (s *TrackService) UpdateTrack(hr *http.Request, req *lm.UpdateTrackRpcReq,
 
 func (s *TrackService) SearchTrack(hr *http.Request, req *lm.SearchTrackRpcReq, rsp *lm.CommRpcRsp) (err error) {
 	defer common.TimeCostTrack(time.Now(), "TrackService rpc", "SearchTrack", err)
-	payload := &lm.SearchTrackRpcRsp{}
+	payload := &lm.SearchTrackRpcRsp{Data: &lm.SearchTrackRpcRsp_Data{}}
 	if err = lm.CheckParamsIsNil(req); err != nil {
 		lm.WrapRpcRsp(2, "", payload, rsp)
 		return
 	}
+	if _, err = dblogic.SelectColumns(&models.Track{}, req.Fields); err != nil {
+		lm.WrapRpcRsp(2, err.Error(), payload, rsp)
+		return
+	}
+	td := dblogic.TkDriver.WithFields(req.Fields).WithPrimary(req.ReadYourWrites)
 	var results []*models.Track
 	var total int64
 	conds := make(map[string]interface{})
@@ -99,7 +132,14 @@ func (s *TrackService) SearchTrack(hr *http.Request, req *lm.SearchTrackRpcReq,
 		}
 
 	}
-	results, total, err = dblogic.TkDriver.GetTracksByCondition(conds, req.Start, req.Count)
+	if req.CursorPage != nil {
+		if req.CursorPage.Size == 0 {
+			req.CursorPage.Size = req.Count
+		}
+		results, payload.Data.NextCursor, err = td.GetTracksByCursor(nil, conds, req.CursorPage)
+	} else {
+		results, total, err = td.GetTracksByCondition(conds, req.Start, req.Count, dblogic.CountExact)
+	}
 	if err != nil {
 		logger.Entry().Errorf("rpc to search track error: %v|%v", *req, err)
 		lm.WrapRpcRsp(-1, "search track record failed.", nil, rsp)
@@ -111,7 +151,11 @@ func (s *TrackService) SearchTrack(hr *http.Request, req *lm.SearchTrackRpcReq,
 		return
 	}
 	payload.Data.Total, payload.Data.Start, payload.Data.Count = total, req.Start, req.Count
-	payload.Data.List = results
+	if len(req.Fields) != 0 {
+		payload.Data.Rows = dblogic.TrimFields(results, req.Fields)
+	} else {
+		payload.Data.List = results
+	}
 	lm.WrapRpcRsp(1, "succeed.", payload.Data, rsp)
 	return
 }